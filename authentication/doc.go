@@ -3,6 +3,8 @@
 // It includes:
 //   - Token: A simple type representing a token and its expiration time.
 //   - TokenManager: A thread-safe component for retrieving and caching tokens from external sources.
+//   - TokenRequest: Parameters (audience, scopes, subject) for fetchers registered through
+//     RegisterFetcherFactory, allowing one registration to serve many audiences.
 //
 // Typical usage:
 //
@@ -32,5 +34,13 @@
 //	      log.Fatalf("failed to get token: %v", err)
 //	    }
 //	    fmt.Println("Acquired Token:", token)
+//
+//	    // Register a factory for parameterized tokens; tokens are cached per distinct request
+//	    tm.RegisterFetcherFactory("id-token", func(req authentication.TokenRequest) authentication.TokenFetcher {
+//	      return func() (string, time.Time, error) {
+//	        return "token-for-" + req.Audience, time.Now().Add(1 * time.Hour), nil
+//	      }
+//	    })
+//	    idToken, err := tm.GetTokenFor("id-token", authentication.TokenRequest{Audience: "https://my-service.example.com"})
 //	}
 package authentication
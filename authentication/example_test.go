@@ -62,3 +62,29 @@ func ExampleTokenManager_error() {
 	// Expected error for unknown-service: no fetcher registered for key: unknown-service
 	// Expected error for failing-service: failed to fetch token for key failing-service: intentional failure
 }
+
+// ExampleTokenManager_fetcherFactory demonstrates serving tokens for many audiences
+// from a single registration.
+func ExampleTokenManager_fetcherFactory() {
+	tm := NewTokenManager(cache.NewInMemoryCache())
+
+	// The factory receives the request and returns a fetcher bound to it.
+	tm.RegisterFetcherFactory("id-token", func(req TokenRequest) TokenFetcher {
+		return func() (string, time.Time, error) {
+			return "token-for-" + req.Audience, time.Now().Add(5 * time.Second), nil
+		}
+	})
+
+	for _, aud := range []string{"https://orders.example.com", "https://billing.example.com"} {
+		token, err := tm.GetTokenFor("id-token", TokenRequest{Audience: aud})
+		if err != nil {
+			fmt.Println("Error fetching token:", err)
+			return
+		}
+		fmt.Println(token)
+	}
+
+	// Output:
+	// token-for-https://orders.example.com
+	// token-for-https://billing.example.com
+}
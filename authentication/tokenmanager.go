@@ -11,6 +11,10 @@ import (
 // TokenFetcher is a function returning a new token and its expiry.
 type TokenFetcher func() (string, time.Time, error)
 
+// TokenFetcherFactory returns a TokenFetcher for a specific TokenRequest. It allows a
+// single registration to serve tokens for many audiences, scopes or subjects.
+type TokenFetcherFactory func(req TokenRequest) TokenFetcher
+
 // TokenManagerInterface defines the behavior for managing tokens.
 type TokenManagerInterface interface {
 	RegisterFetcher(key string, fetcher TokenFetcher)
@@ -18,6 +22,18 @@ type TokenManagerInterface interface {
 	GetToken(key string) (string, error)
 }
 
+// RequestTokenManager is a TokenManagerInterface that also serves tokens for
+// parameterized requests. It is a separate interface so that existing implementations
+// of TokenManagerInterface keep satisfying it.
+type RequestTokenManager interface {
+	TokenManagerInterface
+	RegisterFetcherFactory(name string, factory TokenFetcherFactory)
+	GetTokenFor(name string, req TokenRequest) (string, error)
+}
+
+// Compile-time check that TokenManager implements RequestTokenManager.
+var _ RequestTokenManager = (*TokenManager)(nil)
+
 // cachedToken is stored in the cache.
 type cachedToken struct {
 	token  string
@@ -29,13 +45,16 @@ type TokenManager struct {
 	mu       sync.Mutex
 	c        cache.Cache
 	fetchers map[string]TokenFetcher
+	// factories holds parameterized fetchers, keyed by registration name.
+	factories map[string]TokenFetcherFactory
 }
 
 // NewTokenManager returns a new TokenManager instance, storing tokens in the provided cache.
 func NewTokenManager(c cache.Cache) *TokenManager {
 	return &TokenManager{
-		c:        c,
-		fetchers: make(map[string]TokenFetcher),
+		c:         c,
+		fetchers:  make(map[string]TokenFetcher),
+		factories: make(map[string]TokenFetcherFactory),
 	}
 }
 
@@ -47,6 +66,15 @@ func (tm *TokenManager) RegisterFetcher(key string, fetcher TokenFetcher) {
 	tm.fetchers[key] = fetcher
 }
 
+// RegisterFetcherFactory associates a TokenFetcherFactory with a given name. When
+// GetTokenFor sees a missing or expired token for a request, it asks the factory for
+// a fetcher bound to that request and calls it to obtain a fresh token.
+func (tm *TokenManager) RegisterFetcherFactory(name string, factory TokenFetcherFactory) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.factories[name] = factory
+}
+
 // SetToken manually stores a token and its expiry in the cache, bypassing the fetcher.
 func (tm *TokenManager) SetToken(key, token string, expiry time.Time) {
 	tm.c.Set(key, &cachedToken{
@@ -58,11 +86,8 @@ func (tm *TokenManager) SetToken(key, token string, expiry time.Time) {
 // GetToken retrieves a token for the key. If the token is present and not expired,
 // it returns it. Otherwise, it fetches a new token from the registered TokenFetcher.
 func (tm *TokenManager) GetToken(key string) (string, error) {
-	val, ok := tm.c.Get(key)
-	if ok {
-		if ct, valid := val.(*cachedToken); valid && time.Now().Before(ct.expiry) {
-			return ct.token, nil
-		}
+	if token, ok := tm.lookupCached(key); ok {
+		return token, nil
 	}
 
 	tm.mu.Lock()
@@ -81,3 +106,67 @@ func (tm *TokenManager) GetToken(key string) (string, error) {
 	tm.SetToken(key, token, expiry)
 	return token, nil
 }
+
+// GetTokenFor retrieves a token for the request using the factory registered under
+// name. Tokens are cached per distinct request, as identified by RequestKey, so
+// requests that differ only in the order of their scopes share a cached token.
+func (tm *TokenManager) GetTokenFor(name string, req TokenRequest) (string, error) {
+	key := RequestKey(name, req)
+	label := requestLabel(name, req)
+	if token, ok := tm.lookupCached(key); ok {
+		return token, nil
+	}
+
+	tm.mu.Lock()
+	factory, hasFactory := tm.factories[name]
+	tm.mu.Unlock()
+
+	if !hasFactory {
+		return "", fmt.Errorf("no fetcher factory registered for name: %s", name)
+	}
+
+	fetcher := factory(req)
+	if fetcher == nil {
+		return "", fmt.Errorf("fetcher factory for name %s returned no fetcher for key %s", name, label)
+	}
+
+	token, expiry, err := fetcher()
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch token for key %s: %w", label, err)
+	}
+
+	tm.SetToken(key, token, expiry)
+	return token, nil
+}
+
+// requestKeyPrefix starts every RequestKey, so tokens cached by GetTokenFor never share
+// a cache key with tokens registered under plain keys.
+const requestKeyPrefix = "\x00req:"
+
+// RequestKey returns the cache key under which GetTokenFor stores the token for a
+// request served by the factory registered under name. It can be used with SetToken
+// to seed the cache for a specific request. Request keys start with a NUL byte, so
+// they do not collide with the keys used by RegisterFetcher and GetToken.
+func RequestKey(name string, req TokenRequest) string {
+	return requestKeyPrefix + requestLabel(name, req)
+}
+
+// requestLabel identifies a request in error messages.
+func requestLabel(name string, req TokenRequest) string {
+	if k := req.Key(); k != "" {
+		return name + "?" + k
+	}
+	return name
+}
+
+// lookupCached returns the cached token for key if it is present and not expired.
+func (tm *TokenManager) lookupCached(key string) (string, bool) {
+	val, ok := tm.c.Get(key)
+	if !ok {
+		return "", false
+	}
+	if ct, valid := val.(*cachedToken); valid && time.Now().Before(ct.expiry) {
+		return ct.token, true
+	}
+	return "", false
+}
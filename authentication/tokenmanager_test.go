@@ -63,3 +63,97 @@ func TestTokenManager(t *testing.T) {
 		assert.Equal(t, "failed to fetch token for key failing-service: fetch failed", err.Error())
 	})
 }
+
+func TestTokenManager_FetcherFactory(t *testing.T) {
+	tm := NewTokenManager(cache.NewInMemoryCache())
+
+	var calls []TokenRequest
+	tm.RegisterFetcherFactory("id-token", func(req TokenRequest) TokenFetcher {
+		return func() (string, time.Time, error) {
+			calls = append(calls, req)
+			return "token-for-" + req.Audience, time.Now().Add(time.Minute), nil
+		}
+	})
+
+	t.Run("it should fetch a token per distinct request", func(t *testing.T) {
+		tokenA, err := tm.GetTokenFor("id-token", TokenRequest{Audience: "https://a.example.com"})
+		require.NoError(t, err)
+		assert.Equal(t, "token-for-https://a.example.com", tokenA)
+
+		tokenB, err := tm.GetTokenFor("id-token", TokenRequest{Audience: "https://b.example.com"})
+		require.NoError(t, err)
+		assert.Equal(t, "token-for-https://b.example.com", tokenB)
+
+		assert.Len(t, calls, 2)
+	})
+
+	t.Run("it should return the cached token for an equivalent request", func(t *testing.T) {
+		calls = nil
+		first := TokenRequest{Audience: "aud", Scopes: []string{"read", "write"}}
+		second := TokenRequest{Audience: "aud", Scopes: []string{"write", "read", "read"}}
+
+		_, err := tm.GetTokenFor("id-token", first)
+		require.NoError(t, err)
+		_, err = tm.GetTokenFor("id-token", second)
+		require.NoError(t, err)
+
+		assert.Len(t, calls, 1)
+	})
+
+	t.Run("it should re-fetch when the token for a request is expired", func(t *testing.T) {
+		calls = nil
+		req := TokenRequest{Audience: "expiring"}
+		tm.SetToken(RequestKey("id-token", req), "stale", time.Now().Add(-time.Second))
+
+		token, err := tm.GetTokenFor("id-token", req)
+		require.NoError(t, err)
+		assert.Equal(t, "token-for-expiring", token)
+		assert.Len(t, calls, 1)
+	})
+
+	t.Run("it should keep request tokens apart from plain keys", func(t *testing.T) {
+		calls = nil
+		tm.RegisterFetcher("id-token", func() (string, time.Time, error) {
+			return "plain", time.Now().Add(time.Minute), nil
+		})
+		tm.SetToken("id-token?aud=shadowed", "plain-shadow", time.Now().Add(time.Minute))
+
+		plain, err := tm.GetToken("id-token")
+		require.NoError(t, err)
+		fromFactory, err := tm.GetTokenFor("id-token", TokenRequest{})
+		require.NoError(t, err)
+		shadowed, err := tm.GetTokenFor("id-token", TokenRequest{Audience: "shadowed"})
+		require.NoError(t, err)
+
+		assert.Equal(t, "plain", plain)
+		assert.Equal(t, "token-for-", fromFactory)
+		assert.Equal(t, "token-for-shadowed", shadowed)
+		assert.Len(t, calls, 2)
+	})
+
+	t.Run("it should return an error for an unregistered factory", func(t *testing.T) {
+		_, err := tm.GetTokenFor("unknown", TokenRequest{})
+		require.Error(t, err)
+		assert.Equal(t, "no fetcher factory registered for name: unknown", err.Error())
+	})
+
+	t.Run("it should return an error when the fetcher fails", func(t *testing.T) {
+		tm.RegisterFetcherFactory("failing", func(req TokenRequest) TokenFetcher {
+			return func() (string, time.Time, error) {
+				return "", time.Time{}, errors.New("fetch failed")
+			}
+		})
+
+		_, err := tm.GetTokenFor("failing", TokenRequest{Audience: "aud"})
+		require.Error(t, err)
+		assert.Equal(t, "failed to fetch token for key failing?aud=aud: fetch failed", err.Error())
+	})
+
+	t.Run("it should return an error when the factory returns no fetcher", func(t *testing.T) {
+		tm.RegisterFetcherFactory("nil-fetcher", func(req TokenRequest) TokenFetcher { return nil })
+
+		_, err := tm.GetTokenFor("nil-fetcher", TokenRequest{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "returned no fetcher")
+	})
+}
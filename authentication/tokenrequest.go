@@ -0,0 +1,46 @@
+package authentication
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// TokenRequest describes the token a parameterized fetcher should obtain, such as
+// the target audience of an ID token or the OAuth2 scopes of an access token.
+// The zero value is a valid request with no parameters.
+type TokenRequest struct {
+	Audience string
+	Scopes   []string
+	Subject  string
+}
+
+// Key returns a canonical string representation of the request, suitable for use
+// as a cache key. Scopes are de-duplicated and sorted, so requests that differ only
+// in the order of their scopes produce the same key. Empty fields are omitted.
+func (r TokenRequest) Key() string {
+	v := url.Values{}
+	if r.Audience != "" {
+		v.Set("aud", r.Audience)
+	}
+	if scopes := canonicalScopes(r.Scopes); len(scopes) > 0 {
+		v.Set("scope", strings.Join(scopes, " "))
+	}
+	if r.Subject != "" {
+		v.Set("sub", r.Subject)
+	}
+	// Encode sorts by parameter name, which keeps the key stable.
+	return v.Encode()
+}
+
+// canonicalScopes returns a sorted copy of scopes without empty or duplicate entries.
+func canonicalScopes(scopes []string) []string {
+	out := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	slices.Sort(out)
+	return slices.Compact(out)
+}
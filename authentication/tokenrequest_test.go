@@ -0,0 +1,49 @@
+package authentication
+
+import "testing"
+
+func TestTokenRequestKey(t *testing.T) {
+	cases := []struct {
+		name     string
+		req      TokenRequest
+		expected string
+	}{
+		{
+			name:     "Empty request has an empty key",
+			req:      TokenRequest{},
+			expected: "",
+		},
+		{
+			name:     "Audience only",
+			req:      TokenRequest{Audience: "https://svc.example.com"},
+			expected: "aud=https%3A%2F%2Fsvc.example.com",
+		},
+		{
+			name:     "Scopes are sorted and de-duplicated",
+			req:      TokenRequest{Scopes: []string{"write", "read", "write", " "}},
+			expected: "scope=read+write",
+		},
+		{
+			name:     "All fields",
+			req:      TokenRequest{Audience: "aud", Scopes: []string{"b", "a"}, Subject: "user@example.com"},
+			expected: "aud=aud&scope=a+b&sub=user%40example.com",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.req.Key(); got != c.expected {
+				t.Errorf("expected key %q, got %q", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestRequestKey(t *testing.T) {
+	if got := RequestKey("svc", TokenRequest{}); got != "\x00req:svc" {
+		t.Errorf("expected %q, got %q", "\x00req:svc", got)
+	}
+	if got := RequestKey("svc", TokenRequest{Audience: "aud"}); got != "\x00req:svc?aud=aud" {
+		t.Errorf("expected %q, got %q", "\x00req:svc?aud=aud", got)
+	}
+}
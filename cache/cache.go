@@ -26,3 +26,10 @@ type Cache interface {
 	// Flush removes all entries from the cache, leaving it empty.
 	Flush()
 }
+
+// Deleter is implemented by caches that can remove single entries. Callers that need
+// to free entries should check for it, since not every Cache provides it.
+type Deleter interface {
+	// Delete removes the entries for the given keys. Missing keys are ignored.
+	Delete(keys ...string)
+}
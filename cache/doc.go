@@ -9,6 +9,7 @@
 // Key Features:
 //   - Thread-safe operations for concurrent access in the provided InMemoryCache.
 //   - Basic Get, Set, SetAll, GetAll, and Flush operations.
+//   - Removal of single entries through the optional Deleter interface.
 //   - A flexible Cache interface allowing for different backend implementations.
 //
 // Typical Usage:
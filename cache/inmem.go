@@ -2,6 +2,12 @@ package cache
 
 import "sync"
 
+// Compile-time check that InMemoryCache implements Cache and Deleter.
+var (
+	_ Cache   = (*InMemoryCache)(nil)
+	_ Deleter = (*InMemoryCache)(nil)
+)
+
 // InMemoryCache provides an in-memory implementation of the Cache interface.
 // It stores data in a simple map protected by a mutex, ensuring safe concurrent
 // access. It does not support expiration, persistence, or advanced features.
@@ -66,6 +72,15 @@ func (c *InMemoryCache) GetAll() map[string]interface{} {
 	return copyMap
 }
 
+// Delete removes the entries for the given keys. Missing keys are ignored.
+func (c *InMemoryCache) Delete(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		delete(c.data, key)
+	}
+}
+
 // Flush removes all entries from the cache, leaving it empty.
 func (c *InMemoryCache) Flush() {
 	c.mu.Lock()
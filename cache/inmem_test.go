@@ -33,6 +33,15 @@ func TestInMemoryCache(t *testing.T) {
 		t.Errorf("GetAll returned unexpected data: %v", all)
 	}
 
+	// Test Delete
+	cache.Delete("a", "missing")
+	if _, ok := cache.Get("a"); ok {
+		t.Error("expected no value for 'a' after Delete")
+	}
+	if len(cache.GetAll()) != 2 {
+		t.Errorf("expected 2 items after Delete, got %d", len(cache.GetAll()))
+	}
+
 	// Test Flush
 	cache.Flush()
 	if _, ok := cache.Get("foo"); ok {
@@ -77,9 +77,11 @@ func (e *APIError) WithDetails(details ...ErrorDetail) *APIError {
 
 // Predefined common errors.
 var (
-	ErrBadRequest   = New(400, "bad request")
-	ErrUnauthorized = New(401, "unauthorized")
-	ErrForbidden    = New(403, "forbidden")
-	ErrNotFound     = New(404, "resource not found")
-	ErrServerError  = New(500, "internal server error")
+	ErrBadRequest         = New(400, "bad request")
+	ErrUnauthorized       = New(401, "unauthorized")
+	ErrForbidden          = New(403, "forbidden")
+	ErrNotFound           = New(404, "resource not found")
+	ErrConflict           = New(409, "conflict")
+	ErrPreconditionFailed = New(412, "precondition failed")
+	ErrServerError        = New(500, "internal server error")
 )
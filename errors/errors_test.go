@@ -8,6 +8,7 @@ package errors
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 )
 
@@ -89,3 +90,20 @@ func TestPredefinedErrors(t *testing.T) {
 		t.Errorf("ErrServerError not as expected: code=%d msg=%q", ErrServerError.Code, ErrServerError.Message)
 	}
 }
+
+func TestConflictErrors(t *testing.T) {
+	if ErrConflict.Code != 409 {
+		t.Errorf("ErrConflict code: expected 409, got %d", ErrConflict.Code)
+	}
+	if ErrPreconditionFailed.Code != 412 {
+		t.Errorf("ErrPreconditionFailed code: expected 412, got %d", ErrPreconditionFailed.Code)
+	}
+
+	wrapped := fmt.Errorf("write failed: %w", ErrPreconditionFailed)
+	if !errors.Is(wrapped, ErrPreconditionFailed) {
+		t.Error("wrapped error should match ErrPreconditionFailed")
+	}
+	if errors.Is(wrapped, ErrConflict) {
+		t.Error("wrapped error should not match ErrConflict")
+	}
+}
@@ -0,0 +1,203 @@
+package firestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	apierrors "github.com/duizendstra/dui-go/errors"
+)
+
+// Version identifies a stored revision of a key and is used as a precondition for
+// SetIfVersion. For FirestoreKV it is the document's update time in nanoseconds since
+// the Unix epoch. NoVersion means the key does not exist.
+type Version int64
+
+// NoVersion is the version of a key that does not exist.
+const NoVersion Version = 0
+
+// UpdateFunc computes a new value from the current one. old is empty if the key does
+// not exist. UpdateFunc may be called several times when the update is retried, so it
+// should not have side effects.
+type UpdateFunc func(old string) (string, error)
+
+// MaxUpdateAttempts is the number of times Update and CompareAndSwap try to commit
+// before giving up with ErrConflict.
+const MaxUpdateAttempts = 5
+
+var (
+	// ErrPreconditionFailed is returned by SetIfVersion when the key's version does not
+	// match. It is the errors package's ErrPreconditionFailed, so errors.Is works with either.
+	ErrPreconditionFailed = apierrors.ErrPreconditionFailed
+
+	// ErrConflict is returned by Update and CompareAndSwap when concurrent writers kept
+	// invalidating the transaction until MaxUpdateAttempts was reached.
+	ErrConflict = apierrors.ErrConflict
+)
+
+var (
+	// errValueMismatch aborts the update of CompareAndSwap and CompareAndSwapWith
+	// without retrying it.
+	errValueMismatch = errors.New("value does not match")
+	// errExists aborts the create transaction of SetIfVersion without retrying it.
+	errExists = errors.New("document exists")
+)
+
+// GetVersion retrieves the value for the given key together with its version. For a
+// missing or expired key it returns an empty string and NoVersion.
+func (f *FirestoreKV) GetVersion(ctx context.Context, key string) (string, Version, error) {
+	docRef, err := f.keys.ref(key)
+	if err != nil {
+		return "", NoVersion, err
+	}
+	docSnap, err := docRef.Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return "", NoVersion, nil
+		}
+		return "", NoVersion, fmt.Errorf("firestore get error (key=%s): %w", key, err)
+	}
+
+	value, live := liveValue(docSnap)
+	if !live {
+		return "", NoVersion, nil
+	}
+	return value, Version(docSnap.UpdateTime.UnixNano()), nil
+}
+
+// SetIfVersion writes the value only if the key is still at the given version, using
+// a last-update-time precondition. With NoVersion the key must not exist yet, or must
+// have expired. If the precondition does not hold, the returned error wraps
+// ErrPreconditionFailed. Like Set, it removes any expiry from the key.
+func (f *FirestoreKV) SetIfVersion(ctx context.Context, key, value string, version Version) error {
+	docRef, err := f.keys.ref(key)
+	if err != nil {
+		return err
+	}
+
+	if version == NoVersion {
+		// An expired document still exists until Firestore deletes it, so a create
+		// precondition is not enough; check liveness inside a transaction instead.
+		err = f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			docSnap, err := tx.Get(docRef)
+			switch {
+			case status.Code(err) == codes.NotFound:
+			case err != nil:
+				return err
+			default:
+				if _, live := liveValue(docSnap); live {
+					return errExists
+				}
+			}
+			return tx.Set(docRef, kvData(value, time.Time{}), firestore.MergeAll)
+		}, firestore.MaxAttempts(MaxUpdateAttempts))
+	} else {
+		_, err = docRef.Update(ctx,
+			[]firestore.Update{{Path: valueField, Value: value}, {Path: expireAtField, Value: firestore.Delete}},
+			firestore.LastUpdateTime(time.Unix(0, int64(version))))
+	}
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, errExists), status.Code(err) == codes.NotFound,
+		status.Code(err) == codes.FailedPrecondition, status.Code(err) == codes.Aborted:
+		return fmt.Errorf("firestore conditional set (key=%s, version=%d): %w", key, version, ErrPreconditionFailed)
+	default:
+		return fmt.Errorf("firestore conditional set error (key=%s): %w", key, err)
+	}
+}
+
+// CompareAndSwap sets the key to newValue only if its current value equals old, and
+// reports whether the swap happened. A missing key has the value "". The comparison and
+// the write run in a single Firestore transaction.
+func (f *FirestoreKV) CompareAndSwap(ctx context.Context, key, old, newValue string) (bool, error) {
+	err := f.Update(ctx, key, func(current string) (string, error) {
+		if current != old {
+			return "", errValueMismatch
+		}
+		return newValue, nil
+	})
+	if errors.Is(err, errValueMismatch) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Update atomically replaces the value of the key with the result of fn, running the
+// read and the write in a Firestore transaction. The transaction is retried up to
+// MaxUpdateAttempts times when it conflicts with concurrent writes. An error returned
+// by fn aborts the update and is returned as is.
+func (f *FirestoreKV) Update(ctx context.Context, key string, fn UpdateFunc) error {
+	docRef, err := f.keys.ref(key)
+	if err != nil {
+		return err
+	}
+
+	err = f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		old := ""
+		docSnap, err := tx.Get(docRef)
+		switch {
+		case status.Code(err) == codes.NotFound:
+			// A missing key behaves like an empty value.
+		case err != nil:
+			return err
+		default:
+			// An expired key also behaves like an empty value.
+			old, _ = liveValue(docSnap)
+		}
+
+		value, err := fn(old)
+		if err != nil {
+			return &updateFuncError{err: err}
+		}
+		return tx.Set(docRef, kvData(value, time.Time{}), firestore.MergeAll)
+	}, firestore.MaxAttempts(MaxUpdateAttempts))
+
+	var fnErr *updateFuncError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &fnErr):
+		return fnErr.err
+	case status.Code(err) == codes.Aborted:
+		return fmt.Errorf("firestore update (key=%s): %w: %w", key, ErrConflict, err)
+	default:
+		return fmt.Errorf("firestore update error (key=%s): %w", key, err)
+	}
+}
+
+// CompareAndSwapWith implements CompareAndSwap on top of an atomic update function: it
+// sets the key to newValue only if its current value equals old, and reports whether
+// the swap happened. It is intended for KV implementations that provide Update, such
+// as mocks and decorators.
+func CompareAndSwapWith(ctx context.Context, update func(context.Context, string, UpdateFunc) error, key, old, newValue string) (bool, error) {
+	err := update(ctx, key, func(current string) (string, error) {
+		if current != old {
+			return "", errValueMismatch
+		}
+		return newValue, nil
+	})
+	if errors.Is(err, errValueMismatch) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// updateFuncError marks an error returned by an UpdateFunc so it can be told apart
+// from Firestore errors after the transaction ends.
+type updateFuncError struct {
+	err error
+}
+
+func (e *updateFuncError) Error() string { return e.err.Error() }
+
+func (e *updateFuncError) Unwrap() error { return e.err }
@@ -1,14 +1,26 @@
 // Package firestore provides a simplified Key-Value (KV) interface over Google Cloud Firestore,
 // making basic Get/Set operations straightforward.
 //
-// It defines a KV interface representing simple key-value operations (Get, Set, Close).
+// It defines a KV interface representing simple key-value operations (Get, Set, Delete,
+// Exists, the batch variants GetMulti and SetMulti, key listing with List and Scan,
+// and Close).
 // The FirestoreKV type is a concrete implementation of this KV interface, using a
 // Firestore collection as the backend. If a key does not exist during a Get operation,
 // FirestoreKV returns an empty string without an error, adhering to a common pattern
 // for key-value stores where absence is not necessarily an error state.
 //
 // The Set operation writes or overwrites values, and Close releases underlying
-// Firestore client resources.
+// Firestore client resources. GetMulti fetches documents with batched GetAll calls and
+// SetMulti writes through a BulkWriter; bulk writes are not atomic.
+//
+// List returns keys one page at a time, ordered by document ID and optionally
+// filtered by prefix (see ListOptions). Page tokens are opaque. Scan wraps List in an
+// iter.Seq2 that follows page tokens automatically:
+//
+//	// for key, err := range kvStore.Scan(ctx, firestore.ListOptions{Prefix: "user:"}) {
+//	//     if err != nil { /* handle error */ }
+//	//     fmt.Println(key)
+//	// }
 //
 // Typical Usage:
 //
@@ -22,6 +34,65 @@
 //	// kvStore.Set(ctx, "myKey", "myValue")
 //	// value, _ := kvStore.Get(ctx, "myKey")
 //
+// Client Options and the Emulator:
+// NewKV and NewDocStore accept options to inject an existing *firestore.Client
+// (WithClient), select a named database (WithDatabaseID), or authenticate with explicit
+// credentials (WithCredentialsFile, WithCredentialsJSON) instead of Application Default
+// Credentials. When FIRESTORE_EMULATOR_HOST (EmulatorHostEnv) is set, the client
+// connects to the emulator, credentials are not used, and an empty project ID defaults
+// to a demo project. The testutil package can start the emulator for tests.
+//
+// Keys and Namespaces:
+// Keys are used as document IDs, so by default they must be valid IDs: non-empty UTF-8
+// of at most MaxKeyBytes bytes, without "/", not "." or "..", and not matching __.*__.
+// Other keys are rejected with an error wrapping ErrInvalidKey (see ValidateKey). With
+// the WithKeyEscaping option, keys may also contain "/" and "%" or start with "." or
+// "_": they are percent-encoded with EscapeKey before use and decoded again in List,
+// GetMulti and Watch results. Escaped keys must still be valid UTF-8 and fit in
+// MaxKeyBytes. Namespace returns a FirestoreKV that keeps its keys in a subcollection
+// of the collection, isolating them from other namespaces.
+//
+// Missing Keys:
+// Get returns an empty string for a missing key, which cannot be told apart from a key
+// set to "". Lookup additionally reports whether the key was found, and GetExisting
+// returns an error wrapping ErrNotFound (the errors package's ErrNotFound) instead.
+//
+// Expiry:
+// SetWithTTL stores a value with an "expireAt" timestamp field. Configure a Firestore
+// TTL policy on that field to have expired documents deleted; since that deletion
+// happens with a delay, Get, Exists, GetMulti, List and the conditional operations
+// treat expired documents as missing right away. Plain writes remove the expiry.
+//
+// Concurrency Control:
+// Set overwrites unconditionally. For safe concurrent updates use CompareAndSwap, or
+// Update, which runs a read-modify-write function inside a Firestore transaction and
+// retries on contention (failing with ErrConflict after MaxUpdateAttempts). GetVersion
+// and SetIfVersion expose the document update time as an opaque Version precondition;
+// a mismatch returns an error wrapping ErrPreconditionFailed. Both sentinels are the
+// errors package's ErrConflict and ErrPreconditionFailed.
+//
+// Change Streams:
+// Watch and WatchPrefix use Firestore snapshot listeners to deliver an Event for every
+// write or delete of the watched keys on a channel, starting with their current values,
+// until the context is done. Failed listeners are reported through Event.Err and
+// re-established with exponential backoff, without repeating events already delivered.
+//
+//	// events, err := kvStore.Watch(ctx, "config")
+//	// for ev := range events {
+//	//     if ev.Err == nil && ev.Type == firestore.EventSet { reload(ev.Value) }
+//	// }
+//
+// Typed Documents:
+// DocStore[T] stores Go values, typically structs with `firestore:"..."` tags, as native
+// Firestore documents instead of a single string field, so the data stays queryable.
+// It supports Get, Lookup (which also reports whether the document exists), Set
+// (optionally merging only selected field paths), Update of individual field paths,
+// and Delete. A DocStore[KVDocument] reads and writes the documents of a FirestoreKV
+// on the same collection, making the string key-value store a special case of the
+// typed document store. DocStore does not apply expiry, so it returns expired
+// documents until the TTL policy deletes them. FirestoreKV itself decodes documents
+// leniently, so a "value" field of another type reads as an empty value.
+//
 // Relationship with store.KV:
 // The `store` package in this library defines its own `store.KV` interface for broader
 // storage abstraction purposes. Due to Go's structural typing, `firestore.FirestoreKV`
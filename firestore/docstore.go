@@ -0,0 +1,156 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DeleteField can be used as a FieldUpdate value to remove the field from the document.
+var DeleteField = firestore.Delete
+
+// FieldUpdate describes a change to a single field of a document.
+type FieldUpdate struct {
+	// Path is a dot-separated field path, such as "address.city".
+	Path string
+	// Value is the new value of the field. Use DeleteField to remove the field.
+	Value interface{}
+}
+
+// KVDocument is the document layout used by FirestoreKV. A DocStore[KVDocument]
+// reads and writes the same documents as a FirestoreKV on the same collection, so the
+// string key-value store is a special case of DocStore.
+type KVDocument struct {
+	Value string `firestore:"value"`
+	// ExpireAt is set by SetWithTTL and is zero for keys that do not expire. Configure
+	// a Firestore TTL policy on this field to have expired documents deleted. A
+	// DocStore[KVDocument] does not hide expired documents, unlike FirestoreKV.
+	ExpireAt time.Time `firestore:"expireAt,omitempty"`
+}
+
+// DocStore stores values of type T as native Firestore documents in a collection,
+// one document per key. T is typically a struct whose fields are mapped with
+// `firestore:"..."` tags, which keeps the stored data queryable in Firestore, unlike
+// a JSON string stored through FirestoreKV.
+//
+// DocStore does not apply expiry: unlike FirestoreKV, it returns documents whose
+// expireAt has passed, including those written by SetWithTTL, until a Firestore TTL
+// policy deletes them. Compare KVDocument.ExpireAt with the current time to skip them.
+type DocStore[T any] struct {
+	client *firestore.Client
+	keys   keyspace
+}
+
+// NewDocStore creates a DocStore for the specified projectID and collection, accepting
+// the same options as NewKV. It returns an error if the Firestore client cannot be created.
+func NewDocStore[T any](ctx context.Context, projectID, collection string, opts ...Option) (*DocStore[T], error) {
+	o := applyOptions(opts)
+	client, err := newClient(ctx, projectID, o)
+	if err != nil {
+		return nil, err
+	}
+	return &DocStore[T]{client: client, keys: keyspace{coll: client.Collection(collection), escape: o.escapeKeys}}, nil
+}
+
+// Get retrieves the document for the given key and decodes it into a T. If the key
+// does not exist, it returns the zero value of T and no error; use Lookup to tell a
+// missing document from one holding the zero value.
+func (d *DocStore[T]) Get(ctx context.Context, key string) (T, error) {
+	doc, _, err := d.Lookup(ctx, key)
+	return doc, err
+}
+
+// Lookup retrieves the document for the given key like Get and reports whether it
+// exists. Expired documents that have not been deleted yet are reported as found.
+func (d *DocStore[T]) Lookup(ctx context.Context, key string) (T, bool, error) {
+	var doc T
+	docRef, err := d.keys.ref(key)
+	if err != nil {
+		return doc, false, err
+	}
+	docSnap, err := docRef.Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return doc, false, nil
+		}
+		return doc, false, fmt.Errorf("firestore get error (key=%s): %w", key, err)
+	}
+
+	if err := docSnap.DataTo(&doc); err != nil {
+		return doc, true, fmt.Errorf("firestore data decode error (key=%s): %w", key, err)
+	}
+	return doc, true, nil
+}
+
+// Set writes doc under the given key. Without mergeFields the whole document is
+// replaced. With mergeFields, given as dot-separated field paths, only those fields
+// are written and all other fields of an existing document are left untouched.
+func (d *DocStore[T]) Set(ctx context.Context, key string, doc T, mergeFields ...string) error {
+	docRef, err := d.keys.ref(key)
+	if err != nil {
+		return err
+	}
+	var opts []firestore.SetOption
+	if len(mergeFields) > 0 {
+		opts = append(opts, firestore.Merge(fieldPaths(mergeFields)...))
+	}
+
+	if _, err := docRef.Set(ctx, doc, opts...); err != nil {
+		return fmt.Errorf("firestore set error (key=%s): %w", key, err)
+	}
+	return nil
+}
+
+// Update changes individual fields of the existing document for the given key. It
+// returns an error if the document does not exist.
+func (d *DocStore[T]) Update(ctx context.Context, key string, updates ...FieldUpdate) error {
+	if len(updates) == 0 {
+		return fmt.Errorf("no field updates given (key=%s)", key)
+	}
+	docRef, err := d.keys.ref(key)
+	if err != nil {
+		return err
+	}
+
+	fsUpdates := make([]firestore.Update, 0, len(updates))
+	for _, u := range updates {
+		fsUpdates = append(fsUpdates, firestore.Update{Path: u.Path, Value: u.Value})
+	}
+
+	if _, err := docRef.Update(ctx, fsUpdates); err != nil {
+		return fmt.Errorf("firestore update error (key=%s): %w", key, err)
+	}
+	return nil
+}
+
+// Delete removes the document for the given key. Deleting a missing key is not an error.
+func (d *DocStore[T]) Delete(ctx context.Context, key string) error {
+	docRef, err := d.keys.ref(key)
+	if err != nil {
+		return err
+	}
+	if _, err := docRef.Delete(ctx); err != nil {
+		return fmt.Errorf("firestore delete error (key=%s): %w", key, err)
+	}
+	return nil
+}
+
+// Close releases Firestore resources. After calling Close, the DocStore should no
+// longer be used.
+func (d *DocStore[T]) Close() error {
+	return d.client.Close()
+}
+
+// fieldPaths converts dot-separated field paths into Firestore field paths.
+func fieldPaths(paths []string) []firestore.FieldPath {
+	fps := make([]firestore.FieldPath, 0, len(paths))
+	for _, p := range paths {
+		fps = append(fps, firestore.FieldPath(strings.Split(p, ".")))
+	}
+	return fps
+}
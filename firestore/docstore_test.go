@@ -0,0 +1,186 @@
+package firestore
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	pb "cloud.google.com/go/firestore/apiv1/firestorepb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestFieldPaths(t *testing.T) {
+	got := fieldPaths([]string{"value", "address.city"})
+	if len(got) != 2 {
+		t.Fatalf("expected 2 field paths, got %d", len(got))
+	}
+	if !slices.Equal(got[0], []string{"value"}) {
+		t.Errorf("expected [value], got %v", got[0])
+	}
+	if !slices.Equal(got[1], []string{"address", "city"}) {
+		t.Errorf("expected [address city], got %v", got[1])
+	}
+}
+
+type testAddress struct {
+	City   string `firestore:"city"`
+	Street string `firestore:"street"`
+}
+
+type testProfile struct {
+	Name    string      `firestore:"name"`
+	Visits  int         `firestore:"visits"`
+	Address testAddress `firestore:"address"`
+}
+
+func TestDocStore(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newFakeClient(t)
+	docs := &DocStore[testProfile]{client: client, keys: keyspace{coll: client.Collection("profiles")}}
+
+	t.Run("Get of a missing key returns the zero value", func(t *testing.T) {
+		got, err := docs.Get(ctx, "missing")
+		if err != nil || got != (testProfile{}) {
+			t.Errorf("Get = %+v, %v; want zero value", got, err)
+		}
+		if got, found, err := docs.Lookup(ctx, "missing"); err != nil || found || got != (testProfile{}) {
+			t.Errorf("Lookup = %+v, %v, %v; want zero value, not found", got, found, err)
+		}
+	})
+
+	t.Run("Lookup finds documents holding the zero value", func(t *testing.T) {
+		if err := docs.Set(ctx, "empty", testProfile{}); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+		if got, found, err := docs.Lookup(ctx, "empty"); err != nil || !found || got != (testProfile{}) {
+			t.Errorf("Lookup = %+v, %v, %v; want zero value, found", got, found, err)
+		}
+	})
+
+	alice := testProfile{Name: "Alice", Visits: 3, Address: testAddress{City: "Utrecht", Street: "Oudegracht"}}
+	t.Run("Set and Get", func(t *testing.T) {
+		if err := docs.Set(ctx, "alice", alice); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+		got, err := docs.Get(ctx, "alice")
+		if err != nil || got != alice {
+			t.Errorf("Get = %+v, %v; want %+v", got, err, alice)
+		}
+	})
+
+	t.Run("Set with merge fields only writes those fields", func(t *testing.T) {
+		update := testProfile{Name: "ignored", Visits: 4, Address: testAddress{City: "Amsterdam", Street: "ignored"}}
+		if err := docs.Set(ctx, "alice", update, "visits", "address.city"); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+		want := testProfile{Name: "Alice", Visits: 4, Address: testAddress{City: "Amsterdam", Street: "Oudegracht"}}
+		got, err := docs.Get(ctx, "alice")
+		if err != nil || got != want {
+			t.Errorf("Get = %+v, %v; want %+v", got, err, want)
+		}
+	})
+
+	t.Run("Update changes individual fields", func(t *testing.T) {
+		err := docs.Update(ctx, "alice",
+			FieldUpdate{Path: "address.street", Value: "Damrak"},
+			FieldUpdate{Path: "visits", Value: DeleteField})
+		if err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		want := testProfile{Name: "Alice", Address: testAddress{City: "Amsterdam", Street: "Damrak"}}
+		got, err := docs.Get(ctx, "alice")
+		if err != nil || got != want {
+			t.Errorf("Get = %+v, %v; want %+v", got, err, want)
+		}
+	})
+
+	t.Run("Update of a missing key fails", func(t *testing.T) {
+		if err := docs.Update(ctx, "missing", FieldUpdate{Path: "name", Value: "x"}); err == nil {
+			t.Error("expected an error")
+		}
+		if err := docs.Update(ctx, "alice"); err == nil {
+			t.Error("expected an error without field updates")
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if err := docs.Delete(ctx, "alice"); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		got, err := docs.Get(ctx, "alice")
+		if err != nil || got != (testProfile{}) {
+			t.Errorf("Get after Delete = %+v, %v; want zero value", got, err)
+		}
+		if err := docs.Delete(ctx, "alice"); err != nil {
+			t.Errorf("Delete of a missing key failed: %v", err)
+		}
+	})
+
+	t.Run("Invalid keys are rejected", func(t *testing.T) {
+		if _, err := docs.Get(ctx, "a/b"); err == nil {
+			t.Error("expected an error for an invalid key")
+		}
+	})
+
+	t.Run("Expired documents are returned", func(t *testing.T) {
+		kv := newFirestoreKV(client, keyspace{coll: client.Collection("kv")})
+		if err := kv.SetWithTTL(ctx, "session", "token", time.Hour); err != nil {
+			t.Fatalf("SetWithTTL failed: %v", err)
+		}
+		original := nowFunc
+		nowFunc = func() time.Time { return time.Now().Add(2 * time.Hour) }
+		t.Cleanup(func() { nowFunc = original })
+
+		if _, found, _ := kv.Lookup(ctx, "session"); found {
+			t.Error("expected FirestoreKV to hide the expired key")
+		}
+		got, found, err := kv.docs.Lookup(ctx, "session")
+		if err != nil || !found || got.Value != "token" || got.ExpireAt.IsZero() {
+			t.Errorf("Lookup = %+v, %v, %v; want the expired document", got, found, err)
+		}
+	})
+}
+
+func TestFirestoreKVToleratesForeignDocuments(t *testing.T) {
+	ctx := context.Background()
+	client, fake := newFakeClient(t)
+	kv := newFirestoreKV(client, keyspace{coll: client.Collection("kv")})
+	name := func(id string) string { return kv.keys.coll.Doc(id).Path }
+
+	fake.put(name("number"), map[string]*pb.Value{
+		"value": {ValueType: &pb.Value_IntegerValue{IntegerValue: 42}},
+	})
+	fake.put(name("odd-expiry"), map[string]*pb.Value{
+		"value":    {ValueType: &pb.Value_StringValue{StringValue: "v"}},
+		"expireAt": {ValueType: &pb.Value_StringValue{StringValue: "tomorrow"}},
+	})
+	fake.put(name("expired"), map[string]*pb.Value{
+		"value":    {ValueType: &pb.Value_StringValue{StringValue: "old"}},
+		"expireAt": {ValueType: &pb.Value_TimestampValue{TimestampValue: timestamppb.New(time.Now().Add(-time.Hour))}},
+	})
+
+	cases := []struct {
+		key   string
+		value string
+		found bool
+	}{
+		{key: "number", value: "", found: true},
+		{key: "odd-expiry", value: "v", found: true},
+		{key: "expired", value: "", found: false},
+	}
+	for _, c := range cases {
+		value, found, err := kv.Lookup(ctx, c.key)
+		if err != nil || value != c.value || found != c.found {
+			t.Errorf("Lookup(%q) = %q, %v, %v; want %q, %v", c.key, value, found, err, c.value, c.found)
+		}
+		if value, err := kv.Get(ctx, c.key); err != nil || value != c.value {
+			t.Errorf("Get(%q) = %q, %v; want %q", c.key, value, err, c.value)
+		}
+	}
+
+	values, err := kv.GetMulti(ctx, []string{"number", "odd-expiry", "expired"})
+	if err != nil || len(values) != 2 || values["odd-expiry"] != "v" {
+		t.Errorf("GetMulti = %v, %v; want the number and odd-expiry keys", values, err)
+	}
+}
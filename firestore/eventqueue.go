@@ -0,0 +1,81 @@
+package firestore
+
+import (
+	"context"
+	"sync"
+)
+
+// EventQueue buffers the events of a single watch, so that writers never block on a
+// slow consumer. It is intended for KV implementations that produce change streams from
+// memory, such as mocks: Push queues events, typically while the writer holds its lock,
+// and Run delivers them in order to the channel returned by Events.
+type EventQueue struct {
+	signal   chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	out      chan Event
+
+	mu      sync.Mutex
+	pending []Event
+}
+
+// NewEventQueue returns an empty EventQueue.
+func NewEventQueue() *EventQueue {
+	return &EventQueue{
+		signal: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		out:    make(chan Event),
+	}
+}
+
+// Events returns the channel Run delivers to. It is closed when Run returns.
+func (q *EventQueue) Events() <-chan Event {
+	return q.out
+}
+
+// Push appends the event to the queue without blocking.
+func (q *EventQueue) Push(ev Event) {
+	q.mu.Lock()
+	q.pending = append(q.pending, ev)
+	q.mu.Unlock()
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// Stop ends delivery, for example when the store is closed. Events still queued are
+// dropped.
+func (q *EventQueue) Stop() {
+	q.stopOnce.Do(func() { close(q.done) })
+}
+
+// Run delivers queued events in order until ctx is done or Stop is called, then closes
+// the Events channel.
+func (q *EventQueue) Run(ctx context.Context) {
+	defer close(q.out)
+	for {
+		q.mu.Lock()
+		batch := q.pending
+		q.pending = nil
+		q.mu.Unlock()
+
+		for _, ev := range batch {
+			select {
+			case q.out <- ev:
+			case <-ctx.Done():
+				return
+			case <-q.done:
+				return
+			}
+		}
+
+		select {
+		case <-q.signal:
+		case <-ctx.Done():
+			return
+		case <-q.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package firestore
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventQueue(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("Delivers in order without blocking writers", func(t *testing.T) {
+		q := NewEventQueue()
+		for _, key := range []string{"a", "b", "c"} {
+			q.Push(Event{Type: EventSet, Key: key})
+		}
+		runCtx, stop := context.WithCancel(ctx)
+		go q.Run(runCtx)
+		q.Push(Event{Type: EventDelete, Key: "a"})
+
+		var got []string
+		for range 4 {
+			ev := <-q.Events()
+			got = append(got, ev.Type.String()+":"+ev.Key)
+		}
+		if want := "set:a set:b set:c delete:a"; strings.Join(got, " ") != want {
+			t.Errorf("expected %q, got %q", want, strings.Join(got, " "))
+		}
+		stop()
+		if _, ok := <-q.Events(); ok {
+			t.Error("expected the channel to close when ctx is done")
+		}
+	})
+
+	t.Run("Stop closes the channel", func(t *testing.T) {
+		q := NewEventQueue()
+		go q.Run(ctx)
+		q.Push(Event{Type: EventSet, Key: "dropped"})
+		q.Stop()
+		q.Stop()
+		for range q.Events() {
+		}
+	})
+}
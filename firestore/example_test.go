@@ -1,10 +1,11 @@
-package firestore
+package firestore_test
 
 import (
 	"context"
 	"fmt"
 	"log"
 
+	"github.com/duizendstra/dui-go/firestore"
 	"github.com/duizendstra/dui-go/testutil"
 )
 
@@ -15,7 +16,7 @@ func ExampleFirestoreKV() {
 	ctx := context.Background()
 
 	// Use a mock KV for demonstration. In production, call NewKV(ctx, "your-project-id", "your-collection")
-	kv := testutil.NewMockFirestoreKV()
+	var kv firestore.KV = testutil.NewMockFirestoreKV()
 	defer kv.Close()
 
 	// Set a value
@@ -37,3 +38,35 @@ func ExampleFirestoreKV() {
 	}
 	fmt.Println("missingKey:", val)
 }
+
+// ExampleDocStore demonstrates storing structs as native Firestore documents. It
+// requires a real Firestore database, so it is compiled but not executed.
+func ExampleDocStore() {
+	type Profile struct {
+		Name  string `firestore:"name"`
+		Email string `firestore:"email"`
+		Plan  string `firestore:"plan,omitempty"`
+	}
+
+	ctx := context.Background()
+	profiles, err := firestore.NewDocStore[Profile](ctx, "your-project-id", "profiles")
+	if err != nil {
+		log.Fatalf("NewDocStore failed: %v", err)
+	}
+	defer profiles.Close()
+
+	if err := profiles.Set(ctx, "user-1", Profile{Name: "Ada", Email: "ada@example.com"}); err != nil {
+		log.Fatalf("Set failed: %v", err)
+	}
+
+	// Change a single field without rewriting the document.
+	if err := profiles.Update(ctx, "user-1", firestore.FieldUpdate{Path: "plan", Value: "pro"}); err != nil {
+		log.Fatalf("Update failed: %v", err)
+	}
+
+	p, err := profiles.Get(ctx, "user-1")
+	if err != nil {
+		log.Fatalf("Get failed: %v", err)
+	}
+	fmt.Println(p.Name, p.Plan)
+}
@@ -0,0 +1,435 @@
+package firestore
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	pb "cloud.google.com/go/firestore/apiv1/firestorepb"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fakeProjectID is the project of clients connected to a fakeFirestore.
+const fakeProjectID = "fake-project"
+
+// fakeFirestore is an in-memory implementation of the Firestore RPCs used to read,
+// write and watch documents: BatchGetDocuments, Commit and Listen. It lets tests run
+// the real Firestore client when the emulator is not available.
+type fakeFirestore struct {
+	pb.UnimplementedFirestoreServer
+
+	mu   sync.Mutex
+	docs map[string]*pb.Document
+	// clock is the time of the last commit. Every commit advances it, so update times
+	// are unique like in Firestore.
+	clock     time.Time
+	listeners map[*fakeListener]struct{}
+}
+
+// fakeListener is an open Listen stream with its target.
+type fakeListener struct {
+	id    int32
+	match func(name string) bool
+	// responses is buffered, so that commits can queue changes without blocking.
+	responses chan *pb.ListenResponse
+	fail      chan error
+}
+
+// newFakeClient starts a fakeFirestore and returns a Firestore client connected to it.
+func newFakeClient(t *testing.T) (*firestore.Client, *fakeFirestore) {
+	t.Helper()
+	fake := &fakeFirestore{
+		docs:      make(map[string]*pb.Document),
+		clock:     time.Now(),
+		listeners: make(map[*fakeListener]struct{}),
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterFirestoreServer(srv, fake)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///fake-firestore",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to connect to the fake Firestore: %v", err)
+	}
+	client, err := firestore.NewClient(context.Background(), fakeProjectID, option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatalf("failed to create Firestore client: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client, fake
+}
+
+// put stores a document with the given fields directly, bypassing the client, which
+// allows writing documents that the client would not produce.
+func (f *fakeFirestore) put(name string, fields map[string]*pb.Value) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := timestamppb.New(f.tick())
+	f.docs[name] = &pb.Document{Name: name, Fields: fields, CreateTime: now, UpdateTime: now}
+	f.notify([]string{name})
+}
+
+// breakListeners ends all open Listen streams with err.
+func (f *fakeFirestore) breakListeners(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for l := range f.listeners {
+		select {
+		case l.fail <- err:
+		default:
+		}
+	}
+}
+
+// tick advances the clock and returns the new time. f.mu must be held.
+func (f *fakeFirestore) tick() time.Time {
+	f.clock = f.clock.Add(time.Millisecond)
+	return f.clock
+}
+
+func (f *fakeFirestore) BatchGetDocuments(req *pb.BatchGetDocumentsRequest, stream pb.Firestore_BatchGetDocumentsServer) error {
+	f.mu.Lock()
+	readTime := timestamppb.New(f.clock)
+	var responses []*pb.BatchGetDocumentsResponse
+	for _, name := range req.Documents {
+		res := &pb.BatchGetDocumentsResponse{ReadTime: readTime}
+		if doc, ok := f.docs[name]; ok {
+			res.Result = &pb.BatchGetDocumentsResponse_Found{Found: proto.Clone(doc).(*pb.Document)}
+		} else {
+			res.Result = &pb.BatchGetDocumentsResponse_Missing{Missing: name}
+		}
+		responses = append(responses, res)
+	}
+	f.mu.Unlock()
+
+	for _, res := range responses {
+		if err := stream.Send(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeFirestore) Commit(_ context.Context, req *pb.CommitRequest) (*pb.CommitResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Writes are applied to a copy, so that a failed commit changes nothing.
+	docs := make(map[string]*pb.Document, len(f.docs))
+	for name, doc := range f.docs {
+		docs[name] = doc
+	}
+	commitTime := timestamppb.New(f.tick())
+	res := &pb.CommitResponse{CommitTime: commitTime}
+	var names []string
+	for _, w := range req.Writes {
+		if len(w.UpdateTransforms) > 0 || w.GetTransform() != nil {
+			return nil, status.Error(codes.Unimplemented, "field transforms are not supported")
+		}
+		name := w.GetDelete()
+		if w.GetUpdate() != nil {
+			name = w.GetUpdate().Name
+		}
+		if err := checkPrecondition(w.CurrentDocument, docs[name]); err != nil {
+			return nil, err
+		}
+
+		if w.GetUpdate() == nil {
+			delete(docs, name)
+		} else {
+			docs[name] = applyUpdate(docs[name], w.GetUpdate(), w.UpdateMask, commitTime)
+		}
+		res.WriteResults = append(res.WriteResults, &pb.WriteResult{UpdateTime: commitTime})
+		names = append(names, name)
+	}
+	f.docs = docs
+	f.notify(names)
+	return res, nil
+}
+
+func (f *fakeFirestore) Listen(stream pb.Firestore_ListenServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	target := req.GetAddTarget()
+	if target == nil {
+		return status.Error(codes.InvalidArgument, "expected a target to add")
+	}
+	match, err := targetMatcher(target)
+	if err != nil {
+		return err
+	}
+	l := &fakeListener{
+		id:        target.TargetId,
+		match:     match,
+		responses: make(chan *pb.ListenResponse, 1000),
+		fail:      make(chan error, 1),
+	}
+
+	// The initial state: the target is added, then all matching documents follow,
+	// and the target is marked current and consistent.
+	f.mu.Lock()
+	l.responses <- targetChange(pb.TargetChange_ADD, l.id)
+	names := make([]string, 0, len(f.docs))
+	for name := range f.docs {
+		if match(name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		l.responses <- &pb.ListenResponse{ResponseType: &pb.ListenResponse_DocumentChange{DocumentChange: &pb.DocumentChange{
+			Document:  proto.Clone(f.docs[name]).(*pb.Document),
+			TargetIds: []int32{l.id},
+		}}}
+	}
+	l.responses <- targetChange(pb.TargetChange_CURRENT, l.id)
+	l.responses <- f.consistent()
+	f.listeners[l] = struct{}{}
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		delete(f.listeners, l)
+		f.mu.Unlock()
+	}()
+	for {
+		select {
+		case res := <-l.responses:
+			if err := stream.Send(res); err != nil {
+				return err
+			}
+		case err := <-l.fail:
+			return err
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// notify sends the current state of the named documents to the listeners whose
+// target they match, or matched before. f.mu must be held.
+func (f *fakeFirestore) notify(names []string) {
+	for l := range f.listeners {
+		for _, name := range names {
+			if doc, ok := f.docs[name]; ok && l.match(name) {
+				l.responses <- &pb.ListenResponse{ResponseType: &pb.ListenResponse_DocumentChange{DocumentChange: &pb.DocumentChange{
+					Document:  proto.Clone(doc).(*pb.Document),
+					TargetIds: []int32{l.id},
+				}}}
+			} else {
+				// Removing a document that the listener does not know is a no-op.
+				l.responses <- &pb.ListenResponse{ResponseType: &pb.ListenResponse_DocumentDelete{DocumentDelete: &pb.DocumentDelete{
+					Document:         name,
+					RemovedTargetIds: []int32{l.id},
+				}}}
+			}
+		}
+		l.responses <- f.consistent()
+	}
+}
+
+// consistent returns the response that marks the listener state as consistent at the
+// current time. f.mu must be held.
+func (f *fakeFirestore) consistent() *pb.ListenResponse {
+	return &pb.ListenResponse{ResponseType: &pb.ListenResponse_TargetChange{TargetChange: &pb.TargetChange{
+		TargetChangeType: pb.TargetChange_NO_CHANGE,
+		ReadTime:         timestamppb.New(f.clock),
+		ResumeToken:      []byte(f.clock.Format(time.RFC3339Nano)),
+	}}}
+}
+
+// targetChange returns a target change response for the target.
+func targetChange(typ pb.TargetChange_TargetChangeType, id int32) *pb.ListenResponse {
+	return &pb.ListenResponse{ResponseType: &pb.ListenResponse_TargetChange{TargetChange: &pb.TargetChange{
+		TargetChangeType: typ,
+		TargetIds:        []int32{id},
+	}}}
+}
+
+// targetMatcher returns a function reporting whether a document name matches the
+// target. Only the queries built by this package are supported: a collection,
+// optionally filtered on the document ID or bounded by cursors on it.
+func targetMatcher(target *pb.Target) (func(string) bool, error) {
+	query := target.GetQuery()
+	sq := query.GetStructuredQuery()
+	if sq == nil || len(sq.From) != 1 {
+		return nil, status.Error(codes.Unimplemented, "only collection queries are supported")
+	}
+	collection := query.Parent + "/" + sq.From[0].CollectionId
+	inCollection := func(name string) bool {
+		id, ok := strings.CutPrefix(name, collection+"/")
+		return ok && !strings.Contains(id, "/")
+	}
+
+	var equal string
+	if f := sq.Where.GetFieldFilter(); f != nil {
+		if f.Field.GetFieldPath() != firestore.DocumentID || f.Op != pb.StructuredQuery_FieldFilter_EQUAL {
+			return nil, status.Error(codes.Unimplemented, "only document ID equality filters are supported")
+		}
+		equal = f.Value.GetReferenceValue()
+	} else if sq.Where != nil {
+		return nil, status.Error(codes.Unimplemented, "only field filters are supported")
+	}
+	start, end := sq.StartAt, sq.EndAt
+	for _, c := range []*pb.Cursor{start, end} {
+		if c != nil && len(c.Values) != 1 {
+			return nil, status.Error(codes.Unimplemented, "only cursors on the document ID are supported")
+		}
+	}
+
+	return func(name string) bool {
+		switch {
+		case !inCollection(name):
+			return false
+		case equal != "" && name != equal:
+			return false
+		}
+		if start != nil {
+			// A start cursor before the value includes it.
+			if c := strings.Compare(name, start.Values[0].GetReferenceValue()); c < 0 || (c == 0 && !start.Before) {
+				return false
+			}
+		}
+		if end != nil {
+			// An end cursor before the value excludes it.
+			if c := strings.Compare(name, end.Values[0].GetReferenceValue()); c > 0 || (c == 0 && end.Before) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// checkPrecondition returns the error Firestore reports when doc, which is nil for a
+// missing document, does not satisfy the precondition.
+func checkPrecondition(pc *pb.Precondition, doc *pb.Document) error {
+	switch c := pc.GetConditionType().(type) {
+	case *pb.Precondition_Exists:
+		if c.Exists && doc == nil {
+			return status.Error(codes.NotFound, "no document to update")
+		}
+		if !c.Exists && doc != nil {
+			return status.Error(codes.AlreadyExists, "document already exists")
+		}
+	case *pb.Precondition_UpdateTime:
+		if doc == nil || !doc.UpdateTime.AsTime().Equal(c.UpdateTime.AsTime()) {
+			return status.Error(codes.FailedPrecondition, "update time does not match")
+		}
+	}
+	return nil
+}
+
+// applyUpdate returns old, which may be nil, updated by the write. Without a mask the
+// document is replaced; with one, only the masked fields are set or, when absent
+// from the update, deleted.
+func applyUpdate(old, update *pb.Document, mask *pb.DocumentMask, now *timestamppb.Timestamp) *pb.Document {
+	doc := &pb.Document{Name: update.Name, Fields: make(map[string]*pb.Value), CreateTime: now, UpdateTime: now}
+	if old != nil {
+		doc.CreateTime = old.CreateTime
+	}
+	if mask == nil {
+		for k, v := range update.Fields {
+			doc.Fields[k] = proto.Clone(v).(*pb.Value)
+		}
+		return doc
+	}
+
+	if old != nil {
+		for k, v := range old.Fields {
+			doc.Fields[k] = proto.Clone(v).(*pb.Value)
+		}
+	}
+	for _, fp := range mask.FieldPaths {
+		path := splitFieldPath(fp)
+		if v, ok := fieldAt(update.Fields, path); ok {
+			setFieldAt(doc.Fields, path, proto.Clone(v).(*pb.Value))
+		} else {
+			deleteFieldAt(doc.Fields, path)
+		}
+	}
+	return doc
+}
+
+// splitFieldPath splits a service field path such as "a.`b.c`" into its segments.
+func splitFieldPath(fp string) []string {
+	var (
+		segs   []string
+		cur    strings.Builder
+		quoted bool
+	)
+	for i := 0; i < len(fp); i++ {
+		switch c := fp[i]; {
+		case c == '`':
+			quoted = !quoted
+		case c == '\\' && quoted && i+1 < len(fp):
+			i++
+			cur.WriteByte(fp[i])
+		case c == '.' && !quoted:
+			segs = append(segs, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	return append(segs, cur.String())
+}
+
+// fieldAt returns the value at the path of nested map fields.
+func fieldAt(fields map[string]*pb.Value, path []string) (*pb.Value, bool) {
+	v, ok := fields[path[0]]
+	if !ok || len(path) == 1 {
+		return v, ok
+	}
+	m := v.GetMapValue()
+	if m == nil {
+		return nil, false
+	}
+	return fieldAt(m.Fields, path[1:])
+}
+
+// setFieldAt sets the value at the path, creating or replacing intermediate maps.
+func setFieldAt(fields map[string]*pb.Value, path []string, v *pb.Value) {
+	if len(path) == 1 {
+		fields[path[0]] = v
+		return
+	}
+	m := fields[path[0]].GetMapValue()
+	if m == nil {
+		m = &pb.MapValue{Fields: make(map[string]*pb.Value)}
+		fields[path[0]] = &pb.Value{ValueType: &pb.Value_MapValue{MapValue: m}}
+	}
+	if m.Fields == nil {
+		m.Fields = make(map[string]*pb.Value)
+	}
+	setFieldAt(m.Fields, path[1:], v)
+}
+
+// deleteFieldAt removes the value at the path, if there is one.
+func deleteFieldAt(fields map[string]*pb.Value, path []string) {
+	if len(path) == 1 {
+		delete(fields, path[0])
+		return
+	}
+	if m := fields[path[0]].GetMapValue(); m != nil {
+		deleteFieldAt(m.Fields, path[1:])
+	}
+}
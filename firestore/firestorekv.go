@@ -2,7 +2,11 @@ package firestore
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"iter"
+	"strings"
+	"time"
 
 	"cloud.google.com/go/firestore"
 	"google.golang.org/grpc/codes"
@@ -16,60 +20,258 @@ type KV interface {
 	// it returns an empty string and no error.
 	Get(ctx context.Context, key string) (string, error)
 
+	// Lookup retrieves the value associated with a key and reports whether the key
+	// exists, so that a missing key can be told apart from an empty value.
+	Lookup(ctx context.Context, key string) (string, bool, error)
+
 	// Set stores the value under the given key.
 	Set(ctx context.Context, key, value string) error
 
+	// SetWithTTL stores the value under the given key; it is treated as missing once
+	// ttl has elapsed.
+	SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) error
+
+	// Delete removes the key. Deleting a key that does not exist is not an error.
+	Delete(ctx context.Context, key string) error
+
+	// Exists reports whether the key is present.
+	Exists(ctx context.Context, key string) (bool, error)
+
+	// GetMulti retrieves the values for several keys at once. The returned map only
+	// contains entries for keys that exist.
+	GetMulti(ctx context.Context, keys []string) (map[string]string, error)
+
+	// SetMulti stores several key-value pairs at once, overwriting existing values.
+	SetMulti(ctx context.Context, values map[string]string) error
+
+	// List returns one page of keys, ordered by key, that match the options.
+	List(ctx context.Context, opts ListOptions) (ListPage, error)
+
+	// Scan iterates over all keys matching the options, fetching pages as needed.
+	Scan(ctx context.Context, opts ListOptions) iter.Seq2[string, error]
+
+	// GetVersion retrieves the value together with its version (NoVersion if missing).
+	GetVersion(ctx context.Context, key string) (string, Version, error)
+
+	// SetIfVersion stores the value only if the key is still at the given version.
+	SetIfVersion(ctx context.Context, key, value string, version Version) error
+
+	// CompareAndSwap sets the key to newValue only if its current value equals old.
+	CompareAndSwap(ctx context.Context, key, old, newValue string) (bool, error)
+
+	// Update atomically replaces the value with the result of fn, retrying on conflicts.
+	Update(ctx context.Context, key string, fn UpdateFunc) error
+
+	// Watch reports changes to the key on the returned channel until ctx is done.
+	Watch(ctx context.Context, key string) (<-chan Event, error)
+
+	// WatchPrefix reports changes to all keys starting with prefix until ctx is done.
+	WatchPrefix(ctx context.Context, prefix string) (<-chan Event, error)
+
 	// Close releases any resources associated with this KV implementation.
 	Close() error
 }
 
+// Compile-time check that FirestoreKV implements KV.
+var _ KV = (*FirestoreKV)(nil)
+
+// valueField is the document field holding the stored value.
+const valueField = "value"
+
+// maxGetAllBatch bounds the number of documents requested in a single GetAll call.
+const maxGetAllBatch = 300
+
 // FirestoreKV provides a key-value abstraction using a Firestore collection.
-// Documents are stored with a "value" field. Missing documents return empty strings from Get.
+// Documents are stored with a "value" field (see KVDocument). Missing documents return
+// empty strings from Get.
 type FirestoreKV struct {
-	client     *firestore.Client
-	collection string
+	client *firestore.Client
+	keys   keyspace
+	// docs reads and writes the KVDocument layout on the same collection.
+	docs *DocStore[KVDocument]
 }
 
 // NewKV creates a FirestoreKV instance using the specified projectID and collection.
-// It returns an error if the Firestore client cannot be created.
-func NewKV(ctx context.Context, projectID, collection string) (*FirestoreKV, error) {
-	client, err := firestore.NewClient(ctx, projectID)
+// Options can inject an existing client, select a named database, provide
+// credentials or enable key escaping. If FIRESTORE_EMULATOR_HOST is set, it connects
+// to the emulator. It returns an error if the Firestore client cannot be created.
+func NewKV(ctx context.Context, projectID, collection string, opts ...Option) (*FirestoreKV, error) {
+	o := applyOptions(opts)
+	client, err := newClient(ctx, projectID, o)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Firestore client: %w", err)
+		return nil, err
+	}
+	return newFirestoreKV(client, keyspace{coll: client.Collection(collection), escape: o.escapeKeys}), nil
+}
+
+// newFirestoreKV wraps an existing Firestore client.
+func newFirestoreKV(client *firestore.Client, keys keyspace) *FirestoreKV {
+	return &FirestoreKV{
+		client: client,
+		keys:   keys,
+		docs:   &DocStore[KVDocument]{client: client, keys: keys},
 	}
-	return &FirestoreKV{client: client, collection: collection}, nil
 }
 
-// Get retrieves the value for the given key from Firestore. If the key does not exist,
-// it returns an empty string and no error.
+// Get retrieves the value for the given key from Firestore. If the key does not exist
+// or has expired, it returns an empty string and no error.
 func (f *FirestoreKV) Get(ctx context.Context, key string) (string, error) {
-	docRef := f.client.Collection(f.collection).Doc(key)
+	value, _, err := f.Lookup(ctx, key)
+	return value, err
+}
+
+// Set writes a value at the given key in Firestore. Overwrites existing values and
+// removes any expiry set by SetWithTTL.
+func (f *FirestoreKV) Set(ctx context.Context, key, value string) error {
+	docRef, err := f.keys.ref(key)
+	if err != nil {
+		return err
+	}
+	// Merging leaves fields other than value and expireAt untouched.
+	if _, err := docRef.Set(ctx, kvData(value, time.Time{}), firestore.MergeAll); err != nil {
+		return fmt.Errorf("firestore set error (key=%s): %w", key, err)
+	}
+	return nil
+}
+
+// Delete removes the document for the given key. Deleting a missing key is not an error.
+func (f *FirestoreKV) Delete(ctx context.Context, key string) error {
+	return f.docs.Delete(ctx, key)
+}
+
+// Exists reports whether a non-expired document exists for the given key.
+func (f *FirestoreKV) Exists(ctx context.Context, key string) (bool, error) {
+	docRef, err := f.keys.ref(key)
+	if err != nil {
+		return false, err
+	}
 	docSnap, err := docRef.Get(ctx)
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
-			// Key does not exist, return empty string and no error.
-			return "", nil
+			return false, nil
+		}
+		return false, fmt.Errorf("firestore exists error (key=%s): %w", key, err)
+	}
+	_, live := liveValue(docSnap)
+	return live, nil
+}
+
+// GetMulti retrieves the values for the given keys using batched GetAll calls.
+// Keys that do not exist or have expired are omitted from the returned map.
+func (f *FirestoreKV) GetMulti(ctx context.Context, keys []string) (map[string]string, error) {
+	result := make(map[string]string, len(keys))
+
+	for start := 0; start < len(keys); start += maxGetAllBatch {
+		end := min(start+maxGetAllBatch, len(keys))
+		refs := make([]*firestore.DocumentRef, 0, end-start)
+		for _, key := range keys[start:end] {
+			ref, err := f.keys.ref(key)
+			if err != nil {
+				return nil, err
+			}
+			refs = append(refs, ref)
+		}
+
+		snaps, err := f.client.GetAll(ctx, refs)
+		if err != nil {
+			return nil, fmt.Errorf("firestore get multi error (%d keys): %w", len(refs), err)
+		}
+		for _, snap := range snaps {
+			key := f.keys.key(snap.Ref.ID)
+			if value, live := liveValue(snap); live {
+				result[key] = value
+			}
+		}
+	}
+	return result, nil
+}
+
+// SetMulti writes the given key-value pairs using a BulkWriter, overwriting existing
+// values and removing any expiry. Writes are not atomic: if some fail, the others may
+// still be applied, and the returned error joins the individual failures.
+func (f *FirestoreKV) SetMulti(ctx context.Context, values map[string]string) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	refs := make(map[string]*firestore.DocumentRef, len(values))
+	for key := range values {
+		ref, err := f.keys.ref(key)
+		if err != nil {
+			return err
 		}
-		return "", fmt.Errorf("firestore get error (key=%s): %w", key, err)
+		refs[key] = ref
 	}
+	bw := f.client.BulkWriter(ctx)
 
-	var data map[string]interface{}
-	if err := docSnap.DataTo(&data); err != nil {
-		return "", fmt.Errorf("firestore data decode error (key=%s): %w", key, err)
+	jobs := make(map[string]*firestore.BulkWriterJob, len(values))
+	var errs []error
+	for key, value := range values {
+		job, err := bw.Set(refs[key], kvData(value, time.Time{}), firestore.MergeAll)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("firestore set multi error (key=%s): %w", key, err))
+			continue
+		}
+		jobs[key] = job
 	}
+	bw.End()
 
-	value, _ := data["value"].(string)
-	return value, nil
+	for key, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			errs = append(errs, fmt.Errorf("firestore set multi error (key=%s): %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
-// Set writes a value at the given key in Firestore. Overwrites existing values.
-func (f *FirestoreKV) Set(ctx context.Context, key, value string) error {
-	docRef := f.client.Collection(f.collection).Doc(key)
-	_, err := docRef.Set(ctx, map[string]interface{}{"value": value}, firestore.MergeAll)
+// List returns one page of keys from the collection, ordered by document ID. Only the
+// expiry of each document is read, so that expired keys can be skipped; values are
+// not transferred. Because expired keys are skipped, a page may hold fewer than
+// PageSize keys even when more pages follow.
+func (f *FirestoreKV) List(ctx context.Context, opts ListOptions) (ListPage, error) {
+	pageSize, after, err := opts.normalize()
 	if err != nil {
-		return fmt.Errorf("firestore set error (key=%s): %w", key, err)
+		return ListPage{}, err
 	}
-	return nil
+
+	// Page tokens hold keys, but the query runs on document IDs.
+	prefix := f.keys.idPrefix(opts.Prefix)
+	q := f.keys.coll.OrderBy(firestore.DocumentID, firestore.Asc).Select(expireAtField)
+	switch {
+	case after != "":
+		q = q.StartAfter(f.keys.idPrefix(after))
+	case prefix != "":
+		q = q.StartAt(prefix)
+	}
+
+	// Fetch one extra document to learn whether another page follows.
+	docs, err := q.Limit(pageSize + 1).Documents(ctx).GetAll()
+	if err != nil {
+		return ListPage{}, fmt.Errorf("firestore list error (prefix=%s): %w", opts.Prefix, err)
+	}
+
+	now := nowFunc()
+	page := ListPage{Keys: make([]string, 0, len(docs))}
+	for i, doc := range docs {
+		// Documents are ordered by ID, so the first key outside the prefix ends the scan.
+		if !strings.HasPrefix(doc.Ref.ID, prefix) {
+			break
+		}
+		if i == pageSize {
+			page.NextPageToken = encodePageToken(f.keys.key(docs[i-1].Ref.ID))
+			break
+		}
+		if !decodeKV(doc).expired(now) {
+			page.Keys = append(page.Keys, f.keys.key(doc.Ref.ID))
+		}
+	}
+	return page, nil
+}
+
+// Scan iterates over all keys matching the options in ascending order, calling List
+// for each page. Iteration stops at the first error, which is yielded with an empty key.
+func (f *FirestoreKV) Scan(ctx context.Context, opts ListOptions) iter.Seq2[string, error] {
+	return ScanPages(ctx, f.List, opts)
 }
 
 // Close releases Firestore resources. After calling Close, the FirestoreKV should no longer
@@ -77,3 +279,28 @@ func (f *FirestoreKV) Set(ctx context.Context, key, value string) error {
 func (f *FirestoreKV) Close() error {
 	return f.client.Close()
 }
+
+// liveValue returns the stored value from a document snapshot and reports whether the
+// document exists and has not expired. Firestore TTL deletion lags behind expiry, so
+// expired documents are hidden here.
+func liveValue(snap *firestore.DocumentSnapshot) (string, bool) {
+	if !snap.Exists() {
+		return "", false
+	}
+	doc := decodeKV(snap)
+	if doc.expired(nowFunc()) {
+		return "", false
+	}
+	return doc.Value, true
+}
+
+// decodeKV reads the value and expiry of a document. Unlike DataTo, it tolerates
+// fields of other types, which documents written by other tools may have: a value
+// that is not a string reads as "", and an expireAt that is not a timestamp is
+// ignored.
+func decodeKV(snap *firestore.DocumentSnapshot) KVDocument {
+	data := snap.Data()
+	value, _ := data[valueField].(string)
+	expireAt, _ := data[expireAtField].(time.Time)
+	return KVDocument{Value: value, ExpireAt: expireAt}
+}
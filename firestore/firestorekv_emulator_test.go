@@ -0,0 +1,146 @@
+package firestore_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/duizendstra/dui-go/firestore"
+	"github.com/duizendstra/dui-go/testutil"
+)
+
+// TestFirestoreKVConformance runs the shared KV suite against a real FirestoreKV. It
+// needs the Firestore emulator: set FIRESTORE_EMULATOR_HOST or install gcloud,
+// otherwise the test is skipped.
+func TestFirestoreKVConformance(t *testing.T) {
+	testutil.RunKVConformance(t, func(t *testing.T) firestore.KV {
+		return testutil.NewEmulatorKV(t)
+	})
+}
+
+// TestFirestoreKVEscapingConformance runs the shared KV suite with key escaping and
+// checks that keys Firestore would reject are stored and listed unchanged.
+func TestFirestoreKVEscapingConformance(t *testing.T) {
+	testutil.RunKVConformance(t, func(t *testing.T) firestore.KV {
+		return testutil.NewEmulatorKV(t, firestore.WithKeyEscaping())
+	})
+
+	kv := testutil.NewEmulatorKV(t, firestore.WithKeyEscaping())
+	ctx := context.Background()
+	keys := []string{"a/b", "a/c%d", "__reserved__", ".", "..", "_x"}
+	for _, key := range keys {
+		if err := kv.Set(ctx, key, "v-"+key); err != nil {
+			t.Fatalf("Set(%q) failed: %v", key, err)
+		}
+		if got, err := kv.Get(ctx, key); err != nil || got != "v-"+key {
+			t.Errorf("Get(%q) = %q, %v; want %q", key, got, err, "v-"+key)
+		}
+	}
+	page, err := kv.List(ctx, firestore.ListOptions{Prefix: "a/"})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if want := []string{"a/b", "a/c%d"}; !slices.Equal(page.Keys, want) {
+		t.Errorf("List keys = %q; want %q", page.Keys, want)
+	}
+}
+
+// TestFirestoreKVNamespaceConformance runs the shared KV suite on a namespace and
+// checks that namespaces do not see each other's keys.
+func TestFirestoreKVNamespaceConformance(t *testing.T) {
+	testutil.RunKVConformance(t, func(t *testing.T) firestore.KV {
+		ns, err := testutil.NewEmulatorKV(t).Namespace("tenant")
+		if err != nil {
+			t.Fatalf("Namespace failed: %v", err)
+		}
+		return ns
+	})
+
+	kv := testutil.NewEmulatorKV(t)
+	ctx := context.Background()
+	a, err := kv.Namespace("a")
+	if err != nil {
+		t.Fatalf("Namespace failed: %v", err)
+	}
+	b, err := kv.Namespace("b")
+	if err != nil {
+		t.Fatalf("Namespace failed: %v", err)
+	}
+	if err := a.Set(ctx, "key", "a"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	for name, other := range map[string]firestore.KV{"root": kv, "b": b} {
+		if found, err := other.Exists(ctx, "key"); err != nil || found {
+			t.Errorf("%s: Exists = %v, %v; want false", name, found, err)
+		}
+	}
+}
+
+type emulatorProfile struct {
+	Name   string `firestore:"name"`
+	Visits int    `firestore:"visits"`
+	City   string `firestore:"city"`
+}
+
+// TestDocStoreEmulator checks DocStore against the Firestore emulator, including
+// documents shared with a FirestoreKV on the same collection.
+func TestDocStoreEmulator(t *testing.T) {
+	testutil.FirestoreEmulator(t)
+	ctx := context.Background()
+	collection := fmt.Sprintf("docstore-%d", time.Now().UnixNano())
+	docs, err := firestore.NewDocStore[emulatorProfile](ctx, "", collection)
+	if err != nil {
+		t.Fatalf("NewDocStore failed: %v", err)
+	}
+	t.Cleanup(func() { _ = docs.Close() })
+
+	if got, err := docs.Get(ctx, "missing"); err != nil || got != (emulatorProfile{}) {
+		t.Errorf("Get(missing) = %+v, %v; want zero value", got, err)
+	}
+	if _, found, err := docs.Lookup(ctx, "missing"); err != nil || found {
+		t.Errorf("Lookup(missing) = %v, %v; want not found", found, err)
+	}
+	if err := docs.Set(ctx, "alice", emulatorProfile{Name: "Alice", Visits: 1, City: "Utrecht"}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := docs.Set(ctx, "alice", emulatorProfile{Name: "ignored", Visits: 2}, "visits"); err != nil {
+		t.Fatalf("Set with merge failed: %v", err)
+	}
+	if err := docs.Update(ctx, "alice", firestore.FieldUpdate{Path: "city", Value: "Amsterdam"}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	want := emulatorProfile{Name: "Alice", Visits: 2, City: "Amsterdam"}
+	if got, found, err := docs.Lookup(ctx, "alice"); err != nil || !found || got != want {
+		t.Errorf("Lookup = %+v, %v, %v; want %+v", got, found, err, want)
+	}
+	if err := docs.Update(ctx, "missing", firestore.FieldUpdate{Path: "city", Value: "x"}); err == nil {
+		t.Error("expected Update of a missing key to fail")
+	}
+	if err := docs.Delete(ctx, "alice"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if got, err := docs.Get(ctx, "alice"); err != nil || got != (emulatorProfile{}) {
+		t.Errorf("Get after Delete = %+v, %v; want zero value", got, err)
+	}
+
+	// A FirestoreKV on the same collection reads a document with a non-string value as
+	// an empty value instead of failing.
+	kv, err := firestore.NewKV(ctx, "", collection)
+	if err != nil {
+		t.Fatalf("NewKV failed: %v", err)
+	}
+	t.Cleanup(func() { _ = kv.Close() })
+	numbers, err := firestore.NewDocStore[map[string]any](ctx, "", collection)
+	if err != nil {
+		t.Fatalf("NewDocStore failed: %v", err)
+	}
+	t.Cleanup(func() { _ = numbers.Close() })
+	if err := numbers.Set(ctx, "number", map[string]any{"value": 42, "expireAt": "never"}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if value, found, err := kv.Lookup(ctx, "number"); err != nil || !found || value != "" {
+		t.Errorf("Lookup = %q, %v, %v; want an empty value that is found", value, found, err)
+	}
+}
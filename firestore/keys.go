@@ -0,0 +1,155 @@
+package firestore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"cloud.google.com/go/firestore"
+
+	apierrors "github.com/duizendstra/dui-go/errors"
+)
+
+// MaxKeyBytes is the maximum length of a document ID, and so of a stored key, in bytes.
+const MaxKeyBytes = 1500
+
+// ErrInvalidKey is wrapped by errors for keys that cannot be used as Firestore document
+// IDs. It is a 400 APIError, so it maps directly to a bad request response.
+var ErrInvalidKey = apierrors.New(400, "invalid key")
+
+// ValidateKey reports whether key can be used as a Firestore document ID as is. Keys
+// must be non-empty valid UTF-8 of at most MaxKeyBytes bytes, must not contain "/", must
+// not be "." or "..", and must not match the reserved pattern __.*__. The returned error
+// wraps ErrInvalidKey. WithKeyEscaping lifts the restrictions on "/", "." and "_", but
+// escaped keys must still be valid UTF-8 and at most MaxKeyBytes long after escaping.
+func ValidateKey(key string) error {
+	switch {
+	case key == "":
+		return fmt.Errorf("%w: key cannot be empty", ErrInvalidKey)
+	case !utf8.ValidString(key):
+		return fmt.Errorf("%w: key %q is not valid UTF-8", ErrInvalidKey, key)
+	case len(key) > MaxKeyBytes:
+		return fmt.Errorf("%w: key is %d bytes long, the maximum is %d", ErrInvalidKey, len(key), MaxKeyBytes)
+	case strings.Contains(key, "/"):
+		return fmt.Errorf("%w: key %q contains \"/\"", ErrInvalidKey, key)
+	case key == "." || key == "..":
+		return fmt.Errorf("%w: key %q is reserved", ErrInvalidKey, key)
+	case len(key) >= 4 && strings.HasPrefix(key, "__") && strings.HasSuffix(key, "__"):
+		return fmt.Errorf("%w: key %q matches the reserved pattern __.*__", ErrInvalidKey, key)
+	}
+	return nil
+}
+
+// EscapeKey percent-encodes "%", "/" and a leading "." or "_", so that a non-empty
+// valid UTF-8 key becomes a valid document ID as long as the result fits in
+// MaxKeyBytes. Other bytes are kept as they are, so invalid UTF-8 stays invalid. The
+// mapping is reversible with UnescapeKey, and escaping a prefix of a key yields a
+// prefix of the escaped key, so prefix listings keep working. Keys that need no
+// escaping are unchanged.
+func EscapeKey(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c == '%' || c == '/' || (i == 0 && (c == '.' || c == '_')) {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// UnescapeKey reverses EscapeKey.
+func UnescapeKey(id string) (string, error) {
+	if !strings.Contains(id, "%") {
+		return id, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(id); i++ {
+		if id[i] != '%' {
+			b.WriteByte(id[i])
+			continue
+		}
+		if i+2 >= len(id) {
+			return "", fmt.Errorf("%w: truncated escape in %q", ErrInvalidKey, id)
+		}
+		c, err := strconv.ParseUint(id[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("%w: bad escape in %q", ErrInvalidKey, id)
+		}
+		b.WriteByte(byte(c))
+		i += 2
+	}
+	return b.String(), nil
+}
+
+// keyspace maps keys to documents of a collection, escaping them if configured.
+type keyspace struct {
+	coll   *firestore.CollectionRef
+	escape bool
+}
+
+// id returns the document ID for the key, or an error wrapping ErrInvalidKey.
+func (k keyspace) id(key string) (string, error) {
+	id := key
+	if k.escape {
+		id = EscapeKey(key)
+	}
+	if err := ValidateKey(id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// ref returns the document reference for the key.
+func (k keyspace) ref(key string) (*firestore.DocumentRef, error) {
+	id, err := k.id(key)
+	if err != nil {
+		return nil, err
+	}
+	return k.coll.Doc(id), nil
+}
+
+// key returns the key stored under a document ID. IDs that were not written through an
+// escaping keyspace are returned as is.
+func (k keyspace) key(id string) string {
+	if !k.escape {
+		return id
+	}
+	if key, err := UnescapeKey(id); err == nil {
+		return key
+	}
+	return id
+}
+
+// idPrefix returns the document ID prefix shared by all keys starting with prefix.
+func (k keyspace) idPrefix(prefix string) string {
+	if k.escape {
+		return EscapeKey(prefix)
+	}
+	return prefix
+}
+
+// idPrefixEnd returns the smallest document ID that sorts after all IDs starting with
+// prefix, or "" if there is none. Firestore orders IDs by their UTF-8 bytes, which is
+// the order of their code points, so the last code point that can be incremented is
+// incremented and the rest dropped. Surrogates are skipped, and "/", which IDs cannot
+// contain, is skipped as well so the result stays a valid ID.
+func idPrefixEnd(prefix string) string {
+	runes := []rune(prefix)
+	for i := len(runes) - 1; i >= 0; i-- {
+		r := runes[i] + 1
+		switch {
+		case runes[i] == utf8.MaxRune:
+			continue
+		case r == 0xD800:
+			r = 0xE000
+		case r == '/':
+			r = '0'
+		}
+		runes[i] = r
+		return string(runes[:i+1])
+	}
+	return ""
+}
@@ -0,0 +1,177 @@
+package firestore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateKey(t *testing.T) {
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{"user:42", true},
+		{"with space", true},
+		{"ünïcödé", true},
+		{"_single", true},
+		{"__", true},
+		{"___", true},
+		{strings.Repeat("k", MaxKeyBytes), true},
+		{"", false},
+		{"a/b", false},
+		{"/", false},
+		{".", false},
+		{"..", false},
+		{"__reserved__", false},
+		{"____", false},
+		{"\xff", false},
+		{strings.Repeat("k", MaxKeyBytes+1), false},
+	}
+	for _, tt := range tests {
+		err := ValidateKey(tt.key)
+		if tt.valid && err != nil {
+			t.Errorf("ValidateKey(%q) = %v; want nil", tt.key, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("ValidateKey(%q) = %v; want ErrInvalidKey", tt.key, err)
+		}
+	}
+}
+
+func TestEscapeKey(t *testing.T) {
+	tests := []struct {
+		key, id string
+	}{
+		{"plain", "plain"},
+		{"a/b", "a%2Fb"},
+		{"100%", "100%25"},
+		{".", "%2E"},
+		{"..", "%2E."},
+		{"__reserved__", "%5F_reserved__"},
+		{"mid_dle.dot", "mid_dle.dot"},
+	}
+	for _, tt := range tests {
+		id := EscapeKey(tt.key)
+		if id != tt.id {
+			t.Errorf("EscapeKey(%q) = %q; want %q", tt.key, id, tt.id)
+		}
+		if err := ValidateKey(id); err != nil {
+			t.Errorf("EscapeKey(%q) = %q is not a valid ID: %v", tt.key, id, err)
+		}
+		key, err := UnescapeKey(id)
+		if err != nil || key != tt.key {
+			t.Errorf("UnescapeKey(%q) = %q, %v; want %q", id, key, err, tt.key)
+		}
+	}
+
+	t.Run("Prefixes stay prefixes", func(t *testing.T) {
+		for _, key := range []string{"a/b/c", "%%", "._x", "__x__"} {
+			for i := range len(key) {
+				if !strings.HasPrefix(EscapeKey(key), EscapeKey(key[:i])) {
+					t.Errorf("EscapeKey(%q) does not start with EscapeKey(%q)", key, key[:i])
+				}
+			}
+		}
+	})
+
+	t.Run("Malformed escapes", func(t *testing.T) {
+		for _, id := range []string{"%", "%2", "%zz", "a%4"} {
+			if _, err := UnescapeKey(id); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("UnescapeKey(%q) = %v; want ErrInvalidKey", id, err)
+			}
+		}
+	})
+}
+
+func TestKeyspace(t *testing.T) {
+	// Dialing the emulator is lazy, so no emulator needs to run.
+	t.Setenv(EmulatorHostEnv, "127.0.0.1:1")
+	ctx := context.Background()
+
+	kv, err := NewKV(ctx, "", "settings")
+	if err != nil {
+		t.Fatalf("NewKV failed: %v", err)
+	}
+	defer kv.Close()
+
+	if err := kv.Set(ctx, "a/b", "value"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Set with an invalid key = %v; want ErrInvalidKey", err)
+	}
+
+	ns, err := kv.Namespace("tenant")
+	if err != nil {
+		t.Fatalf("Namespace failed: %v", err)
+	}
+	ref, err := ns.keys.ref("key")
+	if err != nil {
+		t.Fatalf("ref failed: %v", err)
+	}
+	if want := "settings/tenant/kv/key"; !strings.HasSuffix(ref.Path, want) {
+		t.Errorf("namespaced document path = %q; want suffix %q", ref.Path, want)
+	}
+	if _, err := kv.Namespace("a/b"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Namespace with an invalid name = %v; want ErrInvalidKey", err)
+	}
+
+	escaped, err := NewKV(ctx, "", "settings", WithClient(kv.client), WithKeyEscaping())
+	if err != nil {
+		t.Fatalf("NewKV failed: %v", err)
+	}
+	ref, err = escaped.keys.ref("a/b")
+	if err != nil {
+		t.Fatalf("ref failed: %v", err)
+	}
+	if ref.ID != "a%2Fb" {
+		t.Errorf("escaped document ID = %q; want %q", ref.ID, "a%2Fb")
+	}
+	if key := escaped.keys.key(ref.ID); key != "a/b" {
+		t.Errorf("key(%q) = %q; want %q", ref.ID, key, "a/b")
+	}
+
+	t.Run("Escaping does not allow every key", func(t *testing.T) {
+		if _, err := escaped.keys.ref("bad\xffutf8"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("ref of an invalid UTF-8 key = %v; want ErrInvalidKey", err)
+		}
+		// "/" escapes to three bytes, so this key is one byte too long once escaped.
+		tooLong := strings.Repeat("k", MaxKeyBytes-2) + "/"
+		if _, err := escaped.keys.ref(tooLong); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("ref of a key longer than MaxKeyBytes once escaped = %v; want ErrInvalidKey", err)
+		}
+		if _, err := escaped.keys.ref(tooLong[1:]); err != nil {
+			t.Errorf("ref of a key of MaxKeyBytes once escaped = %v; want nil", err)
+		}
+		if err := escaped.Set(ctx, "bad\xffutf8", "value"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Set with an invalid UTF-8 key = %v; want ErrInvalidKey", err)
+		}
+	})
+}
+
+func TestIDPrefixEnd(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		expected string
+	}{
+		{prefix: "emoji-", expected: "emoji."},
+		{prefix: "a\uf8ff", expected: "a\uf900"},
+		{prefix: "a\ud7ff", expected: "a\ue000"},
+		{prefix: "a\U0010ffff", expected: "b"},
+		{prefix: "\U0010ffff", expected: ""},
+		{prefix: "v1.", expected: "v10"},
+	}
+	for _, tt := range tests {
+		end := idPrefixEnd(tt.prefix)
+		if end != tt.expected {
+			t.Errorf("idPrefixEnd(%q) = %q; want %q", tt.prefix, end, tt.expected)
+		}
+	}
+
+	// Every ID with the prefix sorts before the end, including ones whose next
+	// character is above U+F8FF.
+	for _, id := range []string{"emoji-", "emoji-a", "emoji-\uf8ff", "emoji-🔑", "emoji-\U0010ffff"} {
+		if end := idPrefixEnd("emoji-"); id >= end {
+			t.Errorf("expected %q to sort before %q", id, end)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package firestore
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+)
+
+// DefaultPageSize is the number of keys List returns when ListOptions.PageSize is zero.
+const DefaultPageSize = 100
+
+// ListOptions configures a List or Scan call.
+type ListOptions struct {
+	// Prefix restricts the results to keys starting with Prefix. Empty matches all keys.
+	Prefix string
+	// PageSize is the maximum number of keys per page. Zero means DefaultPageSize.
+	PageSize int
+	// PageToken resumes a listing after the page that returned it. It is opaque and
+	// must be passed together with the same Prefix.
+	PageToken string
+}
+
+// ListPage is a single page of keys returned by List.
+type ListPage struct {
+	// Keys holds the keys of this page in ascending order.
+	Keys []string
+	// NextPageToken is empty when there are no more keys.
+	NextPageToken string
+}
+
+// ScanPages turns a paged list function into an iterator over all keys, following
+// page tokens until the listing is exhausted. It is intended for KV implementations
+// that build Scan on top of List. The first error is yielded with an empty key and
+// ends the iteration.
+func ScanPages(ctx context.Context, list func(context.Context, ListOptions) (ListPage, error), opts ListOptions) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		for {
+			page, err := list(ctx, opts)
+			if err != nil {
+				yield("", err)
+				return
+			}
+			for _, key := range page.Keys {
+				if !yield(key, nil) {
+					return
+				}
+			}
+			if page.NextPageToken == "" {
+				return
+			}
+			opts.PageToken = page.NextPageToken
+		}
+	}
+}
+
+// PaginateKeys applies the list options to an in-memory set of keys, returning the
+// requested page with the same ordering and page tokens as FirestoreKV.List. It is
+// intended for KV implementations that do not page natively, such as mocks.
+func PaginateKeys(keys []string, opts ListOptions) (ListPage, error) {
+	pageSize, after, err := opts.normalize()
+	if err != nil {
+		return ListPage{}, err
+	}
+
+	matched := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if strings.HasPrefix(key, opts.Prefix) && (after == "" || key > after) {
+			matched = append(matched, key)
+		}
+	}
+	slices.Sort(matched)
+	return newListPage(slices.Compact(matched), pageSize), nil
+}
+
+// normalize validates the options, returning the effective page size and the key
+// encoded in the page token, if any.
+func (o ListOptions) normalize() (pageSize int, after string, err error) {
+	pageSize = o.PageSize
+	if pageSize < 0 {
+		return 0, "", fmt.Errorf("page size cannot be negative: %d", pageSize)
+	}
+	if pageSize == 0 {
+		pageSize = DefaultPageSize
+	}
+	if o.PageToken != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(o.PageToken)
+		if err != nil || !strings.HasPrefix(string(raw), o.Prefix) {
+			return 0, "", fmt.Errorf("invalid page token: %q", o.PageToken)
+		}
+		after = string(raw)
+	}
+	return pageSize, after, nil
+}
+
+// newListPage builds a page from sorted keys. Keys beyond pageSize are not returned;
+// they only signal that another page follows.
+func newListPage(keys []string, pageSize int) ListPage {
+	if len(keys) <= pageSize {
+		return ListPage{Keys: keys}
+	}
+	keys = keys[:pageSize]
+	return ListPage{
+		Keys:          keys,
+		NextPageToken: encodePageToken(keys[pageSize-1]),
+	}
+}
+
+// encodePageToken returns the opaque page token that resumes a listing after key.
+func encodePageToken(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
@@ -0,0 +1,115 @@
+package firestore
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestPaginateKeys(t *testing.T) {
+	keys := []string{"user:3", "order:1", "user:1", "user:2", "config"}
+
+	t.Run("Filters by prefix and sorts", func(t *testing.T) {
+		page, err := PaginateKeys(keys, ListOptions{Prefix: "user:"})
+		if err != nil {
+			t.Fatalf("PaginateKeys failed: %v", err)
+		}
+		if want := []string{"user:1", "user:2", "user:3"}; !slices.Equal(page.Keys, want) {
+			t.Errorf("expected %v, got %v", want, page.Keys)
+		}
+		if page.NextPageToken != "" {
+			t.Errorf("expected no next page token, got %q", page.NextPageToken)
+		}
+	})
+
+	t.Run("Follows page tokens", func(t *testing.T) {
+		var got []string
+		opts := ListOptions{PageSize: 2}
+		for pages := 0; ; pages++ {
+			if pages > len(keys) {
+				t.Fatal("pagination did not terminate")
+			}
+			page, err := PaginateKeys(keys, opts)
+			if err != nil {
+				t.Fatalf("PaginateKeys failed: %v", err)
+			}
+			if len(page.Keys) > 2 {
+				t.Fatalf("page exceeds page size: %v", page.Keys)
+			}
+			got = append(got, page.Keys...)
+			if page.NextPageToken == "" {
+				break
+			}
+			opts.PageToken = page.NextPageToken
+		}
+		want := []string{"config", "order:1", "user:1", "user:2", "user:3"}
+		if !slices.Equal(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("Rejects invalid options", func(t *testing.T) {
+		if _, err := PaginateKeys(keys, ListOptions{PageSize: -1}); err == nil {
+			t.Error("expected an error for a negative page size")
+		}
+		if _, err := PaginateKeys(keys, ListOptions{PageToken: "%%%"}); err == nil {
+			t.Error("expected an error for a malformed page token")
+		}
+	})
+
+	t.Run("Rejects a token from a different prefix", func(t *testing.T) {
+		page, err := PaginateKeys(keys, ListOptions{Prefix: "user:", PageSize: 1})
+		if err != nil {
+			t.Fatalf("PaginateKeys failed: %v", err)
+		}
+		if _, err := PaginateKeys(keys, ListOptions{Prefix: "order:", PageToken: page.NextPageToken}); err == nil {
+			t.Error("expected an error when the prefix changes between pages")
+		}
+	})
+}
+
+func TestScanPages(t *testing.T) {
+	ctx := context.Background()
+	keys := []string{"a", "b", "c", "d", "e"}
+	list := func(ctx context.Context, opts ListOptions) (ListPage, error) {
+		return PaginateKeys(keys, opts)
+	}
+
+	t.Run("Yields all keys across pages", func(t *testing.T) {
+		var got []string
+		for key, err := range ScanPages(ctx, list, ListOptions{PageSize: 2}) {
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got = append(got, key)
+		}
+		if !slices.Equal(got, keys) {
+			t.Errorf("expected %v, got %v", keys, got)
+		}
+	})
+
+	t.Run("Stops when the consumer breaks", func(t *testing.T) {
+		var got []string
+		for key := range ScanPages(ctx, list, ListOptions{PageSize: 2}) {
+			got = append(got, key)
+			if len(got) == 3 {
+				break
+			}
+		}
+		if len(got) != 3 {
+			t.Errorf("expected 3 keys, got %v", got)
+		}
+	})
+
+	t.Run("Yields the list error", func(t *testing.T) {
+		failing := func(ctx context.Context, opts ListOptions) (ListPage, error) {
+			return ListPage{}, errors.New("boom")
+		}
+		for _, err := range ScanPages(ctx, failing, ListOptions{}) {
+			if err == nil || err.Error() != "boom" {
+				t.Errorf("expected boom error, got %v", err)
+			}
+		}
+	})
+}
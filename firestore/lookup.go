@@ -0,0 +1,53 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	apierrors "github.com/duizendstra/dui-go/errors"
+)
+
+// ErrNotFound is wrapped by the error GetExisting returns for a missing or expired key.
+// It is the errors package's ErrNotFound, so errors.Is works with either.
+var ErrNotFound = apierrors.ErrNotFound
+
+// Lookuper is implemented by key-value stores that can tell a missing key apart from a
+// key holding an empty string.
+type Lookuper interface {
+	Lookup(ctx context.Context, key string) (string, bool, error)
+}
+
+// Lookup retrieves the value for the given key and reports whether the key exists.
+// Unlike Get, it distinguishes a missing or expired key (found is false) from a key
+// that was set to the empty string (found is true).
+func (f *FirestoreKV) Lookup(ctx context.Context, key string) (string, bool, error) {
+	docRef, err := f.keys.ref(key)
+	if err != nil {
+		return "", false, err
+	}
+	docSnap, err := docRef.Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("firestore get error (key=%s): %w", key, err)
+	}
+	value, live := liveValue(docSnap)
+	return value, live, nil
+}
+
+// GetExisting retrieves the value for the given key like Get, but returns an error
+// wrapping ErrNotFound if the key does not exist.
+func GetExisting(ctx context.Context, kv Lookuper, key string) (string, error) {
+	value, found, err := kv.Lookup(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("key %q: %w", key, ErrNotFound)
+	}
+	return value, nil
+}
@@ -0,0 +1,21 @@
+package firestore
+
+// namespaceCollection is the name of the subcollection holding a namespace's keys.
+const namespaceCollection = "kv"
+
+// Namespace returns a FirestoreKV whose keys live in a subcollection of the document
+// named ns, so namespaces are isolated from each other and from the keys of f: the
+// keys of namespace "tenant-a" in collection "settings" are documents of
+// "settings/tenant-a/kv". The namespace name follows the same rules as keys, including
+// escaping if enabled. Namespaces can be nested.
+//
+// The returned FirestoreKV shares the Firestore client with f, so closing either of
+// them closes both. The namespace document itself is never written, so List on f does
+// not report namespaces.
+func (f *FirestoreKV) Namespace(ns string) (*FirestoreKV, error) {
+	docRef, err := f.keys.ref(ns)
+	if err != nil {
+		return nil, err
+	}
+	return newFirestoreKV(f.client, keyspace{coll: docRef.Collection(namespaceCollection), escape: f.keys.escape}), nil
+}
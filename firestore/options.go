@@ -0,0 +1,127 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/option"
+)
+
+// EmulatorHostEnv is the environment variable holding the address of a Firestore
+// emulator, such as "localhost:8080". When it is set, clients connect to the emulator
+// without credentials.
+const EmulatorHostEnv = "FIRESTORE_EMULATOR_HOST"
+
+// emulatorProjectID is used when no project ID is given while targeting the emulator.
+// The emulator accepts any project ID; the "demo-" prefix marks it as not being real.
+const emulatorProjectID = "demo-dui-go"
+
+// Option configures how NewKV and NewDocStore connect to Firestore.
+type Option func(*clientOptions)
+
+// clientOptions collects the settings applied by Options.
+type clientOptions struct {
+	escapeKeys  bool
+	client      *firestore.Client
+	databaseID  string
+	credentials []option.ClientOption
+	extra       []option.ClientOption
+}
+
+// WithClient makes NewKV and NewDocStore use an existing Firestore client instead of
+// creating one. The other options are ignored. Closing the KV or DocStore closes the
+// client.
+func WithClient(client *firestore.Client) Option {
+	return func(o *clientOptions) {
+		o.client = client
+	}
+}
+
+// WithKeyEscaping allows keys containing "/" or "%", starting with "." or "_", or
+// matching __.*__, by percent-encoding them (see EscapeKey). Keys must still be valid
+// UTF-8, and their escaped form at most MaxKeyBytes long; other keys are rejected with
+// ErrInvalidKey, as are all invalid document IDs without the option. Only enable
+// it for new collections: existing documents whose IDs contain "%" or start with "."
+// or "_" would be read back as different keys. List orders keys by their escaped form.
+func WithKeyEscaping() Option {
+	return func(o *clientOptions) {
+		o.escapeKeys = true
+	}
+}
+
+// WithDatabaseID selects a named Firestore database instead of the "(default)" one.
+func WithDatabaseID(databaseID string) Option {
+	return func(o *clientOptions) {
+		o.databaseID = databaseID
+	}
+}
+
+// WithCredentialsFile authenticates with the service account or user credentials in
+// the given JSON file instead of Application Default Credentials. It is ignored when
+// EmulatorHostEnv is set.
+func WithCredentialsFile(path string) Option {
+	return func(o *clientOptions) {
+		o.credentials = append(o.credentials, option.WithCredentialsFile(path))
+	}
+}
+
+// WithCredentialsJSON authenticates with the given JSON credentials instead of
+// Application Default Credentials. It is ignored when EmulatorHostEnv is set.
+func WithCredentialsJSON(json []byte) Option {
+	return func(o *clientOptions) {
+		o.credentials = append(o.credentials, option.WithCredentialsJSON(json))
+	}
+}
+
+// WithClientOptions passes additional options, such as a custom endpoint or user
+// agent, to the Firestore client.
+func WithClientOptions(opts ...option.ClientOption) Option {
+	return func(o *clientOptions) {
+		o.extra = append(o.extra, opts...)
+	}
+}
+
+// applyOptions collects the settings of opts.
+func applyOptions(opts []Option) clientOptions {
+	var o clientOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// newClient returns the client configured by o, creating one if none was injected.
+//
+// If EmulatorHostEnv is set, credentials are not used, since the emulator does not
+// check them and loading them may fail in test environments, and an empty projectID
+// defaults to a demo project.
+func newClient(ctx context.Context, projectID string, o clientOptions) (*firestore.Client, error) {
+	if o.client != nil {
+		return o.client, nil
+	}
+
+	clientOpts := o.extra
+	if os.Getenv(EmulatorHostEnv) != "" {
+		if projectID == "" {
+			projectID = emulatorProjectID
+		}
+	} else {
+		clientOpts = append(clientOpts, o.credentials...)
+	}
+
+	var (
+		client *firestore.Client
+		err    error
+	)
+	if o.databaseID != "" && o.databaseID != firestore.DefaultDatabaseID {
+		client, err = firestore.NewClientWithDatabase(ctx, projectID, o.databaseID, clientOpts...)
+	} else {
+		client, err = firestore.NewClient(ctx, projectID, clientOpts...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Firestore client: %w", err)
+	}
+	return client, nil
+}
@@ -0,0 +1,35 @@
+package firestore
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNewClientOptions(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Emulator ignores credentials and defaults the project", func(t *testing.T) {
+		// Dialing the emulator is lazy, so no emulator needs to run.
+		t.Setenv(EmulatorHostEnv, "127.0.0.1:1")
+		client, err := newClient(ctx, "", applyOptions([]Option{WithCredentialsFile("/does/not/exist.json"), WithDatabaseID("other")}))
+		if err != nil {
+			t.Fatalf("newClient failed: %v", err)
+		}
+		defer client.Close()
+
+		kv, err := NewKV(ctx, "", "collection", WithClient(client))
+		if err != nil {
+			t.Fatalf("NewKV failed: %v", err)
+		}
+		if kv.client != client {
+			t.Error("expected NewKV to use the injected client")
+		}
+	})
+
+	t.Run("Credential errors surface without the emulator", func(t *testing.T) {
+		t.Setenv(EmulatorHostEnv, "")
+		if _, err := newClient(ctx, "project", applyOptions([]Option{WithCredentialsFile("/does/not/exist.json")})); err == nil {
+			t.Error("expected an error for a missing credentials file")
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// expireAtField is the document field holding the expiry time. It can be used as the
+// field of a Firestore TTL policy, which deletes documents some time after they expire.
+const expireAtField = "expireAt"
+
+// nowFunc returns the current time. In tests, we can replace it for stable results.
+var nowFunc = time.Now
+
+// SetWithTTL writes a value at the given key that expires after ttl. The expiry is
+// stored in the "expireAt" timestamp field; configure a Firestore TTL policy on that
+// field to have expired documents deleted. Because Firestore deletes expired documents
+// with a delay, reads treat them as missing as soon as they expire.
+func (f *FirestoreKV) SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("ttl must be positive (key=%s, ttl=%s)", key, ttl)
+	}
+
+	docRef, err := f.keys.ref(key)
+	if err != nil {
+		return err
+	}
+	data := kvData(value, nowFunc().Add(ttl))
+	if _, err := docRef.Set(ctx, data, firestore.MergeAll); err != nil {
+		return fmt.Errorf("firestore set error (key=%s): %w", key, err)
+	}
+	return nil
+}
+
+// Expiry returns the time the key expires, or the zero time if it has no expiry or
+// does not exist. An expired document that Firestore has not deleted yet counts as
+// missing.
+func (f *FirestoreKV) Expiry(ctx context.Context, key string) (time.Time, error) {
+	docRef, err := f.keys.ref(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	docSnap, err := docRef.Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("firestore get error (key=%s): %w", key, err)
+	}
+	if _, live := liveValue(docSnap); !live {
+		return time.Time{}, nil
+	}
+	return decodeKV(docSnap).ExpireAt, nil
+}
+
+// expired reports whether the document has an expiry that is not after now.
+func (d KVDocument) expired(now time.Time) bool {
+	return !d.ExpireAt.IsZero() && !now.Before(d.ExpireAt)
+}
+
+// kvData returns the fields written for a value. A zero expireAt removes any expiry
+// from the document, so a plain write makes a key permanent again.
+func kvData(value string, expireAt time.Time) map[string]interface{} {
+	data := map[string]interface{}{valueField: value, expireAtField: firestore.Delete}
+	if !expireAt.IsZero() {
+		data[expireAtField] = expireAt
+	}
+	return data
+}
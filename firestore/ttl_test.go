@@ -0,0 +1,80 @@
+package firestore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+func TestKVDocumentExpired(t *testing.T) {
+	now := time.Unix(10000, 0)
+
+	cases := []struct {
+		name     string
+		doc      KVDocument
+		expected bool
+	}{
+		{name: "No expiry never expires", doc: KVDocument{Value: "v"}, expected: false},
+		{name: "Expiry in the future", doc: KVDocument{ExpireAt: now.Add(time.Second)}, expected: false},
+		{name: "Expiry equal to now", doc: KVDocument{ExpireAt: now}, expected: true},
+		{name: "Expiry in the past", doc: KVDocument{ExpireAt: now.Add(-time.Second)}, expected: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.doc.expired(now); got != c.expected {
+				t.Errorf("expected %v, got %v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestKVData(t *testing.T) {
+	permanent := kvData("v", time.Time{})
+	if permanent[valueField] != "v" {
+		t.Errorf("expected value 'v', got %v", permanent[valueField])
+	}
+	if permanent[expireAtField] != firestore.Delete {
+		t.Errorf("expected a plain write to delete %s, got %v", expireAtField, permanent[expireAtField])
+	}
+
+	expireAt := time.Unix(20000, 0)
+	expiring := kvData("v", expireAt)
+	if got, ok := expiring[expireAtField].(time.Time); !ok || !got.Equal(expireAt) {
+		t.Errorf("expected %s=%v, got %v", expireAtField, expireAt, expiring[expireAtField])
+	}
+}
+
+func TestFirestoreKVExpiry(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newFakeClient(t)
+	kv := newFirestoreKV(client, keyspace{coll: client.Collection("kv")})
+
+	now := time.Now().Truncate(time.Microsecond)
+	original := nowFunc
+	nowFunc = func() time.Time { return now }
+	t.Cleanup(func() { nowFunc = original })
+
+	if err := kv.SetWithTTL(ctx, "session", "v", time.Minute); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	if err := kv.Set(ctx, "config", "v"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	if got, err := kv.Expiry(ctx, "session"); err != nil || !got.Equal(now.Add(time.Minute)) {
+		t.Errorf("Expiry(session) = %v, %v; want %v", got, err, now.Add(time.Minute))
+	}
+	for _, key := range []string{"config", "missing"} {
+		if got, err := kv.Expiry(ctx, key); err != nil || !got.IsZero() {
+			t.Errorf("Expiry(%s) = %v, %v; want the zero time", key, got, err)
+		}
+	}
+
+	nowFunc = func() time.Time { return now.Add(time.Hour) }
+	if got, err := kv.Expiry(ctx, "session"); err != nil || !got.IsZero() {
+		t.Errorf("Expiry of an expired key = %v, %v; want the zero time", got, err)
+	}
+}
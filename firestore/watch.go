@@ -0,0 +1,235 @@
+package firestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// EventType describes what happened to a watched key.
+type EventType int
+
+const (
+	// EventSet means the key was created or its value was written.
+	EventSet EventType = iota
+	// EventDelete means the key was deleted.
+	EventDelete
+)
+
+// String returns a readable name for the event type.
+func (t EventType) String() string {
+	switch t {
+	case EventSet:
+		return "set"
+	case EventDelete:
+		return "delete"
+	default:
+		return fmt.Sprintf("EventType(%d)", int(t))
+	}
+}
+
+// Event reports a change to a watched key.
+type Event struct {
+	Type EventType
+	Key  string
+	// Value is the new value. It is empty for EventDelete.
+	Value string
+	// Version is the version written by the change, or NoVersion for EventDelete.
+	Version Version
+	// Initial is set for the EventSet events that report the current values of the
+	// watched keys when the watch starts, rather than a change made after it started.
+	Initial bool
+	// Err is set when the listener failed, with Key holding the watched key or prefix
+	// and the other fields empty. The watch reconnects after a backoff, so Err is
+	// informational and the channel stays open.
+	Err error
+}
+
+var (
+	// watchRetryDelay is the first delay before a failed listener is reconnected.
+	// Subsequent failures double it up to maxWatchRetryDelay.
+	watchRetryDelay    = time.Second
+	maxWatchRetryDelay = 30 * time.Second
+)
+
+// Watch reports changes to a single key on the returned channel until ctx is done,
+// at which point the channel is closed. If the key exists when the watch starts, its
+// current value is delivered first as an EventSet with Initial set.
+//
+// Watch uses a Firestore snapshot listener. If the listener fails, an Event with Err
+// set is delivered and the listener is re-established with exponential backoff; on
+// reconnection only changes missed in between are reported. Writing an identical
+// value still produces an event, since the key gets a new version. Expiry on its
+// own does not produce an event; the EventDelete follows when Firestore's TTL
+// policy deletes the document.
+func (f *FirestoreKV) Watch(ctx context.Context, key string) (<-chan Event, error) {
+	docRef, err := f.keys.ref(key)
+	if err != nil {
+		return nil, err
+	}
+	q := f.keys.coll.Where(firestore.DocumentID, "==", docRef)
+	return f.watch(ctx, q, key, true), nil
+}
+
+// WatchPrefix reports changes to all keys starting with prefix, like Watch does for a
+// single key. The current values of matching keys are delivered first, in key order.
+// An empty prefix watches the whole collection.
+func (f *FirestoreKV) WatchPrefix(ctx context.Context, prefix string) (<-chan Event, error) {
+	q := f.keys.coll.OrderBy(firestore.DocumentID, firestore.Asc)
+	if prefix != "" {
+		id := f.keys.idPrefix(prefix)
+		q = q.StartAt(id)
+		if end := idPrefixEnd(id); end != "" {
+			q = q.EndBefore(end)
+		}
+	}
+	return f.watch(ctx, q, prefix, false), nil
+}
+
+// watch starts a goroutine that listens to the query and sends the document changes
+// of each snapshot on the returned channel.
+func (f *FirestoreKV) watch(ctx context.Context, q firestore.Query, key string, exact bool) <-chan Event {
+	events := make(chan Event)
+
+	go func() {
+		defer close(events)
+
+		known := make(map[string]watchEntry)
+		delay := watchRetryDelay
+		// started is set once the first snapshot, whose events are Initial, was sent.
+		started := false
+		for {
+			// The first snapshot of a listener adds all matching documents, so it is
+			// compared against the known state in full to catch deletions missed
+			// while disconnected.
+			full := true
+			err := listen(ctx, q, func(snap *firestore.QuerySnapshot) error {
+				changes := make([]watchChange, 0, len(snap.Changes))
+				for _, change := range snap.Changes {
+					k := f.keys.key(change.Doc.Ref.ID)
+					if (exact && k != key) || (!exact && !strings.HasPrefix(k, key)) {
+						continue
+					}
+					c := watchChange{key: k}
+					if change.Kind != firestore.DocumentRemoved {
+						c.entry.value, c.live = liveValue(change.Doc)
+						c.entry.version = Version(change.Doc.UpdateTime.UnixNano())
+					}
+					changes = append(changes, c)
+				}
+
+				for _, ev := range applyWatchChanges(known, changes, full) {
+					ev.Initial = !started
+					if !sendEvent(ctx, events, ev) {
+						return ctx.Err()
+					}
+				}
+				started = true
+				full = false
+				// A delivered snapshot means the listener is healthy again.
+				delay = watchRetryDelay
+				return nil
+			})
+			if ctx.Err() != nil {
+				return
+			}
+
+			if !sendEvent(ctx, events, Event{Key: key, Err: fmt.Errorf("firestore watch error (key=%s): %w", key, err)}) {
+				return
+			}
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			delay = min(2*delay, maxWatchRetryDelay)
+		}
+	}()
+
+	return events
+}
+
+// listen runs a snapshot listener on the query and calls fn for every snapshot until
+// the listener or fn fails. It always returns a non-nil error.
+func listen(ctx context.Context, q firestore.Query, fn func(*firestore.QuerySnapshot) error) error {
+	it := q.Snapshots(ctx)
+	defer it.Stop()
+
+	for {
+		snap, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return fmt.Errorf("snapshot listener stopped")
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(snap); err != nil {
+			return err
+		}
+	}
+}
+
+// watchEntry is the last observed state of a watched key.
+type watchEntry struct {
+	value   string
+	version Version
+}
+
+// watchChange is a change of a watched key in a snapshot. live is false when the
+// document was removed or has expired.
+type watchChange struct {
+	key   string
+	entry watchEntry
+	live  bool
+}
+
+// applyWatchChanges applies the changes of a snapshot to the known state and returns
+// the resulting events, ordered by key. Changes that keep the version of a known key
+// produce no event, which keeps reconnections from repeating events. If full is set,
+// the changes hold every current key, and known keys without a change were deleted.
+func applyWatchChanges(known map[string]watchEntry, changes []watchChange, full bool) []Event {
+	var events []Event
+	current := make(map[string]bool, len(changes))
+	for _, c := range changes {
+		old, ok := known[c.key]
+		switch {
+		case !c.live:
+			if ok {
+				delete(known, c.key)
+				events = append(events, Event{Type: EventDelete, Key: c.key})
+			}
+		case !ok || old.version != c.entry.version:
+			known[c.key] = c.entry
+			events = append(events, Event{Type: EventSet, Key: c.key, Value: c.entry.value, Version: c.entry.version})
+		}
+		current[c.key] = c.live
+	}
+	if full {
+		for key := range known {
+			if !current[key] {
+				delete(known, key)
+				events = append(events, Event{Type: EventDelete, Key: key})
+			}
+		}
+	}
+	slices.SortFunc(events, func(a, b Event) int { return strings.Compare(a.Key, b.Key) })
+	return events
+}
+
+// sendEvent delivers the event unless ctx is done first, and reports whether it was sent.
+func sendEvent(ctx context.Context, events chan<- Event, ev Event) bool {
+	select {
+	case events <- ev:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,168 @@
+package firestore
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestApplyWatchChanges(t *testing.T) {
+	newKnown := func() map[string]watchEntry {
+		return map[string]watchEntry{
+			"a": {value: "1", version: 10},
+			"b": {value: "2", version: 20},
+			"c": {value: "3", version: 30},
+		}
+	}
+	changes := []watchChange{
+		{key: "d", entry: watchEntry{value: "4", version: 40}, live: true},
+		{key: "b", entry: watchEntry{value: "2", version: 21}, live: true},
+		{key: "a", entry: watchEntry{value: "1", version: 10}, live: true},
+		{key: "e", live: false},
+	}
+
+	t.Run("Incremental changes", func(t *testing.T) {
+		known := newKnown()
+		got := applyWatchChanges(known, append(changes, watchChange{key: "c"}), false)
+		want := []Event{
+			{Type: EventSet, Key: "b", Value: "2", Version: 21},
+			{Type: EventDelete, Key: "c"},
+			{Type: EventSet, Key: "d", Value: "4", Version: 40},
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("expected %+v, got %+v", want, got)
+		}
+		if keys := slices.Sorted(maps.Keys(known)); !slices.Equal(keys, []string{"a", "b", "d"}) {
+			t.Errorf("expected known keys [a b d], got %v", keys)
+		}
+	})
+
+	t.Run("Full snapshot deletes missing keys", func(t *testing.T) {
+		known := newKnown()
+		got := applyWatchChanges(known, changes, true)
+		want := []Event{
+			{Type: EventSet, Key: "b", Value: "2", Version: 21},
+			{Type: EventDelete, Key: "c"},
+			{Type: EventSet, Key: "d", Value: "4", Version: 40},
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("expected %+v, got %+v", want, got)
+		}
+		if events := applyWatchChanges(known, changes, true); len(events) != 0 {
+			t.Errorf("expected no events for an unchanged state, got %+v", events)
+		}
+	})
+}
+
+func TestEventTypeString(t *testing.T) {
+	cases := map[EventType]string{EventSet: "set", EventDelete: "delete", EventType(7): "EventType(7)"}
+	for typ, expected := range cases {
+		if got := typ.String(); got != expected {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+	}
+}
+
+// nextEvent returns the next event from the channel, failing the test if none
+// arrives in time.
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("event channel closed")
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return Event{}
+	}
+}
+
+// expectEvents checks that the next events have the given types, keys and values.
+func expectEvents(t *testing.T, events <-chan Event, want ...Event) {
+	t.Helper()
+	for _, w := range want {
+		ev := nextEvent(t, events)
+		if ev.Err != nil || ev.Type != w.Type || ev.Key != w.Key || ev.Value != w.Value || ev.Initial != w.Initial {
+			t.Fatalf("expected %v %q=%q (initial %v), got %+v", w.Type, w.Key, w.Value, w.Initial, ev)
+		}
+		if ev.Type == EventSet && ev.Version == NoVersion {
+			t.Errorf("expected a version for %q", ev.Key)
+		}
+	}
+}
+
+func TestWatchListener(t *testing.T) {
+	original := watchRetryDelay
+	watchRetryDelay = 100 * time.Millisecond
+	t.Cleanup(func() { watchRetryDelay = original })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client, fake := newFakeClient(t)
+	kv := newFirestoreKV(client, keyspace{coll: client.Collection("kv")})
+	mustSet := func(key, value string) {
+		t.Helper()
+		if err := kv.Set(ctx, key, value); err != nil {
+			t.Fatalf("Set(%q) failed: %v", key, err)
+		}
+	}
+	mustDelete := func(key string) {
+		t.Helper()
+		if err := kv.Delete(ctx, key); err != nil {
+			t.Fatalf("Delete(%q) failed: %v", key, err)
+		}
+	}
+	mustSet("app-a", "1")
+	mustSet("apps", "outside")
+
+	prefixEvents, err := kv.WatchPrefix(ctx, "app-")
+	if err != nil {
+		t.Fatalf("WatchPrefix failed: %v", err)
+	}
+	keyEvents, err := kv.Watch(ctx, "app-b")
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	expectEvents(t, prefixEvents, Event{Type: EventSet, Key: "app-a", Value: "1", Initial: true})
+
+	mustSet("app-🔑", "2")
+	mustSet("apps", "still outside")
+	mustSet("app-b", "3")
+	mustDelete("app-a")
+	expectEvents(t, prefixEvents,
+		Event{Type: EventSet, Key: "app-🔑", Value: "2"},
+		Event{Type: EventSet, Key: "app-b", Value: "3"},
+		Event{Type: EventDelete, Key: "app-a"})
+	expectEvents(t, keyEvents, Event{Type: EventSet, Key: "app-b", Value: "3"})
+
+	// Changes made while the listeners reconnect are reported once they are back,
+	// without repeating the unchanged keys.
+	fake.breakListeners(status.Error(codes.PermissionDenied, "listener broken"))
+	for _, events := range []<-chan Event{prefixEvents, keyEvents} {
+		if ev := nextEvent(t, events); ev.Err == nil {
+			t.Fatalf("expected an error event, got %+v", ev)
+		}
+	}
+	mustDelete("app-b")
+	mustSet("app-c", "4")
+	expectEvents(t, prefixEvents,
+		Event{Type: EventDelete, Key: "app-b"},
+		Event{Type: EventSet, Key: "app-c", Value: "4"})
+	expectEvents(t, keyEvents, Event{Type: EventDelete, Key: "app-b"})
+
+	mustSet("app-🔑", "5")
+	expectEvents(t, prefixEvents, Event{Type: EventSet, Key: "app-🔑", Value: "5"})
+
+	cancel()
+	for range prefixEvents {
+	}
+	for range keyEvents {
+	}
+}
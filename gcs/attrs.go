@@ -0,0 +1,60 @@
+package gcs
+
+import (
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// ObjectAttrs describes a GCS object. It holds the attributes most callers need, so
+// they do not have to import cloud.google.com/go/storage.
+type ObjectAttrs struct {
+	Bucket          string
+	Name            string
+	Size            int64
+	ContentType     string
+	ContentEncoding string
+	CacheControl    string
+	// CRC32C is the CRC32 checksum of the object data, using the Castagnoli table.
+	CRC32C uint32
+	// MD5 is the MD5 hash of the object data. It is empty for composite objects.
+	MD5 []byte
+	// Generation identifies the version of the object data; it changes on every write.
+	Generation int64
+	// Metageneration identifies the version of the object metadata within a generation.
+	Metageneration int64
+	// Metadata holds the custom key-value metadata of the object.
+	Metadata map[string]string
+	// CustomerKeySHA256 is the base64-encoded SHA-256 hash of the customer-supplied
+	// key the object is encrypted with, if any.
+	CustomerKeySHA256 string
+	Created           time.Time
+	Updated           time.Time
+	// Deleted is set for noncurrent generations listed with ListOptions.Versions.
+	Deleted time.Time
+	// Prefix is only set, with all other fields empty, for the directory-like entries
+	// that List and ListPage return when listing with a delimiter.
+	Prefix string
+}
+
+// objectAttrsFrom converts the attributes returned by the storage client.
+func objectAttrsFrom(a *storage.ObjectAttrs) *ObjectAttrs {
+	return &ObjectAttrs{
+		Bucket:            a.Bucket,
+		Name:              a.Name,
+		Size:              a.Size,
+		ContentType:       a.ContentType,
+		ContentEncoding:   a.ContentEncoding,
+		CacheControl:      a.CacheControl,
+		CRC32C:            a.CRC32C,
+		MD5:               a.MD5,
+		Generation:        a.Generation,
+		Metageneration:    a.Metageneration,
+		Metadata:          a.Metadata,
+		Created:           a.Created,
+		CustomerKeySHA256: a.CustomerKeySHA256,
+		Updated:           a.Updated,
+		Deleted:           a.Deleted,
+		Prefix:            a.Prefix,
+	}
+}
@@ -0,0 +1,165 @@
+package gcs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// BlobStore is the set of object operations shared by Client and the local
+// MemoryBlobStore and FileBlobStore, so code that stores blobs can run and be tested
+// without GCS. All implementations follow the semantics documented on Client: errors
+// for missing objects wrap ErrNotFound, failed Conditions wrap ErrPreconditionFailed
+// and mismatched checksums wrap ErrChecksumMismatch.
+type BlobStore interface {
+	// Upload streams r to an object and returns the attributes of the stored object.
+	Upload(ctx context.Context, object string, r io.Reader, opts UploadOptions) (*ObjectAttrs, error)
+	// Download streams the content of an object to w.
+	Download(ctx context.Context, object string, w io.Writer) error
+	// NewRangeReader opens length bytes of an object, starting at offset. A length of
+	// -1 reads until the end and a negative offset reads the last -offset bytes.
+	NewRangeReader(ctx context.Context, object string, offset, length int64) (io.ReadCloser, error)
+	// List iterates over the objects that match the options, ordered by name.
+	List(ctx context.Context, opts ListOptions) iter.Seq2[ObjectAttrs, error]
+	// Delete removes an object if the conditions hold.
+	Delete(ctx context.Context, object string, conds Conditions) error
+	// Stat returns the attributes of an object.
+	Stat(ctx context.Context, object string) (*ObjectAttrs, error)
+}
+
+// Compile-time checks that the stores implement BlobStore.
+var (
+	_ BlobStore = (*Client)(nil)
+	_ BlobStore = (*MemoryBlobStore)(nil)
+	_ BlobStore = (*FileBlobStore)(nil)
+)
+
+// copyUpload copies an upload to w, as the local stores do, and returns the attributes
+// of the new object without its generation and timestamps. The content type is
+// detected like Upload does, the options are validated like Upload does, and the
+// expected checksums in opts are verified. The local stores keep data uncompressed,
+// since reads return it decoded anyway, and they reject encryption rather than store
+// the data in the clear.
+func copyUpload(object string, r io.Reader, opts UploadOptions, w io.Writer) (ObjectAttrs, error) {
+	if object == "" {
+		return ObjectAttrs{}, fmt.Errorf("object name cannot be empty")
+	}
+	if err := opts.validate(); err != nil {
+		return ObjectAttrs{}, err
+	}
+	if opts.Encrypt || opts.CustomerKey != nil {
+		return ObjectAttrs{}, fmt.Errorf("local blob stores do not support encryption")
+	}
+	br := bufio.NewReaderSize(r, sniffLen)
+	contentType := opts.ContentType
+	if contentType == "" {
+		contentType = detectContentType(object, br)
+	}
+
+	sums := newUploadHashes()
+	n, err := io.Copy(io.MultiWriter(w, sums), br)
+	if err != nil {
+		return ObjectAttrs{}, fmt.Errorf("failed to copy data to object '%s': %w", object, err)
+	}
+	if !sums.match(opts.CRC32C, opts.MD5) {
+		return ObjectAttrs{}, fmt.Errorf("failed to upload object '%s': %w", object, ErrChecksumMismatch)
+	}
+
+	return ObjectAttrs{
+		Name:            object,
+		Size:            n,
+		ContentType:     contentType,
+		ContentEncoding: opts.ContentEncoding,
+		CacheControl:    opts.CacheControl,
+		CRC32C:          sums.crc.Sum32(),
+		MD5:             sums.md5.Sum(nil),
+		Metadata:        maps.Clone(opts.Metadata),
+		Metageneration:  1,
+	}, nil
+}
+
+// checkConditions returns an error wrapping ErrPreconditionFailed if the conditions do
+// not hold for the current attributes of an object, which are nil if it does not exist.
+func checkConditions(object string, current *ObjectAttrs, conds Conditions) error {
+	var gen, metagen int64
+	if current != nil {
+		gen, metagen = current.Generation, current.Metageneration
+	}
+	ok := (!conds.DoesNotExist || current == nil) &&
+		(conds.GenerationMatch == 0 || conds.GenerationMatch == gen) &&
+		(conds.GenerationNotMatch == 0 || conds.GenerationNotMatch != gen) &&
+		(conds.MetagenerationMatch == 0 || current != nil && conds.MetagenerationMatch == metagen) &&
+		(conds.MetagenerationNotMatch == 0 || current != nil && conds.MetagenerationNotMatch != metagen)
+	if !ok {
+		return fmt.Errorf("conditions on object '%s' do not hold: %w", object, ErrPreconditionFailed)
+	}
+	return nil
+}
+
+// nextGeneration returns a generation number greater than last. Like GCS generations,
+// it is based on the current time in microseconds.
+func nextGeneration(last int64, now time.Time) int64 {
+	return max(last+1, now.UnixMicro())
+}
+
+// byteRange resolves a range read of an object of the given size to the offsets
+// [start, end).
+func byteRange(object string, size, offset, length int64) (int64, int64, error) {
+	if offset < 0 {
+		if length != -1 {
+			return 0, 0, fmt.Errorf("length must be -1 when reading from the end of the object")
+		}
+		return max(size+offset, 0), size, nil
+	}
+	if offset > 0 && offset >= size {
+		// Like GCS, which answers with 416 Range Not Satisfiable.
+		return 0, 0, fmt.Errorf("offset %d is beyond the end of object '%s' (%d bytes)", offset, object, size)
+	}
+	if length < 0 {
+		return offset, size, nil
+	}
+	return offset, min(offset+length, size), nil
+}
+
+// listObjects returns the objects that match the options, given all objects of a
+// store ordered by name, like GCS returns them in a single page: first the matching
+// objects, then the prefixes when listing with a delimiter. Local stores keep no
+// noncurrent versions and return everything at once, so opts.Versions, PageSize and
+// PageToken have no effect.
+func listObjects(objects []ObjectAttrs, opts ListOptions) []ObjectAttrs {
+	var matched, prefixes []ObjectAttrs
+	seen := make(map[string]bool)
+	for _, attrs := range objects {
+		name := attrs.Name
+		if !strings.HasPrefix(name, opts.Prefix) ||
+			(opts.StartOffset != "" && name < opts.StartOffset) ||
+			(opts.EndOffset != "" && name >= opts.EndOffset) {
+			continue
+		}
+		if opts.Delimiter != "" {
+			if i := strings.Index(name[len(opts.Prefix):], opts.Delimiter); i >= 0 {
+				p := name[:len(opts.Prefix)+i+len(opts.Delimiter)]
+				if !seen[p] {
+					seen[p] = true
+					prefixes = append(prefixes, ObjectAttrs{Prefix: p})
+				}
+				continue
+			}
+		}
+		matched = append(matched, attrs)
+	}
+	return append(matched, prefixes...)
+}
+
+// cloneAttrs returns a copy of attrs that does not share its metadata or hash.
+func cloneAttrs(attrs ObjectAttrs) *ObjectAttrs {
+	attrs.Metadata = maps.Clone(attrs.Metadata)
+	attrs.MD5 = slices.Clone(attrs.MD5)
+	return &attrs
+}
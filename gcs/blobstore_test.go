@@ -0,0 +1,34 @@
+package gcs_test
+
+import (
+	"testing"
+
+	"github.com/duizendstra/dui-go/gcs"
+	"github.com/duizendstra/dui-go/store"
+	"github.com/duizendstra/dui-go/testutil"
+)
+
+// The keyrings of the store package wrap the data keys of encrypted uploads.
+var _ gcs.KeyWrapper = (*store.Keyring)(nil)
+
+func TestBlobStoreConformance(t *testing.T) {
+	t.Run("Client", func(t *testing.T) {
+		testutil.RunBlobStoreConformance(t, func(t *testing.T) gcs.BlobStore {
+			return gcs.NewFakeClient(t)
+		})
+	})
+	t.Run("MemoryBlobStore", func(t *testing.T) {
+		testutil.RunBlobStoreConformance(t, func(t *testing.T) gcs.BlobStore {
+			return gcs.NewMemoryBlobStore()
+		})
+	})
+	t.Run("FileBlobStore", func(t *testing.T) {
+		testutil.RunBlobStoreConformance(t, func(t *testing.T) gcs.BlobStore {
+			store, err := gcs.NewFileBlobStore(t.TempDir())
+			if err != nil {
+				t.Fatalf("NewFileBlobStore failed: %v", err)
+			}
+			return store
+		})
+	})
+}
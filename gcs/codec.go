@@ -0,0 +1,383 @@
+package gcs
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrDecryption is wrapped by errors from reads of encrypted objects that cannot be
+// decrypted, for example because they were tampered with or truncated, or because
+// no configured key matches them.
+var ErrDecryption = errors.New("failed to decrypt object")
+
+// Compression selects how Upload compresses data.
+type Compression int
+
+const (
+	// NoCompression uploads the data as is.
+	NoCompression Compression = iota
+	// Gzip compresses the data with gzip. GCS serves unencrypted gzip objects
+	// decompressed to clients that do not accept gzip.
+	Gzip
+	// Zstd compresses the data with Zstandard, which is faster and compresses better
+	// than gzip, but only clients that decode it themselves can read the object.
+	Zstd
+)
+
+// String returns the Content-Encoding of the compression.
+func (c Compression) String() string {
+	switch c {
+	case Gzip:
+		return "gzip"
+	case Zstd:
+		return "zstd"
+	default:
+		return ""
+	}
+}
+
+// KeyWrapper wraps and unwraps the data keys of objects uploaded with
+// UploadOptions.Encrypt, using key-encryption keys (KEKs) identified by key IDs. It
+// has the method set of store.KeyWrapper, so a store.Keyring or a Cloud KMS adapter
+// written for the store package can be used as is.
+type KeyWrapper interface {
+	// CurrentKeyID returns the ID of the KEK that new data keys are wrapped with.
+	CurrentKeyID(ctx context.Context) (string, error)
+	// WrapKey encrypts dataKey with the KEK identified by keyID.
+	WrapKey(ctx context.Context, keyID string, dataKey []byte) ([]byte, error)
+	// UnwrapKey decrypts a data key that WrapKey wrapped with the KEK identified by keyID.
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Metadata keys describing the client-side encoding of an object. Compression of
+// unencrypted objects is described by their Content-Encoding instead.
+const (
+	metaEncryption  = "dui-encryption"
+	metaCompression = "dui-compression"
+	metaKeyID       = "dui-key-id"
+	metaWrappedKey  = "dui-wrapped-key"
+	metaNonce       = "dui-nonce"
+)
+
+// Client-side encryption splits the data into segments of segmentSize bytes, each
+// sealed with AES-256-GCM under a nonce made of a random per-object prefix, the
+// segment number and a flag marking the last segment, so segments cannot be
+// reordered, dropped or truncated without failing to decrypt. Every segment is
+// authenticated together with the object name and the key ID, so the data cannot be
+// copied or renamed to another object and still decrypt.
+const (
+	encryptionScheme = "AES256-GCM-SEG64K"
+	segmentSize      = 64 << 10
+	noncePrefixSize  = 7
+)
+
+// encoder is the chain of writers that compress and encrypt an upload.
+type encoder struct {
+	w       io.Writer
+	closers []io.Closer
+}
+
+// Close flushes the compressor and the last encrypted segment. Every writer is closed
+// even if an earlier one fails, so the compressor always releases its resources.
+func (e *encoder) Close() error {
+	var errs []error
+	for _, c := range e.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// newEncoder returns an encoder that writes the encoded data of object to dst and
+// adds the metadata that describes the encoding to metadata.
+func (c *Client) newEncoder(ctx context.Context, dst io.Writer, object string, opts UploadOptions, metadata map[string]string) (*encoder, error) {
+	e := &encoder{w: dst}
+	if opts.Encrypt {
+		if c.keyWrapper == nil {
+			return nil, fmt.Errorf("encrypting uploads requires a KeyWrapper in the Config")
+		}
+		keyID, err := c.keyWrapper.CurrentKeyID(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get current key ID: %w", err)
+		}
+		dataKey := make([]byte, 32)
+		noncePrefix := make([]byte, noncePrefixSize)
+		if _, err := rand.Read(dataKey); err != nil {
+			return nil, fmt.Errorf("failed to generate data key: %w", err)
+		}
+		if _, err := rand.Read(noncePrefix); err != nil {
+			return nil, fmt.Errorf("failed to generate nonce: %w", err)
+		}
+		wrapped, err := c.keyWrapper.WrapKey(ctx, keyID, dataKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to wrap data key (keyID=%s): %w", keyID, err)
+		}
+		aead, err := newGCM(dataKey)
+		if err != nil {
+			return nil, err
+		}
+
+		metadata[metaEncryption] = encryptionScheme
+		metadata[metaKeyID] = keyID
+		metadata[metaWrappedKey] = base64.StdEncoding.EncodeToString(wrapped)
+		metadata[metaNonce] = base64.StdEncoding.EncodeToString(noncePrefix)
+		if opts.Compression != NoCompression {
+			metadata[metaCompression] = opts.Compression.String()
+		}
+		sw := &segmentWriter{w: e.w, aead: aead, noncePrefix: noncePrefix, aad: segmentAAD(object, keyID), buf: make([]byte, 0, segmentSize)}
+		e.w, e.closers = sw, append(e.closers, sw)
+	}
+
+	switch opts.Compression {
+	case NoCompression:
+	case Gzip:
+		gw := gzip.NewWriter(e.w)
+		e.w, e.closers = gw, append([]io.Closer{gw}, e.closers...)
+	case Zstd:
+		zw, err := zstd.NewWriter(e.w)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+		}
+		e.w, e.closers = zw, append([]io.Closer{zw}, e.closers...)
+	default:
+		return nil, fmt.Errorf("unknown compression %d", opts.Compression)
+	}
+	return e, nil
+}
+
+// decode returns a reader of the original data of an object, given a reader of its
+// stored data, its Content-Encoding and its metadata. Data with an unknown
+// Content-Encoding is returned as stored.
+func (c *Client) decode(ctx context.Context, object string, r io.ReadCloser, contentEncoding string, metadata map[string]string) (io.ReadCloser, error) {
+	compression := contentEncoding
+	if scheme := metaValue(metadata, metaEncryption); scheme != "" {
+		if scheme != encryptionScheme {
+			return nil, fmt.Errorf("%w '%s': unknown encryption scheme %q", ErrDecryption, object, scheme)
+		}
+		if c.keyWrapper == nil {
+			return nil, fmt.Errorf("%w '%s': the object is encrypted and the Config has no KeyWrapper", ErrDecryption, object)
+		}
+		keyID := metaValue(metadata, metaKeyID)
+		wrapped, err1 := base64.StdEncoding.DecodeString(metaValue(metadata, metaWrappedKey))
+		noncePrefix, err2 := base64.StdEncoding.DecodeString(metaValue(metadata, metaNonce))
+		if err := errors.Join(err1, err2); err != nil || len(noncePrefix) != noncePrefixSize {
+			return nil, fmt.Errorf("%w '%s': invalid encryption metadata", ErrDecryption, object)
+		}
+		dataKey, err := c.keyWrapper.UnwrapKey(ctx, keyID, wrapped)
+		if err != nil {
+			return nil, fmt.Errorf("%w '%s' (keyID=%s): %w", ErrDecryption, object, keyID, err)
+		}
+		aead, err := newGCM(dataKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w '%s' (keyID=%s): %w", ErrDecryption, object, keyID, err)
+		}
+		r = &segmentReader{r: bufio.NewReaderSize(r, segmentSize+aead.Overhead()+1), closer: r, aead: aead, noncePrefix: noncePrefix, aad: segmentAAD(object, keyID)}
+		compression = metaValue(metadata, metaCompression)
+	}
+
+	switch compression {
+	case "gzip":
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress GCS object '%s': %w", object, err)
+		}
+		return readCloser{gr, r}, nil
+	case "zstd":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress GCS object '%s': %w", object, err)
+		}
+		return readCloser{zr.IOReadCloser(), r}, nil
+	default:
+		return r, nil
+	}
+}
+
+// customerKey returns the configured customer-supplied key with the given
+// base64-encoded SHA-256 hash.
+func (c *Client) customerKey(keySHA256 string) []byte {
+	for _, key := range c.customerKeys {
+		sum := sha256.Sum256(key)
+		if base64.StdEncoding.EncodeToString(sum[:]) == keySHA256 {
+			return key
+		}
+	}
+	return nil
+}
+
+// metaValue returns a metadata value, ignoring the case of the key: metadata read
+// through the XML API has its keys canonicalized like HTTP headers.
+func metaValue(metadata map[string]string, key string) string {
+	if v, ok := metadata[key]; ok {
+		return v
+	}
+	for k, v := range metadata {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+// readCloser reads from a decoder and closes both it and the underlying reader.
+type readCloser struct {
+	io.Reader
+	inner io.Closer
+}
+
+func (r readCloser) Close() error {
+	var err error
+	if c, ok := r.Reader.(io.Closer); ok {
+		err = c.Close()
+	}
+	return errors.Join(err, r.inner.Close())
+}
+
+// segmentWriter encrypts data in segments. The last segment, which may be empty, is
+// written by Close.
+type segmentWriter struct {
+	w           io.Writer
+	aead        cipher.AEAD
+	noncePrefix []byte
+	aad         []byte
+	buf         []byte
+	n           uint32
+}
+
+func (s *segmentWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// A full segment is only sealed once more data follows, since the last
+		// segment is sealed differently.
+		if len(s.buf) == segmentSize {
+			if err := s.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(s.buf[len(s.buf):segmentSize], p)
+		s.buf = s.buf[:len(s.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (s *segmentWriter) Close() error {
+	return s.seal(true)
+}
+
+func (s *segmentWriter) seal(last bool) error {
+	if s.n == ^uint32(0) {
+		return fmt.Errorf("data is too large to encrypt")
+	}
+	sealed := s.aead.Seal(nil, segmentNonce(s.noncePrefix, s.n, last), s.buf, s.aad)
+	s.buf = s.buf[:0]
+	s.n++
+	_, err := s.w.Write(sealed)
+	return err
+}
+
+// segmentReader decrypts data written by a segmentWriter.
+type segmentReader struct {
+	r           *bufio.Reader
+	closer      io.Closer
+	aead        cipher.AEAD
+	noncePrefix []byte
+	aad         []byte
+	n           uint32
+	plain       []byte
+	done        bool
+}
+
+func (s *segmentReader) Read(p []byte) (int, error) {
+	for len(s.plain) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.plain)
+	s.plain = s.plain[n:]
+	return n, nil
+}
+
+// open reads and decrypts the next segment.
+func (s *segmentReader) open() error {
+	sealed := make([]byte, segmentSize+s.aead.Overhead())
+	n, err := io.ReadFull(s.r, sealed)
+	switch {
+	case errors.Is(err, io.EOF):
+		return fmt.Errorf("%w: the data is truncated", ErrDecryption)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		s.done = true
+	case err != nil:
+		return err
+	default:
+		if _, err := s.r.Peek(1); errors.Is(err, io.EOF) {
+			s.done = true
+		} else if err != nil {
+			return err
+		}
+	}
+	plain, err := s.aead.Open(sealed[:0], segmentNonce(s.noncePrefix, s.n, s.done), sealed[:n], s.aad)
+	if err != nil {
+		return fmt.Errorf("%w: segment %d: %w", ErrDecryption, s.n, err)
+	}
+	s.plain = plain
+	s.n++
+	return nil
+}
+
+func (s *segmentReader) Close() error {
+	return s.closer.Close()
+}
+
+// segmentNonce returns the nonce of segment n.
+func segmentNonce(prefix []byte, n uint32, last bool) []byte {
+	nonce := make([]byte, 0, noncePrefixSize+5)
+	nonce = append(nonce, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, n)
+	if last {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+// segmentAAD returns the additional data authenticated with every segment of object:
+// the length of the key ID, the key ID and the object name.
+func segmentAAD(object, keyID string) []byte {
+	aad := binary.BigEndian.AppendUint32(nil, uint32(len(keyID)))
+	aad = append(aad, keyID...)
+	return append(aad, object...)
+}
+
+// newGCM returns an AES-GCM cipher for the key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// validCustomerKey reports whether key can be used as a customer-supplied key.
+func validCustomerKey(key []byte) error {
+	if len(key) != 32 {
+		return fmt.Errorf("customer-supplied encryption keys must be 32 bytes, got %d", len(key))
+	}
+	return nil
+}
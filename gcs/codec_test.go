@@ -0,0 +1,411 @@
+package gcs
+
+import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testKeyWrapper is a KeyWrapper with in-memory AES-GCM key-encryption keys.
+type testKeyWrapper struct {
+	current string
+	keys    map[string][]byte
+}
+
+func newTestKeyWrapper(t *testing.T, ids ...string) *testKeyWrapper {
+	t.Helper()
+	kw := &testKeyWrapper{current: ids[len(ids)-1], keys: make(map[string][]byte)}
+	for _, id := range ids {
+		key := make([]byte, 32)
+		_, err := rand.Read(key)
+		require.NoError(t, err)
+		kw.keys[id] = key
+	}
+	return kw
+}
+
+func (kw *testKeyWrapper) CurrentKeyID(context.Context) (string, error) {
+	return kw.current, nil
+}
+
+func (kw *testKeyWrapper) WrapKey(_ context.Context, keyID string, dataKey []byte) ([]byte, error) {
+	aead, err := newGCM(kw.keys[keyID])
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, dataKey, nil), nil
+}
+
+func (kw *testKeyWrapper) UnwrapKey(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	key, ok := kw.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", keyID)
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, fmt.Errorf("wrapped key too short")
+	}
+	return aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], nil)
+}
+
+// textData returns n bytes of compressible text.
+func textData(n int) []byte {
+	return bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), n/44+1)[:n]
+}
+
+// readBack reads object through Download, NewReader and ReadAll, checking that they
+// agree, and returns the data.
+func readBack(t *testing.T, client *Client, object string) []byte {
+	t.Helper()
+	ctx := context.Background()
+	var buf bytes.Buffer
+	require.NoError(t, client.Download(ctx, object, &buf))
+
+	r, err := client.NewReader(ctx, object)
+	require.NoError(t, err)
+	streamed, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.True(t, bytes.Equal(buf.Bytes(), streamed), "NewReader and Download differ")
+
+	all, err := client.ReadAll(ctx, object, int64(buf.Len()))
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(buf.Bytes(), all), "ReadAll and Download differ")
+	return buf.Bytes()
+}
+
+func TestUploadCompression(t *testing.T) {
+	ctx := context.Background()
+	data := textData(300 << 10)
+
+	decompress := map[Compression]func(t *testing.T, stored []byte) []byte{
+		Gzip: func(t *testing.T, stored []byte) []byte {
+			gr, err := gzip.NewReader(bytes.NewReader(stored))
+			require.NoError(t, err)
+			out, err := io.ReadAll(gr)
+			require.NoError(t, err)
+			return out
+		},
+		Zstd: func(t *testing.T, stored []byte) []byte {
+			zr, err := zstd.NewReader(bytes.NewReader(stored))
+			require.NoError(t, err)
+			defer zr.Close()
+			out, err := io.ReadAll(zr)
+			require.NoError(t, err)
+			return out
+		},
+	}
+
+	for _, compression := range []Compression{Gzip, Zstd} {
+		t.Run(compression.String(), func(t *testing.T) {
+			client, fake := newTestClient(t)
+			crc := crc32.Checksum(data, crc32cTable)
+
+			attrs, err := client.Upload(ctx, "logs/app", bytes.NewReader(data), UploadOptions{
+				Compression:     compression,
+				CRC32C:          &crc,
+				VerifyChecksums: true,
+				ChunkSize:       256 << 10,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, compression.String(), attrs.ContentEncoding)
+			assert.Equal(t, "text/plain; charset=utf-8", attrs.ContentType)
+			assert.Less(t, attrs.Size, int64(len(data)/10))
+
+			stored := fake.get(testBucket, "logs/app")
+			require.NotNil(t, stored)
+			assert.Empty(t, stored.Metadata, "expected no encoding metadata for unencrypted objects")
+			assert.True(t, bytes.Equal(data, decompress[compression](t, stored.Data)))
+
+			assert.True(t, bytes.Equal(data, readBack(t, client, "logs/app")))
+
+			_, err = client.ReadAll(ctx, "logs/app", int64(len(data)-1))
+			assert.ErrorIs(t, err, ErrTooLarge, "the limit applies to the decompressed data")
+		})
+	}
+
+	t.Run("Checksums describe the uncompressed data", func(t *testing.T) {
+		client, fake := newTestClient(t)
+		wrong := crc32.Checksum(data, crc32cTable) + 1
+		_, err := client.Upload(ctx, "checked", bytes.NewReader(data), UploadOptions{Compression: Gzip, CRC32C: &wrong})
+		assert.ErrorIs(t, err, ErrChecksumMismatch)
+		assert.Nil(t, fake.get(testBucket, "checked"))
+
+		sum := make([]byte, 16)
+		_, err = client.Upload(ctx, "checked", bytes.NewReader(data), UploadOptions{Compression: Zstd, MD5: sum})
+		assert.ErrorIs(t, err, ErrChecksumMismatch)
+		assert.Nil(t, fake.get(testBucket, "checked"))
+	})
+
+	t.Run("VerifyChecksums checks the stored data", func(t *testing.T) {
+		client, fake := newTestClient(t)
+		fake.corruptUploads = true
+		_, err := client.Upload(ctx, "corrupt", bytes.NewReader(data), UploadOptions{Compression: Gzip, VerifyChecksums: true})
+		assert.ErrorIs(t, err, ErrChecksumMismatch)
+		assert.Nil(t, fake.get(testBucket, "corrupt"))
+	})
+
+	t.Run("Read errors abort the upload", func(t *testing.T) {
+		client, fake := newTestClient(t)
+		for _, opts := range []UploadOptions{{Compression: Zstd}, {Compression: Gzip}} {
+			_, err := client.Upload(ctx, "partial", &failingReader{bytes.NewReader(data)}, opts)
+			require.ErrorContains(t, err, "disk on fire")
+			assert.Nil(t, fake.get(testBucket, "partial"))
+		}
+	})
+
+	t.Run("Rejects ContentEncoding", func(t *testing.T) {
+		client, _ := newTestClient(t)
+		_, err := client.Upload(ctx, "both", bytes.NewReader(data), UploadOptions{Compression: Gzip, ContentEncoding: "gzip"})
+		require.Error(t, err)
+		_, err = client.Upload(ctx, "unknown", bytes.NewReader(data), UploadOptions{Compression: Compression(9)})
+		require.Error(t, err)
+	})
+
+	t.Run("Decompresses objects uploaded elsewhere", func(t *testing.T) {
+		client, fake := newTestClient(t)
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		_, _ = gw.Write(data)
+		require.NoError(t, gw.Close())
+		obj := fake.put(testBucket, "pre-encoded.txt.gz", buf.Bytes(), "text/plain")
+		obj.ContentEncoding = "gzip"
+
+		assert.True(t, bytes.Equal(data, readBack(t, client, "pre-encoded.txt.gz")))
+
+		r, err := client.NewRangeReader(ctx, "pre-encoded.txt.gz", 0, 2)
+		require.NoError(t, err)
+		magic, err := io.ReadAll(r)
+		require.NoError(t, r.Close())
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0x1f, 0x8b}, magic, "expected range reads to return the stored data")
+	})
+}
+
+// closeRecorder records that it was closed and returns err.
+type closeRecorder struct {
+	closed bool
+	err    error
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return c.err
+}
+
+func TestEncoderClose(t *testing.T) {
+	failing := &closeRecorder{err: errors.New("flush failed")}
+	last := &closeRecorder{}
+	enc := &encoder{closers: []io.Closer{failing, last}}
+
+	err := enc.Close()
+	assert.ErrorIs(t, err, failing.err)
+	assert.True(t, last.closed, "expected every writer to be closed after a failure")
+}
+
+func TestUploadEncryption(t *testing.T) {
+	ctx := context.Background()
+
+	for _, compression := range []Compression{NoCompression, Gzip, Zstd} {
+		for _, size := range []int{0, 1, segmentSize - 1, segmentSize, 2*segmentSize + 5} {
+			t.Run(fmt.Sprintf("%s %d bytes", cmp.Or(compression.String(), "none"), size), func(t *testing.T) {
+				client, fake := newTestClient(t)
+				client.keyWrapper = newTestKeyWrapper(t, "kek-1")
+				data := testData(size)
+				metadata := map[string]string{"owner": "billing"}
+
+				attrs, err := client.Upload(ctx, "secret.bin", bytes.NewReader(data), UploadOptions{
+					Compression:     compression,
+					Encrypt:         true,
+					Metadata:        metadata,
+					VerifyChecksums: true,
+				})
+				require.NoError(t, err)
+				assert.Empty(t, attrs.ContentEncoding, "expected GCS not to decode encrypted objects")
+				assert.Equal(t, map[string]string{"owner": "billing"}, metadata, "expected the options not to be modified")
+
+				stored := fake.get(testBucket, "secret.bin")
+				require.NotNil(t, stored)
+				assert.Equal(t, "billing", stored.Metadata["owner"])
+				assert.Equal(t, "kek-1", stored.Metadata[metaKeyID])
+				assert.Equal(t, compression.String(), stored.Metadata[metaCompression])
+				if size > 16 {
+					assert.False(t, bytes.Contains(stored.Data, data[:16]), "expected the stored data to be encrypted")
+				}
+
+				assert.True(t, bytes.Equal(data, readBack(t, client, "secret.bin")))
+			})
+		}
+	}
+
+	t.Run("Reads objects encrypted with previous keys", func(t *testing.T) {
+		client, _ := newTestClient(t)
+		kw := newTestKeyWrapper(t, "kek-1", "kek-2")
+		kw.current = "kek-1"
+		client.keyWrapper = kw
+		_, err := client.Upload(ctx, "old", strings.NewReader("rotated"), UploadOptions{Encrypt: true})
+		require.NoError(t, err)
+
+		kw.current = "kek-2"
+		got, err := client.ReadAll(ctx, "old", 100)
+		require.NoError(t, err)
+		assert.Equal(t, "rotated", string(got))
+	})
+
+	t.Run("Requires a KeyWrapper", func(t *testing.T) {
+		client, _ := newTestClient(t)
+		_, err := client.Upload(ctx, "plain", strings.NewReader("data"), UploadOptions{Encrypt: true})
+		require.Error(t, err)
+
+		client.keyWrapper = newTestKeyWrapper(t, "kek-1")
+		_, err = client.Upload(ctx, "secret", strings.NewReader("data"), UploadOptions{Encrypt: true})
+		require.NoError(t, err)
+		client.keyWrapper = nil
+		_, err = client.ReadAll(ctx, "secret", 100)
+		assert.ErrorIs(t, err, ErrDecryption)
+
+		client.keyWrapper = newTestKeyWrapper(t, "other")
+		_, err = client.ReadAll(ctx, "secret", 100)
+		assert.ErrorIs(t, err, ErrDecryption)
+	})
+
+	t.Run("Detects tampering and truncation", func(t *testing.T) {
+		client, fake := newTestClient(t)
+		client.keyWrapper = newTestKeyWrapper(t, "kek-1")
+		data := testData(2*segmentSize + 100)
+		_, err := client.Upload(ctx, "secret", bytes.NewReader(data), UploadOptions{Encrypt: true})
+		require.NoError(t, err)
+		stored := fake.get(testBucket, "secret")
+		original := stored.Data
+
+		for name, tampered := range map[string][]byte{
+			"flipped byte":         append(bytes.Clone(original[:100]), append([]byte{original[100] ^ 1}, original[101:]...)...),
+			"missing last segment": original[:2*(segmentSize+16)],
+			"missing data":         original[:segmentSize],
+			"empty":                nil,
+			"swapped segments":     append(append(bytes.Clone(original[segmentSize+16:2*(segmentSize+16)]), original[:segmentSize+16]...), original[2*(segmentSize+16):]...),
+		} {
+			t.Run(name, func(t *testing.T) {
+				stored.Data = tampered
+				err := client.Download(ctx, "secret", io.Discard)
+				assert.ErrorIs(t, err, ErrDecryption)
+			})
+		}
+	})
+
+	t.Run("Copies and renames do not decrypt", func(t *testing.T) {
+		client, fake := newTestClient(t)
+		client.keyWrapper = newTestKeyWrapper(t, "kek-1")
+		_, err := client.Upload(ctx, "secret", strings.NewReader("bound to its name"), UploadOptions{Encrypt: true})
+		require.NoError(t, err)
+
+		_, err = client.Copy(ctx, ObjectRef{Name: "secret"}, ObjectRef{Name: "copy"}, CopyOptions{})
+		require.NoError(t, err)
+		_, err = client.ReadAll(ctx, "copy", 100)
+		assert.ErrorIs(t, err, ErrDecryption)
+
+		_, err = client.Move(ctx, ObjectRef{Name: "secret"}, ObjectRef{Name: "renamed"}, CopyOptions{})
+		require.NoError(t, err)
+		_, err = client.ReadAll(ctx, "renamed", 100)
+		assert.ErrorIs(t, err, ErrDecryption)
+
+		// Restoring the original name makes the data readable again.
+		stored := fake.get(testBucket, "renamed")
+		fake.put(testBucket, "secret", stored.Data, "")
+		fake.get(testBucket, "secret").Metadata = stored.Metadata
+		got, err := client.ReadAll(ctx, "secret", 100)
+		require.NoError(t, err)
+		assert.Equal(t, "bound to its name", string(got))
+	})
+
+	t.Run("Checksums describe the plaintext", func(t *testing.T) {
+		client, fake := newTestClient(t)
+		client.keyWrapper = newTestKeyWrapper(t, "kek-1")
+		data := testData(1000)
+		crc := crc32.Checksum(data, crc32cTable)
+		_, err := client.Upload(ctx, "checked", bytes.NewReader(data), UploadOptions{Encrypt: true, CRC32C: &crc})
+		require.NoError(t, err)
+
+		crc++
+		_, err = client.Upload(ctx, "mismatch", bytes.NewReader(data), UploadOptions{Encrypt: true, CRC32C: &crc})
+		assert.ErrorIs(t, err, ErrChecksumMismatch)
+		assert.Nil(t, fake.get(testBucket, "mismatch"))
+	})
+}
+
+func TestCustomerSuppliedKeys(t *testing.T) {
+	ctx := context.Background()
+	client, fake := newTestClient(t)
+	key, other := make([]byte, 32), make([]byte, 32)
+	_, _ = rand.Read(key)
+	_, _ = rand.Read(other)
+	data := testData(2 << 20)
+
+	attrs, err := client.Upload(ctx, "csek.bin", bytes.NewReader(data), UploadOptions{CustomerKey: key, Compression: Gzip, ChunkSize: 256 << 10})
+	require.NoError(t, err)
+	sum := sha256.Sum256(key)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(sum[:]), attrs.CustomerKeySHA256)
+	assert.Equal(t, attrs.CustomerKeySHA256, fake.get(testBucket, "csek.bin").CustomerKeySHA256)
+
+	t.Run("Reads need the key", func(t *testing.T) {
+		client.customerKeys = nil
+		require.Error(t, client.Download(ctx, "csek.bin", io.Discard))
+
+		client.customerKeys = [][]byte{other}
+		assert.ErrorIs(t, client.Download(ctx, "csek.bin", io.Discard), ErrDecryption)
+	})
+
+	t.Run("Reads with the matching key", func(t *testing.T) {
+		client.customerKeys = [][]byte{other, key}
+		assert.True(t, bytes.Equal(data, readBack(t, client, "csek.bin")))
+
+		r, err := client.NewRangeReader(ctx, "csek.bin", 0, 2)
+		require.NoError(t, err)
+		magic, err := io.ReadAll(r)
+		require.NoError(t, r.Close())
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0x1f, 0x8b}, magic)
+
+		f, err := os.Create(filepath.Join(t.TempDir(), "csek.bin.gz"))
+		require.NoError(t, err)
+		defer f.Close()
+		_, err = client.ParallelDownload(ctx, "csek.bin", f, ParallelDownloadOptions{PartSize: 1024})
+		require.NoError(t, err)
+	})
+
+	t.Run("Unencrypted objects", func(t *testing.T) {
+		fake.put(testBucket, "plain.txt", []byte("plain"), "text/plain")
+		got, err := client.ReadAll(ctx, "plain.txt", 10)
+		require.NoError(t, err)
+		assert.Equal(t, "plain", string(got))
+	})
+
+	t.Run("Rejects invalid keys", func(t *testing.T) {
+		_, err := client.Upload(ctx, "short", strings.NewReader("data"), UploadOptions{CustomerKey: key[:16]})
+		require.Error(t, err)
+		assert.Nil(t, fake.get(testBucket, "short"))
+	})
+}
@@ -6,6 +6,18 @@
 // interact with GCS. The client is configured for a specific bucket upon
 // creation.
 //
+// Key Features:
+//   - Streaming Upload with content types, metadata, checksums and preconditions.
+//   - Download, streaming and ranged reads, Stat and List.
+//   - Delete, Copy, Move and Compose with preconditions.
+//   - Parallel composite uploads and parallel ranged downloads.
+//   - Transparent gzip/zstd compression, client-side encryption and customer-supplied
+//     encryption keys.
+//   - Directory Sync in either direction, with dry-run reports.
+//   - V4 signed URLs and POST policies.
+//   - A BlobStore interface with in-memory and filesystem implementations.
+//   - Emulator support via STORAGE_EMULATOR_HOST or custom endpoints.
+//
 // Usage:
 //
 //	import (
@@ -38,12 +50,122 @@
 //	    data := strings.NewReader("This is the content of my file.")
 //	    objectName := "path/to/my-object.txt"
 //
-//	    // Upload the data to the configured bucket.
-//	    if err := client.Upload(ctx, objectName, data); err != nil {
+//	    // Upload the data to the configured bucket, unless the object already exists.
+//	    attrs, err := client.Upload(ctx, objectName, data, gcs.UploadOptions{
+//	        ContentType: "text/plain",
+//	        Conditions:  gcs.Conditions{DoesNotExist: true},
+//	    })
+//	    if err != nil {
 //	        log.Fatalf("Failed to upload object: %v", err)
 //	    }
 //
-//	    log.Println("Successfully uploaded object to GCS.")
+//	    log.Printf("Uploaded object to GCS, generation %d.", attrs.Generation)
+//	}
+//
+// Uploading Objects:
+// Upload streams an io.Reader to an object and returns its ObjectAttrs. UploadOptions
+// set the content type, which otherwise is derived from the object name's extension
+// or sniffed from the data, custom metadata, Cache-Control and Content-Encoding.
+// Expected CRC32C and MD5 checksums are checked by GCS, and VerifyChecksums compares
+// the stored object against checksums computed while uploading, deleting it on a
+// mismatch (ErrChecksumMismatch). Conditions prevent overwriting objects, and
+// ChunkSize tunes resumable uploads.
+//
+// Reading Objects:
+// Download streams an object to an io.Writer, NewReader and NewRangeReader open an
+// object, or a byte range of it, for streaming, and ReadAll loads an object into
+// memory, failing with ErrTooLarge above a size limit. Stat returns the object's
+// ObjectAttrs: size, content type, CRC32C, generation and custom metadata.
+//
+// Listing Objects:
+// List returns an iter.Seq2 over the objects matching a ListOptions: a name prefix,
+// a StartOffset/EndOffset name range, and optionally noncurrent versions. With a
+// Delimiter such as "/", the bucket is walked like a directory tree and
+// subdirectories are returned as entries with only ObjectAttrs.Prefix set. ListPage
+// returns one page at a time with a page token for the next one.
+//
+// Managing Objects:
+// Delete, Copy, Move and Compose act on objects server-side. Conditions guard them
+// with generation and metageneration preconditions, e.g. DoesNotExist to never
+// overwrite, or GenerationMatch to only act on the generation that was read. Errors
+// for missing objects wrap ErrNotFound and failed preconditions wrap
+// ErrPreconditionFailed, the matching errors package sentinels.
+//
+// Parallel Transfers:
+// ParallelUpload splits large data into parts, uploads them concurrently as
+// temporary objects, composes them into the object and deletes the parts.
+// ParallelDownload reads byte ranges of one generation concurrently into an
+// io.WriterAt such as an *os.File. Both take a part size and concurrency, log their
+// progress through the configured logger and can report it to a callback:
+//
+//	attrs, err := client.ParallelUpload(ctx, "exports/2024.csv", f, gcs.ParallelUploadOptions{
+//		PartSize:    64 << 20,
+//		Concurrency: 16,
+//		Progress:    func(p gcs.Progress) { fmt.Printf("%d/%d bytes\n", p.Bytes, p.Total) },
+//	})
+//
+// Directory Sync:
+// Sync mirrors a local directory to the objects under a prefix, or with
+// SyncDownload the other way around. It compares files by size and CRC32C,
+// transfers only new and changed ones concurrently, can delete extraneous entries
+// and reports what it did, or with DryRun what it would do:
+//
+//	report, err := client.Sync(ctx, "/tmp/out", "jobs/2024-06-01", gcs.SyncOptions{Delete: true})
+//	fmt.Printf("copied %d, deleted %d, unchanged %d\n", len(report.Copied), len(report.Deleted), report.Unchanged)
+//
+// To guard against a wrong directory or a mistyped prefix, Delete fails with
+// ErrEmptySyncSource when the source is empty, unless AllowEmptySource is set, and
+// an empty prefix covering the whole bucket needs AllowBucketRoot.
+//
+// Compression and Encryption:
+// Upload can compress data with gzip or zstd while streaming it, and encrypt it
+// client-side with AES-256-GCM under a fresh data key per object, wrapped by the
+// Config.KeyWrapper, such as a store.Keyring. The encrypted data is bound to the
+// object name, so copies and renamed objects cannot be decrypted. Alternatively, CustomerKey has GCS
+// encrypt the object with a customer-supplied key. Download, NewReader and ReadAll
+// reverse the encoding based on the object's Content-Encoding and metadata, using
+// the key that matches among Config.CustomerKeys; range reads and ParallelDownload
+// return the data as stored:
+//
+//	client, err := gcs.NewClient(ctx, gcs.Config{BucketName: "backups", KeyWrapper: keyring})
+//	_, err = client.Upload(ctx, "db/2024-06-01.dump", f, gcs.UploadOptions{Compression: gcs.Zstd, Encrypt: true})
+//	err = client.Download(ctx, "db/2024-06-01.dump", w) // decrypted and decompressed
+//
+// Signed URLs and POST Policies:
+// SignedURL returns a V4 signed URL that lets a client without credentials, such as
+// a browser, download or upload an object until it expires. SignedPostPolicy returns
+// the URL and form fields for an HTML form upload, with conditions on the content
+// type, size and metadata. Both are signed by the Config.Signer: a
+// PrivateKeySigner with a service account key, or an IAMSigner that calls the IAM
+// Credentials signBlob API, which works with the keyless metadata server credentials
+// of Cloud Run:
+//
+//	signer, err := gcs.NewIAMSigner(ctx, "") // the default service account
+//	client, err := gcs.NewClient(ctx, gcs.Config{BucketName: "uploads", Signer: signer})
+//	url, err := client.SignedURL(ctx, "avatars/42.png", http.MethodPut, 15*time.Minute,
+//		gcs.SignedURLOptions{ContentType: "image/png"})
+//
+// Connecting:
+// NewClient uses Application Default Credentials unless options say otherwise:
+// WithCredentials supplies credentials, WithEndpoint targets another endpoint,
+// WithHTTPClient sends requests through a custom HTTP client and WithStorageClient
+// injects an existing storage client. If STORAGE_EMULATOR_HOST (EmulatorHostEnv) is
+// set, the client talks to that emulator, such as fake-gcs-server, without
+// credentials:
+//
+//	// STORAGE_EMULATOR_HOST=localhost:4443
+//	client, err := gcs.NewClient(ctx, gcs.Config{BucketName: "test-bucket"})
+//
+// Blob Stores:
+// BlobStore holds the upload, download, list, delete and stat operations of Client,
+// so code that depends on it can run without GCS. MemoryBlobStore keeps objects in
+// memory for tests, and FileBlobStore keeps them as files in a directory for local
+// runs; both assign generations, honour Conditions and return the same errors as
+// Client:
+//
+//	var blobs gcs.BlobStore = client
+//	if os.Getenv("BLOB_DIR") != "" {
+//		blobs, err = gcs.NewFileBlobStore(os.Getenv("BLOB_DIR"))
 //	}
 //
 // This package is thread-safe after initialization.
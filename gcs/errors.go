@@ -0,0 +1,43 @@
+package gcs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	apierrors "github.com/duizendstra/dui-go/errors"
+)
+
+var (
+	// ErrNotFound is wrapped by errors for objects or buckets that do not exist. It is
+	// the errors package's ErrNotFound, so errors.Is works with either.
+	ErrNotFound = apierrors.ErrNotFound
+	// ErrPreconditionFailed is wrapped by errors for operations whose Conditions did
+	// not hold. It is the errors package's ErrPreconditionFailed.
+	ErrPreconditionFailed = apierrors.ErrPreconditionFailed
+)
+
+// mapError wraps ErrNotFound or ErrPreconditionFailed around storage errors that
+// report a missing object or a failed precondition, keeping the original error in
+// the chain. Other errors are returned unchanged.
+func mapError(err error) error {
+	var apiErr *googleapi.Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, storage.ErrObjectNotExist), errors.Is(err, storage.ErrBucketNotExist),
+		errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound,
+		status.Code(err) == codes.NotFound:
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed,
+		status.Code(err) == codes.FailedPrecondition:
+		return fmt.Errorf("%w: %w", ErrPreconditionFailed, err)
+	default:
+		return err
+	}
+}
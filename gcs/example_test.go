@@ -36,7 +36,7 @@ func ExampleNewClient() {
 	fmt.Println("Successfully created GCS client.")
 
 	data := strings.NewReader("file content")
-	if err := client.Upload(ctx, "my-object", data); err != nil {
+	if _, err := client.Upload(ctx, "my-object", data, gcs.UploadOptions{}); err != nil {
 		log.Printf("upload would fail in this test environment: %v", err)
 	}
 
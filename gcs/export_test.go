@@ -0,0 +1,10 @@
+package gcs
+
+import "testing"
+
+// NewFakeClient returns a Client for a bucket on an in-process fake GCS server, for
+// the external tests of this package.
+func NewFakeClient(t *testing.T) *Client {
+	client, _ := newTestClient(t)
+	return client
+}
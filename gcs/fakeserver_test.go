@@ -0,0 +1,729 @@
+package gcs
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// testBucket is the bucket used by tests against the fake server.
+const testBucket = "test-bucket"
+
+// fakeObject is an object generation stored by fakeGCS.
+type fakeObject struct {
+	Bucket          string
+	Name            string
+	Data            []byte
+	ContentType     string
+	ContentEncoding string
+	CacheControl    string
+	Metadata        map[string]string
+	// CustomerKeySHA256 is the hash of the customer-supplied key the object was
+	// uploaded with, which reads must present.
+	CustomerKeySHA256 string
+	Generation        int64
+	Metageneration    int64
+	Created           time.Time
+	Updated           time.Time
+	Deleted           time.Time
+}
+
+// fakeGCS is a minimal in-process implementation of the GCS JSON and XML APIs, enough
+// for the storage client calls the package makes. All objects are kept in memory;
+// overwritten and deleted generations are kept as noncurrent versions.
+type fakeGCS struct {
+	mu       sync.Mutex
+	live     map[string]*fakeObject
+	archived []*fakeObject
+	uploads  map[string]*fakeUpload
+	nextGen  int64
+	server   *httptest.Server
+	requests []string
+	// authorization is the Authorization header of the last request.
+	authorization string
+	// corruptUploads makes the server store altered data for every upload, as if it
+	// were corrupted in transit.
+	corruptUploads bool
+	// failUploads, if set, makes uploads of the objects it returns true for fail.
+	failUploads func(name string) bool
+}
+
+// fakeUpload is an in-progress resumable upload.
+type fakeUpload struct {
+	resource objectJSON
+	query    url.Values
+	data     []byte
+}
+
+// newFakeGCS starts a fake GCS server that is closed when the test ends.
+func newFakeGCS(t testing.TB) *fakeGCS {
+	t.Helper()
+	f := &fakeGCS{
+		live:    make(map[string]*fakeObject),
+		uploads: make(map[string]*fakeUpload),
+		nextGen: 1000,
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// newTestClient starts a fake GCS server and returns a Client for testBucket that
+// talks to it.
+func newTestClient(t testing.TB) (*Client, *fakeGCS) {
+	t.Helper()
+	f := newFakeGCS(t)
+	t.Setenv("STORAGE_EMULATOR_HOST", f.server.URL)
+	gcsClient, err := storage.NewClient(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create storage client: %v", err)
+	}
+	t.Cleanup(func() { _ = gcsClient.Close() })
+	return &Client{
+		gcsClient:  gcsClient,
+		bucketName: testBucket,
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		now:        time.Now,
+	}, f
+}
+
+// put stores an object directly, bypassing the API.
+func (f *fakeGCS) put(bucket, name string, data []byte, contentType string) *fakeObject {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.store(fakeObject{Bucket: bucket, Name: name, Data: data, ContentType: contentType})
+}
+
+// get returns the live generation of an object, or nil.
+func (f *fakeGCS) get(bucket, name string) *fakeObject {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.live[bucket+"/"+name]
+}
+
+// store makes obj the live generation of its name. f.mu must be held.
+func (f *fakeGCS) store(obj fakeObject) *fakeObject {
+	f.nextGen++
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	obj.Generation, obj.Metageneration, obj.Created, obj.Updated = f.nextGen, 1, now, now
+	if obj.ContentType == "" {
+		obj.ContentType = "application/octet-stream"
+	}
+	key := obj.Bucket + "/" + obj.Name
+	if old, ok := f.live[key]; ok {
+		old.Deleted = now
+		f.archived = append(f.archived, old)
+	}
+	f.live[key] = &obj
+	return &obj
+}
+
+// checkPreconditions evaluates the generation preconditions in q against the live
+// object, which may be nil. prefix is "if", or "ifSource" for the source of a rewrite.
+func checkPreconditions(obj *fakeObject, q url.Values, prefix string) bool {
+	param := func(name string) (int64, bool) {
+		v := q.Get(prefix + name)
+		if v == "" {
+			return 0, false
+		}
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n, true
+	}
+	var gen, metagen int64
+	if obj != nil {
+		gen, metagen = obj.Generation, obj.Metageneration
+	}
+	if want, ok := param("GenerationMatch"); ok && want != gen {
+		return false
+	}
+	if want, ok := param("GenerationNotMatch"); ok && want == gen {
+		return false
+	}
+	if want, ok := param("MetagenerationMatch"); ok && (obj == nil || want != metagen) {
+		return false
+	}
+	if want, ok := param("MetagenerationNotMatch"); ok && (obj == nil || want == metagen) {
+		return false
+	}
+	return true
+}
+
+// serveHTTP routes requests by their escaped path, since object names may contain
+// escaped slashes.
+func (f *fakeGCS) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	f.authorization = r.Header.Get("Authorization")
+
+	var segs []string
+	for _, s := range strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/") {
+		u, err := url.PathUnescape(s)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "bad path")
+			return
+		}
+		segs = append(segs, u)
+	}
+
+	switch {
+	case len(segs) >= 5 && segs[0] == "upload" && segs[1] == "storage":
+		// /upload/storage/v1/b/{bucket}/o
+		f.serveUpload(w, r, segs[4])
+	case len(segs) >= 6 && segs[0] == "storage" && segs[4] == "o":
+		// /storage/v1/b/{bucket}/o/{object}[/...]
+		f.serveObject(w, r, segs[3], segs[5], segs[6:])
+	case len(segs) == 5 && segs[0] == "storage" && segs[4] == "o":
+		f.serveBucket(w, r, segs[3])
+	case len(segs) == 2 && segs[0] != "storage":
+		// XML API: /{bucket}/{object}
+		f.serveMedia(w, r, segs[0], segs[1])
+	default:
+		writeError(w, http.StatusNotFound, "unknown path "+r.URL.Path)
+	}
+}
+
+// serveBucket handles requests on the object collection of a bucket.
+func (f *fakeGCS) serveBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusNotImplemented, "not implemented")
+		return
+	}
+	q := r.URL.Query()
+	prefix, delim := q.Get("prefix"), q.Get("delimiter")
+	start, end := q.Get("startOffset"), q.Get("endOffset")
+
+	candidates := slices.Collect(maps.Values(f.live))
+	if q.Get("versions") == "true" {
+		candidates = append(candidates, f.archived...)
+	}
+
+	// Entries are objects or, with a delimiter, prefixes standing for directories.
+	type entry struct {
+		name   string
+		obj    *fakeObject
+		prefix bool
+	}
+	var entries []entry
+	seen := make(map[string]bool)
+	for _, obj := range candidates {
+		name := obj.Name
+		if obj.Bucket != bucket || !strings.HasPrefix(name, prefix) ||
+			(start != "" && name < start) || (end != "" && name >= end) {
+			continue
+		}
+		if delim != "" {
+			if i := strings.Index(name[len(prefix):], delim); i >= 0 {
+				p := name[:len(prefix)+i+len(delim)]
+				if !seen[p] {
+					seen[p] = true
+					entries = append(entries, entry{name: p, prefix: true})
+				}
+				continue
+			}
+		}
+		entries = append(entries, entry{name: name, obj: obj})
+	}
+	slices.SortFunc(entries, func(a, b entry) int {
+		if c := strings.Compare(a.name, b.name); c != 0 || a.obj == nil || b.obj == nil {
+			return c
+		}
+		return cmp.Compare(a.obj.Generation, b.obj.Generation)
+	})
+
+	// Page tokens are offsets into the sorted entries.
+	offset, _ := strconv.Atoi(q.Get("pageToken"))
+	size, err := strconv.Atoi(q.Get("maxResults"))
+	if err != nil || size <= 0 {
+		size = 1000
+	}
+	resp := struct {
+		Kind          string       `json:"kind"`
+		Items         []objectJSON `json:"items,omitempty"`
+		Prefixes      []string     `json:"prefixes,omitempty"`
+		NextPageToken string       `json:"nextPageToken,omitempty"`
+	}{Kind: "storage#objects"}
+	for i := offset; i < len(entries) && i < offset+size; i++ {
+		if entries[i].prefix {
+			resp.Prefixes = append(resp.Prefixes, entries[i].name)
+		} else {
+			resp.Items = append(resp.Items, objectResource(entries[i].obj))
+		}
+	}
+	if offset+size < len(entries) {
+		resp.NextPageToken = strconv.Itoa(offset + size)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// serveObject handles JSON API requests on a single object.
+func (f *fakeGCS) serveObject(w http.ResponseWriter, r *http.Request, bucket, name string, rest []string) {
+	obj := f.live[bucket+"/"+name]
+	if gen := r.URL.Query().Get("generation"); gen != "" {
+		obj = f.generation(bucket, name, gen)
+	}
+	switch {
+	case r.Method == http.MethodGet && len(rest) == 0:
+		if obj == nil {
+			writeError(w, http.StatusNotFound, "No such object: "+bucket+"/"+name)
+			return
+		}
+		if !checkPreconditions(obj, r.URL.Query(), "if") {
+			writeError(w, http.StatusPreconditionFailed, "precondition failed")
+			return
+		}
+		if r.URL.Query().Get("alt") == "media" {
+			f.writeMedia(w, r, obj)
+			return
+		}
+		writeJSON(w, http.StatusOK, objectResource(obj))
+	case r.Method == http.MethodDelete && len(rest) == 0:
+		if obj == nil {
+			writeError(w, http.StatusNotFound, "No such object: "+bucket+"/"+name)
+			return
+		}
+		if !checkPreconditions(obj, r.URL.Query(), "if") {
+			writeError(w, http.StatusPreconditionFailed, "precondition failed")
+			return
+		}
+		if f.live[bucket+"/"+name] == obj {
+			delete(f.live, bucket+"/"+name)
+			obj.Deleted = time.Now().UTC()
+			f.archived = append(f.archived, obj)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && len(rest) == 5 && rest[0] == "rewriteTo":
+		// .../rewriteTo/b/{bucket}/o/{object}
+		f.serveRewrite(w, r, obj, rest[2], rest[4])
+	case r.Method == http.MethodPost && len(rest) == 1 && rest[0] == "compose":
+		f.serveCompose(w, r, bucket, name)
+	default:
+		writeError(w, http.StatusNotImplemented, "not implemented")
+	}
+}
+
+// serveRewrite copies src to the destination in a single rewrite call.
+func (f *fakeGCS) serveRewrite(w http.ResponseWriter, r *http.Request, src *fakeObject, dstBucket, dstName string) {
+	q := r.URL.Query()
+	if gen := q.Get("sourceGeneration"); gen != "" && src != nil {
+		src = f.generation(src.Bucket, src.Name, gen)
+	}
+	if src == nil {
+		writeError(w, http.StatusNotFound, "No such object")
+		return
+	}
+	if !checkPreconditions(src, q, "ifSource") || !checkPreconditions(f.live[dstBucket+"/"+dstName], q, "if") {
+		writeError(w, http.StatusPreconditionFailed, "precondition failed")
+		return
+	}
+	res, err := decodeObjectResource(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	dst := *src
+	dst.Bucket, dst.Name, dst.Deleted = dstBucket, dstName, time.Time{}
+	if res.ContentType != "" {
+		dst.ContentType = res.ContentType
+	}
+	if res.Metadata != nil {
+		dst.Metadata = res.Metadata
+	}
+	stored := f.store(dst)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"kind":                "storage#rewriteResponse",
+		"done":                true,
+		"totalBytesRewritten": strconv.Itoa(len(stored.Data)),
+		"objectSize":          strconv.Itoa(len(stored.Data)),
+		"resource":            objectResource(stored),
+	})
+}
+
+// serveCompose concatenates source objects of the bucket into the destination.
+func (f *fakeGCS) serveCompose(w http.ResponseWriter, r *http.Request, bucket, name string) {
+	var req struct {
+		Destination   objectJSON `json:"destination"`
+		SourceObjects []struct {
+			Name                string `json:"name"`
+			Generation          string `json:"generation"`
+			ObjectPreconditions struct {
+				IfGenerationMatch string `json:"ifGenerationMatch"`
+			} `json:"objectPreconditions"`
+		} `json:"sourceObjects"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(req.SourceObjects) == 0 || len(req.SourceObjects) > 32 {
+		writeError(w, http.StatusBadRequest, "bad number of source objects")
+		return
+	}
+	if !checkPreconditions(f.live[bucket+"/"+name], r.URL.Query(), "if") {
+		writeError(w, http.StatusPreconditionFailed, "precondition failed")
+		return
+	}
+	var data []byte
+	for _, s := range req.SourceObjects {
+		src := f.live[bucket+"/"+s.Name]
+		if s.Generation != "" {
+			src = f.generation(bucket, s.Name, s.Generation)
+		}
+		if src == nil {
+			writeError(w, http.StatusNotFound, "No such object: "+bucket+"/"+s.Name)
+			return
+		}
+		if g := s.ObjectPreconditions.IfGenerationMatch; g != "" && g != strconv.FormatInt(src.Generation, 10) {
+			writeError(w, http.StatusPreconditionFailed, "precondition failed")
+			return
+		}
+		data = append(data, src.Data...)
+	}
+	stored := f.store(fakeObject{
+		Bucket:          bucket,
+		Name:            name,
+		Data:            data,
+		ContentType:     req.Destination.ContentType,
+		ContentEncoding: req.Destination.ContentEncoding,
+		CacheControl:    req.Destination.CacheControl,
+		Metadata:        req.Destination.Metadata,
+	})
+	writeJSON(w, http.StatusOK, objectResource(stored))
+}
+
+// generation returns the live or archived object with the given generation, or nil.
+func (f *fakeGCS) generation(bucket, name, gen string) *fakeObject {
+	n, _ := strconv.ParseInt(gen, 10, 64)
+	if obj := f.live[bucket+"/"+name]; obj != nil && obj.Generation == n {
+		return obj
+	}
+	for _, obj := range f.archived {
+		if obj.Bucket == bucket && obj.Name == name && obj.Generation == n {
+			return obj
+		}
+	}
+	return nil
+}
+
+// serveMedia handles XML API reads.
+func (f *fakeGCS) serveMedia(w http.ResponseWriter, r *http.Request, bucket, name string) {
+	obj := f.live[bucket+"/"+name]
+	if gen := r.URL.Query().Get("generation"); gen != "" {
+		obj = f.generation(bucket, name, gen)
+	}
+	if obj == nil {
+		writeError(w, http.StatusNotFound, "No such object: "+bucket+"/"+name)
+		return
+	}
+	f.writeMedia(w, r, obj)
+}
+
+// writeMedia writes the object content, honouring a Range header.
+func (f *fakeGCS) writeMedia(w http.ResponseWriter, r *http.Request, obj *fakeObject) {
+	if obj.CustomerKeySHA256 != r.Header.Get("X-Goog-Encryption-Key-Sha256") {
+		writeError(w, http.StatusBadRequest, "the customer-supplied encryption key does not match the object")
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", obj.ContentType)
+	if obj.ContentEncoding != "" {
+		h.Set("Content-Encoding", obj.ContentEncoding)
+	}
+	if obj.CacheControl != "" {
+		h.Set("Cache-Control", obj.CacheControl)
+	}
+	h.Set("X-Goog-Generation", strconv.FormatInt(obj.Generation, 10))
+	h.Set("X-Goog-Metageneration", strconv.FormatInt(obj.Metageneration, 10))
+	h.Set("Last-Modified", obj.Updated.Format(http.TimeFormat))
+	for k, v := range obj.Metadata {
+		h.Set("X-Goog-Meta-"+k, v)
+	}
+
+	data := obj.Data
+	size := int64(len(data))
+	rng := r.Header.Get("Range")
+	if rng == "" {
+		crc, md5sum := checksums(data)
+		h.Set("X-Goog-Hash", "crc32c="+crc+",md5="+md5sum)
+		h.Set("Content-Length", strconv.FormatInt(size, 10))
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			_, _ = w.Write(data)
+		}
+		return
+	}
+
+	start, end, ok := parseRange(rng, size)
+	if !ok {
+		h.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		writeError(w, http.StatusRequestedRangeNotSatisfiable, "range not satisfiable")
+		return
+	}
+	h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, size))
+	h.Set("Content-Length", strconv.FormatInt(end-start, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(data[start:end])
+	}
+}
+
+// parseRange parses a single-range "bytes=" header into a half-open interval.
+func parseRange(header string, size int64) (int64, int64, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return 0, 0, false
+	}
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, 0, false
+	}
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		return max(size-n, 0), size, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+	end := size
+	if last != "" {
+		l, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || l < start {
+			return 0, 0, false
+		}
+		end = min(l+1, size)
+	}
+	return start, end, true
+}
+
+// serveUpload handles multipart and resumable media uploads.
+func (f *fakeGCS) serveUpload(w http.ResponseWriter, r *http.Request, bucket string) {
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && q.Get("uploadType") == "multipart":
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "bad content type")
+			return
+		}
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		metaPart, err := mr.NextPart()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "missing metadata part")
+			return
+		}
+		res, err := decodeObjectResource(metaPart)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		mediaPart, err := mr.NextPart()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "missing media part")
+			return
+		}
+		if res.ContentType == "" {
+			res.ContentType = mediaPart.Header.Get("Content-Type")
+		}
+		res.setCustomerKey(r.Header)
+		data, _ := io.ReadAll(mediaPart)
+		f.finishUpload(w, bucket, res, data, q)
+	case r.Method == http.MethodPost && q.Get("uploadType") == "resumable" && q.Get("upload_id") == "":
+		res, err := decodeObjectResource(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if ct := r.Header.Get("X-Upload-Content-Type"); res.ContentType == "" {
+			res.ContentType = ct
+		}
+		res.setCustomerKey(r.Header)
+		id := strconv.Itoa(len(f.uploads) + 1)
+		f.uploads[id] = &fakeUpload{resource: res, query: q}
+		w.Header().Set("Location", f.server.URL+"/upload/storage/v1/b/"+bucket+"/o?uploadType=resumable&upload_id="+id)
+		w.WriteHeader(http.StatusOK)
+	case q.Get("upload_id") != "":
+		// The storage client sends the chunks of a resumable upload with POST or PUT.
+		up, ok := f.uploads[q.Get("upload_id")]
+		if !ok {
+			writeError(w, http.StatusNotFound, "unknown upload")
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		up.data = append(up.data, data...)
+		// Content-Range is "bytes first-last/total", with "*" while the total is unknown.
+		cr := r.Header.Get("Content-Range")
+		if strings.HasSuffix(cr, "/*") {
+			// The client asks for 200 OK with an override header instead of 308.
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(up.data)-1))
+			w.Header().Set("X-Http-Status-Code-Override", "308")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		delete(f.uploads, q.Get("upload_id"))
+		f.finishUpload(w, bucket, up.resource, up.data, up.query)
+	default:
+		writeError(w, http.StatusNotImplemented, "not implemented")
+	}
+}
+
+// finishUpload stores an uploaded object if its preconditions and checksums hold.
+func (f *fakeGCS) finishUpload(w http.ResponseWriter, bucket string, res objectJSON, data []byte, q url.Values) {
+	crc, md5sum := checksums(data)
+	if (res.CRC32C != "" && res.CRC32C != crc) || (res.MD5Hash != "" && res.MD5Hash != md5sum) {
+		writeError(w, http.StatusBadRequest, "provided checksum does not match the data")
+		return
+	}
+	obj := res.object()
+	obj.Bucket, obj.Data = bucket, data
+	if f.corruptUploads && len(obj.Data) > 0 {
+		obj.Data = slices.Clone(obj.Data)
+		obj.Data[0] ^= 0xff
+	}
+	if q.Get("name") != "" {
+		obj.Name = q.Get("name")
+	}
+	if f.failUploads != nil && f.failUploads(obj.Name) {
+		writeError(w, http.StatusForbidden, "upload rejected")
+		return
+	}
+	if !checkPreconditions(f.live[bucket+"/"+obj.Name], q, "if") {
+		writeError(w, http.StatusPreconditionFailed, "precondition failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, objectResource(f.store(obj)))
+}
+
+// objectJSON is the JSON API representation of an object.
+type objectJSON struct {
+	Kind            string            `json:"kind,omitempty"`
+	Bucket          string            `json:"bucket,omitempty"`
+	Name            string            `json:"name,omitempty"`
+	Size            string            `json:"size,omitempty"`
+	ContentType     string            `json:"contentType,omitempty"`
+	ContentEncoding string            `json:"contentEncoding,omitempty"`
+	CacheControl    string            `json:"cacheControl,omitempty"`
+	CRC32C          string            `json:"crc32c,omitempty"`
+	MD5Hash         string            `json:"md5Hash,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	Generation      string            `json:"generation,omitempty"`
+	Metageneration  string            `json:"metageneration,omitempty"`
+	TimeCreated     string            `json:"timeCreated,omitempty"`
+	Updated         string            `json:"updated,omitempty"`
+	TimeDeleted     string            `json:"timeDeleted,omitempty"`
+
+	CustomerEncryption *customerEncryptionJSON `json:"customerEncryption,omitempty"`
+}
+
+// customerEncryptionJSON describes the customer-supplied key of an object.
+type customerEncryptionJSON struct {
+	EncryptionAlgorithm string `json:"encryptionAlgorithm"`
+	KeySHA256           string `json:"keySha256"`
+}
+
+// setCustomerKey records the customer-supplied key of an upload request.
+func (res *objectJSON) setCustomerKey(header http.Header) {
+	if sum := header.Get("X-Goog-Encryption-Key-Sha256"); sum != "" {
+		res.CustomerEncryption = &customerEncryptionJSON{EncryptionAlgorithm: header.Get("X-Goog-Encryption-Algorithm"), KeySHA256: sum}
+	}
+}
+
+// objectResource returns the JSON representation of obj.
+func objectResource(obj *fakeObject) objectJSON {
+	crc, md5sum := checksums(obj.Data)
+	res := objectJSON{
+		Kind:            "storage#object",
+		Bucket:          obj.Bucket,
+		Name:            obj.Name,
+		Size:            strconv.Itoa(len(obj.Data)),
+		ContentType:     obj.ContentType,
+		ContentEncoding: obj.ContentEncoding,
+		CacheControl:    obj.CacheControl,
+		CRC32C:          crc,
+		MD5Hash:         md5sum,
+		Metadata:        obj.Metadata,
+		Generation:      strconv.FormatInt(obj.Generation, 10),
+		Metageneration:  strconv.FormatInt(obj.Metageneration, 10),
+		TimeCreated:     obj.Created.Format(time.RFC3339Nano),
+		Updated:         obj.Updated.Format(time.RFC3339Nano),
+	}
+	if !obj.Deleted.IsZero() {
+		res.TimeDeleted = obj.Deleted.Format(time.RFC3339Nano)
+	}
+	if obj.CustomerKeySHA256 != "" {
+		res.CustomerEncryption = &customerEncryptionJSON{EncryptionAlgorithm: "AES256", KeySHA256: obj.CustomerKeySHA256}
+	}
+	return res
+}
+
+// decodeObjectResource reads the object metadata sent with an upload or rewrite.
+func decodeObjectResource(r io.Reader) (objectJSON, error) {
+	var res objectJSON
+	data, _ := io.ReadAll(r)
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &res); err != nil {
+			return objectJSON{}, fmt.Errorf("bad object resource: %w", err)
+		}
+	}
+	return res, nil
+}
+
+// object returns an object with the metadata of the resource.
+func (res objectJSON) object() fakeObject {
+	obj := fakeObject{
+		Name:            res.Name,
+		ContentType:     res.ContentType,
+		ContentEncoding: res.ContentEncoding,
+		CacheControl:    res.CacheControl,
+		Metadata:        res.Metadata,
+	}
+	if res.CustomerEncryption != nil {
+		obj.CustomerKeySHA256 = res.CustomerEncryption.KeySHA256
+	}
+	return obj
+}
+
+// checksums returns the base64-encoded CRC32C and MD5 of data, as GCS reports them.
+func checksums(data []byte) (string, string) {
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))
+	sum := md5.Sum(data)
+	return base64.StdEncoding.EncodeToString(crc), base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON API error response.
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]any{"error": map[string]any{"code": code, "message": message}})
+}
@@ -0,0 +1,415 @@
+package gcs
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// fileMetaDir is the directory of a FileBlobStore that holds the object attributes
+// and in-progress uploads.
+const fileMetaDir = ".blobmeta"
+
+// FileBlobStore is a BlobStore that keeps objects as files in a local directory, so a
+// service can run locally against a directory instead of a bucket. An object named
+// "reports/2024/q1.csv" is the file reports/2024/q1.csv below the directory, and
+// files placed in the directory by other means are served as objects.
+//
+// The attributes of uploaded objects, such as the content type, metadata and
+// generation, are kept in the .blobmeta subdirectory. Files without attributes, or
+// modified outside the store, get their content type from the file extension, their
+// checksums from the content and their generation from the modification time.
+//
+// Uploads are written to a temporary file and renamed into place, so readers never see
+// partial objects. Names that do not map to a file, such as names with "..", "//" or
+// a trailing "/", and names that are a directory of other objects, are rejected.
+// Conditions are checked atomically among the users of one FileBlobStore, not across
+// processes sharing the directory. Only the live generation of each object is kept.
+//
+// It is safe for concurrent use.
+type FileBlobStore struct {
+	dir     string
+	mu      sync.Mutex
+	lastGen int64
+	now     func() time.Time
+}
+
+// fileMeta holds the attributes of an object in a FileBlobStore that are not derived
+// from its file.
+type fileMeta struct {
+	Name            string            `json:"name"`
+	ContentType     string            `json:"contentType,omitempty"`
+	ContentEncoding string            `json:"contentEncoding,omitempty"`
+	CacheControl    string            `json:"cacheControl,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	CRC32C          uint32            `json:"crc32c"`
+	MD5             []byte            `json:"md5"`
+	Generation      int64             `json:"generation"`
+	Metageneration  int64             `json:"metageneration"`
+	Created         time.Time         `json:"created"`
+	Updated         time.Time         `json:"updated"`
+	// Size and ModTime record the file the attributes describe, so changes made
+	// outside the store are detected.
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// NewFileBlobStore returns a FileBlobStore for the directory dir, which is created if
+// it does not exist.
+func NewFileBlobStore(dir string) (*FileBlobStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("directory cannot be empty")
+	}
+	if err := os.MkdirAll(filepath.Join(dir, fileMetaDir), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create blob store directory '%s': %w", dir, err)
+	}
+	return &FileBlobStore{dir: dir, now: time.Now}, nil
+}
+
+// Upload implements BlobStore.
+func (s *FileBlobStore) Upload(ctx context.Context, object string, r io.Reader, opts UploadOptions) (*ObjectAttrs, error) {
+	p, err := s.path(object)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(s.dir, fileMetaDir), "upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file for object '%s': %w", object, err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	attrs, err := copyUpload(object, r, opts, tmp)
+	if closeErr := tmp.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write object '%s': %w", object, closeErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, err := s.stat(object, p)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if err := checkConditions(object, current, opts.Conditions); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to store object '%s': %w", object, err)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return nil, fmt.Errorf("failed to store object '%s': %w", object, err)
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store object '%s': %w", object, err)
+	}
+
+	now := s.now()
+	s.lastGen = nextGeneration(s.lastGen, now)
+	attrs.Generation = s.lastGen
+	attrs.Created, attrs.Updated = now, now
+	if err := s.writeMeta(&attrs, info); err != nil {
+		return nil, err
+	}
+	return &attrs, nil
+}
+
+// Download implements BlobStore.
+func (s *FileBlobStore) Download(ctx context.Context, object string, w io.Writer) error {
+	f, _, err := s.open(ctx, object)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("failed to download object '%s': %w", object, err)
+	}
+	return nil
+}
+
+// NewRangeReader implements BlobStore.
+func (s *FileBlobStore) NewRangeReader(ctx context.Context, object string, offset, length int64) (io.ReadCloser, error) {
+	f, info, err := s.open(ctx, object)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := byteRange(object, info.Size(), offset, length)
+	if err == nil {
+		_, err = f.Seek(start, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, end-start), f}, nil
+}
+
+// List implements BlobStore. Objects whose attributes have not been stored by the
+// store are read to compute their checksums.
+func (s *FileBlobStore) List(ctx context.Context, opts ListOptions) iter.Seq2[ObjectAttrs, error] {
+	return func(yield func(ObjectAttrs, error) bool) {
+		var names []ObjectAttrs
+		err := filepath.WalkDir(s.dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(s.dir, p)
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if rel == fileMetaDir {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Type().IsRegular() {
+				names = append(names, ObjectAttrs{Name: filepath.ToSlash(rel)})
+			}
+			return nil
+		})
+		if err != nil {
+			yield(ObjectAttrs{}, fmt.Errorf("failed to list objects (prefix=%s): %w", opts.Prefix, err))
+			return
+		}
+
+		// Directory walks order "a/b" before "a-c"; GCS orders by the full name.
+		slices.SortFunc(names, func(a, b ObjectAttrs) int { return strings.Compare(a.Name, b.Name) })
+		for _, entry := range listObjects(names, opts) {
+			if entry.Prefix == "" {
+				attrs, err := s.Stat(ctx, entry.Name)
+				if errors.Is(err, ErrNotFound) {
+					continue // deleted since the walk
+				}
+				if err != nil {
+					yield(ObjectAttrs{}, err)
+					return
+				}
+				entry = *attrs
+			}
+			if !yield(entry, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Delete implements BlobStore. Directories left empty by the deletion are removed.
+func (s *FileBlobStore) Delete(ctx context.Context, object string, conds Conditions) error {
+	p, err := s.path(object)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, err := s.stat(object, p)
+	if err != nil {
+		return fmt.Errorf("failed to delete object '%s': %w", object, err)
+	}
+	if err := checkConditions(object, current, conds); err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil {
+		return fmt.Errorf("failed to delete object '%s': %w", object, err)
+	}
+	if err := os.Remove(s.metaPath(object)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete attributes of object '%s': %w", object, err)
+	}
+	for dir := filepath.Dir(p); dir != filepath.Clean(s.dir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break // not empty
+		}
+	}
+	return nil
+}
+
+// Stat implements BlobStore.
+func (s *FileBlobStore) Stat(ctx context.Context, object string) (*ObjectAttrs, error) {
+	p, err := s.path(object)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.stat(object, p)
+}
+
+// path returns the file of an object, rejecting names that do not map to a file
+// below the directory.
+func (s *FileBlobStore) path(object string) (string, error) {
+	if object == "" {
+		return "", fmt.Errorf("object name cannot be empty")
+	}
+	if path.Clean(object) != object || !filepath.IsLocal(filepath.FromSlash(object)) ||
+		object == fileMetaDir || strings.HasPrefix(object, fileMetaDir+"/") {
+		return "", fmt.Errorf("object name '%s' cannot be stored as a file", object)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(object)), nil
+}
+
+// metaPath returns the file holding the attributes of an object. It is named after
+// the hash of the object name, so names of any length and nesting map to one flat
+// directory.
+func (s *FileBlobStore) metaPath(object string) string {
+	sum := sha256.Sum256([]byte(object))
+	return filepath.Join(s.dir, fileMetaDir, hex.EncodeToString(sum[:])+".json")
+}
+
+// open opens the file of an object for reading.
+func (s *FileBlobStore) open(ctx context.Context, object string) (*os.File, fs.FileInfo, error) {
+	p, err := s.path(object)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read object '%s': %w", object, fileError(err))
+	}
+	info, err := f.Stat()
+	if err == nil && !info.Mode().IsRegular() {
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("failed to read object '%s': %w", object, fileError(err))
+	}
+	return f, info, nil
+}
+
+// stat returns the attributes of the object stored in the file p, from its stored
+// attributes if they still describe the file and from the file otherwise.
+func (s *FileBlobStore) stat(object, p string) (*ObjectAttrs, error) {
+	info, err := os.Stat(p)
+	if err == nil && !info.Mode().IsRegular() {
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attributes of object '%s': %w", object, fileError(err))
+	}
+
+	var meta fileMeta
+	if data, err := os.ReadFile(s.metaPath(object)); err == nil && json.Unmarshal(data, &meta) == nil &&
+		meta.Name == object && meta.Size == info.Size() && meta.ModTime.Equal(info.ModTime()) {
+		return &ObjectAttrs{
+			Name:            object,
+			Size:            meta.Size,
+			ContentType:     meta.ContentType,
+			ContentEncoding: meta.ContentEncoding,
+			CacheControl:    meta.CacheControl,
+			CRC32C:          meta.CRC32C,
+			MD5:             meta.MD5,
+			Generation:      meta.Generation,
+			Metageneration:  meta.Metageneration,
+			Metadata:        meta.Metadata,
+			Created:         meta.Created,
+			Updated:         meta.Updated,
+		}, nil
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attributes of object '%s': %w", object, fileError(err))
+	}
+	defer f.Close()
+	br := bufio.NewReaderSize(f, sniffLen)
+	contentType := detectContentType(object, br)
+	sums := newUploadHashes()
+	if _, err := io.Copy(sums, br); err != nil {
+		return nil, fmt.Errorf("failed to get attributes of object '%s': %w", object, err)
+	}
+	return &ObjectAttrs{
+		Name:           object,
+		Size:           info.Size(),
+		ContentType:    contentType,
+		CRC32C:         sums.crc.Sum32(),
+		MD5:            sums.md5.Sum(nil),
+		Generation:     info.ModTime().UnixMicro(),
+		Metageneration: 1,
+		Created:        info.ModTime(),
+		Updated:        info.ModTime(),
+	}, nil
+}
+
+// writeMeta stores the attributes of an object written to a file with the given info.
+func (s *FileBlobStore) writeMeta(attrs *ObjectAttrs, info fs.FileInfo) error {
+	data, err := json.Marshal(fileMeta{
+		Name:            attrs.Name,
+		ContentType:     attrs.ContentType,
+		ContentEncoding: attrs.ContentEncoding,
+		CacheControl:    attrs.CacheControl,
+		Metadata:        attrs.Metadata,
+		CRC32C:          attrs.CRC32C,
+		MD5:             attrs.MD5,
+		Generation:      attrs.Generation,
+		Metageneration:  attrs.Metageneration,
+		Created:         attrs.Created,
+		Updated:         attrs.Updated,
+		Size:            info.Size(),
+		ModTime:         info.ModTime(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode attributes of object '%s': %w", attrs.Name, err)
+	}
+
+	metaPath := s.metaPath(attrs.Name)
+	tmp, err := os.CreateTemp(filepath.Dir(metaPath), "meta-*")
+	if err != nil {
+		return fmt.Errorf("failed to store attributes of object '%s': %w", attrs.Name, err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), metaPath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store attributes of object '%s': %w", attrs.Name, err)
+	}
+	return nil
+}
+
+// fileError wraps ErrNotFound around errors for files that do not exist, including
+// paths through a file, which are names below another object.
+func fileError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return err
+}
@@ -0,0 +1,149 @@
+package gcs
+
+import (
+	"context"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileBlobStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Stores objects as files", func(t *testing.T) {
+		dir := t.TempDir()
+		store, err := NewFileBlobStore(dir)
+		require.NoError(t, err)
+
+		_, err = store.Upload(ctx, "reports/q1.csv", strings.NewReader("a,b\n"), UploadOptions{Metadata: map[string]string{"k": "v"}})
+		require.NoError(t, err)
+		data, err := os.ReadFile(filepath.Join(dir, "reports", "q1.csv"))
+		require.NoError(t, err)
+		assert.Equal(t, "a,b\n", string(data))
+
+		reopened, err := NewFileBlobStore(dir)
+		require.NoError(t, err)
+		attrs, err := reopened.Stat(ctx, "reports/q1.csv")
+		require.NoError(t, err)
+		assert.Equal(t, "text/csv; charset=utf-8", attrs.ContentType)
+		assert.Equal(t, map[string]string{"k": "v"}, attrs.Metadata, "expected attributes to persist")
+	})
+
+	t.Run("Serves files written by other means", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "static"), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "static", "app.json"), []byte(`{"a":1}`), 0o644))
+		store, err := NewFileBlobStore(dir)
+		require.NoError(t, err)
+
+		attrs, err := store.Stat(ctx, "static/app.json")
+		require.NoError(t, err)
+		assert.Equal(t, int64(7), attrs.Size)
+		assert.Equal(t, "application/json", attrs.ContentType)
+		assert.Equal(t, crc32.Checksum([]byte(`{"a":1}`), crc32cTable), attrs.CRC32C)
+		assert.NotZero(t, attrs.Generation)
+	})
+
+	t.Run("Detects changes made outside the store", func(t *testing.T) {
+		dir := t.TempDir()
+		store, err := NewFileBlobStore(dir)
+		require.NoError(t, err)
+		uploaded, err := store.Upload(ctx, "notes", strings.NewReader("old"), UploadOptions{ContentType: "text/plain"})
+		require.NoError(t, err)
+
+		p := filepath.Join(dir, "notes")
+		require.NoError(t, os.WriteFile(p, []byte("changed"), 0o644))
+		later := time.Now().Add(time.Hour)
+		require.NoError(t, os.Chtimes(p, later, later))
+
+		attrs, err := store.Stat(ctx, "notes")
+		require.NoError(t, err)
+		assert.Equal(t, int64(7), attrs.Size)
+		assert.Equal(t, crc32.Checksum([]byte("changed"), crc32cTable), attrs.CRC32C)
+		assert.NotEqual(t, uploaded.Generation, attrs.Generation)
+	})
+
+	t.Run("Rejects names that are not files", func(t *testing.T) {
+		store, err := NewFileBlobStore(t.TempDir())
+		require.NoError(t, err)
+		for _, name := range []string{"../escape", "/abs", "a//b", "dir/", "./a", ".blobmeta/x"} {
+			_, err := store.Upload(ctx, name, strings.NewReader("x"), UploadOptions{})
+			assert.Error(t, err, name)
+		}
+
+		_, err = store.Upload(ctx, "dir/file", strings.NewReader("x"), UploadOptions{})
+		require.NoError(t, err)
+		_, err = store.Upload(ctx, "dir", strings.NewReader("x"), UploadOptions{})
+		assert.Error(t, err, "expected a name that is a directory of other objects to fail")
+		_, err = store.Stat(ctx, "dir")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = store.Stat(ctx, "dir/file/below")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("Removes emptied directories", func(t *testing.T) {
+		dir := t.TempDir()
+		store, err := NewFileBlobStore(dir)
+		require.NoError(t, err)
+		_, err = store.Upload(ctx, "a/b/c", strings.NewReader("x"), UploadOptions{})
+		require.NoError(t, err)
+		require.NoError(t, store.Delete(ctx, "a/b/c", Conditions{}))
+
+		_, err = os.Stat(filepath.Join(dir, "a"))
+		assert.True(t, os.IsNotExist(err), "expected empty directories to be removed")
+		_, err = os.Stat(dir)
+		assert.NoError(t, err, "expected the store directory to remain")
+	})
+}
+
+func TestMemoryBlobStore_IsolatesAttributes(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryBlobStore()
+	fixed := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return fixed }
+
+	meta := map[string]string{"k": "v"}
+	attrs, err := store.Upload(ctx, "obj", strings.NewReader("x"), UploadOptions{Metadata: meta})
+	require.NoError(t, err)
+	assert.Equal(t, fixed, attrs.Created)
+	assert.Equal(t, fixed.UnixMicro(), attrs.Generation)
+
+	meta["k"] = "changed"
+	attrs.Metadata["k"] = "changed"
+	stat, err := store.Stat(ctx, "obj")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"k": "v"}, stat.Metadata)
+
+	second, err := store.Upload(ctx, "obj", strings.NewReader("y"), UploadOptions{})
+	require.NoError(t, err)
+	assert.Greater(t, second.Generation, attrs.Generation, "expected generations to increase with a frozen clock")
+}
+
+func TestLocalBlobStores_CodecOptions(t *testing.T) {
+	ctx := context.Background()
+	fileStore, err := NewFileBlobStore(t.TempDir())
+	require.NoError(t, err)
+	for name, store := range map[string]BlobStore{"Memory": NewMemoryBlobStore(), "File": fileStore} {
+		t.Run(name, func(t *testing.T) {
+			attrs, err := store.Upload(ctx, "compressed", strings.NewReader("plain"), UploadOptions{Compression: Gzip})
+			require.NoError(t, err)
+			assert.Empty(t, attrs.ContentEncoding)
+			var buf strings.Builder
+			require.NoError(t, store.Download(ctx, "compressed", &buf))
+			assert.Equal(t, "plain", buf.String())
+
+			_, err = store.Upload(ctx, "encrypted", strings.NewReader("secret"), UploadOptions{Encrypt: true})
+			require.Error(t, err)
+			_, err = store.Upload(ctx, "csek", strings.NewReader("secret"), UploadOptions{CustomerKey: make([]byte, 32)})
+			require.Error(t, err)
+			_, err = store.Stat(ctx, "encrypted")
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"os"
+	"time"
 
 	"cloud.google.com/go/storage"
 )
@@ -14,19 +16,35 @@ type Config struct {
 	BucketName string
 	// Logger is an optional structured logger. If nil, logging is disabled.
 	Logger *slog.Logger
+	// Signer signs the URLs and policies of SignedURL and SignedPostPolicy. It is
+	// optional if the client does not sign.
+	Signer Signer
+	// KeyWrapper wraps the data keys of uploads with UploadOptions.Encrypt and
+	// unwraps them when reading. It is optional if the client does not encrypt.
+	KeyWrapper KeyWrapper
+	// CustomerKeys are the customer-supplied encryption keys (CSEK) that reads try,
+	// matched by their SHA-256 hash, for objects uploaded with
+	// UploadOptions.CustomerKey.
+	CustomerKeys [][]byte
 }
 
 // Client provides a simplified interface for Google Cloud Storage.
 // It is configured to work with a specific bucket upon creation.
 type Client struct {
-	gcsClient  *storage.Client
-	bucketName string
-	logger     *slog.Logger
+	gcsClient    *storage.Client
+	bucketName   string
+	logger       *slog.Logger
+	signer       Signer
+	keyWrapper   KeyWrapper
+	customerKeys [][]byte
+	now          func() time.Time
 }
 
 // NewClient creates a new, authenticated client for GCS using the provided
-// configuration, preparing it to work with the specified bucket.
-func NewClient(ctx context.Context, cfg Config) (*Client, error) {
+// configuration, preparing it to work with the specified bucket. By default it uses
+// Application Default Credentials, or the emulator at EmulatorHostEnv if that is set;
+// opts can inject a storage client, endpoint, HTTP client or credentials.
+func NewClient(ctx context.Context, cfg Config, opts ...Option) (*Client, error) {
 	if cfg.BucketName == "" {
 		return nil, fmt.Errorf("GCS BucketName is required in the config")
 	}
@@ -36,48 +54,30 @@ func NewClient(ctx context.Context, cfg Config) (*Client, error) {
 		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
 	}
 
-	gcsClient, err := storage.NewClient(ctx)
+	o := applyOptions(opts)
+	gcsClient, err := newStorageClient(ctx, o)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create underlying storage.Client: %w", err)
+		return nil, err
 	}
 
-	logger.InfoContext(ctx, "Initialized Google Cloud Storage client", "bucket", cfg.BucketName)
+	if host := os.Getenv(EmulatorHostEnv); host != "" && o.client == nil {
+		logger.InfoContext(ctx, "Initialized Google Cloud Storage client", "bucket", cfg.BucketName, "emulator", host)
+	} else {
+		logger.InfoContext(ctx, "Initialized Google Cloud Storage client", "bucket", cfg.BucketName)
+	}
 	return &Client{
-		gcsClient:  gcsClient,
-		bucketName: cfg.BucketName,
-		logger:     logger,
+		gcsClient:    gcsClient,
+		bucketName:   cfg.BucketName,
+		logger:       logger,
+		signer:       cfg.Signer,
+		keyWrapper:   cfg.KeyWrapper,
+		customerKeys: cfg.CustomerKeys,
+		now:          time.Now,
 	}, nil
 }
 
-// Upload streams data from an io.Reader to a new object in the configured GCS bucket.
-// It is the caller's responsibility to handle the closing of the reader.
-func (c *Client) Upload(ctx context.Context, object string, r io.Reader) (err error) {
-	if object == "" {
-		return fmt.Errorf("object name cannot be empty")
-	}
-
-	c.logger.DebugContext(ctx, "Uploading object to GCS", "object", object, "bucket", c.bucketName)
-
-	writer := c.gcsClient.Bucket(c.bucketName).Object(object).NewWriter(ctx)
-
-	defer func() {
-		if closeErr := writer.Close(); closeErr != nil {
-			if err == nil {
-				err = fmt.Errorf("failed to close GCS writer for object '%s': %w", object, closeErr)
-			}
-		}
-	}()
-
-	if _, copyErr := io.Copy(writer, r); copyErr != nil {
-		return fmt.Errorf("failed to copy data to GCS object '%s': %w", object, copyErr)
-	}
-
-	c.logger.DebugContext(ctx, "Successfully uploaded object", "object", object, "bucket", c.bucketName)
-	return nil
-}
-
 // Close releases any resources held by the client. It should be called when
 // the client is no longer needed.
 func (c *Client) Close() error {
 	return c.gcsClient.Close()
-}
\ No newline at end of file
+}
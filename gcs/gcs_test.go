@@ -46,7 +46,7 @@ func TestUpload_Validation(t *testing.T) {
 	dummyReader := strings.NewReader("some data")
 
 	t.Run("Fails with empty object name", func(t *testing.T) {
-		err := client.Upload(ctx, "", dummyReader)
+		_, err := client.Upload(ctx, "", dummyReader, UploadOptions{})
 		require.Error(t, err, "Expected a validation error but got nil")
 		assert.Equal(t, "object name cannot be empty", err.Error())
 	})
@@ -0,0 +1,143 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+)
+
+// testCredentials returns credentials with a static access token.
+func testCredentials() *google.Credentials {
+	return &google.Credentials{TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test-token"})}
+}
+
+// TestIntegration connects NewClient to the fake GCS server in every supported way and
+// runs the same object workflow through it.
+func TestIntegration(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		connect func(t *testing.T, f *fakeGCS) []Option
+		// authorization is the expected Authorization header of requests.
+		authorization string
+	}{
+		{
+			name: "Emulator host",
+			connect: func(t *testing.T, f *fakeGCS) []Option {
+				t.Setenv(EmulatorHostEnv, f.server.URL)
+				return []Option{WithCredentials(testCredentials())} // ignored for the emulator
+			},
+		},
+		{
+			name: "Emulator host without scheme",
+			connect: func(t *testing.T, f *fakeGCS) []Option {
+				t.Setenv(EmulatorHostEnv, strings.TrimPrefix(f.server.URL, "http://"))
+				return nil
+			},
+		},
+		{
+			name: "Endpoint and HTTP client",
+			connect: func(t *testing.T, f *fakeGCS) []Option {
+				t.Setenv(EmulatorHostEnv, "")
+				return []Option{WithEndpoint(f.server.URL + "/storage/v1/"), WithHTTPClient(f.server.Client())}
+			},
+		},
+		{
+			name: "Endpoint and credentials",
+			connect: func(t *testing.T, f *fakeGCS) []Option {
+				t.Setenv(EmulatorHostEnv, "")
+				return []Option{WithEndpoint(f.server.URL + "/storage/v1/"), WithCredentials(testCredentials())}
+			},
+			authorization: "Bearer test-token",
+		},
+		{
+			name: "Storage client",
+			connect: func(t *testing.T, f *fakeGCS) []Option {
+				t.Setenv(EmulatorHostEnv, "")
+				gcsClient, err := storage.NewClient(ctx, option.WithEndpoint(f.server.URL+"/storage/v1/"), option.WithoutAuthentication())
+				require.NoError(t, err)
+				return []Option{WithStorageClient(gcsClient), WithEndpoint("http://unused.invalid/")}
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := newFakeGCS(t)
+			client, err := NewClient(ctx, Config{BucketName: testBucket}, tc.connect(t, fake)...)
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = client.Close() })
+
+			runObjectWorkflow(t, client)
+
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			assert.NotEmpty(t, fake.requests, "expected the requests to reach the fake server")
+			assert.Equal(t, tc.authorization, fake.authorization)
+		})
+	}
+}
+
+// runObjectWorkflow uploads, reads, lists, copies, composes, moves and deletes objects
+// through client.
+func runObjectWorkflow(t *testing.T, client *Client) {
+	t.Helper()
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("integration "), 50*1024) // 600 KiB, uploaded in chunks
+
+	uploaded, err := client.Upload(ctx, "logs/app.log", bytes.NewReader(data), UploadOptions{ChunkSize: 256 * 1024, VerifyChecksums: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), uploaded.Size)
+
+	attrs, err := client.Stat(ctx, "logs/app.log")
+	require.NoError(t, err)
+	assert.Equal(t, uploaded.Generation, attrs.Generation)
+
+	var buf bytes.Buffer
+	require.NoError(t, client.Download(ctx, "logs/app.log", &buf))
+	assert.True(t, bytes.Equal(data, buf.Bytes()))
+
+	r, err := client.NewRangeReader(ctx, "logs/app.log", 12, 11)
+	require.NoError(t, err)
+	part, err := io.ReadAll(r)
+	require.NoError(t, r.Close())
+	require.NoError(t, err)
+	assert.Equal(t, "integration", string(part))
+
+	_, err = client.Upload(ctx, "parts/1", strings.NewReader("hello, "), UploadOptions{})
+	require.NoError(t, err)
+	_, err = client.Upload(ctx, "parts/2", strings.NewReader("world"), UploadOptions{})
+	require.NoError(t, err)
+	composed, err := client.Compose(ctx, "greeting.txt", []string{"parts/1", "parts/2"}, ComposeOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), composed.Size)
+
+	_, err = client.Copy(ctx, ObjectRef{Name: "greeting.txt"}, ObjectRef{Name: "copies/greeting.txt"}, CopyOptions{})
+	require.NoError(t, err)
+	_, err = client.Move(ctx, ObjectRef{Name: "copies/greeting.txt"}, ObjectRef{Name: "archive/greeting.txt"}, CopyOptions{})
+	require.NoError(t, err)
+
+	var names []string
+	for attrs, err := range client.List(ctx, ListOptions{Delimiter: "/"}) {
+		require.NoError(t, err)
+		names = append(names, attrs.Name+attrs.Prefix)
+	}
+	assert.Equal(t, []string{"greeting.txt", "archive/", "logs/", "parts/"}, names)
+
+	got, err := client.ReadAll(ctx, "archive/greeting.txt", 100)
+	require.NoError(t, err)
+	assert.Equal(t, "hello, world", string(got))
+
+	require.NoError(t, client.Delete(ctx, "archive/greeting.txt", Conditions{}))
+	_, err = client.Stat(ctx, "archive/greeting.txt")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
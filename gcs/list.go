@@ -0,0 +1,135 @@
+package gcs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// DefaultPageSize is the number of entries ListPage returns when ListOptions.PageSize
+// is zero. It is also the largest page size GCS allows.
+const DefaultPageSize = 1000
+
+// ListOptions configures a List or ListPage call.
+type ListOptions struct {
+	// Prefix restricts the results to objects whose names start with Prefix.
+	Prefix string
+	// Delimiter, typically "/", lists the bucket like a directory tree: objects whose
+	// names contain Delimiter after Prefix are not returned. Instead, their names up
+	// to and including the first Delimiter after Prefix are returned once, as entries
+	// with only ObjectAttrs.Prefix set.
+	Delimiter string
+	// StartOffset restricts the results to objects whose names are equal to or after
+	// StartOffset in lexicographic order.
+	StartOffset string
+	// EndOffset restricts the results to objects whose names are before EndOffset in
+	// lexicographic order.
+	EndOffset string
+	// Versions includes noncurrent object generations in the results, each with its
+	// own Generation, in a bucket with object versioning enabled.
+	Versions bool
+	// PageSize is the maximum number of entries per page. Zero means DefaultPageSize.
+	PageSize int
+	// PageToken resumes a listing after the page that returned it. It must be passed
+	// together with the same other options.
+	PageToken string
+}
+
+// ListPage is a single page of entries returned by Client.ListPage.
+type ListPage struct {
+	// Objects holds the objects of this page ordered by name, followed by the
+	// prefixes of this page when listing with a Delimiter.
+	Objects []ObjectAttrs
+	// NextPageToken is empty when there are no more entries.
+	NextPageToken string
+}
+
+// List iterates over the objects in the configured bucket that match the options,
+// ordered by name, fetching pages as needed. When listing with a Delimiter, prefixes
+// are yielded as entries with only ObjectAttrs.Prefix set; as in the GCS API, the
+// prefixes of each page follow its objects. Iteration stops at the first error, which
+// is yielded with empty attributes.
+//
+//	for attrs, err := range client.List(ctx, gcs.ListOptions{Prefix: "exports/", Delimiter: "/"}) {
+//		if err != nil {
+//			return err
+//		}
+//		if attrs.Prefix != "" {
+//			fmt.Println("directory", attrs.Prefix)
+//			continue
+//		}
+//		fmt.Println("object", attrs.Name, attrs.Size)
+//	}
+func (c *Client) List(ctx context.Context, opts ListOptions) iter.Seq2[ObjectAttrs, error] {
+	return func(yield func(ObjectAttrs, error) bool) {
+		c.logger.DebugContext(ctx, "Listing GCS objects", "bucket", c.bucketName, "prefix", opts.Prefix, "delimiter", opts.Delimiter)
+
+		it := c.objects(ctx, opts)
+		count := 0
+		for {
+			attrs, err := it.Next()
+			if errors.Is(err, iterator.Done) {
+				break
+			}
+			if err != nil {
+				yield(ObjectAttrs{}, fmt.Errorf("failed to list GCS objects (prefix=%s): %w", opts.Prefix, err))
+				return
+			}
+			count++
+			if !yield(*objectAttrsFrom(attrs), nil) {
+				return
+			}
+		}
+
+		c.logger.DebugContext(ctx, "Successfully listed objects", "bucket", c.bucketName, "prefix", opts.Prefix, "count", count)
+	}
+}
+
+// ListPage returns one page of the objects in the configured bucket that match the
+// options, like List. Pass its NextPageToken as ListOptions.PageToken to get the next
+// page.
+func (c *Client) ListPage(ctx context.Context, opts ListOptions) (ListPage, error) {
+	if opts.PageSize < 0 {
+		return ListPage{}, fmt.Errorf("page size cannot be negative")
+	}
+	pageSize := opts.PageSize
+	if pageSize == 0 {
+		pageSize = DefaultPageSize
+	}
+
+	c.logger.DebugContext(ctx, "Listing GCS objects", "bucket", c.bucketName, "prefix", opts.Prefix, "delimiter", opts.Delimiter, "page_size", pageSize)
+
+	var objects []*storage.ObjectAttrs
+	token, err := iterator.NewPager(c.objects(ctx, opts), pageSize, opts.PageToken).NextPage(&objects)
+	if err != nil {
+		return ListPage{}, fmt.Errorf("failed to list GCS objects (prefix=%s): %w", opts.Prefix, err)
+	}
+
+	page := ListPage{Objects: make([]ObjectAttrs, 0, len(objects)), NextPageToken: token}
+	for _, attrs := range objects {
+		page.Objects = append(page.Objects, *objectAttrsFrom(attrs))
+	}
+
+	c.logger.DebugContext(ctx, "Successfully listed objects", "bucket", c.bucketName, "prefix", opts.Prefix, "count", len(page.Objects))
+	return page, nil
+}
+
+// objects returns a storage iterator for the options, starting at opts.PageToken.
+func (c *Client) objects(ctx context.Context, opts ListOptions) *storage.ObjectIterator {
+	it := c.gcsClient.Bucket(c.bucketName).Objects(ctx, &storage.Query{
+		Prefix:      opts.Prefix,
+		Delimiter:   opts.Delimiter,
+		StartOffset: opts.StartOffset,
+		EndOffset:   opts.EndOffset,
+		Versions:    opts.Versions,
+	})
+	it.PageInfo().Token = opts.PageToken
+	if opts.PageSize > 0 {
+		it.PageInfo().MaxSize = opts.PageSize
+	}
+	return it
+}
@@ -0,0 +1,113 @@
+package gcs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// names returns the names, or prefixes for directory entries, of the listed objects.
+func names(objects []ObjectAttrs) []string {
+	var result []string
+	for _, attrs := range objects {
+		if attrs.Prefix != "" {
+			result = append(result, attrs.Prefix)
+			continue
+		}
+		result = append(result, attrs.Name)
+	}
+	return result
+}
+
+// collect drains a List iterator.
+func collect(t *testing.T, client *Client, opts ListOptions) []ObjectAttrs {
+	t.Helper()
+	var objects []ObjectAttrs
+	for attrs, err := range client.List(context.Background(), opts) {
+		require.NoError(t, err)
+		objects = append(objects, attrs)
+	}
+	return objects
+}
+
+func TestList(t *testing.T) {
+	client, fake := newTestClient(t)
+	for _, name := range []string{"a.txt", "exports/2024/jan.csv", "exports/2024/feb.csv", "exports/2025/jan.csv", "exports/readme.md", "z.txt"} {
+		fake.put(testBucket, name, []byte(name), "")
+	}
+	fake.put("other-bucket", "exports/hidden.csv", nil, "")
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		want []string
+	}{
+		{"All objects", ListOptions{}, []string{"a.txt", "exports/2024/feb.csv", "exports/2024/jan.csv", "exports/2025/jan.csv", "exports/readme.md", "z.txt"}},
+		{"Prefix", ListOptions{Prefix: "exports/2024/"}, []string{"exports/2024/feb.csv", "exports/2024/jan.csv"}},
+		{"Top-level directory", ListOptions{Delimiter: "/"}, []string{"a.txt", "z.txt", "exports/"}},
+		{"Subdirectory", ListOptions{Prefix: "exports/", Delimiter: "/"}, []string{"exports/readme.md", "exports/2024/", "exports/2025/"}},
+		{"Offsets", ListOptions{StartOffset: "exports/2025", EndOffset: "z"}, []string{"exports/2025/jan.csv", "exports/readme.md"}},
+		{"Small pages", ListOptions{Prefix: "exports/", PageSize: 1}, []string{"exports/2024/feb.csv", "exports/2024/jan.csv", "exports/2025/jan.csv", "exports/readme.md"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, names(collect(t, client, tt.opts)))
+		})
+	}
+
+	t.Run("Attributes", func(t *testing.T) {
+		objects := collect(t, client, ListOptions{Prefix: "a.txt"})
+		require.Len(t, objects, 1)
+		assert.Equal(t, testBucket, objects[0].Bucket)
+		assert.Equal(t, int64(len("a.txt")), objects[0].Size)
+		assert.NotZero(t, objects[0].Generation)
+	})
+
+	t.Run("Versions", func(t *testing.T) {
+		fake.put(testBucket, "a.txt", []byte("v2"), "")
+		objects := collect(t, client, ListOptions{Prefix: "a.txt", Versions: true})
+		require.Len(t, objects, 2)
+		assert.Less(t, objects[0].Generation, objects[1].Generation)
+		assert.False(t, objects[0].Deleted.IsZero(), "expected the old generation to be noncurrent")
+		assert.True(t, objects[1].Deleted.IsZero())
+	})
+
+	t.Run("Stopping early", func(t *testing.T) {
+		count := 0
+		for range client.List(context.Background(), ListOptions{}) {
+			count++
+			break
+		}
+		assert.Equal(t, 1, count)
+	})
+}
+
+func TestListPage(t *testing.T) {
+	client, fake := newTestClient(t)
+	ctx := context.Background()
+	for _, name := range []string{"p/1", "p/2", "p/3", "p/4", "p/5"} {
+		fake.put(testBucket, name, nil, "")
+	}
+
+	var got []string
+	opts := ListOptions{Prefix: "p/", PageSize: 2}
+	pages := 0
+	for {
+		page, err := client.ListPage(ctx, opts)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(page.Objects), 2)
+		got = append(got, names(page.Objects)...)
+		pages++
+		if page.NextPageToken == "" {
+			break
+		}
+		opts.PageToken = page.NextPageToken
+	}
+	assert.Equal(t, []string{"p/1", "p/2", "p/3", "p/4", "p/5"}, got)
+	assert.Equal(t, 3, pages)
+
+	_, err := client.ListPage(ctx, ListOptions{PageSize: -1})
+	require.Error(t, err)
+}
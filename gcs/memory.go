@@ -0,0 +1,164 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryBlobStore is a BlobStore that keeps objects in memory. It suits tests and
+// local runs of code that uses a Client. Every upload assigns the object a new
+// generation, so Conditions behave like they do on GCS, but only the live generation
+// of each object is kept.
+//
+// It is safe for concurrent use.
+type MemoryBlobStore struct {
+	mu      sync.RWMutex
+	objects map[string]*memoryObject
+	lastGen int64
+	now     func() time.Time
+}
+
+// memoryObject is an object held by a MemoryBlobStore.
+type memoryObject struct {
+	attrs ObjectAttrs
+	data  []byte
+}
+
+// NewMemoryBlobStore returns an empty MemoryBlobStore.
+func NewMemoryBlobStore() *MemoryBlobStore {
+	return &MemoryBlobStore{
+		objects: make(map[string]*memoryObject),
+		now:     time.Now,
+	}
+}
+
+// Upload implements BlobStore. The object is stored only once r is fully read, so a
+// failed upload leaves any previous generation in place.
+func (s *MemoryBlobStore) Upload(ctx context.Context, object string, r io.Reader, opts UploadOptions) (*ObjectAttrs, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	attrs, err := copyUpload(object, r, opts, &buf)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var current *ObjectAttrs
+	if obj, ok := s.objects[object]; ok {
+		current = &obj.attrs
+	}
+	if err := checkConditions(object, current, opts.Conditions); err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	s.lastGen = nextGeneration(s.lastGen, now)
+	attrs.Generation = s.lastGen
+	attrs.Created, attrs.Updated = now, now
+	s.objects[object] = &memoryObject{attrs: attrs, data: buf.Bytes()}
+	return cloneAttrs(attrs), nil
+}
+
+// Download implements BlobStore.
+func (s *MemoryBlobStore) Download(ctx context.Context, object string, w io.Writer) error {
+	obj, err := s.get(ctx, object)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(obj.data); err != nil {
+		return fmt.Errorf("failed to download object '%s': %w", object, err)
+	}
+	return nil
+}
+
+// NewRangeReader implements BlobStore.
+func (s *MemoryBlobStore) NewRangeReader(ctx context.Context, object string, offset, length int64) (io.ReadCloser, error) {
+	obj, err := s.get(ctx, object)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := byteRange(object, int64(len(obj.data)), offset, length)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(obj.data[start:end])), nil
+}
+
+// List implements BlobStore. It lists a snapshot of the objects taken when iteration
+// starts.
+func (s *MemoryBlobStore) List(ctx context.Context, opts ListOptions) iter.Seq2[ObjectAttrs, error] {
+	return func(yield func(ObjectAttrs, error) bool) {
+		if err := ctx.Err(); err != nil {
+			yield(ObjectAttrs{}, err)
+			return
+		}
+
+		s.mu.RLock()
+		all := make([]ObjectAttrs, 0, len(s.objects))
+		for _, name := range slices.Sorted(maps.Keys(s.objects)) {
+			all = append(all, *cloneAttrs(s.objects[name].attrs))
+		}
+		s.mu.RUnlock()
+
+		for _, attrs := range listObjects(all, opts) {
+			if !yield(attrs, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Delete implements BlobStore.
+func (s *MemoryBlobStore) Delete(ctx context.Context, object string, conds Conditions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[object]
+	if !ok {
+		return fmt.Errorf("failed to delete object '%s': %w", object, ErrNotFound)
+	}
+	if err := checkConditions(object, &obj.attrs, conds); err != nil {
+		return err
+	}
+	delete(s.objects, object)
+	return nil
+}
+
+// Stat implements BlobStore.
+func (s *MemoryBlobStore) Stat(ctx context.Context, object string) (*ObjectAttrs, error) {
+	obj, err := s.get(ctx, object)
+	if err != nil {
+		return nil, err
+	}
+	return cloneAttrs(obj.attrs), nil
+}
+
+// get returns an object. Objects are replaced rather than modified on upload, so the
+// caller can use it without holding the lock.
+func (s *MemoryBlobStore) get(ctx context.Context, object string) (*memoryObject, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if object == "" {
+		return nil, fmt.Errorf("object name cannot be empty")
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	obj, ok := s.objects[object]
+	if !ok {
+		return nil, fmt.Errorf("failed to read object '%s': %w", object, ErrNotFound)
+	}
+	return obj, nil
+}
@@ -0,0 +1,217 @@
+package gcs
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/storage"
+)
+
+// MaxComposeSources is the largest number of source objects Compose accepts.
+const MaxComposeSources = 32
+
+// Conditions are preconditions on the generation and metageneration of an object.
+// An operation whose conditions do not hold fails with an error wrapping
+// ErrPreconditionFailed. At most one of GenerationMatch, GenerationNotMatch and
+// DoesNotExist, and at most one of the metageneration conditions, can be set. The zero
+// value sets no conditions.
+type Conditions struct {
+	// GenerationMatch requires the object to be at this generation.
+	GenerationMatch int64
+	// GenerationNotMatch requires the object not to be at this generation.
+	GenerationNotMatch int64
+	// DoesNotExist requires the object not to exist.
+	DoesNotExist bool
+	// MetagenerationMatch requires the object metadata to be at this metageneration.
+	MetagenerationMatch int64
+	// MetagenerationNotMatch requires the object metadata not to be at this
+	// metageneration.
+	MetagenerationNotMatch int64
+}
+
+// apply returns the handle with the conditions set, or h itself if there are none.
+func (c Conditions) apply(h *storage.ObjectHandle) *storage.ObjectHandle {
+	if c == (Conditions{}) {
+		return h
+	}
+	return h.If(storage.Conditions{
+		GenerationMatch:        c.GenerationMatch,
+		GenerationNotMatch:     c.GenerationNotMatch,
+		DoesNotExist:           c.DoesNotExist,
+		MetagenerationMatch:    c.MetagenerationMatch,
+		MetagenerationNotMatch: c.MetagenerationNotMatch,
+	})
+}
+
+// ObjectRef names an object. An empty Bucket refers to the client's configured bucket.
+type ObjectRef struct {
+	Bucket string
+	Name   string
+}
+
+// String returns the object in "bucket/name" form.
+func (r ObjectRef) String() string {
+	return r.Bucket + "/" + r.Name
+}
+
+// CopyOptions configures Copy and Move.
+type CopyOptions struct {
+	// SourceConditions must hold for the source object.
+	SourceConditions Conditions
+	// DestinationConditions must hold for the destination object. Use DoesNotExist to
+	// avoid overwriting an existing object.
+	DestinationConditions Conditions
+}
+
+// ComposeOptions configures Compose.
+type ComposeOptions struct {
+	// Conditions must hold for the destination object.
+	Conditions Conditions
+	// ContentType is the content type of the composed object. If empty, GCS leaves it
+	// unset.
+	ContentType string
+	// Metadata is the custom metadata of the composed object.
+	Metadata map[string]string
+	// CacheControl and ContentEncoding set the Cache-Control and Content-Encoding
+	// headers of the composed object.
+	CacheControl    string
+	ContentEncoding string
+}
+
+// Delete removes an object from the configured bucket. If the object does not exist,
+// the returned error wraps ErrNotFound; use Conditions.GenerationMatch to only delete
+// the generation that was read.
+func (c *Client) Delete(ctx context.Context, object string, conds Conditions) error {
+	if object == "" {
+		return fmt.Errorf("object name cannot be empty")
+	}
+
+	c.logger.DebugContext(ctx, "Deleting object from GCS", "object", object, "bucket", c.bucketName)
+
+	h := conds.apply(c.gcsClient.Bucket(c.bucketName).Object(object))
+	if err := h.Delete(ctx); err != nil {
+		return fmt.Errorf("failed to delete GCS object '%s': %w", object, mapError(err))
+	}
+
+	c.logger.DebugContext(ctx, "Successfully deleted object", "object", object, "bucket", c.bucketName)
+	return nil
+}
+
+// Copy copies an object server-side, possibly between buckets, and returns the
+// attributes of the new object. The data is not downloaded; large copies may take
+// several requests, which Copy makes until the copy completes. Objects encrypted
+// client-side are bound to their name, so their copies cannot be decrypted.
+func (c *Client) Copy(ctx context.Context, src, dst ObjectRef, opts CopyOptions) (*ObjectAttrs, error) {
+	src, dst, err := c.resolveRefs(src, dst)
+	if err != nil {
+		return nil, err
+	}
+
+	c.logger.DebugContext(ctx, "Copying GCS object", "source", src.String(), "destination", dst.String())
+
+	attrs, err := c.copy(ctx, src, dst, opts.SourceConditions, opts.DestinationConditions)
+	if err != nil {
+		return nil, err
+	}
+
+	c.logger.DebugContext(ctx, "Successfully copied object", "source", src.String(), "destination", dst.String(), "generation", attrs.Generation)
+	return attrs, nil
+}
+
+// Move renames an object, possibly into another bucket, by copying it and deleting the
+// source, and returns the attributes of the new object. Only the source generation
+// that was copied is deleted: if the source is overwritten during the move, Move
+// returns an error wrapping ErrPreconditionFailed and both objects remain. Like
+// copies, moved objects that were encrypted client-side cannot be decrypted.
+func (c *Client) Move(ctx context.Context, src, dst ObjectRef, opts CopyOptions) (*ObjectAttrs, error) {
+	src, dst, err := c.resolveRefs(src, dst)
+	if err != nil {
+		return nil, err
+	}
+
+	c.logger.DebugContext(ctx, "Moving GCS object", "source", src.String(), "destination", dst.String())
+
+	// Pin the source generation, so that the copy and the delete act on the same data.
+	srcHandle := opts.SourceConditions.apply(c.gcsClient.Bucket(src.Bucket).Object(src.Name))
+	srcAttrs, err := srcHandle.Attrs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move GCS object '%s': %w", src, mapError(err))
+	}
+	pinned := Conditions{GenerationMatch: srcAttrs.Generation}
+
+	attrs, err := c.copy(ctx, src, dst, pinned, opts.DestinationConditions)
+	if err != nil {
+		return nil, err
+	}
+	if err := pinned.apply(c.gcsClient.Bucket(src.Bucket).Object(src.Name)).Delete(ctx); err != nil {
+		return nil, fmt.Errorf("copied GCS object '%s' to '%s' but failed to delete the source: %w", src, dst, mapError(err))
+	}
+
+	c.logger.DebugContext(ctx, "Successfully moved object", "source", src.String(), "destination", dst.String(), "generation", attrs.Generation)
+	return attrs, nil
+}
+
+// Compose concatenates up to MaxComposeSources objects of the configured bucket, in
+// order, into the destination object and returns its attributes. The destination may
+// be one of the sources, which allows appending to an object. Composed objects have a
+// CRC32C checksum but no MD5 hash.
+func (c *Client) Compose(ctx context.Context, dst string, sources []string, opts ComposeOptions) (*ObjectAttrs, error) {
+	if dst == "" {
+		return nil, fmt.Errorf("object name cannot be empty")
+	}
+	if len(sources) == 0 || len(sources) > MaxComposeSources {
+		return nil, fmt.Errorf("compose needs between 1 and %d source objects, got %d", MaxComposeSources, len(sources))
+	}
+
+	c.logger.DebugContext(ctx, "Composing GCS object", "object", dst, "bucket", c.bucketName, "sources", len(sources))
+
+	bucket := c.gcsClient.Bucket(c.bucketName)
+	handles := make([]*storage.ObjectHandle, len(sources))
+	for i, name := range sources {
+		if name == "" {
+			return nil, fmt.Errorf("source object name cannot be empty")
+		}
+		handles[i] = bucket.Object(name)
+	}
+	composer := opts.Conditions.apply(bucket.Object(dst)).ComposerFrom(handles...)
+	composer.ContentType = opts.ContentType
+	composer.Metadata = opts.Metadata
+	composer.CacheControl = opts.CacheControl
+	composer.ContentEncoding = opts.ContentEncoding
+
+	attrs, err := composer.Run(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compose GCS object '%s': %w", dst, mapError(err))
+	}
+
+	c.logger.DebugContext(ctx, "Successfully composed object", "object", dst, "bucket", c.bucketName, "size", attrs.Size)
+	return objectAttrsFrom(attrs), nil
+}
+
+// copy runs a server-side copy with the given conditions.
+func (c *Client) copy(ctx context.Context, src, dst ObjectRef, srcConds, dstConds Conditions) (*ObjectAttrs, error) {
+	srcHandle := srcConds.apply(c.gcsClient.Bucket(src.Bucket).Object(src.Name))
+	dstHandle := dstConds.apply(c.gcsClient.Bucket(dst.Bucket).Object(dst.Name))
+	attrs, err := dstHandle.CopierFrom(srcHandle).Run(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy GCS object '%s' to '%s': %w", src, dst, mapError(err))
+	}
+	return objectAttrsFrom(attrs), nil
+}
+
+// resolveRefs fills in the configured bucket and validates the object names.
+func (c *Client) resolveRefs(src, dst ObjectRef) (ObjectRef, ObjectRef, error) {
+	if src.Name == "" || dst.Name == "" {
+		return src, dst, fmt.Errorf("object name cannot be empty")
+	}
+	if src.Bucket == "" {
+		src.Bucket = c.bucketName
+	}
+	if dst.Bucket == "" {
+		dst.Bucket = c.bucketName
+	}
+	if src == dst {
+		return src, dst, fmt.Errorf("source and destination are the same object '%s'", src)
+	}
+	return src, dst, nil
+}
@@ -0,0 +1,161 @@
+package gcs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	apierrors "github.com/duizendstra/dui-go/errors"
+)
+
+func TestDelete(t *testing.T) {
+	client, fake := newTestClient(t)
+	ctx := context.Background()
+
+	t.Run("Deletes the object", func(t *testing.T) {
+		fake.put(testBucket, "doomed", []byte("x"), "")
+		require.NoError(t, client.Delete(ctx, "doomed", Conditions{}))
+		assert.Nil(t, fake.get(testBucket, "doomed"))
+	})
+
+	t.Run("Missing objects are not found", func(t *testing.T) {
+		err := client.Delete(ctx, "missing", Conditions{})
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, err, apierrors.ErrNotFound)
+	})
+
+	t.Run("Generation precondition", func(t *testing.T) {
+		obj := fake.put(testBucket, "guarded", []byte("v1"), "")
+		err := client.Delete(ctx, "guarded", Conditions{GenerationMatch: obj.Generation + 1})
+		assert.ErrorIs(t, err, ErrPreconditionFailed)
+		assert.NotNil(t, fake.get(testBucket, "guarded"))
+
+		require.NoError(t, client.Delete(ctx, "guarded", Conditions{GenerationMatch: obj.Generation}))
+		assert.Nil(t, fake.get(testBucket, "guarded"))
+	})
+
+	t.Run("Metageneration precondition", func(t *testing.T) {
+		fake.put(testBucket, "meta", []byte("v1"), "")
+		err := client.Delete(ctx, "meta", Conditions{MetagenerationMatch: 2})
+		assert.ErrorIs(t, err, ErrPreconditionFailed)
+	})
+
+	t.Run("Fails with empty object name", func(t *testing.T) {
+		require.Error(t, client.Delete(ctx, "", Conditions{}))
+	})
+}
+
+func TestCopyAndMove(t *testing.T) {
+	client, fake := newTestClient(t)
+	ctx := context.Background()
+
+	t.Run("Copies between buckets", func(t *testing.T) {
+		src := fake.put(testBucket, "source.txt", []byte("payload"), "text/plain")
+		attrs, err := client.Copy(ctx, ObjectRef{Name: "source.txt"}, ObjectRef{Bucket: "backup", Name: "copy.txt"}, CopyOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "backup", attrs.Bucket)
+		assert.Equal(t, "copy.txt", attrs.Name)
+		assert.Equal(t, "text/plain", attrs.ContentType)
+		assert.Equal(t, "payload", string(fake.get("backup", "copy.txt").Data))
+		assert.Equal(t, src.Generation, fake.get(testBucket, "source.txt").Generation, "expected the source to be untouched")
+	})
+
+	t.Run("Destination preconditions", func(t *testing.T) {
+		fake.put(testBucket, "existing", []byte("keep"), "")
+		_, err := client.Copy(ctx, ObjectRef{Name: "source.txt"}, ObjectRef{Name: "existing"}, CopyOptions{
+			DestinationConditions: Conditions{DoesNotExist: true},
+		})
+		assert.ErrorIs(t, err, ErrPreconditionFailed)
+		assert.Equal(t, "keep", string(fake.get(testBucket, "existing").Data))
+	})
+
+	t.Run("Source preconditions", func(t *testing.T) {
+		_, err := client.Copy(ctx, ObjectRef{Name: "source.txt"}, ObjectRef{Name: "other"}, CopyOptions{
+			SourceConditions: Conditions{GenerationMatch: 1 << 40},
+		})
+		assert.ErrorIs(t, err, ErrPreconditionFailed)
+	})
+
+	t.Run("Missing sources are not found", func(t *testing.T) {
+		_, err := client.Copy(ctx, ObjectRef{Name: "missing"}, ObjectRef{Name: "other"}, CopyOptions{})
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("Moves an object", func(t *testing.T) {
+		fake.put(testBucket, "old/name.txt", []byte("moving"), "")
+		attrs, err := client.Move(ctx, ObjectRef{Name: "old/name.txt"}, ObjectRef{Name: "new/name.txt"}, CopyOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "new/name.txt", attrs.Name)
+		assert.Nil(t, fake.get(testBucket, "old/name.txt"))
+		assert.Equal(t, "moving", string(fake.get(testBucket, "new/name.txt").Data))
+	})
+
+	t.Run("Move keeps the source when the copy fails", func(t *testing.T) {
+		fake.put(testBucket, "a", []byte("a"), "")
+		fake.put(testBucket, "b", []byte("b"), "")
+		_, err := client.Move(ctx, ObjectRef{Name: "a"}, ObjectRef{Name: "b"}, CopyOptions{
+			DestinationConditions: Conditions{DoesNotExist: true},
+		})
+		assert.ErrorIs(t, err, ErrPreconditionFailed)
+		assert.NotNil(t, fake.get(testBucket, "a"))
+	})
+
+	t.Run("Rejects copying an object onto itself", func(t *testing.T) {
+		_, err := client.Copy(ctx, ObjectRef{Name: "a"}, ObjectRef{Bucket: testBucket, Name: "a"}, CopyOptions{})
+		require.Error(t, err)
+	})
+}
+
+func TestCompose(t *testing.T) {
+	client, fake := newTestClient(t)
+	ctx := context.Background()
+	var sources []string
+	for i := range 3 {
+		name := fmt.Sprintf("part-%d", i)
+		fake.put(testBucket, name, []byte(fmt.Sprintf("<%d>", i)), "")
+		sources = append(sources, name)
+	}
+
+	attrs, err := client.Compose(ctx, "joined", sources, ComposeOptions{ContentType: "text/plain", Metadata: map[string]string{"parts": "3"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), attrs.Size)
+	assert.Equal(t, "text/plain", attrs.ContentType)
+	assert.Equal(t, "<0><1><2>", string(fake.get(testBucket, "joined").Data))
+
+	t.Run("Appends to the destination", func(t *testing.T) {
+		_, err := client.Compose(ctx, "joined", []string{"joined", "part-0"}, ComposeOptions{
+			Conditions: Conditions{GenerationMatch: attrs.Generation},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "<0><1><2><0>", string(fake.get(testBucket, "joined").Data))
+	})
+
+	t.Run("Destination preconditions", func(t *testing.T) {
+		_, err := client.Compose(ctx, "joined", sources, ComposeOptions{Conditions: Conditions{DoesNotExist: true}})
+		assert.ErrorIs(t, err, ErrPreconditionFailed)
+	})
+
+	t.Run("Missing sources are not found", func(t *testing.T) {
+		_, err := client.Compose(ctx, "broken", []string{"part-0", "missing"}, ComposeOptions{})
+		assert.True(t, errors.Is(err, ErrNotFound), "expected ErrNotFound, got %v", err)
+	})
+
+	t.Run("Limits the number of sources", func(t *testing.T) {
+		_, err := client.Compose(ctx, "too-many", make([]string, MaxComposeSources+1), ComposeOptions{})
+		require.Error(t, err)
+		_, err = client.Compose(ctx, "none", nil, ComposeOptions{})
+		require.Error(t, err)
+	})
+}
+
+func TestStatNotFound(t *testing.T) {
+	client, _ := newTestClient(t)
+	_, err := client.Stat(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+	err = client.Download(context.Background(), "missing", nil)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,104 @@
+package gcs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+)
+
+// EmulatorHostEnv is the environment variable holding the address of a GCS emulator,
+// such as fake-gcs-server at "localhost:4443" or "http://localhost:4443". When it is
+// set, clients connect to the emulator without credentials.
+const EmulatorHostEnv = "STORAGE_EMULATOR_HOST"
+
+// Option configures how NewClient connects to GCS.
+type Option func(*clientOptions)
+
+// clientOptions collects the settings applied by Options.
+type clientOptions struct {
+	client      *storage.Client
+	credentials []option.ClientOption
+	extra       []option.ClientOption
+}
+
+// WithStorageClient makes NewClient use an existing storage client instead of
+// creating one. The other options are ignored. Closing the Client closes the storage
+// client.
+func WithStorageClient(client *storage.Client) Option {
+	return func(o *clientOptions) {
+		o.client = client
+	}
+}
+
+// WithEndpoint sends JSON API requests, and the XML API reads that go to the same
+// host, to endpoint instead of storage.googleapis.com, for example
+// "http://localhost:4443/storage/v1/" for fake-gcs-server or a Private Service
+// Connect endpoint. Requests are still authenticated; to target an emulator without
+// credentials, set EmulatorHostEnv or combine it with WithHTTPClient.
+func WithEndpoint(endpoint string) Option {
+	return func(o *clientOptions) {
+		o.extra = append(o.extra, option.WithEndpoint(endpoint))
+	}
+}
+
+// WithHTTPClient sends all requests through client, for example to add tracing or
+// to use a test server's client. The client is responsible for authentication, so
+// credentials from WithCredentials or Application Default Credentials are not used.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *clientOptions) {
+		o.extra = append(o.extra, option.WithHTTPClient(client))
+	}
+}
+
+// WithCredentials authenticates with creds instead of Application Default
+// Credentials. It is ignored when EmulatorHostEnv is set.
+func WithCredentials(creds *google.Credentials) Option {
+	return func(o *clientOptions) {
+		o.credentials = append(o.credentials, option.WithCredentials(creds))
+	}
+}
+
+// WithClientOptions passes additional options, such as a user agent or scopes, to
+// the storage client.
+func WithClientOptions(opts ...option.ClientOption) Option {
+	return func(o *clientOptions) {
+		o.extra = append(o.extra, opts...)
+	}
+}
+
+// applyOptions collects the settings of opts.
+func applyOptions(opts []Option) clientOptions {
+	var o clientOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// newStorageClient returns the storage client configured by o, creating one if none
+// was injected.
+//
+// If EmulatorHostEnv is set, the storage client targets the emulator without
+// authentication, and credentials are not used, since the storage client rejects
+// them in combination.
+func newStorageClient(ctx context.Context, o clientOptions) (*storage.Client, error) {
+	if o.client != nil {
+		return o.client, nil
+	}
+
+	clientOpts := o.extra
+	if os.Getenv(EmulatorHostEnv) == "" {
+		clientOpts = append(clientOpts, o.credentials...)
+	}
+
+	client, err := storage.NewClient(ctx, clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create underlying storage.Client: %w", err)
+	}
+	return client, nil
+}
@@ -0,0 +1,350 @@
+package gcs
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// DefaultPartSize is the part size of parallel transfers if none is set.
+	DefaultPartSize = 32 << 20
+	// DefaultConcurrency is the number of parts transferred at once if none is set.
+	DefaultConcurrency = 8
+	// DefaultTempPrefix is the prefix of the temporary part objects of parallel
+	// uploads if none is set. A lifecycle rule deleting objects under it after a day
+	// removes the parts of uploads that could not clean up, for example because the
+	// process was killed.
+	DefaultTempPrefix = ".parallel-uploads/"
+)
+
+// Progress reports how far a parallel transfer has come.
+type Progress struct {
+	Object string
+	// Bytes is the number of bytes transferred so far.
+	Bytes int64
+	// Total is the size of the object, or -1 while a parallel upload is still reading
+	// its input.
+	Total int64
+}
+
+// ParallelUploadOptions configures ParallelUpload.
+type ParallelUploadOptions struct {
+	// UploadOptions apply to the final object, except for MD5, which is not
+	// supported because composite objects have no MD5 hash. The CRC32C of the
+	// composed object is always checked against the data read.
+	UploadOptions
+	// PartSize is the size of the parts uploaded concurrently; it defaults to
+	// DefaultPartSize. Up to Concurrency parts are held in memory at once.
+	PartSize int64
+	// Concurrency is the number of parts uploaded at once; it defaults to
+	// DefaultConcurrency.
+	Concurrency int
+	// TempPrefix is the prefix of the temporary part objects; it defaults to
+	// DefaultTempPrefix.
+	TempPrefix string
+	// Progress, if set, is called after each part. Calls are not concurrent.
+	Progress func(Progress)
+}
+
+// ParallelDownloadOptions configures ParallelDownload.
+type ParallelDownloadOptions struct {
+	// PartSize is the size of the ranges downloaded concurrently; it defaults to
+	// DefaultPartSize.
+	PartSize int64
+	// Concurrency is the number of ranges downloaded at once; it defaults to
+	// DefaultConcurrency.
+	Concurrency int
+	// Progress, if set, is called after each part. Calls are not concurrent.
+	Progress func(Progress)
+}
+
+// ParallelUpload uploads large data faster than Upload by splitting it into parts,
+// uploading up to opts.Concurrency parts at once as temporary objects and composing
+// them into the object, which is then checked against the CRC32C of the data. The
+// temporary objects are deleted whether the upload succeeds or fails. Data that fits
+// in a single part is uploaded with Upload.
+//
+// Progress is logged through the configured logger and reported to opts.Progress
+// after each part. The uploading account needs permission to delete objects.
+//
+// Compression, Encrypt and CustomerKey are not supported, since the parts are
+// uploaded and composed as they are; use Upload for such data.
+func (c *Client) ParallelUpload(ctx context.Context, object string, r io.Reader, opts ParallelUploadOptions) (*ObjectAttrs, error) {
+	if object == "" {
+		return nil, fmt.Errorf("object name cannot be empty")
+	}
+	if opts.MD5 != nil {
+		return nil, fmt.Errorf("MD5 checksums are not supported by parallel uploads, use CRC32C")
+	}
+	if opts.Compression != NoCompression || opts.Encrypt || opts.CustomerKey != nil {
+		return nil, fmt.Errorf("compression and encryption are not supported by parallel uploads, use Upload")
+	}
+	partSize := positiveOr(opts.PartSize, DefaultPartSize)
+	tempPrefix := cmp.Or(opts.TempPrefix, DefaultTempPrefix)
+
+	br := bufio.NewReaderSize(r, sniffLen)
+	if opts.ContentType == "" {
+		opts.ContentType = detectContentType(object, br)
+	}
+	data, eof, err := readPart(br, partSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data for object '%s': %w", object, err)
+	}
+	if eof {
+		return c.Upload(ctx, object, bytes.NewReader(data), opts.UploadOptions)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate upload ID: %w", err)
+	}
+	prefix := tempPrefix + hex.EncodeToString(id) + "/"
+	c.logger.DebugContext(ctx, "Starting parallel upload to GCS", "object", object, "bucket", c.bucketName, "partSize", partSize, "tempPrefix", prefix)
+
+	var temp tempObjects
+	defer c.deleteTemp(context.WithoutCancel(ctx), &temp)
+
+	progress := c.newProgress(ctx, "upload", object, -1, opts.Progress)
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(positiveOr(opts.Concurrency, DefaultConcurrency))
+	crc := crc32.New(crc32cTable)
+	var parts []string
+	var size int64
+	var readErr error
+	for len(data) > 0 {
+		crc.Write(data)
+		size += int64(len(data))
+		name := fmt.Sprintf("%s%05d", prefix, len(parts))
+		parts = append(parts, name)
+		part := data
+		g.Go(func() error {
+			// Tracked before uploading, since a part may be stored even if its upload
+			// is cancelled.
+			temp.add(name)
+			sum := crc32.Checksum(part, crc32cTable)
+			_, err := c.Upload(gctx, name, bytes.NewReader(part), UploadOptions{
+				ContentType: "application/octet-stream",
+				CRC32C:      &sum,
+				ChunkSize:   opts.ChunkSize,
+				Conditions:  Conditions{DoesNotExist: true},
+			})
+			if err != nil {
+				return err
+			}
+			progress.add(int64(len(part)))
+			return nil
+		})
+
+		if eof || gctx.Err() != nil {
+			break
+		}
+		if data, eof, readErr = readPart(br, partSize); readErr != nil {
+			readErr = fmt.Errorf("failed to read data for object '%s': %w", object, readErr)
+			break
+		}
+	}
+	if eof {
+		progress.setTotal(size)
+	}
+	// Wait for the parts in flight before returning, so they are cleaned up.
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	if opts.CRC32C != nil && *opts.CRC32C != crc.Sum32() {
+		return nil, fmt.Errorf("failed to upload object '%s': %w", object, ErrChecksumMismatch)
+	}
+	attrs, err := c.composeParts(ctx, object, parts, prefix, &temp, ComposeOptions{
+		Conditions:      opts.Conditions,
+		ContentType:     opts.ContentType,
+		Metadata:        opts.Metadata,
+		CacheControl:    opts.CacheControl,
+		ContentEncoding: opts.ContentEncoding,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if attrs.CRC32C != crc.Sum32() {
+		c.logger.WarnContext(ctx, "Composed object does not match the data sent, deleting it", "object", object, "bucket", c.bucketName, "generation", attrs.Generation)
+		if err := c.Delete(ctx, object, Conditions{GenerationMatch: attrs.Generation}); err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("failed to delete corrupted GCS object '%s': %w", object, err)
+		}
+		return nil, fmt.Errorf("failed to upload GCS object '%s': %w", object, ErrChecksumMismatch)
+	}
+
+	c.logger.DebugContext(ctx, "Successfully uploaded object", "object", object, "bucket", c.bucketName, "size", attrs.Size, "parts", len(parts))
+	return attrs, nil
+}
+
+// ParallelDownload downloads an object faster than Download by reading up to
+// opts.Concurrency byte ranges at once and writing each at its offset in w, such as
+// an *os.File. All ranges are read from the generation current when the download
+// starts, so an object replaced during the download fails with ErrNotFound instead
+// of mixing generations. It returns the attributes of the downloaded generation.
+//
+// Unlike Download, the data is not checked against the object's CRC32C, since GCS
+// does not return checksums for ranges, and the data is written as stored: objects
+// uploaded with compression or encryption are not decoded.
+func (c *Client) ParallelDownload(ctx context.Context, object string, w io.WriterAt, opts ParallelDownloadOptions) (*ObjectAttrs, error) {
+	attrs, err := c.Stat(ctx, object)
+	if err != nil {
+		return nil, err
+	}
+	partSize := positiveOr(opts.PartSize, DefaultPartSize)
+	c.logger.DebugContext(ctx, "Starting parallel download from GCS", "object", object, "bucket", c.bucketName, "size", attrs.Size, "partSize", partSize)
+
+	handle, err := c.withCustomerKey(c.gcsClient.Bucket(c.bucketName).Object(object).Generation(attrs.Generation), attrs)
+	if err != nil {
+		return nil, err
+	}
+	progress := c.newProgress(ctx, "download", object, attrs.Size, opts.Progress)
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(positiveOr(opts.Concurrency, DefaultConcurrency))
+	for offset := int64(0); offset < attrs.Size && gctx.Err() == nil; offset += partSize {
+		length := min(partSize, attrs.Size-offset)
+		g.Go(func() error {
+			r, err := handle.NewRangeReader(gctx, offset, length)
+			if err != nil {
+				return fmt.Errorf("failed to open GCS object '%s' at offset %d: %w", object, offset, mapError(err))
+			}
+			defer r.Close()
+			n, err := io.Copy(io.NewOffsetWriter(w, offset), r)
+			if err == nil && n != length {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return fmt.Errorf("failed to download GCS object '%s' at offset %d: %w", object, offset, err)
+			}
+			progress.add(n)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	c.logger.DebugContext(ctx, "Successfully downloaded object", "object", object, "bucket", c.bucketName, "bytes", attrs.Size)
+	return attrs, nil
+}
+
+// composeParts composes the parts into the object. More than MaxComposeSources parts
+// are first composed into intermediate temporary objects, level by level.
+func (c *Client) composeParts(ctx context.Context, object string, parts []string, prefix string, temp *tempObjects, opts ComposeOptions) (*ObjectAttrs, error) {
+	for level := 0; len(parts) > MaxComposeSources; level++ {
+		var next []string
+		for i := 0; i < len(parts); i += MaxComposeSources {
+			group := parts[i:min(i+MaxComposeSources, len(parts))]
+			name := fmt.Sprintf("%scompose-%d-%05d", prefix, level, len(next))
+			temp.add(name)
+			if _, err := c.Compose(ctx, name, group, ComposeOptions{}); err != nil {
+				return nil, err
+			}
+			next = append(next, name)
+		}
+		parts = next
+	}
+	return c.Compose(ctx, object, parts, opts)
+}
+
+// deleteTemp deletes the temporary objects of a parallel upload, logging failures.
+func (c *Client) deleteTemp(ctx context.Context, temp *tempObjects) {
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(DefaultConcurrency)
+	for _, name := range temp.list() {
+		g.Go(func() error {
+			if err := c.Delete(gctx, name, Conditions{}); err != nil && !errors.Is(err, ErrNotFound) {
+				c.logger.WarnContext(ctx, "Failed to delete temporary object of parallel upload", "object", name, "bucket", c.bucketName, "error", err)
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+}
+
+// tempObjects collects the temporary objects created by a parallel upload.
+type tempObjects struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (t *tempObjects) add(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.names = append(t.names, name)
+}
+
+func (t *tempObjects) list() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.names
+}
+
+// progressReporter logs and reports the progress of a parallel transfer.
+type progressReporter struct {
+	mu       sync.Mutex
+	ctx      context.Context
+	c        *Client
+	op       string
+	progress Progress
+	callback func(Progress)
+}
+
+func (c *Client) newProgress(ctx context.Context, op, object string, total int64, callback func(Progress)) *progressReporter {
+	return &progressReporter{
+		ctx:      ctx,
+		c:        c,
+		op:       op,
+		progress: Progress{Object: object, Total: total},
+		callback: callback,
+	}
+}
+
+// add records n more transferred bytes and reports the progress.
+func (p *progressReporter) add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.progress.Bytes += n
+	p.c.logger.InfoContext(p.ctx, "Parallel "+p.op+" progress", "object", p.progress.Object, "bucket", p.c.bucketName, "bytes", p.progress.Bytes, "total", p.progress.Total)
+	if p.callback != nil {
+		p.callback(p.progress)
+	}
+}
+
+// setTotal records the total size once it is known.
+func (p *progressReporter) setTotal(total int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.progress.Total = total
+}
+
+// readPart reads up to size bytes, reporting whether the end of the data was reached.
+func readPart(r io.Reader, size int64) ([]byte, bool, error) {
+	buf := make([]byte, size)
+	n, err := io.ReadFull(r, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return buf[:n], true, nil
+	}
+	return buf[:n], false, err
+}
+
+// positiveOr returns v if it is positive and def otherwise.
+func positiveOr[T int | int64](v, def T) T {
+	if v > 0 {
+		return v
+	}
+	return def
+}
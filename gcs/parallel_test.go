@@ -0,0 +1,216 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// liveNames returns the names of the live objects of testBucket that start with prefix.
+func (f *fakeGCS) liveNames(prefix string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var names []string
+	for key, obj := range f.live {
+		if obj.Bucket == testBucket && strings.HasPrefix(obj.Name, prefix) {
+			names = append(names, strings.TrimPrefix(key, testBucket+"/"))
+		}
+	}
+	return names
+}
+
+// testData returns n bytes of non-repeating data.
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i/251)
+	}
+	return data
+}
+
+func TestParallelUpload(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Composes the parts and removes them", func(t *testing.T) {
+		client, fake := newTestClient(t)
+		var logs bytes.Buffer
+		client.logger = slog.New(slog.NewTextHandler(&logs, nil))
+		data := testData(1<<20 + 100)
+
+		var reports []Progress
+		attrs, err := client.ParallelUpload(ctx, "exports/data.csv", bytes.NewReader(data), ParallelUploadOptions{
+			UploadOptions: UploadOptions{Metadata: map[string]string{"job": "42"}, CacheControl: "no-store"},
+			PartSize:      256 << 10,
+			Concurrency:   3,
+			Progress:      func(p Progress) { reports = append(reports, p) },
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(data)), attrs.Size)
+		assert.Equal(t, "text/csv; charset=utf-8", attrs.ContentType)
+		assert.Equal(t, crc32.Checksum(data, crc32cTable), attrs.CRC32C)
+
+		obj := fake.get(testBucket, "exports/data.csv")
+		require.NotNil(t, obj)
+		assert.True(t, bytes.Equal(data, obj.Data))
+		assert.Equal(t, map[string]string{"job": "42"}, obj.Metadata)
+		assert.Equal(t, "no-store", obj.CacheControl)
+		assert.Empty(t, fake.liveNames(DefaultTempPrefix), "expected the parts to be deleted")
+
+		require.Len(t, reports, 5)
+		for i := 1; i < len(reports); i++ {
+			assert.Greater(t, reports[i].Bytes, reports[i-1].Bytes)
+		}
+		assert.Equal(t, Progress{Object: "exports/data.csv", Bytes: int64(len(data)), Total: int64(len(data))}, reports[len(reports)-1])
+		assert.Contains(t, logs.String(), "Parallel upload progress")
+	})
+
+	t.Run("Composes more than MaxComposeSources parts in levels", func(t *testing.T) {
+		client, fake := newTestClient(t)
+		data := testData(40*1024 + 7)
+
+		attrs, err := client.ParallelUpload(ctx, "many-parts", bytes.NewReader(data), ParallelUploadOptions{PartSize: 1024, TempPrefix: "tmp/"})
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(data)), attrs.Size)
+		assert.True(t, bytes.Equal(data, fake.get(testBucket, "many-parts").Data))
+		assert.Empty(t, fake.liveNames("tmp/"), "expected the parts and intermediate objects to be deleted")
+	})
+
+	t.Run("Uploads small data directly", func(t *testing.T) {
+		client, fake := newTestClient(t)
+		_, err := client.ParallelUpload(ctx, "small", strings.NewReader("tiny"), ParallelUploadOptions{PartSize: 1024})
+		require.NoError(t, err)
+		assert.Equal(t, "tiny", string(fake.get(testBucket, "small").Data))
+		for _, req := range fake.requests {
+			assert.NotContains(t, req, "compose")
+		}
+	})
+
+	t.Run("Cleans up after a failed part", func(t *testing.T) {
+		client, fake := newTestClient(t)
+		fake.failUploads = func(name string) bool { return strings.HasSuffix(name, "/00002") }
+
+		_, err := client.ParallelUpload(ctx, "failed", bytes.NewReader(testData(10*1024)), ParallelUploadOptions{PartSize: 1024, Concurrency: 2})
+		require.Error(t, err)
+		assert.Nil(t, fake.get(testBucket, "failed"))
+		assert.Empty(t, fake.liveNames(DefaultTempPrefix))
+	})
+
+	t.Run("Cleans up after a read error", func(t *testing.T) {
+		client, fake := newTestClient(t)
+		r := &failingReader{bytes.NewReader(testData(5000))}
+
+		_, err := client.ParallelUpload(ctx, "unreadable", r, ParallelUploadOptions{PartSize: 1024})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "disk on fire")
+		assert.Nil(t, fake.get(testBucket, "unreadable"))
+		assert.Empty(t, fake.liveNames(DefaultTempPrefix))
+	})
+
+	t.Run("Preconditions and checksums", func(t *testing.T) {
+		client, fake := newTestClient(t)
+		fake.put(testBucket, "existing", []byte("keep"), "")
+		data := testData(3000)
+
+		_, err := client.ParallelUpload(ctx, "existing", bytes.NewReader(data), ParallelUploadOptions{
+			UploadOptions: UploadOptions{Conditions: Conditions{DoesNotExist: true}},
+			PartSize:      1024,
+		})
+		assert.ErrorIs(t, err, ErrPreconditionFailed)
+		assert.Equal(t, "keep", string(fake.get(testBucket, "existing").Data))
+
+		wrong := crc32.Checksum(data, crc32cTable) + 1
+		_, err = client.ParallelUpload(ctx, "checked", bytes.NewReader(data), ParallelUploadOptions{
+			UploadOptions: UploadOptions{CRC32C: &wrong},
+			PartSize:      1024,
+		})
+		assert.ErrorIs(t, err, ErrChecksumMismatch)
+		assert.Nil(t, fake.get(testBucket, "checked"))
+
+		_, err = client.ParallelUpload(ctx, "md5", bytes.NewReader(data), ParallelUploadOptions{UploadOptions: UploadOptions{MD5: make([]byte, 16)}})
+		require.Error(t, err)
+		assert.Empty(t, fake.liveNames(DefaultTempPrefix))
+	})
+
+	t.Run("Rejects compression and encryption", func(t *testing.T) {
+		client, fake := newTestClient(t)
+		client.keyWrapper = newTestKeyWrapper(t, "kek-1")
+		data := testData(5000)
+		for name, opts := range map[string]UploadOptions{
+			"encrypt":      {Encrypt: true},
+			"compression":  {Compression: Gzip},
+			"customer key": {CustomerKey: make([]byte, 32)},
+		} {
+			_, err := client.ParallelUpload(ctx, "secret", bytes.NewReader(data), ParallelUploadOptions{UploadOptions: opts, PartSize: 1024})
+			require.Error(t, err, name)
+		}
+		assert.Nil(t, fake.get(testBucket, "secret"), "expected no plaintext to be stored")
+		assert.Empty(t, fake.liveNames(DefaultTempPrefix))
+	})
+}
+
+func TestParallelDownload(t *testing.T) {
+	client, fake := newTestClient(t)
+	ctx := context.Background()
+	data := testData(1<<20 + 3)
+	stored := fake.put(testBucket, "big.bin", data, "application/octet-stream")
+
+	t.Run("Downloads the ranges into a file", func(t *testing.T) {
+		f, err := os.Create(filepath.Join(t.TempDir(), "big.bin"))
+		require.NoError(t, err)
+		defer f.Close()
+
+		var reports []Progress
+		attrs, err := client.ParallelDownload(ctx, "big.bin", f, ParallelDownloadOptions{
+			PartSize:    100 << 10,
+			Concurrency: 3,
+			Progress:    func(p Progress) { reports = append(reports, p) },
+		})
+		require.NoError(t, err)
+		assert.Equal(t, stored.Generation, attrs.Generation)
+
+		got, err := os.ReadFile(f.Name())
+		require.NoError(t, err)
+		assert.True(t, bytes.Equal(data, got))
+		require.Len(t, reports, 11)
+		assert.Equal(t, Progress{Object: "big.bin", Bytes: int64(len(data)), Total: int64(len(data))}, reports[len(reports)-1])
+	})
+
+	t.Run("Empty object", func(t *testing.T) {
+		fake.put(testBucket, "empty", nil, "")
+		f, err := os.Create(filepath.Join(t.TempDir(), "empty"))
+		require.NoError(t, err)
+		defer f.Close()
+		attrs, err := client.ParallelDownload(ctx, "empty", f, ParallelDownloadOptions{})
+		require.NoError(t, err)
+		assert.Zero(t, attrs.Size)
+	})
+
+	t.Run("Missing object", func(t *testing.T) {
+		_, err := client.ParallelDownload(ctx, "missing", &errWriterAt{}, ParallelDownloadOptions{})
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("Write errors", func(t *testing.T) {
+		_, err := client.ParallelDownload(ctx, "big.bin", &errWriterAt{}, ParallelDownloadOptions{PartSize: 100 << 10})
+		assert.ErrorIs(t, err, errDiskFull)
+	})
+}
+
+var errDiskFull = errors.New("disk full")
+
+// errWriterAt fails every write.
+type errWriterAt struct{}
+
+func (*errWriterAt) WriteAt([]byte, int64) (int, error) { return 0, errDiskFull }
+
+var _ io.WriterAt = (*errWriterAt)(nil)
@@ -0,0 +1,206 @@
+package gcs
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"cloud.google.com/go/storage"
+
+	apierrors "github.com/duizendstra/dui-go/errors"
+)
+
+// ErrTooLarge is wrapped by the error ReadAll returns for an object larger than the
+// given limit. It is a 413 APIError.
+var ErrTooLarge = apierrors.New(413, "object too large")
+
+// Download streams the content of an object in the configured bucket to w. It returns
+// after the whole object was written, verifying its CRC32C checksum. Objects uploaded
+// with compression or encryption are decompressed and decrypted, based on their
+// Content-Encoding and metadata. Any object with a gzip or zstd Content-Encoding is
+// decompressed, including data that was compressed before it was uploaded. If the object does not exist, the returned error
+// wraps ErrNotFound; if it cannot be decrypted, it wraps ErrDecryption.
+func (c *Client) Download(ctx context.Context, object string, w io.Writer) (err error) {
+	r, _, err := c.openDecoded(ctx, object)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := r.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close GCS reader for object '%s': %w", object, closeErr)
+		}
+	}()
+
+	n, err := io.Copy(w, r)
+	if err != nil {
+		return fmt.Errorf("failed to download GCS object '%s': %w", object, err)
+	}
+
+	c.logger.DebugContext(ctx, "Successfully downloaded object", "object", object, "bucket", c.bucketName, "bytes", n)
+	return nil
+}
+
+// NewReader opens an object in the configured bucket for streaming, decoding it like
+// Download. The caller must close the returned reader.
+func (c *Client) NewReader(ctx context.Context, object string) (io.ReadCloser, error) {
+	r, _, err := c.openDecoded(ctx, object)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// NewRangeReader opens length bytes of an object, starting at offset, for streaming.
+// A length of -1 reads until the end of the object. A negative offset reads the last
+// -offset bytes, in which case length must be -1. The caller must close the returned
+// reader. Only full reads verify the CRC32C checksum. The range is read from the data
+// as stored, so objects uploaded with compression or encryption are not decoded.
+func (c *Client) NewRangeReader(ctx context.Context, object string, offset, length int64) (io.ReadCloser, error) {
+	r, err := c.openReader(ctx, object, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ReadAll returns the content of an object, which must not be larger than maxBytes.
+// For a larger object it returns an error wrapping ErrTooLarge without reading the
+// content, which protects against loading unexpectedly large objects into memory.
+// Objects are decoded like Download, and the limit applies to the decoded content.
+func (c *Client) ReadAll(ctx context.Context, object string, maxBytes int64) (data []byte, err error) {
+	if maxBytes < 0 {
+		return nil, fmt.Errorf("maxBytes cannot be negative")
+	}
+	r, size, err := c.openDecoded(ctx, object)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := r.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close GCS reader for object '%s': %w", object, closeErr)
+		}
+	}()
+
+	if size > maxBytes {
+		return nil, fmt.Errorf("GCS object '%s' is %d bytes, the limit is %d: %w", object, size, maxBytes, ErrTooLarge)
+	}
+	// The size is not known up front for objects decoded while downloading, so enforce
+	// the limit while reading as well.
+	data, err = io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GCS object '%s': %w", object, err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("GCS object '%s' exceeds the limit of %d bytes: %w", object, maxBytes, ErrTooLarge)
+	}
+
+	c.logger.DebugContext(ctx, "Successfully read object", "object", object, "bucket", c.bucketName, "bytes", len(data))
+	return data, nil
+}
+
+// Stat returns the attributes of an object in the configured bucket. If the object
+// does not exist, the returned error wraps ErrNotFound.
+func (c *Client) Stat(ctx context.Context, object string) (*ObjectAttrs, error) {
+	if object == "" {
+		return nil, fmt.Errorf("object name cannot be empty")
+	}
+
+	c.logger.DebugContext(ctx, "Fetching GCS object attributes", "object", object, "bucket", c.bucketName)
+
+	attrs, err := c.gcsClient.Bucket(c.bucketName).Object(object).Attrs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attributes of GCS object '%s': %w", object, mapError(err))
+	}
+
+	c.logger.DebugContext(ctx, "Successfully fetched object attributes", "object", object, "bucket", c.bucketName, "size", attrs.Size, "generation", attrs.Generation)
+	return objectAttrsFrom(attrs), nil
+}
+
+// openReader validates the arguments and opens a range reader on the object.
+func (c *Client) openReader(ctx context.Context, object string, offset, length int64) (*storage.Reader, error) {
+	if object == "" {
+		return nil, fmt.Errorf("object name cannot be empty")
+	}
+	if offset < 0 && length != -1 {
+		return nil, fmt.Errorf("length must be -1 when reading from the end of the object")
+	}
+
+	c.logger.DebugContext(ctx, "Downloading object from GCS", "object", object, "bucket", c.bucketName, "offset", offset, "length", length)
+
+	h, err := c.readHandle(ctx, c.gcsClient.Bucket(c.bucketName).Object(object))
+	if err != nil {
+		return nil, err
+	}
+	r, err := h.NewRangeReader(ctx, offset, length)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GCS object '%s': %w", object, mapError(err))
+	}
+	return r, nil
+}
+
+// openDecoded opens the whole object, as stored, and returns a reader that decodes it.
+// The returned size is that of the decoded content if it is known, and -1 otherwise.
+func (c *Client) openDecoded(ctx context.Context, object string) (io.ReadCloser, int64, error) {
+	if object == "" {
+		return nil, 0, fmt.Errorf("object name cannot be empty")
+	}
+
+	c.logger.DebugContext(ctx, "Downloading object from GCS", "object", object, "bucket", c.bucketName)
+
+	h, err := c.readHandle(ctx, c.gcsClient.Bucket(c.bucketName).Object(object).ReadCompressed(true))
+	if err != nil {
+		return nil, 0, err
+	}
+	r, err := h.NewReader(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open GCS object '%s': %w", object, mapError(err))
+	}
+
+	metadata := r.Metadata()
+	if metadata == nil {
+		// Reads through the JSON API do not return the custom metadata.
+		attrs, err := h.Generation(r.Attrs.Generation).Attrs(ctx)
+		if err != nil {
+			_ = r.Close()
+			return nil, 0, fmt.Errorf("failed to get attributes of GCS object '%s': %w", object, mapError(err))
+		}
+		metadata = attrs.Metadata
+	}
+
+	decoded, err := c.decode(ctx, object, r, r.Attrs.ContentEncoding, metadata)
+	if err != nil {
+		_ = r.Close()
+		return nil, 0, err
+	}
+	if decoded != io.ReadCloser(r) {
+		return decoded, -1, nil
+	}
+	return r, r.Attrs.Size, nil
+}
+
+// readHandle returns h, pinned to the current generation and with its
+// customer-supplied key, if the Config has customer keys and the object is encrypted
+// with one of them.
+func (c *Client) readHandle(ctx context.Context, h *storage.ObjectHandle) (*storage.ObjectHandle, error) {
+	if len(c.customerKeys) == 0 {
+		return h, nil
+	}
+	attrs, err := h.Attrs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attributes of GCS object '%s': %w", h.ObjectName(), mapError(err))
+	}
+	return c.withCustomerKey(h.Generation(attrs.Generation), objectAttrsFrom(attrs))
+}
+
+// withCustomerKey returns h with the configured customer-supplied key that the object
+// described by attrs is encrypted with, if any.
+func (c *Client) withCustomerKey(h *storage.ObjectHandle, attrs *ObjectAttrs) (*storage.ObjectHandle, error) {
+	if attrs.CustomerKeySHA256 == "" {
+		return h, nil
+	}
+	key := c.customerKey(attrs.CustomerKeySHA256)
+	if key == nil {
+		return nil, fmt.Errorf("%w '%s': no configured customer-supplied key matches the key hash %s", ErrDecryption, attrs.Name, attrs.CustomerKeySHA256)
+	}
+	return h.Key(key), nil
+}
@@ -0,0 +1,122 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownload(t *testing.T) {
+	client, fake := newTestClient(t)
+	ctx := context.Background()
+	fake.put(testBucket, "dir/object.txt", []byte("hello, world"), "text/plain")
+
+	t.Run("Streams the whole object", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, client.Download(ctx, "dir/object.txt", &buf))
+		assert.Equal(t, "hello, world", buf.String())
+	})
+
+	t.Run("Reads back an upload", func(t *testing.T) {
+		_, err := client.Upload(ctx, "uploaded", strings.NewReader("round trip"), UploadOptions{})
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		require.NoError(t, client.Download(ctx, "uploaded", &buf))
+		assert.Equal(t, "round trip", buf.String())
+	})
+
+	t.Run("Fails for a missing object", func(t *testing.T) {
+		err := client.Download(ctx, "missing", io.Discard)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "missing")
+	})
+
+	t.Run("Fails with empty object name", func(t *testing.T) {
+		err := client.Download(ctx, "", io.Discard)
+		require.Error(t, err)
+		assert.Equal(t, "object name cannot be empty", err.Error())
+	})
+}
+
+func TestNewRangeReader(t *testing.T) {
+	client, fake := newTestClient(t)
+	ctx := context.Background()
+	fake.put(testBucket, "digits", []byte("0123456789"), "")
+
+	tests := []struct {
+		name           string
+		offset, length int64
+		want           string
+	}{
+		{"Whole object", 0, -1, "0123456789"},
+		{"Middle", 2, 3, "234"},
+		{"Until the end", 7, -1, "789"},
+		{"Suffix", -4, -1, "6789"},
+		{"Length past the end", 8, 10, "89"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := client.NewRangeReader(ctx, "digits", tt.offset, tt.length)
+			require.NoError(t, err)
+			defer r.Close()
+			got, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+
+	t.Run("NewReader reads everything", func(t *testing.T) {
+		r, err := client.NewReader(ctx, "digits")
+		require.NoError(t, err)
+		defer r.Close()
+		got, _ := io.ReadAll(r)
+		assert.Equal(t, "0123456789", string(got))
+	})
+
+	t.Run("Rejects a length with a suffix offset", func(t *testing.T) {
+		_, err := client.NewRangeReader(ctx, "digits", -4, 2)
+		require.Error(t, err)
+	})
+}
+
+func TestReadAll(t *testing.T) {
+	client, fake := newTestClient(t)
+	ctx := context.Background()
+	fake.put(testBucket, "small", []byte("tiny"), "")
+	fake.put(testBucket, "large", []byte(strings.Repeat("x", 1024)), "")
+
+	data, err := client.ReadAll(ctx, "small", 4)
+	require.NoError(t, err)
+	assert.Equal(t, "tiny", string(data))
+
+	_, err = client.ReadAll(ctx, "large", 1023)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrTooLarge), "expected ErrTooLarge, got %v", err)
+}
+
+func TestStat(t *testing.T) {
+	client, fake := newTestClient(t)
+	ctx := context.Background()
+	obj := fake.put(testBucket, "report.csv", []byte("a,b\n1,2\n"), "text/csv")
+	obj.Metadata = map[string]string{"owner": "batch"}
+
+	attrs, err := client.Stat(ctx, "report.csv")
+	require.NoError(t, err)
+	assert.Equal(t, testBucket, attrs.Bucket)
+	assert.Equal(t, "report.csv", attrs.Name)
+	assert.Equal(t, int64(8), attrs.Size)
+	assert.Equal(t, "text/csv", attrs.ContentType)
+	assert.Equal(t, crc32.Checksum([]byte("a,b\n1,2\n"), crc32.MakeTable(crc32.Castagnoli)), attrs.CRC32C)
+	assert.Equal(t, obj.Generation, attrs.Generation)
+	assert.Equal(t, map[string]string{"owner": "batch"}, attrs.Metadata)
+
+	_, err = client.Stat(ctx, "missing")
+	require.Error(t, err)
+}
@@ -0,0 +1,346 @@
+package gcs
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// MaxSignedURLExpiry is the longest time a V4 signed URL or POST policy can be valid.
+const MaxSignedURLExpiry = 7 * 24 * time.Hour
+
+const (
+	signingAlgorithm = "GOOG4-RSA-SHA256"
+	defaultHostname  = "storage.googleapis.com"
+	iso8601          = "20060102T150405Z"
+	yearMonthDay     = "20060102"
+)
+
+// URLStyle selects the form of the URLs that SignedURL and SignedPostPolicy return.
+type URLStyle int
+
+const (
+	// PathStyle URLs name the bucket in the path:
+	// https://storage.googleapis.com/{bucket}/{object}.
+	PathStyle URLStyle = iota
+	// VirtualHostedStyle URLs name the bucket in the host name:
+	// https://{bucket}.storage.googleapis.com/{object}.
+	VirtualHostedStyle
+	// BucketBoundHostname URLs use a custom domain that serves the bucket, such as a
+	// load balancer or CNAME, given as the Hostname: https://{hostname}/{object}.
+	BucketBoundHostname
+)
+
+// urlTarget is where a signed URL or POST policy points.
+type urlTarget struct {
+	style    URLStyle
+	hostname string
+	insecure bool
+}
+
+// host returns the host of the URL for the bucket.
+func (t urlTarget) host(bucket string) (string, error) {
+	switch t.style {
+	case PathStyle:
+		return cmp.Or(t.hostname, defaultHostname), nil
+	case VirtualHostedStyle:
+		return bucket + "." + cmp.Or(t.hostname, defaultHostname), nil
+	case BucketBoundHostname:
+		if t.hostname == "" {
+			return "", fmt.Errorf("a hostname is required for bucket-bound URLs")
+		}
+		return t.hostname, nil
+	default:
+		return "", fmt.Errorf("unknown URL style %d", t.style)
+	}
+}
+
+// path returns the unescaped path of the URL for the object, without a leading slash.
+func (t urlTarget) path(bucket, object string) string {
+	if t.style == PathStyle {
+		return bucket + "/" + object
+	}
+	return object
+}
+
+// scheme returns the scheme of the URL.
+func (t urlTarget) scheme() string {
+	if t.insecure {
+		return "http"
+	}
+	return "https"
+}
+
+// SignedURLOptions configures SignedURL.
+type SignedURLOptions struct {
+	// ContentType, if set, must be sent as the Content-Type header of the request,
+	// such as the content type of an upload.
+	ContentType string
+	// Headers must be sent with the request, with the same values. Use them to fix
+	// metadata of an upload (x-goog-meta-*), preconditions (x-goog-if-generation-match)
+	// or to start a resumable upload (x-goog-resumable: start).
+	Headers http.Header
+	// QueryParameters are added to the URL and signed, e.g.
+	// response-content-disposition to make browsers download the object.
+	QueryParameters url.Values
+	// Style is the form of the URL; the default is PathStyle.
+	Style URLStyle
+	// Hostname replaces storage.googleapis.com, or is the custom domain for
+	// BucketBoundHostname.
+	Hostname string
+	// Insecure returns an http URL instead of https.
+	Insecure bool
+}
+
+// SignedURL returns a V4 signed URL that allows anyone holding it to make a request
+// with the given HTTP method on an object in the configured bucket, without
+// credentials, until the expiry has passed. Typically, GET URLs let browsers download
+// private objects and PUT URLs let them upload directly to GCS. The URL is signed
+// with the Config.Signer; the expiry can be at most MaxSignedURLExpiry.
+func (c *Client) SignedURL(ctx context.Context, object, method string, expiry time.Duration, opts SignedURLOptions) (string, error) {
+	if object == "" {
+		return "", fmt.Errorf("object name cannot be empty")
+	}
+	method = strings.ToUpper(method)
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPost, http.MethodDelete:
+	default:
+		return "", fmt.Errorf("unsupported method '%s' for a signed URL", method)
+	}
+	if err := c.checkSigning(expiry); err != nil {
+		return "", err
+	}
+	target := urlTarget{style: opts.Style, hostname: opts.Hostname, insecure: opts.Insecure}
+	host, err := target.host(c.bucketName)
+	if err != nil {
+		return "", err
+	}
+
+	now := c.now().UTC()
+	scope := now.Format(yearMonthDay) + "/auto/storage/goog4_request"
+	escapedPath := escapePath(target.path(c.bucketName, object))
+
+	// Canonical headers are lowercase, with values trimmed and whitespace collapsed.
+	// The host is always signed; like GCS, it excludes the port.
+	headers := map[string]string{"host": strings.Split(host, ":")[0]}
+	for name, values := range opts.Headers {
+		value := strings.Join(strings.Fields(strings.Join(values, ",")), " ")
+		if value != "" {
+			headers[strings.ToLower(strings.TrimSpace(name))] = value
+		}
+	}
+	if opts.ContentType != "" {
+		headers["content-type"] = opts.ContentType
+	}
+	names := slices.Sorted(maps.Keys(headers))
+	signedHeaders := strings.Join(names, ";")
+
+	query := url.Values{
+		"X-Goog-Algorithm":     {signingAlgorithm},
+		"X-Goog-Credential":    {c.signer.ServiceAccount() + "/" + scope},
+		"X-Goog-Date":          {now.Format(iso8601)},
+		"X-Goog-Expires":       {strconv.Itoa(int(expiry.Seconds()))},
+		"X-Goog-SignedHeaders": {signedHeaders},
+	}
+	for name, values := range opts.QueryParameters {
+		query[name] = append(query[name], values...)
+	}
+
+	var canonical strings.Builder
+	fmt.Fprintf(&canonical, "%s\n/%s\n%s\n", method, escapedPath, encodeQuery(query))
+	for _, name := range names {
+		fmt.Fprintf(&canonical, "%s:%s\n", name, headers[name])
+	}
+	// A client that signs its payload sends its hash in x-goog-content-sha256.
+	fmt.Fprintf(&canonical, "\n%s\n%s", signedHeaders, cmp.Or(headers["x-goog-content-sha256"], "UNSIGNED-PAYLOAD"))
+
+	digest := sha256.Sum256([]byte(canonical.String()))
+	stringToSign := strings.Join([]string{signingAlgorithm, now.Format(iso8601), scope, hex.EncodeToString(digest[:])}, "\n")
+	signature, err := c.signer.SignBlob(ctx, []byte(stringToSign))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign URL for GCS object '%s': %w", object, err)
+	}
+	query.Set("X-Goog-Signature", hex.EncodeToString(signature))
+
+	c.logger.DebugContext(ctx, "Signed URL for object", "object", object, "bucket", c.bucketName, "method", method, "expiry", expiry)
+	return target.scheme() + "://" + host + "/" + escapedPath + "?" + encodeQuery(query), nil
+}
+
+// PostPolicyOptions configures SignedPostPolicy. Each set field is both a form field
+// of the upload and a condition of the policy, so the uploader cannot change it.
+type PostPolicyOptions struct {
+	ContentType        string
+	CacheControl       string
+	ContentDisposition string
+	ContentEncoding    string
+	// Metadata is the custom metadata of the uploaded object.
+	Metadata map[string]string
+	// MinSize and MaxSize limit the size of the upload in bytes when MaxSize is not
+	// zero.
+	MinSize, MaxSize int64
+	// StartsWith requires form fields, by name, to start with a prefix, e.g.
+	// {"Content-Type": "image/"}. This allows the uploader to choose the value.
+	StartsWith map[string]string
+	// RedirectURL is where the browser is redirected after a successful upload.
+	RedirectURL string
+	// SuccessStatus is the HTTP status returned after a successful upload without a
+	// RedirectURL, 200, 201 or 204. Zero means 204.
+	SuccessStatus int
+	// Style is the form of the URL; the default is PathStyle.
+	Style URLStyle
+	// Hostname replaces storage.googleapis.com, or is the custom domain for
+	// BucketBoundHostname.
+	Hostname string
+	// Insecure returns an http URL instead of https.
+	Insecure bool
+}
+
+// PostPolicy is a signed policy for an HTML form upload: a multipart/form-data POST
+// to URL with all Fields as form fields, followed by a "file" field with the data.
+type PostPolicy struct {
+	URL    string
+	Fields map[string]string
+}
+
+// SignedPostPolicy returns a V4 signed POST policy that allows browsers to upload an
+// object to the configured bucket with an HTML form, without credentials, until the
+// expiry has passed. The object name may contain "${filename}", which GCS replaces
+// with the name of the uploaded file. The policy is signed with the Config.Signer;
+// the expiry can be at most MaxSignedURLExpiry.
+func (c *Client) SignedPostPolicy(ctx context.Context, object string, expiry time.Duration, opts PostPolicyOptions) (*PostPolicy, error) {
+	if object == "" {
+		return nil, fmt.Errorf("object name cannot be empty")
+	}
+	if opts.MinSize < 0 || opts.MaxSize < opts.MinSize && opts.MaxSize != 0 {
+		return nil, fmt.Errorf("invalid size range %d-%d", opts.MinSize, opts.MaxSize)
+	}
+	if err := c.checkSigning(expiry); err != nil {
+		return nil, err
+	}
+	target := urlTarget{style: opts.Style, hostname: opts.Hostname, insecure: opts.Insecure}
+	host, err := target.host(c.bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	now := c.now().UTC()
+	credential := c.signer.ServiceAccount() + "/" + now.Format(yearMonthDay) + "/auto/storage/goog4_request"
+	fields := map[string]string{
+		"key":                     object,
+		"x-goog-date":             now.Format(iso8601),
+		"x-goog-credential":       credential,
+		"x-goog-algorithm":        signingAlgorithm,
+		"cache-control":           opts.CacheControl,
+		"content-disposition":     opts.ContentDisposition,
+		"content-encoding":        opts.ContentEncoding,
+		"content-type":            opts.ContentType,
+		"success_action_redirect": opts.RedirectURL,
+	}
+	if opts.SuccessStatus != 0 {
+		fields["success_action_status"] = strconv.Itoa(opts.SuccessStatus)
+	}
+
+	// The conditions are ordered like the GCS conformance tests, so that policies are
+	// reproducible.
+	var conditions []any
+	if opts.MaxSize != 0 {
+		conditions = append(conditions, []any{"content-length-range", opts.MinSize, opts.MaxSize})
+	}
+	for _, name := range slices.Sorted(maps.Keys(opts.StartsWith)) {
+		conditions = append(conditions, []string{"starts-with", "$" + name, opts.StartsWith[name]})
+	}
+	for _, name := range []string{"cache-control", "content-disposition", "content-encoding", "content-type", "success_action_redirect", "success_action_status"} {
+		if fields[name] != "" {
+			conditions = append(conditions, map[string]string{name: fields[name]})
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(opts.Metadata)) {
+		field := "x-goog-meta-" + name
+		fields[field] = opts.Metadata[name]
+		conditions = append(conditions, map[string]string{field: fields[field]})
+	}
+	for _, name := range []string{"bucket", "key", "x-goog-date", "x-goog-credential", "x-goog-algorithm"} {
+		value := fields[name]
+		if name == "bucket" {
+			value = c.bucketName
+		}
+		conditions = append(conditions, map[string]string{name: value})
+	}
+
+	policy, err := json.Marshal(map[string]any{
+		"conditions": conditions,
+		"expiration": now.Add(expiry).Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode POST policy for GCS object '%s': %w", object, err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(escapeNonASCII(policy))
+	signature, err := c.signer.SignBlob(ctx, []byte(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign POST policy for GCS object '%s': %w", object, err)
+	}
+	fields["policy"] = encoded
+	fields["x-goog-signature"] = hex.EncodeToString(signature)
+	maps.DeleteFunc(fields, func(_, value string) bool { return value == "" })
+
+	c.logger.DebugContext(ctx, "Signed POST policy for object", "object", object, "bucket", c.bucketName, "expiry", expiry)
+	return &PostPolicy{
+		URL:    target.scheme() + "://" + host + "/" + escapePath(target.path(c.bucketName, "")),
+		Fields: fields,
+	}, nil
+}
+
+// checkSigning validates the signer and the expiry of a signed URL or policy.
+func (c *Client) checkSigning(expiry time.Duration) error {
+	if c.signer == nil {
+		return fmt.Errorf("signing requires a Signer in the client config")
+	}
+	if expiry < time.Second || expiry > MaxSignedURLExpiry {
+		return fmt.Errorf("expiry must be between 1s and %s, got %s", MaxSignedURLExpiry, expiry)
+	}
+	return nil
+}
+
+// escapePath escapes each segment of a path as V4 signing requires, keeping slashes.
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+	}
+	return strings.Join(segments, "/")
+}
+
+// escapeNonASCII replaces the non-ASCII characters in JSON with \u escapes, as GCS
+// expects in POST policies.
+func escapeNonASCII(data []byte) []byte {
+	var b strings.Builder
+	for _, r := range string(data) {
+		if r < utf8.RuneSelf {
+			b.WriteRune(r)
+			continue
+		}
+		for _, u := range utf16.Encode([]rune{r}) {
+			fmt.Fprintf(&b, "\\u%04x", u)
+		}
+	}
+	return []byte(b.String())
+}
+
+// encodeQuery encodes query parameters sorted by name, escaping spaces as %20 as V4
+// signing requires.
+func encodeQuery(q url.Values) string {
+	return strings.ReplaceAll(q.Encode(), "+", "%20")
+}
@@ -0,0 +1,293 @@
+package gcs
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+)
+
+// The signing tests use the dummy service account key and the test vectors of the
+// cross-language GCS V4 signing conformance suite, limited to the options this
+// package supports.
+
+// testSigner returns a PrivateKeySigner for the conformance suite's service account.
+func testSigner(t *testing.T) *PrivateKeySigner {
+	t.Helper()
+	key, err := os.ReadFile("testdata/service-account.json")
+	require.NoError(t, err)
+	signer, err := NewServiceAccountKeySigner(key)
+	require.NoError(t, err)
+	return signer
+}
+
+// signingClient returns a client for bucket that signs with signer at a fixed time.
+func signingClient(bucket string, signer Signer, now time.Time) *Client {
+	return &Client{
+		bucketName: bucket,
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		signer:     signer,
+		now:        func() time.Time { return now },
+	}
+}
+
+// conformanceTests holds the test vectors in testdata/v4_signatures.json.
+type conformanceTests struct {
+	SigningV4Tests []struct {
+		Description         string            `json:"description"`
+		Bucket              string            `json:"bucket"`
+		Object              string            `json:"object"`
+		Method              string            `json:"method"`
+		Expiration          int               `json:"expiration"`
+		Timestamp           time.Time         `json:"timestamp"`
+		Headers             map[string]string `json:"headers"`
+		QueryParameters     map[string]string `json:"queryParameters"`
+		Scheme              string            `json:"scheme"`
+		URLStyle            string            `json:"urlStyle"`
+		BucketBoundHostname string            `json:"bucketBoundHostname"`
+		Hostname            string            `json:"hostname"`
+		ExpectedURL         string            `json:"expectedUrl"`
+	} `json:"signingV4Tests"`
+	PostPolicyV4Tests []struct {
+		Description string `json:"description"`
+		PolicyInput struct {
+			Scheme              string            `json:"scheme"`
+			URLStyle            string            `json:"urlStyle"`
+			BucketBoundHostname string            `json:"bucketBoundHostname"`
+			Bucket              string            `json:"bucket"`
+			Object              string            `json:"object"`
+			Expiration          int               `json:"expiration"`
+			Timestamp           time.Time         `json:"timestamp"`
+			Fields              map[string]string `json:"fields"`
+			Conditions          struct {
+				StartsWith         []string `json:"startsWith"`
+				ContentLengthRange []int64  `json:"contentLengthRange"`
+			} `json:"conditions"`
+		} `json:"policyInput"`
+		PolicyOutput struct {
+			URL                   string            `json:"url"`
+			Fields                map[string]string `json:"fields"`
+			ExpectedDecodedPolicy string            `json:"expectedDecodedPolicy"`
+		} `json:"policyOutput"`
+	} `json:"postPolicyV4Tests"`
+}
+
+func loadConformanceTests(t *testing.T) conformanceTests {
+	t.Helper()
+	data, err := os.ReadFile("testdata/v4_signatures.json")
+	require.NoError(t, err)
+	var tests conformanceTests
+	require.NoError(t, json.Unmarshal(data, &tests))
+	return tests
+}
+
+// conformanceTarget returns the URL style and hostname of a test vector.
+func conformanceTarget(style, boundHostname, hostname string) (URLStyle, string) {
+	switch style {
+	case "VIRTUAL_HOSTED_STYLE":
+		return VirtualHostedStyle, hostname
+	case "BUCKET_BOUND_HOSTNAME":
+		return BucketBoundHostname, boundHostname
+	default:
+		return PathStyle, hostname
+	}
+}
+
+// assertSameURL compares URLs irrespective of the order and escaping of the query.
+func assertSameURL(t *testing.T, want, got string) {
+	t.Helper()
+	wantURL, err := url.Parse(want)
+	require.NoError(t, err)
+	gotURL, err := url.Parse(got)
+	require.NoError(t, err)
+	assert.Equal(t, wantURL.Scheme, gotURL.Scheme)
+	assert.Equal(t, wantURL.Host, gotURL.Host)
+	assert.Equal(t, wantURL.EscapedPath(), gotURL.EscapedPath())
+	assert.Equal(t, wantURL.Query(), gotURL.Query())
+}
+
+func TestSignedURL_Conformance(t *testing.T) {
+	signer := testSigner(t)
+	for _, tc := range loadConformanceTests(t).SigningV4Tests {
+		t.Run(tc.Description, func(t *testing.T) {
+			style, hostname := conformanceTarget(tc.URLStyle, tc.BucketBoundHostname, tc.Hostname)
+			opts := SignedURLOptions{
+				Headers:  http.Header{},
+				Style:    style,
+				Hostname: hostname,
+				Insecure: tc.Scheme == "http",
+			}
+			for name, value := range tc.Headers {
+				opts.Headers[name] = []string{value}
+			}
+			if len(tc.QueryParameters) > 0 {
+				opts.QueryParameters = url.Values{}
+				for name, value := range tc.QueryParameters {
+					opts.QueryParameters.Set(name, value)
+				}
+			}
+
+			client := signingClient(tc.Bucket, signer, tc.Timestamp)
+			got, err := client.SignedURL(context.Background(), tc.Object, tc.Method, time.Duration(tc.Expiration)*time.Second, opts)
+			require.NoError(t, err)
+			assertSameURL(t, tc.ExpectedURL, got)
+		})
+	}
+}
+
+func TestSignedPostPolicy_Conformance(t *testing.T) {
+	signer := testSigner(t)
+	for _, tc := range loadConformanceTests(t).PostPolicyV4Tests {
+		t.Run(tc.Description, func(t *testing.T) {
+			in := tc.PolicyInput
+			style, hostname := conformanceTarget(in.URLStyle, in.BucketBoundHostname, "")
+			opts := PostPolicyOptions{
+				ContentType:        in.Fields["content-type"],
+				CacheControl:       in.Fields["cache-control"],
+				ContentDisposition: in.Fields["content-disposition"],
+				ContentEncoding:    in.Fields["content-encoding"],
+				RedirectURL:        in.Fields["success_action_redirect"],
+				Style:              style,
+				Hostname:           hostname,
+				Insecure:           in.Scheme == "http",
+			}
+			if status := in.Fields["success_action_status"]; status != "" {
+				opts.SuccessStatus, _ = strconv.Atoi(status)
+			}
+			for name, value := range in.Fields {
+				if meta, ok := strings.CutPrefix(name, "x-goog-meta-"); ok {
+					opts.Metadata = map[string]string{meta: value}
+				}
+			}
+			if sw := in.Conditions.StartsWith; len(sw) == 2 {
+				opts.StartsWith = map[string]string{strings.TrimPrefix(sw[0], "$"): sw[1]}
+			}
+			if r := in.Conditions.ContentLengthRange; len(r) == 2 {
+				opts.MinSize, opts.MaxSize = r[0], r[1]
+			}
+
+			client := signingClient(in.Bucket, signer, in.Timestamp)
+			got, err := client.SignedPostPolicy(context.Background(), in.Object, time.Duration(in.Expiration)*time.Second, opts)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.PolicyOutput.URL, got.URL)
+			policy, err := base64.StdEncoding.DecodeString(got.Fields["policy"])
+			require.NoError(t, err)
+			// The expected policy is given with non-ASCII characters unescaped.
+			assert.Equal(t, string(escapeNonASCII([]byte(tc.PolicyOutput.ExpectedDecodedPolicy))), string(policy))
+			assert.Equal(t, tc.PolicyOutput.Fields, got.Fields)
+		})
+	}
+}
+
+func TestSignedURL(t *testing.T) {
+	signer := testSigner(t)
+	now := time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC)
+	client := signingClient("uploads", signer, now)
+	ctx := context.Background()
+
+	t.Run("Signature verifies with the public key", func(t *testing.T) {
+		got, err := client.SignedURL(ctx, "images/cat photo.png", "put", 15*time.Minute, SignedURLOptions{ContentType: "image/png"})
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(got, "https://storage.googleapis.com/uploads/images/cat%20photo.png?"))
+
+		u, err := url.Parse(got)
+		require.NoError(t, err)
+		q := u.Query()
+		assert.Equal(t, "20260314T150926Z", q.Get("X-Goog-Date"))
+		assert.Equal(t, "900", q.Get("X-Goog-Expires"))
+		assert.Equal(t, "content-type;host", q.Get("X-Goog-SignedHeaders"))
+		signature, err := hex.DecodeString(q.Get("X-Goog-Signature"))
+		require.NoError(t, err)
+
+		q.Del("X-Goog-Signature")
+		canonical := "PUT\n/uploads/images/cat%20photo.png\n" + encodeQuery(q) + "\n" +
+			"content-type:image/png\nhost:storage.googleapis.com\n\ncontent-type;host\nUNSIGNED-PAYLOAD"
+		digest := sha256.Sum256([]byte(canonical))
+		stringToSign := "GOOG4-RSA-SHA256\n20260314T150926Z\n20260314/auto/storage/goog4_request\n" + hex.EncodeToString(digest[:])
+		sum := sha256.Sum256([]byte(stringToSign))
+		assert.NoError(t, rsa.VerifyPKCS1v15(&signer.key.PublicKey, crypto.SHA256, sum[:], signature))
+	})
+
+	t.Run("Rejects invalid arguments", func(t *testing.T) {
+		_, err := client.SignedURL(ctx, "", "GET", time.Hour, SignedURLOptions{})
+		assert.Error(t, err)
+		_, err = client.SignedURL(ctx, "a", "PATCH", time.Hour, SignedURLOptions{})
+		assert.Error(t, err)
+		_, err = client.SignedURL(ctx, "a", "GET", MaxSignedURLExpiry+time.Second, SignedURLOptions{})
+		assert.Error(t, err)
+		_, err = client.SignedURL(ctx, "a", "GET", 0, SignedURLOptions{})
+		assert.Error(t, err)
+		_, err = client.SignedURL(ctx, "a", "GET", time.Hour, SignedURLOptions{Style: BucketBoundHostname})
+		assert.Error(t, err)
+		_, err = client.SignedPostPolicy(ctx, "a", time.Hour, PostPolicyOptions{MinSize: 10, MaxSize: 5})
+		assert.Error(t, err)
+	})
+
+	t.Run("Requires a signer", func(t *testing.T) {
+		_, err := signingClient("uploads", nil, now).SignedURL(ctx, "a", "GET", time.Hour, SignedURLOptions{})
+		assert.ErrorContains(t, err, "Signer")
+	})
+}
+
+func TestIAMSigner(t *testing.T) {
+	local := testSigner(t)
+	var gotName string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotName = strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/"), ":signBlob")
+		var req struct {
+			Payload string `json:"payload"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		payload, _ := base64.StdEncoding.DecodeString(req.Payload)
+		signature, _ := local.SignBlob(r.Context(), payload)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"keyId":      "key-1",
+			"signedBlob": base64.StdEncoding.EncodeToString(signature),
+		})
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	iamSigner, err := NewIAMSigner(ctx, local.ServiceAccount(), option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	require.NoError(t, err)
+	assert.Equal(t, local.ServiceAccount(), iamSigner.ServiceAccount())
+
+	// RSA PKCS #1 v1.5 signatures are deterministic, so both signers produce the same URL.
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	want, err := signingClient("b", local, now).SignedURL(ctx, "o", "GET", time.Hour, SignedURLOptions{})
+	require.NoError(t, err)
+	got, err := signingClient("b", iamSigner, now).SignedURL(ctx, "o", "GET", time.Hour, SignedURLOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+	assert.Equal(t, "projects/-/serviceAccounts/"+local.ServiceAccount(), gotName)
+}
+
+func TestNewPrivateKeySigner_Errors(t *testing.T) {
+	_, err := NewPrivateKeySigner("", []byte("key"))
+	assert.Error(t, err)
+	_, err = NewPrivateKeySigner("sa@example.com", []byte("not a key"))
+	assert.Error(t, err)
+	_, err = NewServiceAccountKeySigner([]byte("{"))
+	assert.Error(t, err)
+}
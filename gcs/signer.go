@@ -0,0 +1,136 @@
+package gcs
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+
+	"cloud.google.com/go/compute/metadata"
+	"google.golang.org/api/iamcredentials/v1"
+	"google.golang.org/api/option"
+)
+
+// Signer signs V4 signed URLs and POST policies on behalf of a service account.
+// GCS verifies the signatures with the public keys of that service account.
+type Signer interface {
+	// ServiceAccount returns the email of the service account whose key signs.
+	ServiceAccount() string
+	// SignBlob returns the RSA PKCS #1 v1.5 signature of the SHA-256 hash of data.
+	SignBlob(ctx context.Context, data []byte) ([]byte, error)
+}
+
+// PrivateKeySigner signs locally with the private key of a service account.
+type PrivateKeySigner struct {
+	serviceAccount string
+	key            *rsa.PrivateKey
+}
+
+// NewPrivateKeySigner returns a Signer for the service account with the given email
+// and PEM-encoded RSA private key, in PKCS #8 or PKCS #1 form.
+func NewPrivateKeySigner(serviceAccount string, pemKey []byte) (*PrivateKeySigner, error) {
+	if serviceAccount == "" {
+		return nil, fmt.Errorf("service account email cannot be empty")
+	}
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, fmt.Errorf("private key is not PEM encoded")
+	}
+
+	var key *rsa.PrivateKey
+	if parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("private key is a %T, not an RSA key", parsed)
+		}
+		key = rsaKey
+	} else if rsaKey, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		key = rsaKey
+	} else {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	return &PrivateKeySigner{serviceAccount: serviceAccount, key: key}, nil
+}
+
+// NewServiceAccountKeySigner returns a PrivateKeySigner for a service account JSON key
+// file, as downloaded from the Google Cloud console.
+func NewServiceAccountKeySigner(jsonKey []byte) (*PrivateKeySigner, error) {
+	var key struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+	}
+	if err := json.Unmarshal(jsonKey, &key); err != nil {
+		return nil, fmt.Errorf("failed to parse service account key: %w", err)
+	}
+	return NewPrivateKeySigner(key.ClientEmail, []byte(key.PrivateKey))
+}
+
+// ServiceAccount implements Signer.
+func (s *PrivateKeySigner) ServiceAccount() string {
+	return s.serviceAccount
+}
+
+// SignBlob implements Signer.
+func (s *PrivateKeySigner) SignBlob(_ context.Context, data []byte) ([]byte, error) {
+	sum := sha256.Sum256(data)
+	return rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, sum[:])
+}
+
+// IAMSigner signs with the IAM Credentials API signBlob method, using a
+// Google-managed key of the service account. It works with credentials that have no
+// private key, such as the metadata server credentials of Cloud Run, Cloud Functions
+// and GCE. The caller needs the roles/iam.serviceAccountTokenCreator role on the
+// service account, which for the account's own credentials must be granted
+// explicitly.
+type IAMSigner struct {
+	serviceAccount string
+	service        *iamcredentials.Service
+}
+
+// NewIAMSigner returns a Signer that signs as the given service account through the
+// IAM Credentials API. An empty serviceAccount uses the default service account of
+// the metadata server, which is the identity of a Cloud Run service. The options
+// configure the API client; by default it uses Application Default Credentials.
+func NewIAMSigner(ctx context.Context, serviceAccount string, opts ...option.ClientOption) (*IAMSigner, error) {
+	if serviceAccount == "" {
+		email, err := metadata.EmailWithContext(ctx, "default")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the default service account from the metadata server: %w", err)
+		}
+		serviceAccount = email
+	}
+
+	service, err := iamcredentials.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create IAM Credentials client: %w", err)
+	}
+	return &IAMSigner{serviceAccount: serviceAccount, service: service}, nil
+}
+
+// ServiceAccount implements Signer.
+func (s *IAMSigner) ServiceAccount() string {
+	return s.serviceAccount
+}
+
+// SignBlob implements Signer.
+func (s *IAMSigner) SignBlob(ctx context.Context, data []byte) ([]byte, error) {
+	name := "projects/-/serviceAccounts/" + s.serviceAccount
+	resp, err := s.service.Projects.ServiceAccounts.SignBlob(name, &iamcredentials.SignBlobRequest{
+		Payload: base64.StdEncoding.EncodeToString(data),
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign blob as '%s': %w", s.serviceAccount, err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(resp.SignedBlob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode signature for '%s': %w", s.serviceAccount, err)
+	}
+	return signature, nil
+}
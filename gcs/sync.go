@@ -0,0 +1,412 @@
+package gcs
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrEmptySyncSource is returned by Sync with SyncOptions.Delete when the source has
+// no files or objects, unless SyncOptions.AllowEmptySource is set.
+var ErrEmptySyncSource = errors.New("sync source is empty")
+
+// SyncDirection selects which side of a Sync is the source.
+type SyncDirection int
+
+const (
+	// SyncUpload makes the objects under the prefix mirror the local directory.
+	SyncUpload SyncDirection = iota
+	// SyncDownload makes the local directory mirror the objects under the prefix.
+	SyncDownload
+)
+
+// String returns "upload" or "download".
+func (d SyncDirection) String() string {
+	if d == SyncDownload {
+		return "download"
+	}
+	return "upload"
+}
+
+// SyncReason explains why Sync copied or deleted a file or object.
+type SyncReason string
+
+const (
+	// SyncMissing means the destination did not exist.
+	SyncMissing SyncReason = "missing"
+	// SyncSizeChanged means the destination had a different size.
+	SyncSizeChanged SyncReason = "size"
+	// SyncChecksumChanged means the destination had the same size but a different
+	// CRC32C checksum.
+	SyncChecksumChanged SyncReason = "checksum"
+	// SyncExtraneous means the destination had no counterpart in the source.
+	SyncExtraneous SyncReason = "extraneous"
+)
+
+// SyncOptions configures a Sync. The zero value uploads the changed files of the
+// local directory without deleting anything.
+type SyncOptions struct {
+	// Direction selects the source and destination; it defaults to SyncUpload.
+	Direction SyncDirection
+	// Delete removes the files or objects at the destination that have no
+	// counterpart in the source.
+	Delete bool
+	// AllowEmptySource lets Delete empty the destination when the source has no files
+	// or objects. Without it, such a Sync fails with ErrEmptySyncSource, because an
+	// empty source usually means a wrong directory or a mistyped prefix.
+	AllowEmptySource bool
+	// AllowBucketRoot lets Delete run with an empty prefix, which makes the whole
+	// bucket the destination or source. Without it, such a Sync is rejected.
+	AllowBucketRoot bool
+	// DryRun compares the source and destination and reports what would be copied
+	// and deleted, without changing either.
+	DryRun bool
+	// Concurrency is the number of files compared and transferred at once; it
+	// defaults to DefaultConcurrency.
+	Concurrency int
+	// Exclude, if set, is called with the slash-separated path of every file and
+	// object relative to the directory and prefix. Excluded paths are neither copied
+	// nor deleted.
+	Exclude func(path string) bool
+}
+
+// SyncEntry describes a file or object that Sync copied or deleted.
+type SyncEntry struct {
+	// Path is the slash-separated path relative to the local directory and prefix.
+	Path string
+	// Object is the name of the object.
+	Object string
+	// Size is the size of the copied source, or of the deleted file or object.
+	Size int64
+	// Reason explains why the entry was copied or deleted.
+	Reason SyncReason
+}
+
+// SyncReport is the result of a Sync. Copied and Deleted are sorted by path.
+type SyncReport struct {
+	Direction SyncDirection
+	// DryRun is set if nothing was changed; Copied and Deleted then list what would
+	// have been.
+	DryRun bool
+	// Copied lists the files or objects that were transferred.
+	Copied []SyncEntry
+	// Deleted lists the files or objects that were removed from the destination.
+	Deleted []SyncEntry
+	// Unchanged is the number of files that matched the destination.
+	Unchanged int
+	// Bytes is the number of bytes transferred.
+	Bytes int64
+}
+
+// syncEntry is a file or object found while listing one side of a sync. The
+// checksum and generation are only set for objects.
+type syncEntry struct {
+	size       int64
+	crc        uint32
+	generation int64
+}
+
+// Sync mirrors the files under localDir to the objects under prefix, or the other
+// way around with SyncDownload. A non-empty prefix is treated as a directory: a
+// trailing slash is added if it is missing, and object names continue with the
+// slash-separated path of the file relative to localDir.
+//
+// Files are compared by size and then by CRC32C checksum, so only new and changed
+// files are transferred, up to opts.Concurrency at once. Uploads are conditional on
+// the generation that was compared, so objects written concurrently are not
+// overwritten but fail with ErrPreconditionFailed. With opts.Delete, destination
+// entries without a source counterpart are removed once all transfers succeeded. If
+// the source is empty, Delete fails with ErrEmptySyncSource before changing anything
+// unless opts.AllowEmptySource is set. Delete with an empty prefix, which covers the
+// whole bucket, is rejected unless opts.AllowBucketRoot is set. The temporary part
+// objects of parallel uploads under DefaultTempPrefix are never synced.
+//
+// Objects are compared as stored, so objects with a Content-Encoding or client-side
+// encryption never match their decoded local files and are copied on every sync.
+//
+// The report lists what was done, even if Sync fails part of the way, in which case
+// the first failure cancels the remaining transfers and no entries are deleted.
+func (c *Client) Sync(ctx context.Context, localDir, prefix string, opts SyncOptions) (*SyncReport, error) {
+	if localDir == "" {
+		return nil, fmt.Errorf("local directory cannot be empty")
+	}
+	if opts.Delete && prefix == "" && !opts.AllowBucketRoot {
+		return nil, fmt.Errorf("refusing to delete when syncing '%s' with the whole bucket, set AllowBucketRoot to allow it", localDir)
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	if opts.Direction == SyncUpload {
+		// A missing source directory must not make the prefix look extraneous.
+		if info, err := os.Stat(localDir); err != nil {
+			return nil, fmt.Errorf("failed to sync local directory '%s': %w", localDir, err)
+		} else if !info.IsDir() {
+			return nil, fmt.Errorf("failed to sync local directory '%s': not a directory", localDir)
+		}
+	}
+	report := &SyncReport{Direction: opts.Direction, DryRun: opts.DryRun}
+
+	c.logger.DebugContext(ctx, "Starting sync", "dir", localDir, "bucket", c.bucketName, "prefix", prefix, "direction", opts.Direction, "dry_run", opts.DryRun)
+
+	local, err := listLocalFiles(localDir, opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := c.listSyncObjects(ctx, prefix, opts.Direction, opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	src, dst := local, remote
+	if opts.Direction == SyncDownload {
+		src, dst = remote, local
+	}
+	if opts.Delete && len(src) == 0 && len(dst) > 0 && !opts.AllowEmptySource {
+		return nil, fmt.Errorf("refusing to delete %d entries when syncing '%s' with GCS prefix '%s': %w", len(dst), localDir, prefix, ErrEmptySyncSource)
+	}
+
+	var mu sync.Mutex
+	record := func(list *[]SyncEntry, entry SyncEntry) {
+		mu.Lock()
+		defer mu.Unlock()
+		*list = append(*list, entry)
+		if list == &report.Copied {
+			report.Bytes += entry.Size
+		}
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(positiveOr(opts.Concurrency, DefaultConcurrency))
+	for _, path := range sortedKeys(src) {
+		g.Go(func() error {
+			from, to := src[path], dst[path]
+			reason, err := syncReason(filepath.Join(localDir, filepath.FromSlash(path)), from, to)
+			if err != nil {
+				return err
+			}
+			if reason == "" {
+				mu.Lock()
+				report.Unchanged++
+				mu.Unlock()
+				return nil
+			}
+			entry := SyncEntry{Path: path, Object: prefix + path, Size: from.size, Reason: reason}
+			if !opts.DryRun {
+				if err := c.syncCopy(gctx, localDir, entry, to, opts.Direction); err != nil {
+					return err
+				}
+			}
+			c.logger.DebugContext(gctx, "Synced file", "path", path, "object", entry.Object, "reason", reason, "direction", opts.Direction)
+			record(&report.Copied, entry)
+			return nil
+		})
+	}
+	err = g.Wait()
+
+	if err == nil && opts.Delete {
+		g, gctx := errgroup.WithContext(ctx)
+		g.SetLimit(positiveOr(opts.Concurrency, DefaultConcurrency))
+		for _, path := range sortedKeys(dst) {
+			if _, ok := src[path]; ok {
+				continue
+			}
+			g.Go(func() error {
+				entry := SyncEntry{Path: path, Object: prefix + path, Size: dst[path].size, Reason: SyncExtraneous}
+				if !opts.DryRun {
+					if err := c.syncDelete(gctx, localDir, entry, dst[path], opts.Direction); err != nil {
+						return err
+					}
+				}
+				record(&report.Deleted, entry)
+				return nil
+			})
+		}
+		err = g.Wait()
+	}
+
+	byPath := func(a, b SyncEntry) int { return cmp.Compare(a.Path, b.Path) }
+	slices.SortFunc(report.Copied, byPath)
+	slices.SortFunc(report.Deleted, byPath)
+	if err != nil {
+		return report, fmt.Errorf("failed to sync '%s' with GCS prefix '%s': %w", localDir, prefix, err)
+	}
+
+	c.logger.InfoContext(ctx, "Synced directory", "dir", localDir, "bucket", c.bucketName, "prefix", prefix, "direction", opts.Direction, "dry_run", opts.DryRun,
+		"copied", len(report.Copied), "deleted", len(report.Deleted), "unchanged", report.Unchanged, "bytes", report.Bytes)
+	return report, nil
+}
+
+// syncReason compares a source entry with its destination, which may be nil, and
+// returns why it must be copied, or "" if they match. The checksum of the local file
+// at path is only computed for entries of equal size.
+func syncReason(path string, from, to *syncEntry) (SyncReason, error) {
+	switch {
+	case to == nil:
+		return SyncMissing, nil
+	case from.size != to.size:
+		return SyncSizeChanged, nil
+	}
+	// One side is the local file at path, the other an object.
+	object := from
+	if to.generation != 0 {
+		object = to
+	}
+	crc, err := fileCRC32C(path)
+	if err != nil {
+		return "", err
+	}
+	if crc != object.crc {
+		return SyncChecksumChanged, nil
+	}
+	return "", nil
+}
+
+// syncCopy transfers one entry. to is the destination entry that was compared, or
+// nil if it was missing.
+func (c *Client) syncCopy(ctx context.Context, localDir string, entry SyncEntry, to *syncEntry, direction SyncDirection) error {
+	path := filepath.Join(localDir, filepath.FromSlash(entry.Path))
+	if direction == SyncDownload {
+		return c.downloadFile(ctx, entry.Object, path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open '%s': %w", path, err)
+	}
+	defer f.Close()
+	conds := Conditions{DoesNotExist: true}
+	if to != nil {
+		conds = Conditions{GenerationMatch: to.generation}
+	}
+	_, err = c.Upload(ctx, entry.Object, f, UploadOptions{Conditions: conds})
+	return err
+}
+
+// syncDelete removes one extraneous entry from the destination.
+func (c *Client) syncDelete(ctx context.Context, localDir string, entry SyncEntry, e *syncEntry, direction SyncDirection) error {
+	if direction == SyncDownload {
+		path := filepath.Join(localDir, filepath.FromSlash(entry.Path))
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove '%s': %w", path, err)
+		}
+		return nil
+	}
+	return c.Delete(ctx, entry.Object, Conditions{GenerationMatch: e.generation})
+}
+
+// downloadFile downloads an object to a temporary file next to path and renames it
+// into place, so path never holds partial data.
+func (c *Client) downloadFile(ctx context.Context, object, path string) (err error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create directory '%s': %w", dir, err)
+	}
+	tmp, err := os.CreateTemp(dir, ".sync-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file in '%s': %w", dir, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if err := c.Download(ctx, object, tmp); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write '%s': %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write '%s': %w", path, err)
+	}
+	return nil
+}
+
+// listLocalFiles returns the regular files under dir by their slash-separated
+// relative path. A missing dir has no files, as before the first download.
+func listLocalFiles(dir string, exclude func(string) bool) (map[string]*syncEntry, error) {
+	files := make(map[string]*syncEntry)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if exclude != nil && exclude(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files[rel] = &syncEntry{size: info.Size()}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list local directory '%s': %w", dir, err)
+	}
+	return files, nil
+}
+
+// listSyncObjects returns the objects under prefix by their path relative to it.
+// Directory placeholders, whose names end with a slash, and the temporary parts of
+// parallel uploads are skipped. When downloading, every path must be a valid local
+// path.
+func (c *Client) listSyncObjects(ctx context.Context, prefix string, direction SyncDirection, exclude func(string) bool) (map[string]*syncEntry, error) {
+	objects := make(map[string]*syncEntry)
+	for attrs, err := range c.List(ctx, ListOptions{Prefix: prefix}) {
+		if err != nil {
+			return nil, err
+		}
+		rel := strings.TrimPrefix(attrs.Name, prefix)
+		if rel == "" || strings.HasPrefix(attrs.Name, DefaultTempPrefix) || strings.HasSuffix(rel, "/") || (exclude != nil && exclude(rel)) {
+			continue
+		}
+		if direction == SyncDownload && (!filepath.IsLocal(filepath.FromSlash(rel)) || rel != filepath.ToSlash(filepath.Clean(filepath.FromSlash(rel)))) {
+			return nil, fmt.Errorf("GCS object '%s' cannot be stored as a local file", attrs.Name)
+		}
+		objects[rel] = &syncEntry{size: attrs.Size, crc: attrs.CRC32C, generation: attrs.Generation}
+	}
+	return objects, nil
+}
+
+// fileCRC32C returns the CRC32C checksum of the file at path.
+func fileCRC32C(path string) (uint32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open '%s': %w", path, err)
+	}
+	defer f.Close()
+	h := crc32.New(crc32cTable)
+	if _, err := io.Copy(h, f); err != nil {
+		return 0, fmt.Errorf("failed to read '%s': %w", path, err)
+	}
+	return h.Sum32(), nil
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys[V any](m map[string]V) []string {
+	return slices.Sorted(maps.Keys(m))
+}
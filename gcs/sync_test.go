@@ -0,0 +1,243 @@
+package gcs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFiles creates files under dir from slash-separated paths to contents.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+// syncPaths returns the paths and reasons of entries.
+func syncPaths(entries []SyncEntry) []string {
+	paths := []string{}
+	for _, e := range entries {
+		paths = append(paths, e.Path+":"+string(e.Reason))
+	}
+	return paths
+}
+
+func TestSyncUpload(t *testing.T) {
+	ctx := context.Background()
+	client, fake := newTestClient(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "alpha", "sub/b.bin": "bravo", "sub/deep/c": "charlie"})
+	fake.put(testBucket, "backupx/outside", []byte("x"), "")
+	fake.put(testBucket, "other", []byte("x"), "")
+
+	t.Run("Uploads new files", func(t *testing.T) {
+		report, err := client.Sync(ctx, dir, "backup", SyncOptions{Concurrency: 2})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a.txt:missing", "sub/b.bin:missing", "sub/deep/c:missing"}, syncPaths(report.Copied))
+		assert.Equal(t, "backup/sub/b.bin", report.Copied[1].Object)
+		assert.Equal(t, int64(17), report.Bytes)
+		assert.Zero(t, report.Unchanged)
+		assert.Equal(t, "charlie", string(fake.get(testBucket, "backup/sub/deep/c").Data))
+	})
+
+	t.Run("Skips unchanged files", func(t *testing.T) {
+		report, err := client.Sync(ctx, dir, "backup/", SyncOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, report.Copied)
+		assert.Equal(t, 3, report.Unchanged)
+		assert.Zero(t, report.Bytes)
+	})
+
+	t.Run("Uploads changed files", func(t *testing.T) {
+		writeFiles(t, dir, map[string]string{"a.txt": "alpha, longer", "sub/b.bin": "BRAVO"})
+		report, err := client.Sync(ctx, dir, "backup", SyncOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a.txt:size", "sub/b.bin:checksum"}, syncPaths(report.Copied))
+		assert.Equal(t, 1, report.Unchanged)
+		assert.Equal(t, "BRAVO", string(fake.get(testBucket, "backup/sub/b.bin").Data))
+	})
+
+	fake.put(testBucket, "backup/old.txt", []byte("stale"), "")
+	fake.put(testBucket, "backup/placeholder/", nil, "")
+
+	t.Run("Dry run changes nothing", func(t *testing.T) {
+		writeFiles(t, dir, map[string]string{"new.txt": "new"})
+		report, err := client.Sync(ctx, dir, "backup", SyncOptions{Delete: true, DryRun: true})
+		require.NoError(t, err)
+		assert.True(t, report.DryRun)
+		assert.Equal(t, []string{"new.txt:missing"}, syncPaths(report.Copied))
+		assert.Equal(t, []string{"old.txt:extraneous"}, syncPaths(report.Deleted))
+		assert.Equal(t, int64(3), report.Bytes)
+		assert.Nil(t, fake.get(testBucket, "backup/new.txt"))
+		assert.NotNil(t, fake.get(testBucket, "backup/old.txt"))
+	})
+
+	t.Run("Keeps extraneous objects unless deleting", func(t *testing.T) {
+		report, err := client.Sync(ctx, dir, "backup", SyncOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, report.Deleted)
+		assert.NotNil(t, fake.get(testBucket, "backup/old.txt"))
+
+		report, err = client.Sync(ctx, dir, "backup", SyncOptions{Delete: true})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"old.txt:extraneous"}, syncPaths(report.Deleted))
+		assert.Nil(t, fake.get(testBucket, "backup/old.txt"))
+		assert.NotNil(t, fake.get(testBucket, "backup/placeholder/"), "expected directory placeholders to be kept")
+		assert.NotNil(t, fake.get(testBucket, "backupx/outside"))
+		assert.NotNil(t, fake.get(testBucket, "other"))
+	})
+
+	t.Run("Excluded paths", func(t *testing.T) {
+		writeFiles(t, dir, map[string]string{"tmp/scratch": "x"})
+		fake.put(testBucket, "backup/tmp/remote", []byte("y"), "")
+		report, err := client.Sync(ctx, dir, "backup", SyncOptions{Delete: true, Exclude: func(path string) bool {
+			return strings.HasPrefix(path, "tmp/")
+		}})
+		require.NoError(t, err)
+		assert.Empty(t, report.Copied)
+		assert.Empty(t, report.Deleted)
+		assert.Nil(t, fake.get(testBucket, "backup/tmp/scratch"))
+		assert.NotNil(t, fake.get(testBucket, "backup/tmp/remote"))
+	})
+}
+
+func TestSyncDownload(t *testing.T) {
+	ctx := context.Background()
+	client, fake := newTestClient(t)
+	for name, content := range map[string]string{"exports/a.csv": "a,b\n", "exports/2024/jan.csv": "jan", "exports/2024/feb.csv": "feb"} {
+		fake.put(testBucket, name, []byte(content), "text/csv")
+	}
+	dir := filepath.Join(t.TempDir(), "mirror")
+
+	report, err := client.Sync(ctx, dir, "exports", SyncOptions{Direction: SyncDownload})
+	require.NoError(t, err)
+	assert.Equal(t, SyncDownload, report.Direction)
+	assert.Equal(t, []string{"2024/feb.csv:missing", "2024/jan.csv:missing", "a.csv:missing"}, syncPaths(report.Copied))
+	got, err := os.ReadFile(filepath.Join(dir, "2024", "jan.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, "jan", string(got))
+
+	writeFiles(t, dir, map[string]string{"a.csv": "x,y\n", "local-only": "z"})
+	report, err = client.Sync(ctx, dir, "exports", SyncOptions{Direction: SyncDownload, Delete: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.csv:checksum"}, syncPaths(report.Copied))
+	assert.Equal(t, []string{"local-only:extraneous"}, syncPaths(report.Deleted))
+	assert.Equal(t, 2, report.Unchanged)
+	got, err = os.ReadFile(filepath.Join(dir, "a.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, "a,b\n", string(got))
+	_, err = os.Stat(filepath.Join(dir, "local-only"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, e := range entries {
+		assert.False(t, strings.HasPrefix(e.Name(), ".sync-"), "expected no temporary files, found %s", e.Name())
+	}
+}
+
+func TestSyncErrors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Missing local directory", func(t *testing.T) {
+		client, fake := newTestClient(t)
+		fake.put(testBucket, "backup/keep", []byte("x"), "")
+		_, err := client.Sync(ctx, filepath.Join(t.TempDir(), "missing"), "backup", SyncOptions{Delete: true})
+		require.ErrorIs(t, err, os.ErrNotExist)
+		assert.NotNil(t, fake.get(testBucket, "backup/keep"))
+
+		_, err = client.Sync(ctx, "", "backup", SyncOptions{})
+		require.Error(t, err)
+	})
+
+	t.Run("Failed transfers skip deletion", func(t *testing.T) {
+		client, fake := newTestClient(t)
+		dir := t.TempDir()
+		files := make(map[string]string)
+		for i := range 20 {
+			files[fmt.Sprintf("f%02d", i)] = "data"
+		}
+		writeFiles(t, dir, files)
+		fake.put(testBucket, "backup/extra", []byte("x"), "")
+		fake.failUploads = func(name string) bool { return name == "backup/f07" }
+
+		report, err := client.Sync(ctx, dir, "backup", SyncOptions{Delete: true, Concurrency: 1})
+		require.Error(t, err)
+		require.NotNil(t, report)
+		assert.Len(t, report.Copied, 7)
+		assert.Empty(t, report.Deleted)
+		assert.NotNil(t, fake.get(testBucket, "backup/extra"))
+	})
+
+	t.Run("Empty sources do not empty the destination", func(t *testing.T) {
+		client, fake := newTestClient(t)
+		fake.put(testBucket, "exports/a.csv", []byte("a"), "")
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{"keep.txt": "local"})
+
+		_, err := client.Sync(ctx, dir, "exprots", SyncOptions{Direction: SyncDownload, Delete: true})
+		require.ErrorIs(t, err, ErrEmptySyncSource)
+		_, err = os.Stat(filepath.Join(dir, "keep.txt"))
+		require.NoError(t, err)
+
+		_, err = client.Sync(ctx, t.TempDir(), "exports", SyncOptions{Delete: true, DryRun: true})
+		require.ErrorIs(t, err, ErrEmptySyncSource)
+		assert.NotNil(t, fake.get(testBucket, "exports/a.csv"))
+
+		report, err := client.Sync(ctx, dir, "exprots", SyncOptions{Direction: SyncDownload, Delete: true, AllowEmptySource: true})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"keep.txt:extraneous"}, syncPaths(report.Deleted))
+		_, err = os.Stat(filepath.Join(dir, "keep.txt"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("Deleting at the bucket root needs opting in", func(t *testing.T) {
+		client, fake := newTestClient(t)
+		fake.put(testBucket, "other", []byte("x"), "")
+		fake.put(testBucket, DefaultTempPrefix+"0123/part-00000", []byte("part"), "")
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{"a.txt": "alpha"})
+
+		_, err := client.Sync(ctx, dir, "", SyncOptions{Delete: true})
+		require.ErrorContains(t, err, "AllowBucketRoot")
+		assert.Nil(t, fake.get(testBucket, "a.txt"))
+
+		report, err := client.Sync(ctx, dir, "", SyncOptions{Delete: true, AllowBucketRoot: true})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a.txt:missing"}, syncPaths(report.Copied))
+		assert.Equal(t, []string{"other:extraneous"}, syncPaths(report.Deleted))
+		assert.NotNil(t, fake.get(testBucket, DefaultTempPrefix+"0123/part-00000"), "expected parallel upload parts to be kept")
+	})
+
+	t.Run("Parallel upload parts are not synced", func(t *testing.T) {
+		client, fake := newTestClient(t)
+		fake.put(testBucket, "a.txt", []byte("alpha"), "")
+		fake.put(testBucket, DefaultTempPrefix+"0123/part-00000", []byte("part"), "")
+		dir := t.TempDir()
+
+		report, err := client.Sync(ctx, dir, "", SyncOptions{Direction: SyncDownload})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a.txt:missing"}, syncPaths(report.Copied))
+		_, err = os.Stat(filepath.Join(dir, filepath.FromSlash(DefaultTempPrefix)))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("Object names that are not local paths", func(t *testing.T) {
+		client, fake := newTestClient(t)
+		fake.put(testBucket, "exports/../escape", []byte("x"), "")
+		dir := t.TempDir()
+		_, err := client.Sync(ctx, dir, "exports", SyncOptions{Direction: SyncDownload})
+		require.Error(t, err)
+		_, err = os.Stat(filepath.Join(filepath.Dir(dir), "escape"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
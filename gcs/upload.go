@@ -0,0 +1,272 @@
+package gcs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"path"
+
+	apierrors "github.com/duizendstra/dui-go/errors"
+)
+
+// ErrChecksumMismatch is wrapped by the error Upload returns when the uploaded data
+// does not match the expected checksums in UploadOptions, or when VerifyChecksums
+// finds that GCS stored different data. It is a 400 APIError.
+var ErrChecksumMismatch = apierrors.New(400, "checksum mismatch")
+
+// crc32cTable is the Castagnoli table GCS uses for CRC32C checksums.
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// sniffLen is the number of bytes http.DetectContentType considers.
+const sniffLen = 512
+
+// UploadOptions configures an Upload. The zero value uploads with a detected content
+// type, overwriting any existing object.
+type UploadOptions struct {
+	// ContentType is the MIME type of the object. If empty, it is derived from the
+	// extension of the object name or, failing that, sniffed from the first 512 bytes
+	// of the data.
+	ContentType string
+	// Metadata is the custom metadata of the object.
+	Metadata map[string]string
+	// CacheControl is the Cache-Control header served with the object.
+	CacheControl string
+	// ContentEncoding is the Content-Encoding of the data, such as "gzip". The data
+	// is uploaded as is; set it for data that is already encoded.
+	ContentEncoding string
+	// CRC32C is the expected CRC32C checksum of the data. If set, GCS rejects data
+	// that does not match and Upload returns an error wrapping ErrChecksumMismatch.
+	CRC32C *uint32
+	// MD5 is the expected MD5 hash of the data. If set, GCS rejects data that does not
+	// match and Upload returns an error wrapping ErrChecksumMismatch.
+	MD5 []byte
+	// VerifyChecksums computes the CRC32C and MD5 of the data while uploading and
+	// compares them with the checksums of the stored object. On a mismatch the stored
+	// generation is deleted and Upload returns an error wrapping ErrChecksumMismatch.
+	VerifyChecksums bool
+	// Conditions must hold for the existing object. Use DoesNotExist to avoid
+	// overwriting an object, or GenerationMatch to only replace the generation that
+	// was read.
+	Conditions Conditions
+	// ChunkSize is the size of the chunks of a resumable upload, which GCS rounds up
+	// to a multiple of 256 KiB. Each chunk is buffered in memory and retried on
+	// failure. Zero uses the storage client default of 16 MiB; a negative value
+	// uploads in a single request.
+	ChunkSize int
+	// Compression compresses the data while uploading. The ContentEncoding of an
+	// unencrypted object is set to match, so GCS can serve it decompressed; that of
+	// an encrypted object is recorded in its metadata. Download, NewReader and ReadAll
+	// decompress the data again. It cannot be combined with ContentEncoding.
+	Compression Compression
+	// Encrypt encrypts the data client-side with AES-256-GCM under a new data key,
+	// which is wrapped by the KeyWrapper of the Config and stored, with the key ID,
+	// in the object metadata. Download, NewReader and ReadAll decrypt the data again.
+	// It cannot be combined with ContentEncoding.
+	Encrypt bool
+	// CustomerKey is a 32-byte customer-supplied encryption key (CSEK) that GCS
+	// encrypts the object with instead of a Google-managed key. GCS does not store
+	// the key, so reading the object requires the key in Config.CustomerKeys.
+	CustomerKey []byte
+}
+
+// validate returns an error for options that cannot be combined or are out of range.
+func (o UploadOptions) validate() error {
+	if (o.Compression != NoCompression || o.Encrypt) && o.ContentEncoding != "" {
+		return fmt.Errorf("ContentEncoding cannot be combined with Compression or Encrypt")
+	}
+	if o.Compression < NoCompression || o.Compression > Zstd {
+		return fmt.Errorf("unknown compression %d", o.Compression)
+	}
+	if o.CustomerKey != nil {
+		return validCustomerKey(o.CustomerKey)
+	}
+	return nil
+}
+
+// Upload streams data from an io.Reader to an object in the configured GCS bucket and
+// returns the attributes of the stored object. It is the caller's responsibility to
+// handle the closing of the reader. If reading r fails, the upload is aborted and no
+// object is written. If the Conditions do not hold, the returned error wraps
+// ErrPreconditionFailed.
+//
+// With Compression or Encrypt, CRC32C and MD5 are the checksums of the data read from
+// r, which Upload verifies itself, while VerifyChecksums and the returned attributes
+// concern the stored, encoded data.
+func (c *Client) Upload(ctx context.Context, object string, r io.Reader, opts UploadOptions) (*ObjectAttrs, error) {
+	if object == "" {
+		return nil, fmt.Errorf("object name cannot be empty")
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReaderSize(r, sniffLen)
+	contentType := opts.ContentType
+	if contentType == "" {
+		contentType = detectContentType(object, br)
+	}
+
+	c.logger.DebugContext(ctx, "Uploading object to GCS", "object", object, "bucket", c.bucketName, "content_type", contentType)
+
+	// Cancelling the writer's context is the only way to abandon an upload without
+	// committing the data written so far.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	encoded := opts.Compression != NoCompression || opts.Encrypt
+	h := c.gcsClient.Bucket(c.bucketName).Object(object)
+	if opts.CustomerKey != nil {
+		h = h.Key(opts.CustomerKey)
+	}
+	writer := opts.Conditions.apply(h).NewWriter(ctx)
+	writer.ContentType = contentType
+	writer.Metadata = opts.Metadata
+	writer.CacheControl = opts.CacheControl
+	writer.ContentEncoding = opts.ContentEncoding
+	if opts.ChunkSize != 0 {
+		writer.ChunkSize = max(opts.ChunkSize, 0)
+	}
+
+	var src io.Reader = br
+	var sums *uploadHashes
+	if opts.VerifyChecksums || opts.CRC32C != nil || opts.MD5 != nil {
+		sums = newUploadHashes()
+		src = io.TeeReader(br, sums)
+	}
+
+	if !encoded {
+		writer.MD5 = opts.MD5
+		if opts.CRC32C != nil {
+			writer.CRC32C = *opts.CRC32C
+			writer.SendCRC32C = true
+		}
+		if _, err := io.Copy(writer, src); err != nil {
+			cancel()
+			_ = writer.Close()
+			return nil, fmt.Errorf("failed to copy data to GCS object '%s': %w", object, mapError(err))
+		}
+	} else {
+		// The checksums in opts describe the data read from r, and VerifyChecksums
+		// compares the stored object with the encoded data that was sent.
+		input := sums
+		var dst io.Writer = writer
+		sums = nil
+		if opts.VerifyChecksums {
+			sums = newUploadHashes()
+			dst = io.MultiWriter(writer, sums)
+		}
+		metadata := maps.Clone(opts.Metadata)
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		enc, err := c.newEncoder(ctx, dst, object, opts, metadata)
+		if err != nil {
+			return nil, err
+		}
+		writer.Metadata = metadata
+		if !opts.Encrypt {
+			writer.ContentEncoding = opts.Compression.String()
+		}
+
+		_, err = io.Copy(enc.w, src)
+		if err != nil {
+			// Closing the encoder waits for the zstd block goroutines and releases
+			// its buffers. The upload is cancelled first, so the data it flushes is
+			// never committed.
+			cancel()
+			_ = enc.Close()
+		} else {
+			err = enc.Close()
+		}
+		if err == nil && input != nil && !input.match(opts.CRC32C, opts.MD5) {
+			err = fmt.Errorf("data does not match the expected checksums: %w", ErrChecksumMismatch)
+		}
+		if err != nil {
+			cancel()
+			_ = writer.Close()
+			return nil, fmt.Errorf("failed to upload GCS object '%s': %w", object, mapError(err))
+		}
+	}
+	if err := writer.Close(); err != nil {
+		if sums != nil && !encoded && !sums.match(opts.CRC32C, opts.MD5) {
+			return nil, fmt.Errorf("failed to upload GCS object '%s': %w: %w", object, ErrChecksumMismatch, err)
+		}
+		return nil, fmt.Errorf("failed to close GCS writer for object '%s': %w", object, mapError(err))
+	}
+	attrs := objectAttrsFrom(writer.Attrs())
+
+	if opts.VerifyChecksums {
+		if err := c.verifyUpload(ctx, attrs, sums); err != nil {
+			return nil, err
+		}
+	}
+
+	c.logger.DebugContext(ctx, "Successfully uploaded object", "object", object, "bucket", c.bucketName, "size", attrs.Size, "generation", attrs.Generation)
+	return attrs, nil
+}
+
+// verifyUpload compares the checksums of a stored object with those of the data that
+// was sent, deleting the stored generation if they differ.
+func (c *Client) verifyUpload(ctx context.Context, attrs *ObjectAttrs, sums *uploadHashes) error {
+	crc, sum := attrs.CRC32C, attrs.MD5
+	if len(sum) == 0 {
+		// Composite objects have no MD5 hash.
+		sum = nil
+	}
+	if sums.match(&crc, sum) {
+		return nil
+	}
+
+	c.logger.WarnContext(ctx, "Uploaded object does not match the data sent, deleting it", "object", attrs.Name, "bucket", attrs.Bucket, "generation", attrs.Generation)
+	h := Conditions{GenerationMatch: attrs.Generation}.apply(c.gcsClient.Bucket(attrs.Bucket).Object(attrs.Name))
+	err := fmt.Errorf("GCS object '%s' generation %d does not match the uploaded data: %w", attrs.Name, attrs.Generation, ErrChecksumMismatch)
+	if delErr := h.Delete(ctx); delErr != nil && !errors.Is(mapError(delErr), ErrNotFound) {
+		return errors.Join(err, fmt.Errorf("failed to delete mismatched GCS object '%s': %w", attrs.Name, mapError(delErr)))
+	}
+	return err
+}
+
+// detectContentType derives a content type from the extension of the object name or,
+// failing that, from the first bytes of the data, which are peeked from br.
+func detectContentType(object string, br *bufio.Reader) string {
+	if ct := mime.TypeByExtension(path.Ext(object)); ct != "" {
+		return ct
+	}
+	head, _ := br.Peek(sniffLen)
+	return http.DetectContentType(head)
+}
+
+// uploadHashes computes the CRC32C and MD5 of the data written to it.
+type uploadHashes struct {
+	crc hash.Hash32
+	md5 hash.Hash
+}
+
+func newUploadHashes() *uploadHashes {
+	return &uploadHashes{crc: crc32.New(crc32cTable), md5: md5.New()}
+}
+
+// Write implements io.Writer.
+func (h *uploadHashes) Write(p []byte) (int, error) {
+	h.crc.Write(p)
+	h.md5.Write(p)
+	return len(p), nil
+}
+
+// match reports whether the data matches the given checksums; nil checksums are not
+// compared.
+func (h *uploadHashes) match(crc *uint32, sum []byte) bool {
+	if crc != nil && *crc != h.crc.Sum32() {
+		return false
+	}
+	return sum == nil || bytes.Equal(sum, h.md5.Sum(nil))
+}
@@ -0,0 +1,161 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpload(t *testing.T) {
+	client, fake := newTestClient(t)
+	ctx := context.Background()
+
+	t.Run("Stores the data and options", func(t *testing.T) {
+		attrs, err := client.Upload(ctx, "report", strings.NewReader("a,b\n1,2\n"), UploadOptions{
+			ContentType:     "text/csv",
+			Metadata:        map[string]string{"source": "test"},
+			CacheControl:    "no-cache",
+			ContentEncoding: "identity",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, testBucket, attrs.Bucket)
+		assert.Equal(t, "report", attrs.Name)
+		assert.Equal(t, int64(8), attrs.Size)
+		assert.Equal(t, "text/csv", attrs.ContentType)
+		assert.Equal(t, "no-cache", attrs.CacheControl)
+		assert.Equal(t, "identity", attrs.ContentEncoding)
+		assert.Equal(t, map[string]string{"source": "test"}, attrs.Metadata)
+		assert.Equal(t, crc32.Checksum([]byte("a,b\n1,2\n"), crc32cTable), attrs.CRC32C)
+
+		obj := fake.get(testBucket, "report")
+		require.NotNil(t, obj)
+		assert.Equal(t, "a,b\n1,2\n", string(obj.Data))
+		assert.Equal(t, obj.Generation, attrs.Generation)
+	})
+
+	t.Run("Detects the content type", func(t *testing.T) {
+		tests := []struct {
+			name, object, data, want string
+		}{
+			{"From the extension", "data.json", "[]", "application/json"},
+			{"Sniffed from the data", "page", "<!DOCTYPE html><html></html>", "text/html; charset=utf-8"},
+			{"Binary data", "blob", "\x00\x01\x02", "application/octet-stream"},
+		}
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				attrs, err := client.Upload(ctx, tc.object, strings.NewReader(tc.data), UploadOptions{})
+				require.NoError(t, err)
+				assert.Equal(t, tc.want, attrs.ContentType)
+				assert.Equal(t, tc.data, string(fake.get(testBucket, tc.object).Data), "expected sniffing not to consume the data")
+			})
+		}
+	})
+
+	t.Run("Preconditions", func(t *testing.T) {
+		first, err := client.Upload(ctx, "once", strings.NewReader("v1"), UploadOptions{Conditions: Conditions{DoesNotExist: true}})
+		require.NoError(t, err)
+
+		_, err = client.Upload(ctx, "once", strings.NewReader("v2"), UploadOptions{Conditions: Conditions{DoesNotExist: true}})
+		assert.ErrorIs(t, err, ErrPreconditionFailed)
+		_, err = client.Upload(ctx, "once", strings.NewReader("v2"), UploadOptions{Conditions: Conditions{GenerationMatch: first.Generation + 1}})
+		assert.ErrorIs(t, err, ErrPreconditionFailed)
+		assert.Equal(t, "v1", string(fake.get(testBucket, "once").Data))
+
+		second, err := client.Upload(ctx, "once", strings.NewReader("v2"), UploadOptions{Conditions: Conditions{GenerationMatch: first.Generation}})
+		require.NoError(t, err)
+		assert.NotEqual(t, first.Generation, second.Generation)
+		assert.Equal(t, "v2", string(fake.get(testBucket, "once").Data))
+	})
+
+	t.Run("Expected checksums", func(t *testing.T) {
+		data := []byte("checked")
+		crc := crc32.Checksum(data, crc32cTable)
+		sum := md5.Sum(data)
+
+		_, err := client.Upload(ctx, "checked", bytes.NewReader(data), UploadOptions{CRC32C: &crc, MD5: sum[:]})
+		require.NoError(t, err)
+
+		wrong := crc + 1
+		_, err = client.Upload(ctx, "bad-crc", bytes.NewReader(data), UploadOptions{CRC32C: &wrong})
+		assert.ErrorIs(t, err, ErrChecksumMismatch)
+		assert.Nil(t, fake.get(testBucket, "bad-crc"))
+
+		_, err = client.Upload(ctx, "bad-md5", bytes.NewReader(data), UploadOptions{MD5: make([]byte, md5.Size)})
+		assert.ErrorIs(t, err, ErrChecksumMismatch)
+		assert.Nil(t, fake.get(testBucket, "bad-md5"))
+	})
+
+	t.Run("Fails with empty object name", func(t *testing.T) {
+		_, err := client.Upload(ctx, "", strings.NewReader("x"), UploadOptions{})
+		require.Error(t, err)
+	})
+}
+
+func TestUpload_VerifyChecksums(t *testing.T) {
+	client, fake := newTestClient(t)
+	ctx := context.Background()
+
+	_, err := client.Upload(ctx, "intact", strings.NewReader("payload"), UploadOptions{VerifyChecksums: true})
+	require.NoError(t, err)
+
+	fake.mu.Lock()
+	fake.corruptUploads = true
+	fake.mu.Unlock()
+
+	_, err = client.Upload(ctx, "corrupted", strings.NewReader("payload"), UploadOptions{VerifyChecksums: true})
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.Nil(t, fake.get(testBucket, "corrupted"), "expected the corrupted object to be deleted")
+}
+
+func TestUpload_ChunkSize(t *testing.T) {
+	client, fake := newTestClient(t)
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("0123456789abcdef"), 40*1024) // 640 KiB
+
+	tests := []struct {
+		name      string
+		chunkSize int
+	}{
+		{"Default", 0},
+		{"Resumable chunks", 256 * 1024},
+		{"Single request", -1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			attrs, err := client.Upload(ctx, "large", bytes.NewReader(data), UploadOptions{ChunkSize: tc.chunkSize})
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(data)), attrs.Size)
+			assert.True(t, bytes.Equal(data, fake.get(testBucket, "large").Data))
+		})
+	}
+}
+
+// failingReader returns some data and then an error.
+type failingReader struct {
+	data io.Reader
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	if errors.Is(err, io.EOF) {
+		return n, errors.New("disk on fire")
+	}
+	return n, err
+}
+
+func TestUpload_AbortsOnReadError(t *testing.T) {
+	client, fake := newTestClient(t)
+
+	_, err := client.Upload(context.Background(), "partial", &failingReader{strings.NewReader("half of it")}, UploadOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "disk on fire")
+	assert.Nil(t, fake.get(testBucket, "partial"), "expected no object for an aborted upload")
+}
@@ -0,0 +1,37 @@
+// Package lock provides lease-based distributed locks on top of a key-value store.
+//
+// A Locker stores one record per lock name, holding the current owner, the lease expiry
+// and a fencing token. Every change to a record goes through an atomic read-modify-write
+// (the Updater interface), which store.Store and firestore.FirestoreKV provide; with
+// Firestore each change runs in a transaction, so instances of a service can coordinate
+// through a shared collection.
+//
+//	kv, err := firestore.NewKV(ctx, projectID, "locks")
+//	// ...
+//	locker, err := lock.NewLocker(kv, lock.Config{TTL: 30 * time.Second, AutoRenew: true})
+//	// ...
+//	lease, err := locker.Acquire(ctx, "nightly-report")
+//	if err != nil {
+//		return err
+//	}
+//	defer lease.Release(ctx)
+//
+// TryAcquire makes a single attempt and returns ErrLocked if the lock is held, even by
+// an earlier lease of the same Locker; Acquire retries until the lock is free or the
+// context is done. A lease that is not renewed expires after the TTL and can then be
+// taken over by another owner. Renew and Release return ErrLeaseLost once that has
+// happened.
+//
+// Fencing Tokens:
+// Each acquisition increments the lock's token. A paused process may still believe it
+// holds an expired lease, so resources guarded by a lock should record the highest
+// token they have seen and reject requests with lower tokens.
+//
+// Auto-Renewal:
+// With Config.AutoRenew, every lease renews itself at a third of the TTL. Lease.Done is
+// closed when renewal stops, and Lease.Err reports why, which lets callers cancel work
+// that is no longer protected.
+//
+// For tests and single-process use, NewInMemoryLocker provides a Locker backed by
+// process memory; Fork creates additional Lockers with other owners on the same storage.
+package lock
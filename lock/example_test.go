@@ -0,0 +1,49 @@
+package lock_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/duizendstra/dui-go/lock"
+)
+
+// ExampleLocker shows two instances contending for the same lock. In production, pass a
+// firestore.FirestoreKV or store.Store to NewLocker instead of using in-memory storage.
+func ExampleLocker() {
+	ctx := context.Background()
+
+	worker1, err := lock.NewInMemoryLocker(lock.Config{Owner: "worker-1"})
+	if err != nil {
+		log.Fatalf("failed to create locker: %v", err)
+	}
+	worker2, err := worker1.Fork(lock.Config{Owner: "worker-2"})
+	if err != nil {
+		log.Fatalf("failed to create locker: %v", err)
+	}
+
+	lease, err := worker1.TryAcquire(ctx, "nightly-report")
+	if err != nil {
+		log.Fatalf("failed to acquire lock: %v", err)
+	}
+	fmt.Printf("%s holds the lock with token %d\n", lease.Owner(), lease.Token())
+
+	if _, err := worker2.TryAcquire(ctx, "nightly-report"); errors.Is(err, lock.ErrLocked) {
+		fmt.Println("worker-2 has to wait")
+	}
+
+	if err := lease.Release(ctx); err != nil {
+		log.Fatalf("failed to release lock: %v", err)
+	}
+	lease, err = worker2.TryAcquire(ctx, "nightly-report")
+	if err != nil {
+		log.Fatalf("failed to acquire lock: %v", err)
+	}
+	fmt.Printf("%s holds the lock with token %d\n", lease.Owner(), lease.Token())
+
+	// Output:
+	// worker-1 holds the lock with token 1
+	// worker-2 has to wait
+	// worker-2 holds the lock with token 2
+}
@@ -0,0 +1,3 @@
+module github.com/duizendstra/dui-go/lock
+
+go 1.24
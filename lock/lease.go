@@ -0,0 +1,139 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Lease is a held lock. Its fencing token increases every time the lock changes hands,
+// so a resource guarded by the lock can reject writes carrying a token lower than the
+// highest it has seen.
+type Lease struct {
+	locker *Locker
+	name   string
+	token  int64
+
+	mu        sync.Mutex
+	expiresAt time.Time
+	err       error
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newLease(l *Locker, name string, r record) *Lease {
+	return &Lease{
+		locker:    l,
+		name:      name,
+		token:     r.Token,
+		expiresAt: r.ExpiresAt,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Name returns the name of the lock.
+func (l *Lease) Name() string {
+	return l.name
+}
+
+// Owner returns the owner ID holding the lease.
+func (l *Lease) Owner() string {
+	return l.locker.owner
+}
+
+// Token returns the fencing token of the lease.
+func (l *Lease) Token() int64 {
+	return l.token
+}
+
+// ExpiresAt returns the time the lease expires unless it is renewed.
+func (l *Lease) ExpiresAt() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.expiresAt
+}
+
+// Renew extends the lease by the Locker's TTL. It returns an error wrapping
+// ErrLeaseLost if the lease expired and another owner acquired the lock since.
+func (l *Lease) Renew(ctx context.Context) error {
+	expiresAt, err := l.locker.renew(ctx, l.name, l.token)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.expiresAt = expiresAt
+	l.mu.Unlock()
+	return nil
+}
+
+// Release gives up the lease and stops auto-renewal. It returns an error wrapping
+// ErrLeaseLost if the lock already belongs to someone else.
+func (l *Lease) Release(ctx context.Context) error {
+	l.stopAutoRenew()
+	return l.locker.release(ctx, l.name, l.token)
+}
+
+// Done returns a channel that is closed when auto-renewal stops, either because the
+// lease was released or because a renewal failed. Without auto-renewal the channel is
+// closed when the lease is released.
+func (l *Lease) Done() <-chan struct{} {
+	return l.done
+}
+
+// Err returns the error that stopped auto-renewal, or nil.
+func (l *Lease) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// startAutoRenew renews the lease at a third of the TTL until it is released or a
+// renewal fails. A failed renewal is retried on the next tick as long as the lease has
+// not expired, so transient storage errors do not drop the lease.
+func (l *Lease) startAutoRenew() {
+	interval := l.locker.ttl / 3
+	go func() {
+		defer close(l.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-l.stop:
+				return
+			case <-ticker.C:
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			err := l.Renew(ctx)
+			cancel()
+			if err == nil {
+				continue
+			}
+
+			l.locker.logger.Warn("Failed to renew lease", "lock", l.name, "token", l.token, "error", err)
+			if !l.locker.now().Before(l.ExpiresAt()) || errors.Is(err, ErrLeaseLost) {
+				l.mu.Lock()
+				l.err = err
+				l.mu.Unlock()
+				return
+			}
+		}
+	}()
+}
+
+// stopAutoRenew stops the auto-renewal goroutine, or closes Done directly when the
+// lease is not auto-renewed, and waits for it to finish.
+func (l *Lease) stopAutoRenew() {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+		if !l.locker.autoRenew {
+			close(l.done)
+		}
+	})
+	<-l.done
+}
@@ -0,0 +1,275 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/duizendstra/dui-go/store"
+)
+
+// Default configuration values.
+const (
+	DefaultTTL           = 30 * time.Second
+	DefaultRetryInterval = time.Second
+	DefaultKeyPrefix     = "lock:"
+)
+
+// MinTTL is the shortest TTL NewLocker accepts. Shorter leases would expire before a
+// renewal or a write to the storage could complete.
+const MinTTL = time.Second
+
+var (
+	// ErrLocked is returned by TryAcquire when the lock is held by an unexpired lease,
+	// including one of the same Locker.
+	ErrLocked = errors.New("lock is already held")
+
+	// ErrLeaseLost is returned by Renew and Release when the lease has expired and was
+	// taken over by another owner, or was otherwise invalidated.
+	ErrLeaseLost = errors.New("lease lost")
+)
+
+// Updater is the storage a Locker needs: an atomic read-modify-write of a single key.
+// store.Store and firestore.FirestoreKV satisfy it; FirestoreKV runs each update in a
+// Firestore transaction.
+type Updater interface {
+	Update(ctx context.Context, key string, fn store.UpdateFunc) error
+}
+
+// Config holds the configuration for a Locker.
+type Config struct {
+	// Owner identifies this instance in lock records. If empty, an ID is generated from
+	// the hostname, process ID and random bytes.
+	Owner string
+	// TTL is how long a lease stays valid without renewal. Defaults to DefaultTTL and
+	// must be at least MinTTL.
+	TTL time.Duration
+	// RetryInterval is how long Acquire waits between attempts while the lock is
+	// held. Defaults to DefaultRetryInterval.
+	RetryInterval time.Duration
+	// KeyPrefix is prepended to lock names to form the storage key. Defaults to
+	// DefaultKeyPrefix.
+	KeyPrefix string
+	// AutoRenew starts a goroutine for every acquired lease that renews it at a third
+	// of the TTL until it is released or a renewal fails.
+	AutoRenew bool
+	// Logger is an optional structured logger. If nil, logging is disabled.
+	Logger *slog.Logger
+}
+
+// Locker hands out leases on named locks stored through an Updater. It is safe for
+// concurrent use.
+//
+// Lease expiry is decided by comparing the stored expiry with the local clock of the
+// instance trying to acquire, so instances should have reasonably synchronized clocks
+// and the TTL should be well above the expected clock skew.
+type Locker struct {
+	kv            Updater
+	owner         string
+	ttl           time.Duration
+	retryInterval time.Duration
+	keyPrefix     string
+	autoRenew     bool
+	logger        *slog.Logger
+	// now returns the current time. In tests, it can be replaced for stable results.
+	now func() time.Time
+}
+
+// record is the JSON document stored for each lock. Token survives releases so that
+// fencing tokens keep increasing for the lifetime of the key.
+type record struct {
+	Owner     string    `json:"owner"`
+	Token     int64     `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// NewLocker creates a Locker that stores its lock records through kv. It returns an
+// error if cfg.TTL is negative or below MinTTL.
+func NewLocker(kv Updater, cfg Config) (*Locker, error) {
+	if kv == nil {
+		return nil, fmt.Errorf("lock storage is required")
+	}
+	if cfg.TTL < 0 || cfg.RetryInterval < 0 {
+		return nil, fmt.Errorf("TTL and RetryInterval cannot be negative")
+	}
+	if cfg.TTL != 0 && cfg.TTL < MinTTL {
+		return nil, fmt.Errorf("TTL %s is below the minimum of %s", cfg.TTL, MinTTL)
+	}
+
+	owner := cfg.Owner
+	if owner == "" {
+		var err error
+		if owner, err = generateOwnerID(); err != nil {
+			return nil, err
+		}
+	}
+
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	l := &Locker{
+		kv:            kv,
+		owner:         owner,
+		ttl:           cfg.TTL,
+		retryInterval: cfg.RetryInterval,
+		keyPrefix:     cfg.KeyPrefix,
+		autoRenew:     cfg.AutoRenew,
+		logger:        logger,
+		now:           time.Now,
+	}
+	if l.ttl == 0 {
+		l.ttl = DefaultTTL
+	}
+	if l.retryInterval == 0 {
+		l.retryInterval = DefaultRetryInterval
+	}
+	if l.keyPrefix == "" {
+		l.keyPrefix = DefaultKeyPrefix
+	}
+	return l, nil
+}
+
+// Owner returns the owner ID this Locker writes into lock records.
+func (l *Locker) Owner() string {
+	return l.owner
+}
+
+// TryAcquire attempts to take the named lock once. It returns ErrLocked if an unexpired
+// lease holds the lock, even when this Locker acquired it: each lease has its own
+// fencing token, and only one of them is valid at a time.
+func (l *Locker) TryAcquire(ctx context.Context, name string) (*Lease, error) {
+	if name == "" {
+		return nil, fmt.Errorf("lock name cannot be empty")
+	}
+
+	var acquired record
+	err := l.kv.Update(ctx, l.keyPrefix+name, func(old string) (string, error) {
+		current, err := decodeRecord(old)
+		if err != nil {
+			return "", err
+		}
+		now := l.now()
+		if current.Owner != "" && now.Before(current.ExpiresAt) {
+			return "", ErrLocked
+		}
+		acquired = record{Owner: l.owner, Token: current.Token + 1, ExpiresAt: now.Add(l.ttl)}
+		return encodeRecord(acquired)
+	})
+	if errors.Is(err, ErrLocked) {
+		return nil, fmt.Errorf("failed to acquire lock %q: %w", name, ErrLocked)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock %q: %w", name, err)
+	}
+
+	l.logger.DebugContext(ctx, "Acquired lock", "lock", name, "owner", l.owner, "token", acquired.Token)
+	lease := newLease(l, name, acquired)
+	if l.autoRenew {
+		lease.startAutoRenew()
+	}
+	return lease, nil
+}
+
+// Acquire takes the named lock, waiting RetryInterval between attempts while it is
+// held. It returns when the lock is acquired, when an attempt fails with an error
+// other than ErrLocked, or with the context's error when ctx is done.
+func (l *Locker) Acquire(ctx context.Context, name string) (*Lease, error) {
+	for {
+		lease, err := l.TryAcquire(ctx, name)
+		if !errors.Is(err, ErrLocked) {
+			return lease, err
+		}
+
+		timer := time.NewTimer(l.retryInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("failed to acquire lock %q: %w", name, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// renew extends the lease if the stored record still carries its token.
+func (l *Locker) renew(ctx context.Context, name string, token int64) (time.Time, error) {
+	var expiresAt time.Time
+	err := l.kv.Update(ctx, l.keyPrefix+name, func(old string) (string, error) {
+		current, err := decodeRecord(old)
+		if err != nil {
+			return "", err
+		}
+		if current.Owner != l.owner || current.Token != token {
+			return "", ErrLeaseLost
+		}
+		expiresAt = l.now().Add(l.ttl)
+		current.ExpiresAt = expiresAt
+		return encodeRecord(current)
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to renew lock %q: %w", name, err)
+	}
+	return expiresAt, nil
+}
+
+// release marks the lock as free if the stored record still carries the token. The
+// record is kept so the next owner receives a higher fencing token.
+func (l *Locker) release(ctx context.Context, name string, token int64) error {
+	err := l.kv.Update(ctx, l.keyPrefix+name, func(old string) (string, error) {
+		current, err := decodeRecord(old)
+		if err != nil {
+			return "", err
+		}
+		if current.Owner != l.owner || current.Token != token {
+			return "", ErrLeaseLost
+		}
+		return encodeRecord(record{Token: current.Token})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to release lock %q: %w", name, err)
+	}
+	l.logger.DebugContext(ctx, "Released lock", "lock", name, "owner", l.owner, "token", token)
+	return nil
+}
+
+// decodeRecord parses a stored lock record. An empty value is a lock that was never taken.
+func decodeRecord(value string) (record, error) {
+	var r record
+	if value == "" {
+		return r, nil
+	}
+	if err := json.Unmarshal([]byte(value), &r); err != nil {
+		return r, fmt.Errorf("failed to decode lock record: %w", err)
+	}
+	return r, nil
+}
+
+// encodeRecord serializes a lock record for storage.
+func encodeRecord(r record) (string, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode lock record: %w", err)
+	}
+	return string(b), nil
+}
+
+// generateOwnerID returns an owner ID that is unique across instances and restarts.
+func generateOwnerID() (string, error) {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown-host"
+	}
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate owner ID: %w", err)
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b)), nil
+}
@@ -0,0 +1,371 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/duizendstra/dui-go/testutil"
+)
+
+// fakeClock is a manually advanced clock shared by Lockers in a test.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newTestLockers returns two Lockers with different owners on shared in-memory storage.
+func newTestLockers(t *testing.T, clock *fakeClock) (*Locker, *Locker) {
+	t.Helper()
+	a, err := NewInMemoryLocker(Config{Owner: "a", TTL: 10 * time.Second, RetryInterval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewInMemoryLocker failed: %v", err)
+	}
+	b, err := a.Fork(Config{Owner: "b", TTL: 10 * time.Second, RetryInterval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Fork failed: %v", err)
+	}
+	a.now, b.now = clock.Now, clock.Now
+	return a, b
+}
+
+func TestNewLocker(t *testing.T) {
+	if _, err := NewLocker(nil, Config{}); err == nil {
+		t.Error("expected an error for missing storage")
+	}
+	if _, err := NewInMemoryLocker(Config{TTL: -time.Second}); err == nil {
+		t.Error("expected an error for a negative TTL")
+	}
+	for _, ttl := range []time.Duration{time.Nanosecond, 2, MinTTL - 1} {
+		if _, err := NewInMemoryLocker(Config{TTL: ttl, AutoRenew: true}); err == nil {
+			t.Errorf("expected an error for TTL %s below the minimum", ttl)
+		}
+	}
+	if _, err := NewInMemoryLocker(Config{TTL: MinTTL}); err != nil {
+		t.Errorf("expected MinTTL to be accepted, got %v", err)
+	}
+
+	l, err := NewInMemoryLocker(Config{})
+	if err != nil {
+		t.Fatalf("NewInMemoryLocker failed: %v", err)
+	}
+	if l.Owner() == "" {
+		t.Error("expected a generated owner ID")
+	}
+	if l.ttl != DefaultTTL || l.retryInterval != DefaultRetryInterval || l.keyPrefix != DefaultKeyPrefix {
+		t.Errorf("expected defaults, got ttl=%s retry=%s prefix=%q", l.ttl, l.retryInterval, l.keyPrefix)
+	}
+
+	other, _ := NewInMemoryLocker(Config{})
+	if l.Owner() == other.Owner() {
+		t.Error("expected generated owner IDs to differ")
+	}
+}
+
+func TestLocker_TryAcquire(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	a, b := newTestLockers(t, clock)
+
+	lease, err := a.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("TryAcquire failed: %v", err)
+	}
+	if lease.Name() != "job" || lease.Owner() != "a" || lease.Token() != 1 {
+		t.Errorf("unexpected lease: name=%q owner=%q token=%d", lease.Name(), lease.Owner(), lease.Token())
+	}
+	if want := clock.Now().Add(10 * time.Second); !lease.ExpiresAt().Equal(want) {
+		t.Errorf("expected expiry %s, got %s", want, lease.ExpiresAt())
+	}
+
+	if _, err := b.TryAcquire(ctx, "job"); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected ErrLocked while held, got %v", err)
+	}
+	if _, err := b.TryAcquire(ctx, "other"); err != nil {
+		t.Errorf("expected an unrelated lock to be free, got %v", err)
+	}
+	if _, err := a.TryAcquire(ctx, ""); err == nil {
+		t.Error("expected an error for an empty lock name")
+	}
+
+	if err := lease.Release(ctx); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	lease2, err := b.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("TryAcquire after release failed: %v", err)
+	}
+	if lease2.Token() != 2 {
+		t.Errorf("expected fencing token 2, got %d", lease2.Token())
+	}
+}
+
+func TestLocker_TryAcquireHeldBySameLocker(t *testing.T) {
+	ctx := context.Background()
+	l, err := NewInMemoryLocker(Config{Owner: "a"})
+	if err != nil {
+		t.Fatalf("NewInMemoryLocker failed: %v", err)
+	}
+
+	var (
+		wg     sync.WaitGroup
+		leases [2]*Lease
+		errs   [2]error
+	)
+	for i := range leases {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			leases[i], errs[i] = l.TryAcquire(ctx, "job")
+		}()
+	}
+	wg.Wait()
+
+	held := 0
+	var lease *Lease
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			held++
+			lease = leases[i]
+		case !errors.Is(err, ErrLocked):
+			t.Errorf("expected ErrLocked, got %v", err)
+		}
+	}
+	if held != 1 {
+		t.Fatalf("expected exactly one lease, got %d", held)
+	}
+
+	if _, err := l.TryAcquire(ctx, "job"); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected ErrLocked while the Locker holds the lock, got %v", err)
+	}
+	if err := lease.Release(ctx); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if _, err := l.TryAcquire(ctx, "job"); err != nil {
+		t.Errorf("expected TryAcquire after release to succeed, got %v", err)
+	}
+}
+
+func TestLease_ExpiryAndFencing(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	a, b := newTestLockers(t, clock)
+
+	stale, err := a.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("TryAcquire failed: %v", err)
+	}
+
+	clock.Advance(5 * time.Second)
+	if err := stale.Renew(ctx); err != nil {
+		t.Fatalf("Renew failed: %v", err)
+	}
+	clock.Advance(9 * time.Second)
+	if _, err := b.TryAcquire(ctx, "job"); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected the renewed lease to still hold, got %v", err)
+	}
+
+	clock.Advance(2 * time.Second)
+	fresh, err := b.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("TryAcquire after expiry failed: %v", err)
+	}
+	if fresh.Token() <= stale.Token() {
+		t.Errorf("expected token %d to exceed stale token %d", fresh.Token(), stale.Token())
+	}
+
+	if err := stale.Renew(ctx); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("expected ErrLeaseLost on renew, got %v", err)
+	}
+	if err := stale.Release(ctx); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("expected ErrLeaseLost on release, got %v", err)
+	}
+	if _, err := a.TryAcquire(ctx, "job"); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected a stale release to leave the lock held, got %v", err)
+	}
+}
+
+func TestLocker_Acquire(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	a, b := newTestLockers(t, clock)
+
+	held, err := a.Acquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := b.Acquire(timeoutCtx, "job"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = held.Release(ctx)
+	}()
+	lease, err := b.Acquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("Acquire after release failed: %v", err)
+	}
+	if lease.Owner() != "b" {
+		t.Errorf("expected owner 'b', got %q", lease.Owner())
+	}
+}
+
+func TestLocker_MutualExclusion(t *testing.T) {
+	ctx := context.Background()
+	base, err := NewInMemoryLocker(Config{RetryInterval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewInMemoryLocker failed: %v", err)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		holders int
+		tokens  []int64
+	)
+	for i := 0; i < 8; i++ {
+		l, err := base.Fork(Config{RetryInterval: time.Millisecond})
+		if err != nil {
+			t.Fatalf("Fork failed: %v", err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lease, err := l.Acquire(ctx, "counter")
+			if err != nil {
+				t.Errorf("Acquire failed: %v", err)
+				return
+			}
+			mu.Lock()
+			holders++
+			if holders > 1 {
+				t.Errorf("expected a single holder, got %d", holders)
+			}
+			tokens = append(tokens, lease.Token())
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			holders--
+			mu.Unlock()
+			if err := lease.Release(ctx); err != nil {
+				t.Errorf("Release failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := 1; i < len(tokens); i++ {
+		if tokens[i] <= tokens[i-1] {
+			t.Errorf("expected increasing tokens, got %v", tokens)
+			break
+		}
+	}
+}
+
+func TestLease_AutoRenew(t *testing.T) {
+	ctx := context.Background()
+	l, err := NewInMemoryLocker(Config{Owner: "a", TTL: MinTTL, AutoRenew: true})
+	if err != nil {
+		t.Fatalf("NewInMemoryLocker failed: %v", err)
+	}
+	other, _ := l.Fork(Config{Owner: "b", TTL: MinTTL})
+
+	lease, err := l.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("TryAcquire failed: %v", err)
+	}
+	first := lease.ExpiresAt()
+
+	time.Sleep(MinTTL / 2)
+	if !lease.ExpiresAt().After(first) {
+		t.Error("expected the lease to have been renewed")
+	}
+	if _, err := other.TryAcquire(ctx, "job"); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected the auto-renewed lease to hold, got %v", err)
+	}
+
+	if err := lease.Release(ctx); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	select {
+	case <-lease.Done():
+	default:
+		t.Error("expected Done to be closed after Release")
+	}
+	if lease.Err() != nil {
+		t.Errorf("expected no error after Release, got %v", lease.Err())
+	}
+}
+
+func TestLease_AutoRenewStopsWhenLost(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	l, err := NewInMemoryLocker(Config{Owner: "a", TTL: MinTTL, AutoRenew: true})
+	if err != nil {
+		t.Fatalf("NewInMemoryLocker failed: %v", err)
+	}
+	other, _ := l.Fork(Config{Owner: "b", TTL: MinTTL})
+	l.now, other.now = clock.Now, clock.Now
+
+	lease, err := l.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("TryAcquire failed: %v", err)
+	}
+	// Jump past the expiry before the first renewal so the other owner takes over.
+	clock.Advance(time.Minute)
+	if _, err := other.TryAcquire(ctx, "job"); err != nil {
+		t.Fatalf("TryAcquire by other owner failed: %v", err)
+	}
+
+	select {
+	case <-lease.Done():
+	case <-time.After(2 * MinTTL):
+		t.Fatal("expected auto-renewal to stop")
+	}
+	if !errors.Is(lease.Err(), ErrLeaseLost) {
+		t.Errorf("expected ErrLeaseLost, got %v", lease.Err())
+	}
+}
+
+func TestLocker_WithKV(t *testing.T) {
+	ctx := context.Background()
+	kv := testutil.NewMockFirestoreKV()
+
+	l, err := NewLocker(kv, Config{Owner: "a"})
+	if err != nil {
+		t.Fatalf("NewLocker failed: %v", err)
+	}
+	lease, err := l.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("TryAcquire failed: %v", err)
+	}
+
+	raw, err := kv.Get(ctx, DefaultKeyPrefix+"job")
+	if err != nil || raw == "" {
+		t.Fatalf("expected a stored lock record, got %q (err=%v)", raw, err)
+	}
+	if err := lease.Release(ctx); err != nil {
+		t.Errorf("Release failed: %v", err)
+	}
+}
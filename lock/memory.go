@@ -0,0 +1,40 @@
+package lock
+
+import (
+	"context"
+	"sync"
+
+	"github.com/duizendstra/dui-go/store"
+)
+
+// memoryUpdater is an in-process Updater. Lockers sharing one memoryUpdater coordinate
+// with each other, which is enough for tests and single-process use.
+type memoryUpdater struct {
+	mu   sync.Mutex
+	data map[string]string
+}
+
+// Update applies fn to the key while holding the updater's mutex.
+func (m *memoryUpdater) Update(_ context.Context, key string, fn store.UpdateFunc) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, err := fn(m.data[key])
+	if err != nil {
+		return err
+	}
+	m.data[key] = value
+	return nil
+}
+
+// NewInMemoryLocker creates a Locker backed by process memory. Use Fork to create
+// Lockers with other owners that contend for the same locks.
+func NewInMemoryLocker(cfg Config) (*Locker, error) {
+	return NewLocker(&memoryUpdater{data: make(map[string]string)}, cfg)
+}
+
+// Fork returns a Locker with a different configuration that shares the storage of l.
+// It is mostly useful with NewInMemoryLocker to simulate several instances in tests.
+func (l *Locker) Fork(cfg Config) (*Locker, error) {
+	return NewLocker(l.kv, cfg)
+}
@@ -0,0 +1,409 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/duizendstra/dui-go/cache"
+)
+
+// Compile-time check that CachingStore implements Store.
+var _ Store = (*CachingStore)(nil)
+
+// DefaultCacheTTL is how long CachingStore serves a value from the cache when
+// CacheConfig.TTL is not set.
+const DefaultCacheTTL = time.Minute
+
+// CacheConfig configures a CachingStore.
+type CacheConfig struct {
+	// Cache holds the cached entries. It should not be shared with other code, since
+	// the store uses keys as cache keys. Defaults to a new cache.InMemoryCache.
+	// Evicted and expired entries are only freed if the cache implements
+	// cache.Deleter; otherwise evictions overwrite the entry and expired entries stay
+	// until InvalidateAll.
+	Cache cache.Cache
+	// TTL bounds how long a value is served from the cache, and so how stale it can
+	// be when another instance writes it. Defaults to DefaultCacheTTL.
+	TTL time.Duration
+	// WatchInvalidation subscribes to changes of all keys with WatchPrefix, so values
+	// written through other instances are evicted as soon as the change is reported
+	// instead of when TTL elapses. The watch stops when the store is closed.
+	//
+	// The watch covers the whole store. On Firestore it listens to the entire
+	// collection: it reads every document once when it starts, is billed a read for
+	// every later write, and keeps the value and version of every key in memory. The
+	// Initial events of the first snapshot are ignored.
+	WatchInvalidation bool
+	// Logger receives watch failures. Defaults to discarding logs.
+	Logger *slog.Logger
+}
+
+// CacheStats holds the counters of a CachingStore.
+type CacheStats struct {
+	// Hits counts reads served from the cache, including cached missing keys.
+	Hits uint64
+	// Misses counts reads that went to the underlying store.
+	Misses uint64
+	// Invalidations counts evictions caused by writes and watch events. A flush of the
+	// whole cache counts once.
+	Invalidations uint64
+}
+
+// cacheEntry is the cached state of a key. The zero value is an evicted entry, used
+// when the cache cannot delete entries.
+type cacheEntry struct {
+	value    string
+	found    bool
+	expireAt time.Time
+}
+
+// CachingStore is a read-through Store decorator that serves Get, Lookup, Exists and
+// GetMulti from a cache.Cache. Missing keys are cached as well. Entries expire after
+// the configured TTL, and writes through the CachingStore evict the keys they touch.
+// Writes by other instances are only noticed when the entry expires, or right away
+// with CacheConfig.WatchInvalidation.
+//
+// Keys written with SetWithTTL may be served from the cache for up to TTL after they
+// expire in the underlying store, so keep TTL shorter than those expiries. GetVersion,
+// List, Scan and the watch methods always go to the underlying store.
+type CachingStore struct {
+	inner  Store
+	cache  cache.Cache
+	ttl    time.Duration
+	logger *slog.Logger
+	now    func() time.Time
+
+	// mu orders evictions and cache fills, so a read that started before a write
+	// cannot put the old value back after the write evicted it.
+	mu         sync.Mutex
+	generation uint64
+	// nextSweep is when fill next removes expired entries from the cache.
+	nextSweep time.Time
+
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	invalidations atomic.Uint64
+
+	stopWatch context.CancelFunc
+	watchDone chan struct{}
+}
+
+// NewCachingStore returns a Store that caches reads from inner.
+func NewCachingStore(inner Store, cfg CacheConfig) (*CachingStore, error) {
+	if inner == nil {
+		return nil, fmt.Errorf("inner store is required")
+	}
+	if cfg.TTL < 0 {
+		return nil, fmt.Errorf("cache TTL cannot be negative: %s", cfg.TTL)
+	}
+	if cfg.Cache == nil {
+		cfg.Cache = cache.NewInMemoryCache()
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = DefaultCacheTTL
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	c := &CachingStore{
+		inner:  inner,
+		cache:  cfg.Cache,
+		ttl:    cfg.TTL,
+		logger: cfg.Logger,
+		now:    time.Now,
+	}
+	if cfg.WatchInvalidation {
+		ctx, cancel := context.WithCancel(context.Background())
+		events, err := inner.WatchPrefix(ctx, "")
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to watch for cache invalidation: %w", err)
+		}
+		c.stopWatch = cancel
+		c.watchDone = make(chan struct{})
+		go c.invalidateOnEvents(events)
+	}
+	return c, nil
+}
+
+// Stats returns the current hit, miss and invalidation counters.
+func (c *CachingStore) Stats() CacheStats {
+	return CacheStats{
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Invalidations: c.invalidations.Load(),
+	}
+}
+
+// Invalidate evicts the keys from the cache, so the next read goes to the underlying
+// store.
+func (c *CachingStore) Invalidate(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.evict(keys...)
+	c.invalidations.Add(uint64(len(keys)))
+}
+
+// InvalidateAll evicts every entry from the cache.
+func (c *CachingStore) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.cache.Flush()
+	c.invalidations.Add(1)
+}
+
+// Get retrieves the value for a given key, from the cache if possible. Returns an
+// empty string if not found.
+func (c *CachingStore) Get(ctx context.Context, key string) (string, error) {
+	value, _, err := c.Lookup(ctx, key)
+	return value, err
+}
+
+// Lookup retrieves the value for a given key, from the cache if possible, and reports
+// whether the key exists.
+func (c *CachingStore) Lookup(ctx context.Context, key string) (string, bool, error) {
+	if e, ok := c.cached(key); ok {
+		c.hits.Add(1)
+		return e.value, e.found, nil
+	}
+	c.misses.Add(1)
+
+	gen := c.currentGeneration()
+	value, found, err := c.inner.Lookup(ctx, key)
+	if err != nil {
+		return "", false, err
+	}
+	c.fill(gen, map[string]cacheEntry{key: {value: value, found: found}})
+	return value, found, nil
+}
+
+// Exists reports whether the key is present, from the cache if possible.
+func (c *CachingStore) Exists(ctx context.Context, key string) (bool, error) {
+	_, found, err := c.Lookup(ctx, key)
+	return found, err
+}
+
+// GetMulti retrieves several keys at once, fetching only the keys that are not cached
+// from the underlying store. Missing keys are omitted.
+func (c *CachingStore) GetMulti(ctx context.Context, keys []string) (map[string]string, error) {
+	result := make(map[string]string, len(keys))
+	var missing []string
+	for _, key := range keys {
+		e, ok := c.cached(key)
+		if !ok {
+			missing = append(missing, key)
+			continue
+		}
+		c.hits.Add(1)
+		if e.found {
+			result[key] = e.value
+		}
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+	c.misses.Add(uint64(len(missing)))
+
+	gen := c.currentGeneration()
+	values, err := c.inner.GetMulti(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]cacheEntry, len(missing))
+	for _, key := range missing {
+		value, found := values[key]
+		entries[key] = cacheEntry{value: value, found: found}
+		if found {
+			result[key] = value
+		}
+	}
+	c.fill(gen, entries)
+	return result, nil
+}
+
+// Set stores the value for a given key and evicts it from the cache.
+func (c *CachingStore) Set(ctx context.Context, key, value string) error {
+	defer c.Invalidate(key)
+	return c.inner.Set(ctx, key, value)
+}
+
+// SetWithTTL stores the value for a given key with an expiry and evicts it from the cache.
+func (c *CachingStore) SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) error {
+	defer c.Invalidate(key)
+	return c.inner.SetWithTTL(ctx, key, value, ttl)
+}
+
+// Delete removes the key and evicts it from the cache.
+func (c *CachingStore) Delete(ctx context.Context, key string) error {
+	defer c.Invalidate(key)
+	return c.inner.Delete(ctx, key)
+}
+
+// SetMulti stores several key-value pairs at once and evicts them from the cache.
+func (c *CachingStore) SetMulti(ctx context.Context, values map[string]string) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	defer c.Invalidate(keys...)
+	return c.inner.SetMulti(ctx, values)
+}
+
+// List returns one page of keys from the underlying store.
+func (c *CachingStore) List(ctx context.Context, opts ListOptions) (ListPage, error) {
+	return c.inner.List(ctx, opts)
+}
+
+// Scan iterates over all keys matching the options in the underlying store.
+func (c *CachingStore) Scan(ctx context.Context, opts ListOptions) iter.Seq2[string, error] {
+	return c.inner.Scan(ctx, opts)
+}
+
+// GetVersion retrieves the value together with its version from the underlying store.
+func (c *CachingStore) GetVersion(ctx context.Context, key string) (string, Version, error) {
+	return c.inner.GetVersion(ctx, key)
+}
+
+// Expiry returns the time the key expires from the underlying store, if it can
+// report it.
+func (c *CachingStore) Expiry(ctx context.Context, key string) (time.Time, error) {
+	return expiryOf(ctx, c.inner, key)
+}
+
+// SetIfVersion stores the value only if the key is still at the given version, and
+// evicts it from the cache.
+func (c *CachingStore) SetIfVersion(ctx context.Context, key, value string, version Version) error {
+	defer c.Invalidate(key)
+	return c.inner.SetIfVersion(ctx, key, value, version)
+}
+
+// CompareAndSwap sets the key to newValue only if its current value equals old, and
+// evicts it from the cache. The comparison uses the underlying store, not the cache.
+func (c *CachingStore) CompareAndSwap(ctx context.Context, key, old, newValue string) (bool, error) {
+	defer c.Invalidate(key)
+	return c.inner.CompareAndSwap(ctx, key, old, newValue)
+}
+
+// Update atomically replaces the value with the result of fn, and evicts it from the cache.
+func (c *CachingStore) Update(ctx context.Context, key string, fn UpdateFunc) error {
+	defer c.Invalidate(key)
+	return c.inner.Update(ctx, key, fn)
+}
+
+// Watch reports changes to the key from the underlying store.
+func (c *CachingStore) Watch(ctx context.Context, key string) (<-chan Event, error) {
+	return c.inner.Watch(ctx, key)
+}
+
+// WatchPrefix reports changes to all keys starting with prefix from the underlying store.
+func (c *CachingStore) WatchPrefix(ctx context.Context, prefix string) (<-chan Event, error) {
+	return c.inner.WatchPrefix(ctx, prefix)
+}
+
+// Close stops the invalidation watch, if any, closes the underlying store and empties
+// the cache, so reads fail like those of the closed store instead of being served
+// from the cache.
+func (c *CachingStore) Close() error {
+	if c.stopWatch != nil {
+		c.stopWatch()
+		<-c.watchDone
+	}
+	err := c.inner.Close()
+	c.InvalidateAll()
+	return err
+}
+
+// cached returns the unexpired cache entry for the key.
+func (c *CachingStore) cached(key string) (cacheEntry, bool) {
+	v, ok := c.cache.Get(key)
+	if !ok {
+		return cacheEntry{}, false
+	}
+	e, ok := v.(cacheEntry)
+	if !ok || !c.now().Before(e.expireAt) {
+		return cacheEntry{}, false
+	}
+	return e, true
+}
+
+// currentGeneration returns the eviction counter, to be passed to fill.
+func (c *CachingStore) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// fill caches entries read from the underlying store, unless an eviction happened
+// since gen was taken, in which case the entries may already be stale.
+func (c *CachingStore) fill(gen uint64, entries map[string]cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != gen {
+		return
+	}
+	now := c.now()
+	c.sweep(now)
+	expireAt := now.Add(c.ttl)
+	for key, e := range entries {
+		e.expireAt = expireAt
+		c.cache.Set(key, e)
+	}
+}
+
+// evict removes the keys from the cache, or overwrites them with evicted entries if the
+// cache cannot delete. c.mu must be held.
+func (c *CachingStore) evict(keys ...string) {
+	if d, ok := c.cache.(cache.Deleter); ok {
+		d.Delete(keys...)
+		return
+	}
+	for _, key := range keys {
+		c.cache.Set(key, cacheEntry{})
+	}
+}
+
+// sweep deletes expired entries once per TTL, so keys that are not read again do not
+// keep their memory. It does nothing if the cache cannot delete. c.mu must be held.
+func (c *CachingStore) sweep(now time.Time) {
+	d, ok := c.cache.(cache.Deleter)
+	if !ok || now.Before(c.nextSweep) {
+		return
+	}
+	c.nextSweep = now.Add(c.ttl)
+	var expired []string
+	for key, v := range c.cache.GetAll() {
+		if e, ok := v.(cacheEntry); !ok || !now.Before(e.expireAt) {
+			expired = append(expired, key)
+		}
+	}
+	if len(expired) > 0 {
+		d.Delete(expired...)
+	}
+}
+
+// invalidateOnEvents evicts the keys of watch events until the channel is closed. A
+// watch failure may hide changes, so it evicts everything.
+func (c *CachingStore) invalidateOnEvents(events <-chan Event) {
+	defer close(c.watchDone)
+	for ev := range events {
+		if ev.Err != nil {
+			c.logger.Warn("Cache invalidation watch failed, flushing the cache", "error", ev.Err)
+			c.InvalidateAll()
+			continue
+		}
+		if ev.Initial {
+			// The current values at the start of the watch are not changes.
+			continue
+		}
+		c.Invalidate(ev.Key)
+	}
+}
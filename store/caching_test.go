@@ -0,0 +1,201 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/duizendstra/dui-go/cache"
+	"github.com/duizendstra/dui-go/firestore"
+	"github.com/duizendstra/dui-go/testutil"
+)
+
+func TestCachingStoreConformance(t *testing.T) {
+	testutil.RunKVConformance(t, func(t *testing.T) firestore.KV {
+		s, err := NewCachingStore(NewMemoryStore(), CacheConfig{})
+		if err != nil {
+			t.Fatalf("NewCachingStore failed: %v", err)
+		}
+		t.Cleanup(func() { _ = s.Close() })
+		return s
+	})
+}
+
+func TestCachingStore(t *testing.T) {
+	ctx := context.Background()
+	inner := NewMemoryStore()
+	s, err := NewCachingStore(inner, CacheConfig{TTL: time.Minute})
+	if err != nil {
+		t.Fatalf("NewCachingStore failed: %v", err)
+	}
+	defer s.Close()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	_ = inner.Set(ctx, "key", "v1")
+
+	t.Run("Reads are cached", func(t *testing.T) {
+		if val, _ := s.Get(ctx, "key"); val != "v1" {
+			t.Fatalf("expected v1, got %q", val)
+		}
+		_ = inner.Set(ctx, "key", "changed elsewhere")
+		if val, _ := s.Get(ctx, "key"); val != "v1" {
+			t.Errorf("expected the cached v1, got %q", val)
+		}
+		if stats := s.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+			t.Errorf("expected 1 hit and 1 miss, got %+v", stats)
+		}
+	})
+
+	t.Run("Entries expire after the TTL", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		if val, _ := s.Get(ctx, "key"); val != "changed elsewhere" {
+			t.Errorf("expected the fresh value after the TTL, got %q", val)
+		}
+	})
+
+	t.Run("Missing keys are cached", func(t *testing.T) {
+		if ok, _ := s.Exists(ctx, "missing"); ok {
+			t.Fatal("expected missing key not to exist")
+		}
+		_ = inner.Set(ctx, "missing", "now present")
+		if _, found, _ := s.Lookup(ctx, "missing"); found {
+			t.Error("expected the cached miss to be served")
+		}
+	})
+
+	t.Run("Writes evict", func(t *testing.T) {
+		_ = s.Set(ctx, "key", "v2")
+		if val, _ := s.Get(ctx, "key"); val != "v2" {
+			t.Errorf("expected v2 after Set, got %q", val)
+		}
+		_ = s.Delete(ctx, "key")
+		if val, found, _ := s.Lookup(ctx, "key"); found {
+			t.Errorf("expected the key to be gone after Delete, got %q", val)
+		}
+		_ = s.Update(ctx, "key", func(string) (string, error) { return "v3", nil })
+		if val, _ := s.Get(ctx, "key"); val != "v3" {
+			t.Errorf("expected v3 after Update, got %q", val)
+		}
+	})
+
+	t.Run("GetMulti fetches only uncached keys", func(t *testing.T) {
+		s.InvalidateAll()
+		_ = inner.SetMulti(ctx, map[string]string{"a": "1", "b": "2"})
+		_, _ = s.Get(ctx, "a")
+		before := s.Stats()
+		values, err := s.GetMulti(ctx, []string{"a", "b", "c"})
+		if err != nil {
+			t.Fatalf("GetMulti failed: %v", err)
+		}
+		if len(values) != 2 || values["a"] != "1" || values["b"] != "2" {
+			t.Errorf("unexpected GetMulti result %v", values)
+		}
+		after := s.Stats()
+		if after.Hits-before.Hits != 1 || after.Misses-before.Misses != 2 {
+			t.Errorf("expected 1 hit and 2 misses, got %+v then %+v", before, after)
+		}
+	})
+
+	t.Run("Stale reads are not cached", func(t *testing.T) {
+		gen := s.currentGeneration()
+		s.Invalidate("stale")
+		s.fill(gen, map[string]cacheEntry{"stale": {value: "old", found: true}})
+		if _, ok := s.cached("stale"); ok {
+			t.Error("expected a fill after an eviction to be dropped")
+		}
+	})
+}
+
+func TestCachingStoreFreesEntries(t *testing.T) {
+	ctx := context.Background()
+	inner := NewMemoryStore()
+	_ = inner.SetMulti(ctx, map[string]string{"a": "1", "b": "2"})
+
+	t.Run("Deleting caches", func(t *testing.T) {
+		c := cache.NewInMemoryCache()
+		s, err := NewCachingStore(inner, CacheConfig{Cache: c, TTL: time.Minute})
+		if err != nil {
+			t.Fatalf("NewCachingStore failed: %v", err)
+		}
+		now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		s.now = func() time.Time { return now }
+
+		_, _ = s.GetMulti(ctx, []string{"a", "b", "missing"})
+		if n := len(c.GetAll()); n != 3 {
+			t.Fatalf("expected 3 cached entries, got %d", n)
+		}
+		s.Invalidate("a", "missing")
+		if all := c.GetAll(); len(all) != 1 || all["b"] == nil {
+			t.Errorf("expected only b to stay cached after Invalidate, got %v", all)
+		}
+		_ = s.Set(ctx, "b", "3")
+		if n := len(c.GetAll()); n != 0 {
+			t.Errorf("expected a write to free the entry, got %d entries", n)
+		}
+
+		_, _ = s.Get(ctx, "a")
+		now = now.Add(time.Minute)
+		_, _ = s.Get(ctx, "b")
+		if all := c.GetAll(); len(all) != 1 || all["b"] == nil {
+			t.Errorf("expected the expired entry for a to be swept, got %v", all)
+		}
+	})
+
+	t.Run("Caches without Delete", func(t *testing.T) {
+		c := struct{ cache.Cache }{cache.NewInMemoryCache()}
+		s, err := NewCachingStore(inner, CacheConfig{Cache: c, TTL: time.Minute})
+		if err != nil {
+			t.Fatalf("NewCachingStore failed: %v", err)
+		}
+		_, _ = s.Get(ctx, "a")
+		s.Invalidate("a")
+		if _, ok := s.cached("a"); ok {
+			t.Error("expected the invalidated entry not to be served")
+		}
+		if val, _ := s.Get(ctx, "a"); val != "1" {
+			t.Errorf("expected 1, got %q", val)
+		}
+	})
+}
+
+func TestCachingStoreWatchInvalidation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	inner := NewMemoryStore()
+	_ = inner.SetMulti(ctx, map[string]string{"key": "v1", "other": "x", "third": "y"})
+	s, err := NewCachingStore(inner, CacheConfig{TTL: time.Hour, WatchInvalidation: true})
+	if err != nil {
+		t.Fatalf("NewCachingStore failed: %v", err)
+	}
+	if n := s.Stats().Invalidations; n != 0 {
+		t.Errorf("expected no invalidations right after construction, got %d", n)
+	}
+
+	for {
+		if val, _ := s.Get(ctx, "key"); val == "v1" {
+			break
+		}
+	}
+	// Another instance writes to the shared store directly.
+	_ = inner.Set(ctx, "key", "v2")
+	for {
+		if val, _ := s.Get(ctx, "key"); val == "v2" {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for the watch to evict the key")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	// The initial values of the three keys preceded the change and were not counted.
+	if n := s.Stats().Invalidations; n != 1 {
+		t.Errorf("expected 1 invalidation for the change, got %d", n)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+}
@@ -1,10 +1,13 @@
 // Package store provides a generic key-value storage abstraction through the Store
 // interface. Implementations of this Store interface can utilize various backends.
 //
-// The package also defines a KV interface (Get, Set, Close). This KV interface
-// represents the contract for basic key-value operations that a backend (like one
-// based on Firestore) might provide. The FirestoreStore implementation in this
-// package, for example, uses an object that satisfies this KV interface.
+// The package also defines a KV interface (Get, Lookup, Set, Delete, Exists, GetMulti,
+// SetMulti, List, Scan, the conditional writes GetVersion, SetIfVersion,
+// CompareAndSwap and Update, the change streams Watch and WatchPrefix, and Close).
+// This KV interface represents the contract for basic key-value operations that a
+// backend (like one based on Firestore) might provide. The FirestoreStore
+// implementation in this package, for example, uses an object that satisfies this KV
+// interface.
 //
 // Hypothetical Store Interface Usage:
 //
@@ -33,6 +36,41 @@
 // can more easily swap storage implementations or mock the store and its underlying
 // key-value mechanism in tests.
 //
+// Backends:
+// Besides FirestoreStore, the package provides MemoryStore (NewMemoryStore), which
+// keeps data in process memory, and FileStore (OpenFileStore), which persists every
+// write to a single file crash-safely by writing a temporary file and renaming it.
+// Open selects a backend from a URL, so it can be chosen by configuration:
+//
+//	s, err := store.Open(ctx, os.Getenv("STORE_URL")) // e.g. "mem://", "file:///var/lib/app/store.json"
+//	if err != nil { /* handle error */ }
+//	defer s.Close()
+//
+// Firestore URLs take the form "firestore://project/collection". The "namespace"
+// query parameter confines any backend to a namespace.
+//
+// Namespaces:
+// NewNamespacedStore wraps any Store and prefixes its keys with a namespace and
+// NamespaceSeparator, so several tenants or components can share one backend. Keys in
+// results are returned without the prefix. For Firestore, firestore.FirestoreKV's
+// Namespace method keeps each namespace in its own subcollection instead.
+//
+// Caching:
+// NewCachingStore wraps any Store with a read-through cache.Cache: Get, Lookup, Exists
+// and GetMulti are served from the cache for up to CacheConfig.TTL, including for
+// missing keys, and writes through the CachingStore evict the keys they touch. With
+// CacheConfig.WatchInvalidation, changes made by other instances are evicted as soon
+// as the underlying store reports them through WatchPrefix. Stats reports hits,
+// misses and invalidations.
+//
+// Encryption at Rest:
+// NewEncryptedStore wraps any Store and encrypts values with envelope encryption:
+// AES-256-GCM data keys, one per value, wrapped by a key-encryption key from a
+// KeyWrapper. Keyring provides local keys; a Cloud KMS adapter can implement
+// KeyWrapper as well. Stored values record the key ID, so after rotating to a new
+// primary key, ReencryptAll moves existing values to it. Values with an expiry are
+// left as they are until they expire, since rewriting them would drop the expiry.
+//
 // This package focuses on production code. For testing without relying on external
 // services, use mocks from the internal testutil package. For example,
 // testutil.NewMockFirestoreKV() can simulate Firestore KV behavior in-memory and
@@ -0,0 +1,398 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"strings"
+	"time"
+
+	"github.com/duizendstra/dui-go/firestore"
+)
+
+// Compile-time check that EncryptedStore implements Store.
+var _ Store = (*EncryptedStore)(nil)
+
+// envelopePrefix marks values written by EncryptedStore and versions their format.
+const envelopePrefix = "enc:v1:"
+
+// ErrDecryption is wrapped by errors from EncryptedStore reads when a stored value
+// cannot be decrypted, for example because it was tampered with, its key ID is unknown,
+// or it is plaintext and EncryptionConfig.AllowPlaintext is not set.
+var ErrDecryption = errors.New("failed to decrypt value")
+
+// EncryptionConfig configures an EncryptedStore.
+type EncryptionConfig struct {
+	// Keys wraps the per-value data keys. Use a Keyring for local keys, or an adapter
+	// around Cloud KMS. Required.
+	Keys KeyWrapper
+	// AllowPlaintext makes reads return values that were stored without encryption as
+	// they are, instead of failing with ErrDecryption. Enable it while migrating an
+	// existing store, then run ReencryptAll to encrypt the old values.
+	AllowPlaintext bool
+}
+
+// EncryptedStore is a Store decorator that encrypts values before they reach the
+// underlying Store, using envelope encryption: every value is encrypted with a fresh
+// AES-256-GCM data key, and the data key is wrapped by a key-encryption key (KEK) from
+// the configured KeyWrapper. The stored value holds the KEK's key ID, the wrapped data
+// key and the ciphertext, so KEKs can be rotated while older values stay readable.
+// Ciphertexts are bound to their key, so a value copied to another key fails to decrypt.
+//
+// Keys, versions, expiry and listing are passed through unchanged; only values are
+// encrypted. CompareAndSwap compares decrypted values.
+type EncryptedStore struct {
+	inner          Store
+	keys           KeyWrapper
+	allowPlaintext bool
+}
+
+// envelope is the stored form of an encrypted value.
+type envelope struct {
+	KeyID      string `json:"kid"`
+	WrappedKey []byte `json:"dk"`
+	Ciphertext []byte `json:"ct"`
+}
+
+// NewEncryptedStore returns a Store that encrypts values stored in inner.
+func NewEncryptedStore(inner Store, cfg EncryptionConfig) (*EncryptedStore, error) {
+	if inner == nil {
+		return nil, fmt.Errorf("inner store is required")
+	}
+	if cfg.Keys == nil {
+		return nil, fmt.Errorf("key wrapper is required")
+	}
+	return &EncryptedStore{inner: inner, keys: cfg.Keys, allowPlaintext: cfg.AllowPlaintext}, nil
+}
+
+// Get retrieves and decrypts the value for a given key. Returns an empty string if not found.
+func (e *EncryptedStore) Get(ctx context.Context, key string) (string, error) {
+	value, _, err := e.Lookup(ctx, key)
+	return value, err
+}
+
+// Lookup retrieves and decrypts the value for a given key and reports whether the key exists.
+func (e *EncryptedStore) Lookup(ctx context.Context, key string) (string, bool, error) {
+	stored, found, err := e.inner.Lookup(ctx, key)
+	if err != nil || !found {
+		return "", found, err
+	}
+	value, err := e.decrypt(ctx, key, stored)
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// Set encrypts and stores the value for a given key.
+func (e *EncryptedStore) Set(ctx context.Context, key, value string) error {
+	stored, err := e.encrypt(ctx, key, value)
+	if err != nil {
+		return err
+	}
+	return e.inner.Set(ctx, key, stored)
+}
+
+// SetWithTTL encrypts and stores the value for a given key with an expiry.
+func (e *EncryptedStore) SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) error {
+	stored, err := e.encrypt(ctx, key, value)
+	if err != nil {
+		return err
+	}
+	return e.inner.SetWithTTL(ctx, key, stored, ttl)
+}
+
+// Delete removes the key.
+func (e *EncryptedStore) Delete(ctx context.Context, key string) error {
+	return e.inner.Delete(ctx, key)
+}
+
+// Exists reports whether the key is present.
+func (e *EncryptedStore) Exists(ctx context.Context, key string) (bool, error) {
+	return e.inner.Exists(ctx, key)
+}
+
+// GetMulti retrieves and decrypts several keys at once. Missing keys are omitted.
+func (e *EncryptedStore) GetMulti(ctx context.Context, keys []string) (map[string]string, error) {
+	stored, err := e.inner.GetMulti(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string, len(stored))
+	for key, s := range stored {
+		if result[key], err = e.decrypt(ctx, key, s); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// SetMulti encrypts and stores several key-value pairs at once.
+func (e *EncryptedStore) SetMulti(ctx context.Context, values map[string]string) error {
+	stored := make(map[string]string, len(values))
+	for key, value := range values {
+		s, err := e.encrypt(ctx, key, value)
+		if err != nil {
+			return err
+		}
+		stored[key] = s
+	}
+	return e.inner.SetMulti(ctx, stored)
+}
+
+// List returns one page of keys. Keys are not encrypted.
+func (e *EncryptedStore) List(ctx context.Context, opts ListOptions) (ListPage, error) {
+	return e.inner.List(ctx, opts)
+}
+
+// Scan iterates over all keys matching the options.
+func (e *EncryptedStore) Scan(ctx context.Context, opts ListOptions) iter.Seq2[string, error] {
+	return e.inner.Scan(ctx, opts)
+}
+
+// GetVersion retrieves and decrypts the value together with its version.
+func (e *EncryptedStore) GetVersion(ctx context.Context, key string) (string, Version, error) {
+	stored, version, err := e.inner.GetVersion(ctx, key)
+	if err != nil || version == NoVersion {
+		return "", version, err
+	}
+	value, err := e.decrypt(ctx, key, stored)
+	if err != nil {
+		return "", NoVersion, err
+	}
+	return value, version, nil
+}
+
+// Expiry returns the time the key expires, if the underlying store can report it.
+func (e *EncryptedStore) Expiry(ctx context.Context, key string) (time.Time, error) {
+	return expiryOf(ctx, e.inner, key)
+}
+
+// SetIfVersion encrypts and stores the value only if the key is still at the given version.
+func (e *EncryptedStore) SetIfVersion(ctx context.Context, key, value string, version Version) error {
+	stored, err := e.encrypt(ctx, key, value)
+	if err != nil {
+		return err
+	}
+	return e.inner.SetIfVersion(ctx, key, stored, version)
+}
+
+// CompareAndSwap sets the key to newValue only if its decrypted value equals old. A
+// missing key has the value "".
+func (e *EncryptedStore) CompareAndSwap(ctx context.Context, key, old, newValue string) (bool, error) {
+	return firestore.CompareAndSwapWith(ctx, e.Update, key, old, newValue)
+}
+
+// Update atomically replaces the value with the result of fn, which receives and
+// returns plaintext. A missing key passes "" to fn. The value is read with GetVersion
+// and written with SetIfVersion, so that a missing key is told apart from an empty
+// stored value, which fails to decrypt like any other tampered value. If the key
+// changes in the meantime, fn is called again, up to MaxUpdateAttempts times before
+// failing with an error wrapping ErrConflict.
+func (e *EncryptedStore) Update(ctx context.Context, key string, fn UpdateFunc) error {
+	for attempt := 0; attempt < firestore.MaxUpdateAttempts; attempt++ {
+		old, version, err := e.GetVersion(ctx, key)
+		if err != nil {
+			return err
+		}
+		value, err := fn(old)
+		if err != nil {
+			return err
+		}
+		err = e.SetIfVersion(ctx, key, value, version)
+		if !errors.Is(err, ErrPreconditionFailed) {
+			return err
+		}
+	}
+	return fmt.Errorf("update (key=%s): %w", key, ErrConflict)
+}
+
+// Watch reports changes to the key with decrypted values. A value that cannot be
+// decrypted is reported as an event with Err set.
+func (e *EncryptedStore) Watch(ctx context.Context, key string) (<-chan Event, error) {
+	events, err := e.inner.Watch(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return e.decryptEvents(ctx, events), nil
+}
+
+// WatchPrefix reports changes to all keys starting with prefix with decrypted values.
+func (e *EncryptedStore) WatchPrefix(ctx context.Context, prefix string) (<-chan Event, error) {
+	events, err := e.inner.WatchPrefix(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return e.decryptEvents(ctx, events), nil
+}
+
+// Close closes the underlying store.
+func (e *EncryptedStore) Close() error {
+	return e.inner.Close()
+}
+
+// Reencrypt re-encrypts the value of the key with the current KEK if it was encrypted
+// with an older one, or stored as plaintext while AllowPlaintext is set. It reports
+// whether the value was rewritten.
+//
+// Keys with an expiry are skipped, since rewriting would make them permanent; they
+// stay readable with their KEK until they expire. The underlying store must therefore
+// implement ExpiryReader, as the stores of this package do.
+func (e *EncryptedStore) Reencrypt(ctx context.Context, key string) (bool, error) {
+	currentID, err := e.keys.CurrentKeyID(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get current key ID: %w", err)
+	}
+
+	for attempt := 0; attempt < firestore.MaxUpdateAttempts; attempt++ {
+		rewritten, err := e.reencrypt(ctx, key, currentID)
+		if !errors.Is(err, ErrPreconditionFailed) {
+			if err != nil {
+				return false, fmt.Errorf("failed to re-encrypt key %s: %w", key, err)
+			}
+			return rewritten, nil
+		}
+	}
+	return false, fmt.Errorf("failed to re-encrypt key %s: %w", key, ErrConflict)
+}
+
+// reencrypt makes one attempt of Reencrypt. The rewrite is conditional on the version
+// read, so a concurrent write, including one that sets an expiry, fails it with
+// ErrPreconditionFailed.
+func (e *EncryptedStore) reencrypt(ctx context.Context, key, currentID string) (bool, error) {
+	stored, version, err := e.inner.GetVersion(ctx, key)
+	if err != nil || version == NoVersion {
+		return false, err
+	}
+	if env, ok := parseEnvelope(stored); ok && env.KeyID == currentID {
+		return false, nil
+	}
+	expireAt, err := expiryOf(ctx, e.inner, key)
+	if err != nil || !expireAt.IsZero() {
+		return false, err
+	}
+
+	value, err := e.decrypt(ctx, key, stored)
+	if err != nil {
+		return false, err
+	}
+	stored, err = e.encrypt(ctx, key, value)
+	if err != nil {
+		return false, err
+	}
+	if err := e.inner.SetIfVersion(ctx, key, stored, version); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ReencryptAll calls Reencrypt for every key matching the options and returns the
+// number of values rewritten. It stops at the first error. Running it after adding a
+// new primary KEK moves all values without an expiry to that key; once the values
+// with an expiry under the old KEKs have expired, those KEKs can be retired.
+func (e *EncryptedStore) ReencryptAll(ctx context.Context, opts ListOptions) (int, error) {
+	count := 0
+	for key, err := range e.inner.Scan(ctx, opts) {
+		if err != nil {
+			return count, err
+		}
+		rewritten, err := e.Reencrypt(ctx, key)
+		if err != nil {
+			return count, err
+		}
+		if rewritten {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// encrypt seals value under a new data key and returns the stored form.
+func (e *EncryptedStore) encrypt(ctx context.Context, key, value string) (string, error) {
+	keyID, err := e.keys.CurrentKeyID(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get current key ID: %w", err)
+	}
+
+	// Every value gets its own AES-256 data key.
+	dataKey, err := GenerateKey()
+	if err != nil {
+		return "", err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(aead, []byte(value), []byte(key))
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := e.keys.WrapKey(ctx, keyID, dataKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap data key (key=%s, keyID=%s): %w", key, keyID, err)
+	}
+
+	b, err := json.Marshal(envelope{KeyID: keyID, WrappedKey: wrapped, Ciphertext: ciphertext})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode encrypted value (key=%s): %w", key, err)
+	}
+	return envelopePrefix + string(b), nil
+}
+
+// decrypt returns the plaintext of a stored value. Every value EncryptedStore writes
+// is an envelope, so an empty stored value is only accepted as plaintext.
+func (e *EncryptedStore) decrypt(ctx context.Context, key, stored string) (string, error) {
+	env, ok := parseEnvelope(stored)
+	if !ok {
+		if e.allowPlaintext && !strings.HasPrefix(stored, envelopePrefix) {
+			return stored, nil
+		}
+		return "", fmt.Errorf("%w (key=%s): not an encrypted value", ErrDecryption, key)
+	}
+
+	dataKey, err := e.keys.UnwrapKey(ctx, env.KeyID, env.WrappedKey)
+	if err != nil {
+		return "", fmt.Errorf("%w (key=%s, keyID=%s): %w", ErrDecryption, key, env.KeyID, err)
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return "", fmt.Errorf("%w (key=%s, keyID=%s): %w", ErrDecryption, key, env.KeyID, err)
+	}
+	plaintext, err := unseal(aead, env.Ciphertext, []byte(key))
+	if err != nil {
+		return "", fmt.Errorf("%w (key=%s, keyID=%s): %w", ErrDecryption, key, env.KeyID, err)
+	}
+	return string(plaintext), nil
+}
+
+// decryptEvents forwards events from in with decrypted values until in is closed.
+func (e *EncryptedStore) decryptEvents(ctx context.Context, in <-chan Event) <-chan Event {
+	out := make(chan Event)
+	go func() {
+		defer close(out)
+		for ev := range in {
+			if ev.Err == nil && ev.Type == EventSet {
+				value, err := e.decrypt(ctx, ev.Key, ev.Value)
+				ev.Value, ev.Err = value, err
+			}
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// parseEnvelope decodes a stored value written by encrypt.
+func parseEnvelope(stored string) (envelope, bool) {
+	var env envelope
+	data, ok := strings.CutPrefix(stored, envelopePrefix)
+	if !ok || json.Unmarshal([]byte(data), &env) != nil || env.KeyID == "" {
+		return envelope{}, false
+	}
+	return env, true
+}
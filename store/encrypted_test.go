@@ -0,0 +1,279 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/duizendstra/dui-go/firestore"
+	"github.com/duizendstra/dui-go/testutil"
+)
+
+// newTestKeyring returns a keyring with a random primary key "k1".
+func newTestKeyring(t *testing.T) *Keyring {
+	t.Helper()
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	keys, err := NewKeyring("k1", key)
+	if err != nil {
+		t.Fatalf("NewKeyring failed: %v", err)
+	}
+	return keys
+}
+
+func TestEncryptedStoreConformance(t *testing.T) {
+	testutil.RunKVConformance(t, func(t *testing.T) firestore.KV {
+		s, err := NewEncryptedStore(NewMemoryStore(), EncryptionConfig{Keys: newTestKeyring(t)})
+		if err != nil {
+			t.Fatalf("NewEncryptedStore failed: %v", err)
+		}
+		t.Cleanup(func() { _ = s.Close() })
+		return s
+	})
+}
+
+func TestEncryptedStore(t *testing.T) {
+	ctx := context.Background()
+	inner := NewMemoryStore()
+	s, err := NewEncryptedStore(inner, EncryptionConfig{Keys: newTestKeyring(t)})
+	if err != nil {
+		t.Fatalf("NewEncryptedStore failed: %v", err)
+	}
+
+	if err := s.Set(ctx, "api-key", "secret-value"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	stored, _ := inner.Get(ctx, "api-key")
+	if strings.Contains(stored, "secret-value") || !strings.HasPrefix(stored, envelopePrefix) {
+		t.Errorf("expected an encrypted envelope, got %q", stored)
+	}
+	if env, ok := parseEnvelope(stored); !ok || env.KeyID != "k1" {
+		t.Errorf("expected the envelope to record key ID k1, got %+v", env)
+	}
+	if val, _ := s.Get(ctx, "api-key"); val != "secret-value" {
+		t.Errorf("expected the decrypted value, got %q", val)
+	}
+
+	t.Run("Values are bound to their key", func(t *testing.T) {
+		_ = inner.Set(ctx, "copied", stored)
+		if _, err := s.Get(ctx, "copied"); !errors.Is(err, ErrDecryption) {
+			t.Errorf("expected ErrDecryption for a copied value, got %v", err)
+		}
+	})
+
+	t.Run("Tampered values fail", func(t *testing.T) {
+		_ = inner.Set(ctx, "tampered", stored[:len(stored)-4]+"AA\"}")
+		if _, err := s.Get(ctx, "tampered"); !errors.Is(err, ErrDecryption) {
+			t.Errorf("expected ErrDecryption for a tampered value, got %v", err)
+		}
+	})
+
+	t.Run("Empty stored values fail", func(t *testing.T) {
+		_ = inner.Set(ctx, "emptied", "")
+		if _, err := s.Get(ctx, "emptied"); !errors.Is(err, ErrDecryption) {
+			t.Errorf("expected ErrDecryption from Get, got %v", err)
+		}
+		if _, _, err := s.Lookup(ctx, "emptied"); !errors.Is(err, ErrDecryption) {
+			t.Errorf("expected ErrDecryption from Lookup, got %v", err)
+		}
+		if _, err := s.GetMulti(ctx, []string{"emptied"}); !errors.Is(err, ErrDecryption) {
+			t.Errorf("expected ErrDecryption from GetMulti, got %v", err)
+		}
+		if _, _, err := s.GetVersion(ctx, "emptied"); !errors.Is(err, ErrDecryption) {
+			t.Errorf("expected ErrDecryption from GetVersion, got %v", err)
+		}
+		if err := s.Update(ctx, "emptied", func(string) (string, error) { return "x", nil }); !errors.Is(err, ErrDecryption) {
+			t.Errorf("expected ErrDecryption from Update, got %v", err)
+		}
+		if _, err := s.CompareAndSwap(ctx, "emptied", "", "x"); !errors.Is(err, ErrDecryption) {
+			t.Errorf("expected ErrDecryption from CompareAndSwap, got %v", err)
+		}
+
+		// A missing key still reads as "" in Update and CompareAndSwap.
+		if swapped, err := s.CompareAndSwap(ctx, "fresh", "", "x"); err != nil || !swapped {
+			t.Errorf("expected CompareAndSwap on a missing key to succeed, got %v, %v", swapped, err)
+		}
+		if val, err := s.Get(ctx, "fresh"); err != nil || val != "x" {
+			t.Errorf("expected 'x', got %q, %v", val, err)
+		}
+	})
+
+	t.Run("Plaintext values", func(t *testing.T) {
+		_ = inner.Set(ctx, "legacy", "plain")
+		if _, err := s.Get(ctx, "legacy"); !errors.Is(err, ErrDecryption) {
+			t.Errorf("expected ErrDecryption for plaintext, got %v", err)
+		}
+
+		lenient, _ := NewEncryptedStore(inner, EncryptionConfig{Keys: s.keys, AllowPlaintext: true})
+		if val, err := lenient.Get(ctx, "legacy"); err != nil || val != "plain" {
+			t.Errorf("expected plaintext to pass through, got %q, %v", val, err)
+		}
+		if val, err := lenient.Get(ctx, "emptied"); err != nil || val != "" {
+			t.Errorf("expected an empty plaintext to pass through, got %q, %v", val, err)
+		}
+	})
+
+	if _, err := NewEncryptedStore(inner, EncryptionConfig{}); err == nil {
+		t.Error("expected an error without a key wrapper")
+	}
+}
+
+func TestEncryptedStoreRotation(t *testing.T) {
+	ctx := context.Background()
+	inner := NewMemoryStore()
+	keys := newTestKeyring(t)
+	s, _ := NewEncryptedStore(inner, EncryptionConfig{Keys: keys, AllowPlaintext: true})
+
+	_ = s.SetMulti(ctx, map[string]string{"a": "1", "b": "2"})
+	_ = inner.Set(ctx, "legacy", "3")
+
+	newKey, _ := GenerateKey()
+	if err := keys.AddKey("k2", newKey, true); err != nil {
+		t.Fatalf("AddKey failed: %v", err)
+	}
+	// Values under the old key stay readable after rotation.
+	if val, err := s.Get(ctx, "a"); err != nil || val != "1" {
+		t.Errorf("expected old values to stay readable, got %q, %v", val, err)
+	}
+
+	n, err := s.ReencryptAll(ctx, ListOptions{})
+	if err != nil || n != 3 {
+		t.Fatalf("expected 3 re-encrypted values, got %d, %v", n, err)
+	}
+	for _, key := range []string{"a", "b", "legacy"} {
+		stored, _ := inner.Get(ctx, key)
+		if env, ok := parseEnvelope(stored); !ok || env.KeyID != "k2" {
+			t.Errorf("expected %s to use k2, got %q", key, stored)
+		}
+	}
+	if n, err := s.ReencryptAll(ctx, ListOptions{}); err != nil || n != 0 {
+		t.Errorf("expected nothing left to re-encrypt, got %d, %v", n, err)
+	}
+	if got, _ := s.GetMulti(ctx, []string{"a", "b", "legacy"}); got["a"] != "1" || got["b"] != "2" || got["legacy"] != "3" {
+		t.Errorf("expected values to survive re-encryption, got %v", got)
+	}
+}
+
+func TestEncryptedStoreReencryptKeepsExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+	inner := NewMemoryStore()
+	inner.now = func() time.Time { return now }
+	keys := newTestKeyring(t)
+	s, _ := NewEncryptedStore(inner, EncryptionConfig{Keys: keys})
+
+	rotate := func(t *testing.T, keyID string) {
+		t.Helper()
+		key, _ := GenerateKey()
+		if err := keys.AddKey(keyID, key, true); err != nil {
+			t.Fatalf("AddKey failed: %v", err)
+		}
+	}
+	// expectExpiring checks that the key is still under oldID and expires at expireAt.
+	expectExpiring := func(t *testing.T, key, oldID string, expireAt time.Time) {
+		t.Helper()
+		stored, _ := inner.Get(ctx, key)
+		if env, ok := parseEnvelope(stored); !ok || env.KeyID != oldID {
+			t.Errorf("expected %s to keep %s, got %q", key, oldID, stored)
+		}
+		if got, err := s.Expiry(ctx, key); err != nil || !got.Equal(expireAt) {
+			t.Errorf("expected %s to expire at %v, got %v, %v", key, expireAt, got, err)
+		}
+	}
+
+	t.Run("Reencrypt", func(t *testing.T) {
+		_ = s.SetWithTTL(ctx, "session", "token", time.Minute)
+		rotate(t, "k2")
+		if rewritten, err := s.Reencrypt(ctx, "session"); err != nil || rewritten {
+			t.Fatalf("expected the key with an expiry to be skipped, got %v, %v", rewritten, err)
+		}
+		expectExpiring(t, "session", "k1", now.Add(time.Minute))
+		if val, err := s.Get(ctx, "session"); err != nil || val != "token" {
+			t.Errorf("expected 'token', got %q, %v", val, err)
+		}
+	})
+
+	t.Run("ReencryptAll", func(t *testing.T) {
+		_ = s.Set(ctx, "config", "permanent")
+		_ = s.SetWithTTL(ctx, "cache", "temporary", time.Hour)
+		rotate(t, "k3")
+		if n, err := s.ReencryptAll(ctx, ListOptions{}); err != nil || n != 1 {
+			t.Fatalf("expected only the permanent key to be re-encrypted, got %d, %v", n, err)
+		}
+		stored, _ := inner.Get(ctx, "config")
+		if env, ok := parseEnvelope(stored); !ok || env.KeyID != "k3" {
+			t.Errorf("expected config to use k3, got %q", stored)
+		}
+		expectExpiring(t, "cache", "k2", now.Add(time.Hour))
+		expectExpiring(t, "session", "k1", now.Add(time.Minute))
+
+		now = now.Add(2 * time.Hour)
+		if found, _ := s.Exists(ctx, "cache"); found {
+			t.Error("expected the skipped key to expire")
+		}
+	})
+
+	t.Run("Stores that cannot report expiry", func(t *testing.T) {
+		// Embedding the Store interface hides MemoryStore.Expiry.
+		opaque, _ := NewEncryptedStore(struct{ Store }{inner}, EncryptionConfig{Keys: keys})
+		_ = inner.Set(ctx, "legacy", "plain")
+		lenient, _ := NewEncryptedStore(struct{ Store }{inner}, EncryptionConfig{Keys: keys, AllowPlaintext: true})
+		if _, err := lenient.Reencrypt(ctx, "legacy"); !errors.Is(err, errors.ErrUnsupported) {
+			t.Errorf("expected ErrUnsupported, got %v", err)
+		}
+		if _, err := opaque.Expiry(ctx, "config"); !errors.Is(err, errors.ErrUnsupported) {
+			t.Errorf("expected ErrUnsupported, got %v", err)
+		}
+	})
+}
+
+// fakeKMS stands in for a Cloud KMS adapter and counts its calls.
+type fakeKMS struct {
+	*Keyring
+	wraps, unwraps int
+}
+
+func (f *fakeKMS) WrapKey(ctx context.Context, keyID string, dataKey []byte) ([]byte, error) {
+	f.wraps++
+	return f.Keyring.WrapKey(ctx, keyID, dataKey)
+}
+
+func (f *fakeKMS) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	f.unwraps++
+	return f.Keyring.UnwrapKey(ctx, keyID, wrapped)
+}
+
+func TestEncryptedStoreCustomKeyWrapper(t *testing.T) {
+	ctx := context.Background()
+	kms := &fakeKMS{Keyring: newTestKeyring(t)}
+	s, _ := NewEncryptedStore(NewMemoryStore(), EncryptionConfig{Keys: kms})
+
+	_ = s.Set(ctx, "token", "refresh")
+	if val, _ := s.Get(ctx, "token"); val != "refresh" {
+		t.Errorf("expected 'refresh', got %q", val)
+	}
+	if kms.wraps != 1 || kms.unwraps != 1 {
+		t.Errorf("expected one wrap and one unwrap, got %d and %d", kms.wraps, kms.unwraps)
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	if _, err := NewKeyring("k1", []byte("short")); err == nil {
+		t.Error("expected an error for an invalid key length")
+	}
+	keys := newTestKeyring(t)
+	key, _ := GenerateKey()
+	if err := keys.AddKey("k1", key, false); err == nil {
+		t.Error("expected an error for a duplicate key ID")
+	}
+	if err := keys.SetPrimary("missing"); err == nil {
+		t.Error("expected an error for an unknown key ID")
+	}
+	if _, err := keys.UnwrapKey(context.Background(), "missing", nil); err == nil {
+		t.Error("expected an error for an unknown key ID")
+	}
+}
@@ -0,0 +1,254 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"iter"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrFileLocked is returned by OpenFileStore when another store holds the file.
+var ErrFileLocked = errors.New("store file is locked by another store")
+
+// fileFormatVersion is written into every store file so the format can evolve.
+const fileFormatVersion = 1
+
+// fileState is the on-disk layout of a file store.
+type fileState struct {
+	Format      int                    `json:"format"`
+	LastVersion Version                `json:"lastVersion"`
+	Entries     map[string]memoryEntry `json:"entries"`
+}
+
+// Compile-time checks that FileStore implements Store and ExpiryReader.
+var (
+	_ Store        = (*FileStore)(nil)
+	_ ExpiryReader = (*FileStore)(nil)
+)
+
+// FileStore is a Store kept in a single file, opened with OpenFileStore. It holds all
+// data in memory, like MemoryStore, and rewrites the file after every write.
+type FileStore struct {
+	mem *MemoryStore
+}
+
+// OpenFileStore opens the store kept in the single file at path, creating the file on
+// the first write if it does not exist. The returned store holds all data in memory,
+// like MemoryStore, and rewrites the file after every write.
+//
+// Writes are crash-safe: the new state is written to a temporary file in the same
+// directory, flushed to disk and then renamed over the old file, so the file always
+// holds either the previous or the new state. A write only succeeds once the file is
+// updated; if persisting fails, the write is rolled back and the error returned.
+//
+// Only one store can use the file at a time. OpenFileStore takes an exclusive lock on
+// the file path + ".lock", which it creates next to the store file, and returns
+// ErrFileLocked if another store, in this or another process, holds it. Close releases
+// the lock. On Unix systems the lock is an flock, which the operating system releases
+// when the process exits; elsewhere the lock file itself is the lock, and one left
+// behind by a crashed process must be removed by hand.
+//
+// Because every write rewrites the whole file, the file store suits small data sets
+// such as configuration and local development.
+func OpenFileStore(path string) (*FileStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file store path cannot be empty")
+	}
+
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	state, err := readFileState(path)
+	if err != nil {
+		_ = unlock()
+		return nil, err
+	}
+
+	m := NewMemoryStore()
+	m.entries = state.Entries
+	m.lastVersion = state.LastVersion
+	m.persist = func(entries map[string]memoryEntry, lastVersion Version) error {
+		return writeFileState(path, entries, lastVersion, m.now())
+	}
+	m.release = unlock
+	return &FileStore{mem: m}, nil
+}
+
+// Get retrieves the value for a given key. Returns an empty string if not found.
+func (f *FileStore) Get(ctx context.Context, key string) (string, error) {
+	return f.mem.Get(ctx, key)
+}
+
+// Lookup retrieves the value for a given key and reports whether the key exists.
+func (f *FileStore) Lookup(ctx context.Context, key string) (string, bool, error) {
+	return f.mem.Lookup(ctx, key)
+}
+
+// Set stores the value under the given key and rewrites the file.
+func (f *FileStore) Set(ctx context.Context, key, value string) error {
+	return f.mem.Set(ctx, key, value)
+}
+
+// SetWithTTL stores the value under the given key until ttl has elapsed and rewrites
+// the file. Expired keys are left out of the file the next time it is written.
+func (f *FileStore) SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) error {
+	return f.mem.SetWithTTL(ctx, key, value, ttl)
+}
+
+// Delete removes the key and rewrites the file.
+func (f *FileStore) Delete(ctx context.Context, key string) error {
+	return f.mem.Delete(ctx, key)
+}
+
+// Exists reports whether the key is present.
+func (f *FileStore) Exists(ctx context.Context, key string) (bool, error) {
+	return f.mem.Exists(ctx, key)
+}
+
+// GetMulti retrieves several keys at once. Missing keys are omitted from the result.
+func (f *FileStore) GetMulti(ctx context.Context, keys []string) (map[string]string, error) {
+	return f.mem.GetMulti(ctx, keys)
+}
+
+// SetMulti stores several key-value pairs and rewrites the file once.
+func (f *FileStore) SetMulti(ctx context.Context, values map[string]string) error {
+	return f.mem.SetMulti(ctx, values)
+}
+
+// List returns one page of keys, in ascending order, matching the options.
+func (f *FileStore) List(ctx context.Context, opts ListOptions) (ListPage, error) {
+	return f.mem.List(ctx, opts)
+}
+
+// Scan iterates over all keys matching the options.
+func (f *FileStore) Scan(ctx context.Context, opts ListOptions) iter.Seq2[string, error] {
+	return f.mem.Scan(ctx, opts)
+}
+
+// GetVersion retrieves the value together with its version (NoVersion if missing).
+func (f *FileStore) GetVersion(ctx context.Context, key string) (string, Version, error) {
+	return f.mem.GetVersion(ctx, key)
+}
+
+// Expiry returns the time the key expires, or the zero time if it has no expiry or
+// does not exist.
+func (f *FileStore) Expiry(ctx context.Context, key string) (time.Time, error) {
+	return f.mem.Expiry(ctx, key)
+}
+
+// SetIfVersion stores the value only if the key is still at the given version.
+func (f *FileStore) SetIfVersion(ctx context.Context, key, value string, version Version) error {
+	return f.mem.SetIfVersion(ctx, key, value, version)
+}
+
+// CompareAndSwap sets the key to newValue only if its current value equals old.
+func (f *FileStore) CompareAndSwap(ctx context.Context, key, old, newValue string) (bool, error) {
+	return f.mem.CompareAndSwap(ctx, key, old, newValue)
+}
+
+// Update replaces the value with the result of fn and rewrites the file.
+func (f *FileStore) Update(ctx context.Context, key string, fn UpdateFunc) error {
+	return f.mem.Update(ctx, key, fn)
+}
+
+// Watch reports changes to the key made through this store until ctx is done.
+func (f *FileStore) Watch(ctx context.Context, key string) (<-chan Event, error) {
+	return f.mem.Watch(ctx, key)
+}
+
+// WatchPrefix reports changes to the keys starting with prefix made through this
+// store until ctx is done.
+func (f *FileStore) WatchPrefix(ctx context.Context, prefix string) (<-chan Event, error) {
+	return f.mem.WatchPrefix(ctx, prefix)
+}
+
+// Close ends all watches and releases the lock on the file. Operations after Close
+// fail with ErrClosed.
+func (f *FileStore) Close() error {
+	return f.mem.Close()
+}
+
+// readFileState loads the store file at path. A missing file is an empty store.
+func readFileState(path string) (fileState, error) {
+	state := fileState{Entries: make(map[string]memoryEntry)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to read store file %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("failed to decode store file %s: %w", path, err)
+	}
+	if state.Format != fileFormatVersion {
+		return state, fmt.Errorf("unsupported store file format %d in %s", state.Format, path)
+	}
+	if state.Entries == nil {
+		state.Entries = make(map[string]memoryEntry)
+	}
+	return state, nil
+}
+
+// writeFileState atomically replaces the store file at path with the given state,
+// leaving out entries that have expired at now.
+func writeFileState(path string, entries map[string]memoryEntry, lastVersion Version, now time.Time) error {
+	state := fileState{
+		Format:      fileFormatVersion,
+		LastVersion: lastVersion,
+		Entries:     make(map[string]memoryEntry, len(entries)),
+	}
+	for key, e := range entries {
+		if e.live(now) {
+			state.Entries[key] = e
+		}
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode store file %s: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary store file in %s: %w", dir, err)
+	}
+	// Removing the temporary file fails harmlessly once it has been renamed.
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write store file %s: %w", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync store file %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close store file %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace store file %s: %w", path, err)
+	}
+	syncDir(dir)
+	return nil
+}
+
+// syncDir flushes the directory entry of a renamed file to disk. Not all platforms
+// support syncing directories, so failures are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/duizendstra/dui-go/firestore"
+	"github.com/duizendstra/dui-go/testutil"
+)
+
+func TestFileStoreConformance(t *testing.T) {
+	testutil.RunKVConformance(t, func(t *testing.T) firestore.KV {
+		s, err := OpenFileStore(filepath.Join(t.TempDir(), "store.json"))
+		if err != nil {
+			t.Fatalf("OpenFileStore failed: %v", err)
+		}
+		t.Cleanup(func() { _ = s.Close() })
+		return s
+	})
+}
+
+func TestFileStorePersistence(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	s, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	if err := s.SetMulti(ctx, map[string]string{"a": "1", "b": ""}); err != nil {
+		t.Fatalf("SetMulti failed: %v", err)
+	}
+	if err := s.SetWithTTL(ctx, "session", "x", time.Hour); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	_, version, _ := s.GetVersion(ctx, "a")
+	if err := s.Delete(ctx, "b"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	_ = s.Close()
+
+	reopened, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("reopening failed: %v", err)
+	}
+	defer reopened.Close()
+
+	if val, found, _ := reopened.Lookup(ctx, "a"); !found || val != "1" {
+		t.Errorf("expected 'a' to persist, got %q, %v", val, found)
+	}
+	if _, found, _ := reopened.Lookup(ctx, "b"); found {
+		t.Error("expected the deleted key not to persist")
+	}
+	if val, _ := reopened.Get(ctx, "session"); val != "x" {
+		t.Errorf("expected the TTL key to persist, got %q", val)
+	}
+	if err := reopened.SetIfVersion(ctx, "a", "2", version); err != nil {
+		t.Errorf("expected versions to persist, got %v", err)
+	}
+	if _, newVersion, _ := reopened.GetVersion(ctx, "a"); newVersion <= version {
+		t.Errorf("expected versions to keep increasing after reopening, got %d after %d", newVersion, version)
+	}
+
+	// Only the store and lock files remain; temporary files are renamed or removed.
+	files, _ := os.ReadDir(filepath.Dir(path))
+	if len(files) > 2 {
+		t.Errorf("expected only the store and lock files, got %d files", len(files))
+	}
+}
+
+func TestFileStoreErrors(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	if _, err := OpenFileStore(""); err == nil {
+		t.Error("expected an error for an empty path")
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.json")
+	_ = os.WriteFile(corrupt, []byte("{not json"), 0o600)
+	if _, err := OpenFileStore(corrupt); err == nil {
+		t.Error("expected an error for a corrupt file")
+	}
+
+	future := filepath.Join(dir, "future.json")
+	_ = os.WriteFile(future, []byte(`{"format": 99}`), 0o600)
+	if _, err := OpenFileStore(future); err == nil || !strings.Contains(err.Error(), "format") {
+		t.Errorf("expected an unsupported format error, got %v", err)
+	}
+
+	if _, err := OpenFileStore(filepath.Join(dir, "missing", "store.json")); err == nil {
+		t.Error("expected an error when the directory does not exist")
+	}
+
+	// A write that cannot be persisted is rolled back.
+	s, err := OpenFileStore(filepath.Join(dir, "store.json"))
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	defer s.Close()
+	s.mem.persist = func(map[string]memoryEntry, Version) error { return errors.New("disk full") }
+	if err := s.Set(ctx, "key", "value"); err == nil {
+		t.Fatal("expected Set to fail when the file cannot be written")
+	}
+	if _, found, _ := s.Lookup(ctx, "key"); found {
+		t.Error("expected the failed write to be rolled back")
+	}
+	if err := s.Update(ctx, "key", func(string) (string, error) { return "", errors.New("unused") }); err == nil {
+		t.Error("expected the update function error")
+	}
+}
+
+func TestFileStoreLock(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	s, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	if _, err := OpenFileStore(path); !errors.Is(err, ErrFileLocked) {
+		t.Fatalf("expected ErrFileLocked while the store is open, got %v", err)
+	}
+	if err := s.Set(ctx, "key", "value"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	reopened, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("expected the file to be unlocked after Close, got %v", err)
+	}
+	defer reopened.Close()
+	if val, _ := reopened.Get(ctx, "key"); val != "value" {
+		t.Errorf("expected value, got %q", val)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !unix
+
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// lockFile creates the lock file at path, failing if it already exists. The returned
+// function removes it again. A process that crashes leaves the file behind, and it must
+// then be removed by hand.
+func lockFile(path string) (func() error, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, fmt.Errorf("%w: %s", ErrFileLocked, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lock file %s: %w", path, err)
+	}
+	return func() error {
+		_ = f.Close()
+		return os.Remove(path)
+	}, nil
+}
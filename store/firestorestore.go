@@ -3,6 +3,8 @@ package store
 import (
 	"context"
 	"fmt"
+	"iter"
+	"time"
 
 	"github.com/duizendstra/dui-go/firestore"
 )
@@ -11,7 +13,21 @@ import (
 // It allows us to inject either a real FirestoreKV or a mock implementation for testing.
 type kvInterface interface {
 	Get(ctx context.Context, key string) (string, error)
+	Lookup(ctx context.Context, key string) (string, bool, error)
 	Set(ctx context.Context, key, value string) error
+	SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	Exists(ctx context.Context, key string) (bool, error)
+	GetMulti(ctx context.Context, keys []string) (map[string]string, error)
+	SetMulti(ctx context.Context, values map[string]string) error
+	List(ctx context.Context, opts ListOptions) (ListPage, error)
+	Scan(ctx context.Context, opts ListOptions) iter.Seq2[string, error]
+	GetVersion(ctx context.Context, key string) (string, Version, error)
+	SetIfVersion(ctx context.Context, key, value string, version Version) error
+	CompareAndSwap(ctx context.Context, key, old, newValue string) (bool, error)
+	Update(ctx context.Context, key string, fn UpdateFunc) error
+	Watch(ctx context.Context, key string) (<-chan Event, error)
+	WatchPrefix(ctx context.Context, prefix string) (<-chan Event, error)
 	Close() error
 }
 
@@ -22,7 +38,8 @@ type FirestoreStore struct {
 }
 
 // NewFirestoreStore creates a Store implementation backed by Firestore.
-// It uses firestore.NewKV to connect to a Firestore project and collection.
+// It uses firestore.NewKV to connect to a Firestore project and collection, passing on
+// any options such as firestore.WithDatabaseID.
 //
 // Example usage:
 //
@@ -39,8 +56,8 @@ type FirestoreStore struct {
 //
 //	val, err := s.Get(ctx, "foo")
 //	// ...
-func NewFirestoreStore(ctx context.Context, projectID, collection string) (Store, error) {
-	realKV, err := firestore.NewKV(ctx, projectID, collection)
+func NewFirestoreStore(ctx context.Context, projectID, collection string, opts ...firestore.Option) (Store, error) {
+	realKV, err := firestore.NewKV(ctx, projectID, collection, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create FirestoreKV for store: %w", err)
 	}
@@ -52,11 +69,100 @@ func (s *FirestoreStore) Get(ctx context.Context, key string) (string, error) {
 	return s.kv.Get(ctx, key)
 }
 
+// Lookup retrieves the value for a given key and reports whether the key exists. Use
+// it instead of Get when an empty value and a missing key must be told apart.
+func (s *FirestoreStore) Lookup(ctx context.Context, key string) (string, bool, error) {
+	return s.kv.Lookup(ctx, key)
+}
+
 // Set stores the value for a given key, overwriting any existing value.
 func (s *FirestoreStore) Set(ctx context.Context, key, value string) error {
 	return s.kv.Set(ctx, key, value)
 }
 
+// SetWithTTL stores the value for a given key with an expiry. Expired keys read as
+// missing; configure a Firestore TTL policy on the "expireAt" field to have them deleted.
+func (s *FirestoreStore) SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) error {
+	return s.kv.SetWithTTL(ctx, key, value, ttl)
+}
+
+// Delete removes the given key. Deleting a key that does not exist is not an error.
+func (s *FirestoreStore) Delete(ctx context.Context, key string) error {
+	return s.kv.Delete(ctx, key)
+}
+
+// Exists reports whether the given key is present in Firestore.
+func (s *FirestoreStore) Exists(ctx context.Context, key string) (bool, error) {
+	return s.kv.Exists(ctx, key)
+}
+
+// GetMulti retrieves the values for several keys in batches. Missing keys are omitted
+// from the returned map.
+func (s *FirestoreStore) GetMulti(ctx context.Context, keys []string) (map[string]string, error) {
+	return s.kv.GetMulti(ctx, keys)
+}
+
+// SetMulti stores several key-value pairs, overwriting existing values. The writes are
+// not atomic; on failure some pairs may have been stored.
+func (s *FirestoreStore) SetMulti(ctx context.Context, values map[string]string) error {
+	return s.kv.SetMulti(ctx, values)
+}
+
+// List returns one page of keys from the collection, ordered by document ID.
+func (s *FirestoreStore) List(ctx context.Context, opts ListOptions) (ListPage, error) {
+	return s.kv.List(ctx, opts)
+}
+
+// Scan iterates over all keys in the collection that match the options.
+func (s *FirestoreStore) Scan(ctx context.Context, opts ListOptions) iter.Seq2[string, error] {
+	return s.kv.Scan(ctx, opts)
+}
+
+// GetVersion retrieves the value for a key together with its version, which can be
+// passed to SetIfVersion for optimistic concurrency control.
+func (s *FirestoreStore) GetVersion(ctx context.Context, key string) (string, Version, error) {
+	return s.kv.GetVersion(ctx, key)
+}
+
+// Expiry returns the time the key expires, or the zero time if it has no expiry or
+// does not exist. It fails with errors.ErrUnsupported if the KV cannot report expiry.
+func (s *FirestoreStore) Expiry(ctx context.Context, key string) (time.Time, error) {
+	return expiryOf(ctx, s.kv, key)
+}
+
+// SetIfVersion stores the value only if the key is still at the given version. Use
+// NoVersion to require that the key does not exist yet. On mismatch the error wraps
+// ErrPreconditionFailed.
+func (s *FirestoreStore) SetIfVersion(ctx context.Context, key, value string, version Version) error {
+	return s.kv.SetIfVersion(ctx, key, value, version)
+}
+
+// CompareAndSwap sets the key to newValue only if its current value equals old and
+// reports whether the swap happened. Unlike Set, it never overwrites a concurrent write.
+func (s *FirestoreStore) CompareAndSwap(ctx context.Context, key, old, newValue string) (bool, error) {
+	return s.kv.CompareAndSwap(ctx, key, old, newValue)
+}
+
+// Update atomically replaces the value of the key with the result of fn inside a
+// Firestore transaction, retrying when concurrent writes conflict.
+func (s *FirestoreStore) Update(ctx context.Context, key string, fn UpdateFunc) error {
+	return s.kv.Update(ctx, key, fn)
+}
+
+// Watch reports changes to the key on the returned channel until ctx is done, starting
+// with its current value if it exists. This lets long-running services pick up new
+// configuration without restarting. The underlying snapshot listener reconnects on
+// failure.
+func (s *FirestoreStore) Watch(ctx context.Context, key string) (<-chan Event, error) {
+	return s.kv.Watch(ctx, key)
+}
+
+// WatchPrefix reports changes to all keys starting with prefix until ctx is done,
+// starting with the current values of the matching keys.
+func (s *FirestoreStore) WatchPrefix(ctx context.Context, prefix string) (<-chan Event, error) {
+	return s.kv.WatchPrefix(ctx, prefix)
+}
+
 // Close releases any resources associated with the Firestore store.
 func (s *FirestoreStore) Close() error {
 	return s.kv.Close()
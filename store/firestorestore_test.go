@@ -2,9 +2,14 @@ package store
 
 import (
 	"context"
+	"errors"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
+	apierrors "github.com/duizendstra/dui-go/errors"
+	"github.com/duizendstra/dui-go/firestore"
 	"github.com/duizendstra/dui-go/testutil"
 )
 
@@ -41,3 +46,207 @@ func TestFirestoreStoreWithMock(t *testing.T) {
 		t.Errorf("expected empty string for nonexistentKey, got %q", val)
 	}
 }
+
+// TestFirestoreStoreBulkAndDelete verifies the Delete, Exists, GetMulti and SetMulti
+// operations are passed through to the underlying KV.
+func TestFirestoreStoreBulkAndDelete(t *testing.T) {
+	ctx := context.Background()
+	store := &FirestoreStore{kv: testutil.NewMockFirestoreKV()}
+
+	if err := store.SetMulti(ctx, map[string]string{"a": "1", "b": "2"}); err != nil {
+		t.Fatalf("SetMulti failed: %v", err)
+	}
+
+	values, err := store.GetMulti(ctx, []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatalf("GetMulti failed: %v", err)
+	}
+	if len(values) != 2 || values["a"] != "1" || values["b"] != "2" {
+		t.Errorf("unexpected GetMulti result: %v", values)
+	}
+
+	if err := store.Delete(ctx, "a"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	exists, err := store.Exists(ctx, "a")
+	if err != nil {
+		t.Fatalf("Exists failed: %v", err)
+	}
+	if exists {
+		t.Error("expected 'a' to be deleted")
+	}
+	exists, err = store.Exists(ctx, "b")
+	if err != nil {
+		t.Fatalf("Exists failed: %v", err)
+	}
+	if !exists {
+		t.Error("expected 'b' to exist")
+	}
+}
+
+// TestFirestoreStoreListAndScan verifies key listing with prefix filtering and paging.
+func TestFirestoreStoreListAndScan(t *testing.T) {
+	ctx := context.Background()
+	store := &FirestoreStore{kv: testutil.NewMockFirestoreKV()}
+
+	if err := store.SetMulti(ctx, map[string]string{"tenant-a:1": "x", "tenant-a:2": "y", "tenant-b:1": "z"}); err != nil {
+		t.Fatalf("SetMulti failed: %v", err)
+	}
+
+	page, err := store.List(ctx, ListOptions{Prefix: "tenant-a:"})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(page.Keys) != 2 || page.NextPageToken != "" {
+		t.Errorf("unexpected page: %+v", page)
+	}
+
+	count := 0
+	for _, err := range store.Scan(ctx, ListOptions{PageSize: 1}) {
+		if err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		count++
+	}
+	if count != 3 {
+		t.Errorf("expected 3 keys, got %d", count)
+	}
+}
+
+// TestFirestoreStoreConcurrentUpdate verifies that concurrent Update calls do not lose
+// writes, unlike concurrent Get/Set pairs.
+func TestFirestoreStoreConcurrentUpdate(t *testing.T) {
+	ctx := context.Background()
+	store := &FirestoreStore{kv: testutil.NewMockFirestoreKV()}
+
+	const workers = 4
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each worker retries until its increment commits, since the mock may
+			// report conflicts when all attempts race with other workers.
+			for {
+				err := store.Update(ctx, "counter", func(old string) (string, error) {
+					n, _ := strconv.Atoi(old) // a missing key counts as zero
+					return strconv.Itoa(n + 1), nil
+				})
+				if !errors.Is(err, ErrConflict) {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+	}
+
+	val, err := store.Get(ctx, "counter")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if val != strconv.Itoa(workers) {
+		t.Errorf("expected counter %d, got %q", workers, val)
+	}
+
+	swapped, err := store.CompareAndSwap(ctx, "counter", "0", "reset")
+	if err != nil {
+		t.Fatalf("CompareAndSwap failed: %v", err)
+	}
+	if swapped {
+		t.Error("expected CompareAndSwap with a stale value to fail")
+	}
+}
+
+// TestFirestoreStoreTTL verifies that keys written with SetWithTTL read as missing
+// once they expire.
+func TestFirestoreStoreTTL(t *testing.T) {
+	ctx := context.Background()
+	mockKV := testutil.NewMockFirestoreKV()
+	now := time.Unix(10000, 0)
+	mockKV.SetClock(func() time.Time { return now })
+	store := &FirestoreStore{kv: mockKV}
+
+	if err := store.SetWithTTL(ctx, "idempotency-key", "done", 10*time.Second); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	if val, err := store.Get(ctx, "idempotency-key"); err != nil || val != "done" {
+		t.Fatalf("expected 'done', got %q (err %v)", val, err)
+	}
+
+	now = now.Add(10 * time.Second)
+	if val, err := store.Get(ctx, "idempotency-key"); err != nil || val != "" {
+		t.Errorf("expected expired key to read as empty, got %q (err %v)", val, err)
+	}
+}
+
+func TestFirestoreStoreWatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s := &FirestoreStore{kv: testutil.NewMockFirestoreKV()}
+
+	events, err := s.Watch(ctx, "feature-flag")
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	if err := s.Set(ctx, "feature-flag", "on"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if ev := <-events; ev.Type != EventSet || ev.Value != "on" {
+		t.Errorf("expected set of 'on', got %+v", ev)
+	}
+
+	prefixEvents, err := s.WatchPrefix(ctx, "feature-")
+	if err != nil {
+		t.Fatalf("WatchPrefix failed: %v", err)
+	}
+	if ev := <-prefixEvents; ev.Key != "feature-flag" {
+		t.Errorf("expected initial event for feature-flag, got %+v", ev)
+	}
+	if err := s.Delete(ctx, "feature-flag"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if ev := <-prefixEvents; ev.Type != EventDelete {
+		t.Errorf("expected delete event, got %+v", ev)
+	}
+}
+
+func TestFirestoreStoreConformance(t *testing.T) {
+	testutil.RunKVConformance(t, func(t *testing.T) firestore.KV {
+		return &FirestoreStore{kv: testutil.NewMockFirestoreKV()}
+	})
+}
+
+func TestFirestoreStoreLookup(t *testing.T) {
+	ctx := context.Background()
+	s := &FirestoreStore{kv: testutil.NewMockFirestoreKV()}
+
+	if err := s.Set(ctx, "flag", ""); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if val, found, err := s.Lookup(ctx, "flag"); err != nil || !found || val != "" {
+		t.Errorf("expected the empty flag to be found, got %q, %v, %v", val, found, err)
+	}
+	if _, found, err := s.Lookup(ctx, "missing"); err != nil || found {
+		t.Errorf("expected a missing key not to be found, got %v, %v", found, err)
+	}
+
+	if val, err := GetExisting(ctx, s, "flag"); err != nil || val != "" {
+		t.Errorf("expected GetExisting to return the empty value, got %q, %v", val, err)
+	}
+	_, err := GetExisting(ctx, s, "missing")
+	if !errors.Is(err, ErrNotFound) || !errors.Is(err, apierrors.ErrNotFound) {
+		t.Errorf("expected an error wrapping ErrNotFound, got %v", err)
+	}
+	// Get keeps its legacy behaviour.
+	if val, err := s.Get(ctx, "missing"); err != nil || val != "" {
+		t.Errorf("expected Get to return an empty value without error, got %q, %v", val, err)
+	}
+}
@@ -0,0 +1,152 @@
+package store
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"sync"
+)
+
+// KeyWrapper wraps and unwraps data keys with key-encryption keys (KEKs) identified by
+// key IDs. Keyring implements it with local keys; an adapter around Cloud KMS would
+// implement it with KMS Encrypt and Decrypt calls, using crypto key version names as
+// key IDs.
+type KeyWrapper interface {
+	// CurrentKeyID returns the ID of the KEK that new data keys are wrapped with.
+	CurrentKeyID(ctx context.Context) (string, error)
+	// WrapKey encrypts dataKey with the KEK identified by keyID.
+	WrapKey(ctx context.Context, keyID string, dataKey []byte) ([]byte, error)
+	// UnwrapKey decrypts a data key that WrapKey wrapped with the KEK identified by keyID.
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Compile-time check that Keyring implements KeyWrapper.
+var _ KeyWrapper = (*Keyring)(nil)
+
+// Keyring is a KeyWrapper backed by AES keys held in memory. One key is the primary key
+// used for new values; the others are kept to unwrap data keys written before a
+// rotation. It is safe for concurrent use.
+type Keyring struct {
+	mu      sync.RWMutex
+	keys    map[string]cipher.AEAD
+	primary string
+}
+
+// NewKeyring creates a Keyring whose primary key has the given ID. The key must be 16,
+// 24 or 32 bytes long, selecting AES-128, AES-192 or AES-256.
+func NewKeyring(primaryID string, primaryKey []byte) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]cipher.AEAD)}
+	if err := k.AddKey(primaryID, primaryKey, true); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// AddKey adds a key to the keyring. If primary is true, the key becomes the primary key,
+// which rotates the KEK for values written from now on. Adding a key with an existing
+// ID returns an error.
+func (k *Keyring) AddKey(id string, key []byte, primary bool) error {
+	if id == "" {
+		return fmt.Errorf("key ID cannot be empty")
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return fmt.Errorf("invalid key %q: %w", id, err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.keys[id]; ok {
+		return fmt.Errorf("key %q already exists", id)
+	}
+	k.keys[id] = aead
+	if primary {
+		k.primary = id
+	}
+	return nil
+}
+
+// SetPrimary makes the key with the given ID the primary key.
+func (k *Keyring) SetPrimary(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.keys[id]; !ok {
+		return fmt.Errorf("unknown key %q", id)
+	}
+	k.primary = id
+	return nil
+}
+
+// CurrentKeyID returns the ID of the primary key.
+func (k *Keyring) CurrentKeyID(ctx context.Context) (string, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.primary, nil
+}
+
+// WrapKey encrypts dataKey with AES-GCM under the key identified by keyID.
+func (k *Keyring) WrapKey(ctx context.Context, keyID string, dataKey []byte) ([]byte, error) {
+	aead, err := k.key(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return seal(aead, dataKey, []byte(keyID))
+}
+
+// UnwrapKey decrypts a data key wrapped by WrapKey.
+func (k *Keyring) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, err := k.key(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return unseal(aead, wrapped, []byte(keyID))
+}
+
+// key returns the cipher for the given key ID.
+func (k *Keyring) key(id string) (cipher.AEAD, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	aead, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+	return aead, nil
+}
+
+// GenerateKey returns a new random 256-bit AES key, for use with NewKeyring or AddKey.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return key, nil
+}
+
+// newGCM returns an AES-GCM cipher for the key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with a random nonce and returns nonce||ciphertext.
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// unseal decrypts nonce||ciphertext as produced by seal.
+func unseal(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
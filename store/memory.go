@@ -0,0 +1,376 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/duizendstra/dui-go/firestore"
+)
+
+// Compile-time check that MemoryStore implements Store.
+var _ Store = (*MemoryStore)(nil)
+
+// ErrClosed is returned by operations on a MemoryStore or FileStore after Close.
+var ErrClosed = errors.New("store is closed")
+
+// MemoryStore is a Store that keeps all keys in process memory. It is safe for
+// concurrent use and supports every Store operation, including versions, expiry and
+// change streams, which makes it suitable for local development and unit tests.
+// Data is lost when the process exits; use OpenFileStore for a persistent store.
+type MemoryStore struct {
+	mu          sync.Mutex
+	entries     map[string]memoryEntry
+	lastVersion Version
+	watchers    map[*firestore.EventQueue]func(key string) bool
+	closed      bool
+	// now returns the current time and decides expiry. In tests, it can be replaced
+	// for stable results.
+	now func() time.Time
+	// persist, if set, is called with the new state after every write, while the
+	// lock is held. If it fails, the write is rolled back.
+	persist func(entries map[string]memoryEntry, lastVersion Version) error
+	// release, if set, is called once by Close, for example to unlock the store file.
+	release func() error
+}
+
+// memoryEntry is a stored value with its version and optional expiry.
+type memoryEntry struct {
+	Value    string    `json:"value"`
+	Version  Version   `json:"version"`
+	ExpireAt time.Time `json:"expireAt,omitzero"`
+}
+
+// live reports whether the entry has not expired at the given time.
+func (e memoryEntry) live(now time.Time) bool {
+	return e.ExpireAt.IsZero() || now.Before(e.ExpireAt)
+}
+
+// NewMemoryStore creates an empty in-memory Store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries:  make(map[string]memoryEntry),
+		watchers: make(map[*firestore.EventQueue]func(key string) bool),
+		now:      time.Now,
+	}
+}
+
+// Get retrieves the value for a given key. Returns an empty string if not found.
+func (m *MemoryStore) Get(ctx context.Context, key string) (string, error) {
+	value, _, err := m.Lookup(ctx, key)
+	return value, err
+}
+
+// Lookup retrieves the value for a given key and reports whether the key exists.
+func (m *MemoryStore) Lookup(ctx context.Context, key string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return "", false, ErrClosed
+	}
+	e, ok := m.lookup(key)
+	return e.Value, ok, nil
+}
+
+// Set stores the value for a given key, overwriting any existing value and expiry.
+func (m *MemoryStore) Set(ctx context.Context, key, value string) error {
+	return m.write(map[string]*string{key: &value}, time.Time{})
+}
+
+// SetWithTTL stores the value for a given key; it reads as missing once ttl has elapsed.
+func (m *MemoryStore) SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("ttl must be positive (key=%s, ttl=%s)", key, ttl)
+	}
+	return m.write(map[string]*string{key: &value}, m.now().Add(ttl))
+}
+
+// Delete removes the key. Deleting a key that does not exist is not an error.
+func (m *MemoryStore) Delete(ctx context.Context, key string) error {
+	return m.write(map[string]*string{key: nil}, time.Time{})
+}
+
+// Exists reports whether the key is present and has not expired.
+func (m *MemoryStore) Exists(ctx context.Context, key string) (bool, error) {
+	_, ok, err := m.Lookup(ctx, key)
+	return ok, err
+}
+
+// GetMulti retrieves several keys at once. Missing keys are omitted from the result.
+func (m *MemoryStore) GetMulti(ctx context.Context, keys []string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+	result := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if e, ok := m.lookup(key); ok {
+			result[key] = e.Value
+		}
+	}
+	return result, nil
+}
+
+// SetMulti stores several key-value pairs at once. Unlike FirestoreStore, the writes
+// are applied atomically.
+func (m *MemoryStore) SetMulti(ctx context.Context, values map[string]string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	changes := make(map[string]*string, len(values))
+	for key, value := range values {
+		changes[key] = &value
+	}
+	return m.write(changes, time.Time{})
+}
+
+// List returns one page of keys, ordered by key, that match the options.
+func (m *MemoryStore) List(ctx context.Context, opts ListOptions) (ListPage, error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return ListPage{}, ErrClosed
+	}
+	now := m.now()
+	keys := make([]string, 0, len(m.entries))
+	for key, e := range m.entries {
+		if e.live(now) {
+			keys = append(keys, key)
+		}
+	}
+	m.mu.Unlock()
+	return firestore.PaginateKeys(keys, opts)
+}
+
+// Scan iterates over all keys matching the options in ascending order.
+func (m *MemoryStore) Scan(ctx context.Context, opts ListOptions) iter.Seq2[string, error] {
+	return firestore.ScanPages(ctx, m.List, opts)
+}
+
+// GetVersion retrieves the value together with its version (NoVersion if missing).
+func (m *MemoryStore) GetVersion(ctx context.Context, key string) (string, Version, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return "", NoVersion, ErrClosed
+	}
+	e, ok := m.lookup(key)
+	if !ok {
+		return "", NoVersion, nil
+	}
+	return e.Value, e.Version, nil
+}
+
+// Expiry returns the time the key expires, or the zero time if it has no expiry or
+// does not exist.
+func (m *MemoryStore) Expiry(ctx context.Context, key string) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return time.Time{}, ErrClosed
+	}
+	e, _ := m.lookup(key)
+	return e.ExpireAt, nil
+}
+
+// SetIfVersion stores the value only if the key is still at the given version. With
+// NoVersion the key must not exist. A mismatch returns an error wrapping
+// ErrPreconditionFailed.
+func (m *MemoryStore) SetIfVersion(ctx context.Context, key, value string, version Version) error {
+	err := m.writeIf(key, version, value)
+	if errors.Is(err, errVersionMismatch) {
+		return fmt.Errorf("conditional set (key=%s, version=%d): %w", key, version, ErrPreconditionFailed)
+	}
+	return err
+}
+
+// CompareAndSwap sets the key to newValue only if its current value equals old, and
+// reports whether the swap happened. A missing key has the value "".
+func (m *MemoryStore) CompareAndSwap(ctx context.Context, key, old, newValue string) (bool, error) {
+	return firestore.CompareAndSwapWith(ctx, m.Update, key, old, newValue)
+}
+
+// Update atomically replaces the value of the key with the result of fn. fn runs
+// without holding the store's lock, so it may use the store; if the key changes in the
+// meantime, fn is called again, up to MaxUpdateAttempts times before failing with an
+// error wrapping ErrConflict. An error returned by fn is returned as is.
+func (m *MemoryStore) Update(ctx context.Context, key string, fn UpdateFunc) error {
+	for attempt := 0; attempt < firestore.MaxUpdateAttempts; attempt++ {
+		old, version, err := m.GetVersion(ctx, key)
+		if err != nil {
+			return err
+		}
+		value, err := fn(old)
+		if err != nil {
+			return err
+		}
+		err = m.writeIf(key, version, value)
+		if !errors.Is(err, errVersionMismatch) {
+			return err
+		}
+	}
+	return fmt.Errorf("update (key=%s): %w", key, ErrConflict)
+}
+
+// Watch reports changes to the key on the returned channel until ctx is done or the
+// store is closed. If the key exists, its current value is delivered first.
+func (m *MemoryStore) Watch(ctx context.Context, key string) (<-chan Event, error) {
+	if key == "" {
+		return nil, fmt.Errorf("watch key cannot be empty")
+	}
+	return m.watch(ctx, func(k string) bool { return k == key })
+}
+
+// WatchPrefix reports changes to all keys starting with prefix until ctx is done or the
+// store is closed. The current values of matching keys are delivered first, in key order.
+func (m *MemoryStore) WatchPrefix(ctx context.Context, prefix string) (<-chan Event, error) {
+	return m.watch(ctx, func(k string) bool { return strings.HasPrefix(k, prefix) })
+}
+
+// Close releases the store's data and ends all watches; a file store also releases
+// its file lock. Further operations return ErrClosed. Closing an already closed store
+// is not an error.
+func (m *MemoryStore) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	m.entries = nil
+	for q := range m.watchers {
+		q.Stop()
+	}
+	m.watchers = nil
+	if m.release != nil {
+		return m.release()
+	}
+	return nil
+}
+
+// errVersionMismatch reports a failed version check inside writeIf.
+var errVersionMismatch = errors.New("version mismatch")
+
+// lookup returns the entry of a key that exists and has not expired. The caller must
+// hold m.mu.
+func (m *MemoryStore) lookup(key string) (memoryEntry, bool) {
+	e, ok := m.entries[key]
+	if !ok || !e.live(m.now()) {
+		return memoryEntry{}, false
+	}
+	return e, true
+}
+
+// writeIf stores the value if the key is at the given version, and returns
+// errVersionMismatch otherwise.
+func (m *MemoryStore) writeIf(key string, version Version, value string) error {
+	return m.apply(map[string]*string{key: &value}, time.Time{}, func() error {
+		current := NoVersion
+		if e, ok := m.lookup(key); ok {
+			current = e.Version
+		}
+		if current != version {
+			return errVersionMismatch
+		}
+		return nil
+	})
+}
+
+// write applies the changes unconditionally. See apply.
+func (m *MemoryStore) write(changes map[string]*string, expireAt time.Time) error {
+	return m.apply(changes, expireAt, nil)
+}
+
+// apply stores the changes, where a nil value deletes the key, after check (if set)
+// succeeds. Written keys get a new version and the given expiry (zero for none). If
+// persisting the new state fails, the changes are rolled back. Watchers are notified
+// of changes to keys that exist or existed.
+func (m *MemoryStore) apply(changes map[string]*string, expireAt time.Time, check func() error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	if check != nil {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+
+	previous := make(map[string]memoryEntry, len(changes))
+	existed := make(map[string]bool, len(changes))
+	prevVersion := m.lastVersion
+	var events []Event
+	for _, key := range slices.Sorted(maps.Keys(changes)) {
+		previous[key], existed[key] = m.entries[key]
+		value := changes[key]
+		if value == nil {
+			if _, live := m.lookup(key); live {
+				events = append(events, Event{Type: EventDelete, Key: key})
+			}
+			delete(m.entries, key)
+			continue
+		}
+		m.lastVersion++
+		m.entries[key] = memoryEntry{Value: *value, Version: m.lastVersion, ExpireAt: expireAt}
+		events = append(events, Event{Type: EventSet, Key: key, Value: *value, Version: m.lastVersion})
+	}
+
+	if m.persist != nil {
+		if err := m.persist(m.entries, m.lastVersion); err != nil {
+			for key, e := range previous {
+				if existed[key] {
+					m.entries[key] = e
+				} else {
+					delete(m.entries, key)
+				}
+			}
+			m.lastVersion = prevVersion
+			return err
+		}
+	}
+
+	for _, ev := range events {
+		for q, match := range m.watchers {
+			if match(ev.Key) {
+				q.Push(ev)
+			}
+		}
+	}
+	return nil
+}
+
+// watch registers a watcher for the keys accepted by match and queues the current
+// state of those keys.
+func (m *MemoryStore) watch(ctx context.Context, match func(key string) bool) (<-chan Event, error) {
+	q := firestore.NewEventQueue()
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, ErrClosed
+	}
+	now := m.now()
+	for _, key := range slices.Sorted(maps.Keys(m.entries)) {
+		if e := m.entries[key]; e.live(now) && match(key) {
+			q.Push(Event{Type: EventSet, Key: key, Value: e.Value, Version: e.Version, Initial: true})
+		}
+	}
+	m.watchers[q] = match
+	m.mu.Unlock()
+
+	go func() {
+		q.Run(ctx)
+		m.mu.Lock()
+		delete(m.watchers, q)
+		m.mu.Unlock()
+	}()
+	return q.Events(), nil
+}
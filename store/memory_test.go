@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/duizendstra/dui-go/firestore"
+	"github.com/duizendstra/dui-go/testutil"
+)
+
+func TestMemoryStoreConformance(t *testing.T) {
+	testutil.RunKVConformance(t, func(t *testing.T) firestore.KV {
+		s := NewMemoryStore()
+		t.Cleanup(func() { _ = s.Close() })
+		return s
+	})
+}
+
+func TestMemoryStoreTTL(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+
+	if err := s.SetWithTTL(ctx, "session", "abc", time.Minute); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	if val, _ := s.Get(ctx, "session"); val != "abc" {
+		t.Errorf("expected 'abc' before expiry, got %q", val)
+	}
+
+	now = now.Add(time.Minute)
+	if _, found, _ := s.Lookup(ctx, "session"); found {
+		t.Error("expected the key to have expired")
+	}
+	if err := s.SetIfVersion(ctx, "session", "new", NoVersion); err != nil {
+		t.Errorf("expected an expired key to count as missing, got %v", err)
+	}
+}
+
+func TestMemoryStoreClose(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	events, err := s.WatchPrefix(ctx, "")
+	if err != nil {
+		t.Fatalf("WatchPrefix failed: %v", err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("expected a second Close to succeed, got %v", err)
+	}
+	if _, ok := <-events; ok {
+		t.Error("expected Close to end the watch")
+	}
+	if err := s.Set(ctx, "key", "value"); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed from Set, got %v", err)
+	}
+	if _, err := s.Get(ctx, "key"); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed from Get, got %v", err)
+	}
+}
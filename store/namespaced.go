@@ -0,0 +1,193 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"strings"
+	"time"
+
+	"github.com/duizendstra/dui-go/firestore"
+)
+
+// Compile-time check that NamespacedStore implements Store.
+var _ Store = (*NamespacedStore)(nil)
+
+// NamespaceSeparator separates the namespace from the key in the keys NamespacedStore
+// writes to the underlying Store.
+const NamespaceSeparator = ":"
+
+// NamespacedStore is a Store decorator that confines all keys to a namespace by
+// prefixing them with the namespace and NamespaceSeparator, so several tenants or
+// components can share one underlying Store without seeing each other's keys. Keys in
+// results, such as those from List, Scan, GetMulti and Watch events, are returned
+// without the prefix.
+//
+// Namespaces can be nested by wrapping a NamespacedStore. For FirestoreKV, which can
+// also keep each namespace in its own subcollection, see firestore.FirestoreKV.Namespace.
+type NamespacedStore struct {
+	inner  Store
+	prefix string
+}
+
+// NewNamespacedStore returns a Store that keeps its keys in the given namespace of
+// inner. The namespace must be non-empty and must not contain NamespaceSeparator.
+func NewNamespacedStore(inner Store, namespace string) (*NamespacedStore, error) {
+	if inner == nil {
+		return nil, fmt.Errorf("inner store is required")
+	}
+	if namespace == "" {
+		return nil, fmt.Errorf("namespace cannot be empty")
+	}
+	if strings.Contains(namespace, NamespaceSeparator) {
+		return nil, fmt.Errorf("namespace %q must not contain %q", namespace, NamespaceSeparator)
+	}
+	return &NamespacedStore{inner: inner, prefix: namespace + NamespaceSeparator}, nil
+}
+
+// Namespace returns the namespace of the store.
+func (n *NamespacedStore) Namespace() string {
+	return strings.TrimSuffix(n.prefix, NamespaceSeparator)
+}
+
+// Get retrieves the value for a given key in the namespace. Returns an empty string if not found.
+func (n *NamespacedStore) Get(ctx context.Context, key string) (string, error) {
+	return n.inner.Get(ctx, n.prefix+key)
+}
+
+// Lookup retrieves the value for a given key and reports whether the key exists.
+func (n *NamespacedStore) Lookup(ctx context.Context, key string) (string, bool, error) {
+	return n.inner.Lookup(ctx, n.prefix+key)
+}
+
+// Set stores the value for a given key in the namespace.
+func (n *NamespacedStore) Set(ctx context.Context, key, value string) error {
+	return n.inner.Set(ctx, n.prefix+key, value)
+}
+
+// SetWithTTL stores the value for a given key in the namespace with an expiry.
+func (n *NamespacedStore) SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) error {
+	return n.inner.SetWithTTL(ctx, n.prefix+key, value, ttl)
+}
+
+// Delete removes the key from the namespace.
+func (n *NamespacedStore) Delete(ctx context.Context, key string) error {
+	return n.inner.Delete(ctx, n.prefix+key)
+}
+
+// Exists reports whether the key is present in the namespace.
+func (n *NamespacedStore) Exists(ctx context.Context, key string) (bool, error) {
+	return n.inner.Exists(ctx, n.prefix+key)
+}
+
+// GetMulti retrieves several keys of the namespace at once. Missing keys are omitted.
+func (n *NamespacedStore) GetMulti(ctx context.Context, keys []string) (map[string]string, error) {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = n.prefix + key
+	}
+	values, err := n.inner.GetMulti(ctx, prefixed)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string, len(values))
+	for key, value := range values {
+		result[strings.TrimPrefix(key, n.prefix)] = value
+	}
+	return result, nil
+}
+
+// SetMulti stores several key-value pairs in the namespace at once.
+func (n *NamespacedStore) SetMulti(ctx context.Context, values map[string]string) error {
+	prefixed := make(map[string]string, len(values))
+	for key, value := range values {
+		prefixed[n.prefix+key] = value
+	}
+	return n.inner.SetMulti(ctx, prefixed)
+}
+
+// List returns one page of keys of the namespace. Page tokens come from the underlying
+// Store and are only valid for this namespace.
+func (n *NamespacedStore) List(ctx context.Context, opts ListOptions) (ListPage, error) {
+	opts.Prefix = n.prefix + opts.Prefix
+	page, err := n.inner.List(ctx, opts)
+	if err != nil {
+		return ListPage{}, err
+	}
+	for i, key := range page.Keys {
+		page.Keys[i] = strings.TrimPrefix(key, n.prefix)
+	}
+	return page, nil
+}
+
+// Scan iterates over all keys of the namespace matching the options.
+func (n *NamespacedStore) Scan(ctx context.Context, opts ListOptions) iter.Seq2[string, error] {
+	return firestore.ScanPages(ctx, n.List, opts)
+}
+
+// GetVersion retrieves the value together with its version.
+func (n *NamespacedStore) GetVersion(ctx context.Context, key string) (string, Version, error) {
+	return n.inner.GetVersion(ctx, n.prefix+key)
+}
+
+// Expiry returns the time the key expires, if the underlying store can report it.
+func (n *NamespacedStore) Expiry(ctx context.Context, key string) (time.Time, error) {
+	return expiryOf(ctx, n.inner, n.prefix+key)
+}
+
+// SetIfVersion stores the value only if the key is still at the given version.
+func (n *NamespacedStore) SetIfVersion(ctx context.Context, key, value string, version Version) error {
+	return n.inner.SetIfVersion(ctx, n.prefix+key, value, version)
+}
+
+// CompareAndSwap sets the key to newValue only if its current value equals old.
+func (n *NamespacedStore) CompareAndSwap(ctx context.Context, key, old, newValue string) (bool, error) {
+	return n.inner.CompareAndSwap(ctx, n.prefix+key, old, newValue)
+}
+
+// Update atomically replaces the value with the result of fn.
+func (n *NamespacedStore) Update(ctx context.Context, key string, fn UpdateFunc) error {
+	return n.inner.Update(ctx, n.prefix+key, fn)
+}
+
+// Watch reports changes to the key in the namespace.
+func (n *NamespacedStore) Watch(ctx context.Context, key string) (<-chan Event, error) {
+	events, err := n.inner.Watch(ctx, n.prefix+key)
+	if err != nil {
+		return nil, err
+	}
+	return n.stripEvents(ctx, events), nil
+}
+
+// WatchPrefix reports changes to all keys of the namespace starting with prefix. An
+// empty prefix watches the whole namespace.
+func (n *NamespacedStore) WatchPrefix(ctx context.Context, prefix string) (<-chan Event, error) {
+	events, err := n.inner.WatchPrefix(ctx, n.prefix+prefix)
+	if err != nil {
+		return nil, err
+	}
+	return n.stripEvents(ctx, events), nil
+}
+
+// Close closes the underlying store, which ends its use by every namespace sharing it.
+func (n *NamespacedStore) Close() error {
+	return n.inner.Close()
+}
+
+// stripEvents forwards events from in with the namespace removed from their keys
+// until in is closed.
+func (n *NamespacedStore) stripEvents(ctx context.Context, in <-chan Event) <-chan Event {
+	out := make(chan Event)
+	go func() {
+		defer close(out)
+		for ev := range in {
+			ev.Key = strings.TrimPrefix(ev.Key, n.prefix)
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/duizendstra/dui-go/firestore"
+	"github.com/duizendstra/dui-go/testutil"
+)
+
+func TestNamespacedStoreConformance(t *testing.T) {
+	testutil.RunKVConformance(t, func(t *testing.T) firestore.KV {
+		s, err := NewNamespacedStore(NewMemoryStore(), "tenant")
+		if err != nil {
+			t.Fatalf("NewNamespacedStore failed: %v", err)
+		}
+		t.Cleanup(func() { _ = s.Close() })
+		return s
+	})
+}
+
+func TestNamespacedStore(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	inner := NewMemoryStore()
+	a, err := NewNamespacedStore(inner, "a")
+	if err != nil {
+		t.Fatalf("NewNamespacedStore failed: %v", err)
+	}
+	b, _ := NewNamespacedStore(inner, "b")
+
+	_ = inner.Set(ctx, "key", "root")
+	_ = a.SetMulti(ctx, map[string]string{"key": "a", "k2": "a2"})
+	_ = b.Set(ctx, "key", "b")
+
+	t.Run("Keys are prefixed in the inner store", func(t *testing.T) {
+		if val, _ := inner.Get(ctx, "a:key"); val != "a" {
+			t.Errorf("expected a:key to hold %q, got %q", "a", val)
+		}
+	})
+
+	t.Run("Namespaces are isolated", func(t *testing.T) {
+		for s, want := range map[Store]string{inner: "root", a: "a", b: "b"} {
+			if val, _ := s.Get(ctx, "key"); val != want {
+				t.Errorf("expected %q, got %q", want, val)
+			}
+		}
+		if ok, _ := b.Exists(ctx, "k2"); ok {
+			t.Error("expected k2 not to exist in namespace b")
+		}
+	})
+
+	t.Run("Results are unprefixed", func(t *testing.T) {
+		page, err := a.List(ctx, ListOptions{})
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		if want := []string{"k2", "key"}; !slices.Equal(page.Keys, want) {
+			t.Errorf("expected keys %q, got %q", want, page.Keys)
+		}
+		values, _ := a.GetMulti(ctx, []string{"key", "k2", "missing"})
+		if len(values) != 2 || values["key"] != "a" || values["k2"] != "a2" {
+			t.Errorf("unexpected GetMulti result %v", values)
+		}
+	})
+
+	t.Run("Watch events are unprefixed", func(t *testing.T) {
+		events, err := a.WatchPrefix(ctx, "")
+		if err != nil {
+			t.Fatalf("WatchPrefix failed: %v", err)
+		}
+		_ = b.Set(ctx, "other", "b")
+		_ = a.Set(ctx, "new", "a")
+		for ev := range events {
+			if ev.Key == "other" {
+				t.Fatal("received an event from another namespace")
+			}
+			if ev.Key == "new" {
+				break
+			}
+		}
+	})
+
+	t.Run("Invalid namespaces", func(t *testing.T) {
+		for _, ns := range []string{"", "a:b"} {
+			if _, err := NewNamespacedStore(inner, ns); err == nil {
+				t.Errorf("expected an error for namespace %q", ns)
+			}
+		}
+	})
+}
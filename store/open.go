@@ -0,0 +1,86 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/duizendstra/dui-go/firestore"
+)
+
+// Open creates a Store from a URL, which lets the backend be chosen by configuration:
+//
+//   - "firestore://project/collection" uses Firestore like NewFirestoreStore. The
+//     optional "database" query parameter selects a named database, as in
+//     "firestore://project/collection?database=mydb".
+//   - "file:///path/to/store.json" uses the single-file store of OpenFileStore.
+//   - "mem://" uses a new, empty MemoryStore.
+//
+// The optional "namespace" query parameter confines the store to a namespace. For
+// Firestore, the namespace gets its own subcollection (see
+// firestore.FirestoreKV.Namespace); other backends are wrapped in a NamespacedStore.
+// For Firestore, "escape=true" enables firestore.WithKeyEscaping.
+func Open(ctx context.Context, rawURL string) (Store, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid store URL %q: %w", rawURL, err)
+	}
+
+	namespace := u.Query().Get("namespace")
+	var s Store
+	switch u.Scheme {
+	case "firestore":
+		collection := strings.Trim(u.Path, "/")
+		if u.Host == "" || collection == "" || strings.Contains(collection, "/") {
+			return nil, fmt.Errorf("invalid store URL %q: expected firestore://project/collection", rawURL)
+		}
+		var opts []firestore.Option
+		if db := u.Query().Get("database"); db != "" {
+			opts = append(opts, firestore.WithDatabaseID(db))
+		}
+		if u.Query().Get("escape") == "true" {
+			opts = append(opts, firestore.WithKeyEscaping())
+		}
+		kv, err := firestore.NewKV(ctx, u.Host, collection, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create FirestoreKV for store: %w", err)
+		}
+		if namespace != "" {
+			nsKV, err := kv.Namespace(namespace)
+			if err != nil {
+				_ = kv.Close()
+				return nil, fmt.Errorf("invalid store URL %q: %w", rawURL, err)
+			}
+			kv = nsKV
+		}
+		return &FirestoreStore{kv: kv}, nil
+	case "file":
+		if u.Host != "" && u.Host != "localhost" {
+			return nil, fmt.Errorf("invalid store URL %q: file URLs must not name a remote host", rawURL)
+		}
+		if u.Path == "" {
+			return nil, fmt.Errorf("invalid store URL %q: missing file path", rawURL)
+		}
+		fs, err := OpenFileStore(filepath.FromSlash(u.Path))
+		if err != nil {
+			return nil, err
+		}
+		s = fs
+	case "mem":
+		s = NewMemoryStore()
+	default:
+		return nil, fmt.Errorf("unsupported store URL scheme %q in %q", u.Scheme, rawURL)
+	}
+
+	if namespace == "" {
+		return s, nil
+	}
+	ns, err := NewNamespacedStore(s, namespace)
+	if err != nil {
+		_ = s.Close()
+		return nil, fmt.Errorf("invalid store URL %q: %w", rawURL, err)
+	}
+	return ns, nil
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/duizendstra/dui-go/firestore"
+)
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Memory", func(t *testing.T) {
+		s, err := Open(ctx, "mem://")
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer s.Close()
+		if _, ok := s.(*MemoryStore); !ok {
+			t.Errorf("expected a MemoryStore, got %T", s)
+		}
+	})
+
+	t.Run("File", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "store.json")
+		s, err := Open(ctx, "file://"+filepath.ToSlash(path))
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		if _, ok := s.(*FileStore); !ok {
+			t.Errorf("expected a FileStore, got %T", s)
+		}
+		if err := s.Set(ctx, "key", "value"); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+		_ = s.Close()
+
+		reopened, err := OpenFileStore(path)
+		if err != nil {
+			t.Fatalf("OpenFileStore failed: %v", err)
+		}
+		defer reopened.Close()
+		if val, _ := reopened.Get(ctx, "key"); val != "value" {
+			t.Errorf("expected the file URL to use %s, got %q", path, val)
+		}
+	})
+
+	t.Run("Namespace", func(t *testing.T) {
+		s, err := Open(ctx, "mem://?namespace=tenant")
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer s.Close()
+		if ns, ok := s.(*NamespacedStore); !ok || ns.Namespace() != "tenant" {
+			t.Errorf("expected a NamespacedStore for tenant, got %T", s)
+		}
+	})
+
+	t.Run("Firestore namespace", func(t *testing.T) {
+		// Dialing the emulator is lazy, so no emulator needs to run.
+		t.Setenv(firestore.EmulatorHostEnv, "127.0.0.1:1")
+		s, err := Open(ctx, "firestore://demo-project/settings?namespace=tenant&escape=true")
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer s.Close()
+		if _, ok := s.(*FirestoreStore); !ok {
+			t.Errorf("expected a FirestoreStore using a subcollection, got %T", s)
+		}
+		if _, err := Open(ctx, "firestore://demo-project/settings?namespace=a/b"); !errors.Is(err, firestore.ErrInvalidKey) {
+			t.Errorf("expected ErrInvalidKey for an invalid namespace, got %v", err)
+		}
+	})
+
+	t.Run("Invalid URLs", func(t *testing.T) {
+		for _, rawURL := range []string{
+			"redis://localhost",
+			"firestore://project",
+			"firestore://project/a/b",
+			"file://remote-host/path",
+			"file://",
+			"mem://?namespace=a:b",
+			"::not a url",
+		} {
+			if _, err := Open(ctx, rawURL); err == nil {
+				t.Errorf("expected an error for %q", rawURL)
+			}
+		}
+	})
+}
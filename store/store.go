@@ -1,15 +1,93 @@
 // store/store.go
 package store
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"time"
+
+	"github.com/duizendstra/dui-go/firestore"
+)
+
+// ListOptions configures List and Scan calls: key prefix, page size and page token.
+type ListOptions = firestore.ListOptions
+
+// ListPage is a single page of keys returned by List.
+type ListPage = firestore.ListPage
+
+// Version identifies a stored revision of a key, for use with SetIfVersion.
+type Version = firestore.Version
+
+// NoVersion is the version of a key that does not exist.
+const NoVersion = firestore.NoVersion
+
+// UpdateFunc computes a new value from the current one for Update. It may be called
+// more than once when the update is retried.
+type UpdateFunc = firestore.UpdateFunc
+
+// Event reports a change to a watched key.
+type Event = firestore.Event
+
+// EventType describes what happened to a watched key: EventSet or EventDelete.
+type EventType = firestore.EventType
+
+const (
+	// EventSet means the key was created or its value was written.
+	EventSet = firestore.EventSet
+	// EventDelete means the key was deleted.
+	EventDelete = firestore.EventDelete
+)
+
+var (
+	// ErrNotFound is wrapped by errors from GetExisting when the key does not exist.
+	ErrNotFound = firestore.ErrNotFound
+	// ErrPreconditionFailed is wrapped by errors from SetIfVersion when the version
+	// no longer matches.
+	ErrPreconditionFailed = firestore.ErrPreconditionFailed
+	// ErrConflict is wrapped by errors from Update and CompareAndSwap when concurrent
+	// writes prevented the update from committing.
+	ErrConflict = firestore.ErrConflict
+)
 
 // KV defines simple key-value operations.
 // It's defined here in the consumer package (store) rather than in the producer package (firestore).
 type KV interface {
 	// Get retrieves the value for a given key. If not found, returns an empty string with no error.
 	Get(ctx context.Context, key string) (string, error)
+	// Lookup retrieves the value for a given key and reports whether the key exists,
+	// distinguishing a missing key from one set to an empty string.
+	Lookup(ctx context.Context, key string) (string, bool, error)
 	// Set stores the value under the given key, overwriting existing values.
 	Set(ctx context.Context, key, value string) error
+	// SetWithTTL stores the value under the given key; it is treated as missing once
+	// ttl has elapsed.
+	SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) error
+	// Delete removes the key. Deleting a key that does not exist is not an error.
+	Delete(ctx context.Context, key string) error
+	// Exists reports whether the key is present.
+	Exists(ctx context.Context, key string) (bool, error)
+	// GetMulti retrieves several keys at once. Missing keys are omitted from the result.
+	GetMulti(ctx context.Context, keys []string) (map[string]string, error)
+	// SetMulti stores several key-value pairs at once, overwriting existing values.
+	SetMulti(ctx context.Context, values map[string]string) error
+	// List returns one page of keys, in ascending order, matching the options.
+	List(ctx context.Context, opts ListOptions) (ListPage, error)
+	// Scan iterates over all keys matching the options, fetching pages as needed.
+	Scan(ctx context.Context, opts ListOptions) iter.Seq2[string, error]
+	// GetVersion retrieves the value together with its version (NoVersion if missing).
+	GetVersion(ctx context.Context, key string) (string, Version, error)
+	// SetIfVersion stores the value only if the key is still at the given version.
+	SetIfVersion(ctx context.Context, key, value string, version Version) error
+	// CompareAndSwap sets the key to newValue only if its current value equals old.
+	CompareAndSwap(ctx context.Context, key, old, newValue string) (bool, error)
+	// Update atomically replaces the value with the result of fn, retrying on conflicts.
+	Update(ctx context.Context, key string, fn UpdateFunc) error
+	// Watch reports changes to the key on the returned channel until ctx is done.
+	Watch(ctx context.Context, key string) (<-chan Event, error)
+	// WatchPrefix reports changes to all keys starting with prefix until ctx is done.
+	WatchPrefix(ctx context.Context, prefix string) (<-chan Event, error)
 	// Close releases resources held by the KV implementation.
 	Close() error
 }
@@ -18,6 +96,45 @@ type KV interface {
 // Store implementations can use a KV to persist data.
 type Store interface {
 	Get(ctx context.Context, key string) (string, error)
+	Lookup(ctx context.Context, key string) (string, bool, error)
 	Set(ctx context.Context, key, value string) error
+	SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	Exists(ctx context.Context, key string) (bool, error)
+	GetMulti(ctx context.Context, keys []string) (map[string]string, error)
+	SetMulti(ctx context.Context, values map[string]string) error
+	List(ctx context.Context, opts ListOptions) (ListPage, error)
+	Scan(ctx context.Context, opts ListOptions) iter.Seq2[string, error]
+	GetVersion(ctx context.Context, key string) (string, Version, error)
+	SetIfVersion(ctx context.Context, key, value string, version Version) error
+	CompareAndSwap(ctx context.Context, key, old, newValue string) (bool, error)
+	Update(ctx context.Context, key string, fn UpdateFunc) error
+	Watch(ctx context.Context, key string) (<-chan Event, error)
+	WatchPrefix(ctx context.Context, prefix string) (<-chan Event, error)
 	Close() error
 }
+
+// ExpiryReader is implemented by stores that can report when a key expires. The
+// decorators of this package implement it by asking their underlying store.
+type ExpiryReader interface {
+	// Expiry returns the time the key expires, or the zero time if it has no expiry
+	// or does not exist.
+	Expiry(ctx context.Context, key string) (time.Time, error)
+}
+
+// expiryOf returns the expiry of the key in s, or an error wrapping
+// errors.ErrUnsupported if s does not implement ExpiryReader.
+func expiryOf(ctx context.Context, s any, key string) (time.Time, error) {
+	er, ok := s.(ExpiryReader)
+	if !ok {
+		return time.Time{}, fmt.Errorf("%T cannot report the expiry of keys: %w", s, errors.ErrUnsupported)
+	}
+	return er.Expiry(ctx, key)
+}
+
+// GetExisting retrieves the value for the given key from s, returning an error that
+// wraps ErrNotFound if the key does not exist. Get keeps returning an empty string
+// without error for missing keys.
+func GetExisting(ctx context.Context, s Store, key string) (string, error) {
+	return firestore.GetExisting(ctx, s, key)
+}
@@ -0,0 +1,392 @@
+package testutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/duizendstra/dui-go/gcs"
+)
+
+// BlobStoreFactory returns a new, empty BlobStore for a single conformance test. It
+// should register any cleanup, such as closing a client, with t.Cleanup.
+type BlobStoreFactory func(t *testing.T) gcs.BlobStore
+
+// RunBlobStoreConformance runs the shared BlobStore test suite against the
+// implementations returned by newStore, verifying the semantics documented on
+// gcs.BlobStore: missing objects fail with gcs.ErrNotFound, uploads round-trip data
+// and attributes, content types are detected, every write makes a new generation,
+// compression and invalid upload options, range reads, expected checksums,
+// conditions, listing order and filters, deletion and concurrent use. Each subtest
+// gets its own store from newStore.
+//
+// The suite works with gcs.Client, gcs.MemoryBlobStore, gcs.FileBlobStore and
+// MockBlobStore.
+func RunBlobStoreConformance(t *testing.T, newStore BlobStoreFactory) {
+	t.Helper()
+
+	t.Run("MissingObjects", func(t *testing.T) {
+		ctx, store := ctxFor(t), newStore(t)
+		if _, err := store.Stat(ctx, "missing"); !errors.Is(err, gcs.ErrNotFound) {
+			t.Errorf("expected Stat to return ErrNotFound, got %v", err)
+		}
+		if err := store.Download(ctx, "missing", io.Discard); !errors.Is(err, gcs.ErrNotFound) {
+			t.Errorf("expected Download to return ErrNotFound, got %v", err)
+		}
+		if r, err := store.NewRangeReader(ctx, "missing", 0, -1); !errors.Is(err, gcs.ErrNotFound) {
+			t.Errorf("expected NewRangeReader to return ErrNotFound, got %v", err)
+			if err == nil {
+				r.Close()
+			}
+		}
+		if err := store.Delete(ctx, "missing", gcs.Conditions{}); !errors.Is(err, gcs.ErrNotFound) {
+			t.Errorf("expected Delete to return ErrNotFound, got %v", err)
+		}
+		if _, err := store.Upload(ctx, "", strings.NewReader("x"), gcs.UploadOptions{}); err == nil {
+			t.Error("expected Upload to reject an empty object name")
+		}
+	})
+
+	t.Run("UploadAndRead", func(t *testing.T) {
+		ctx, store := ctxFor(t), newStore(t)
+		data := []byte("id,name\n1,alice\n")
+		attrs, err := store.Upload(ctx, "reports/2024/q1", bytes.NewReader(data), gcs.UploadOptions{
+			ContentType:  "text/csv",
+			CacheControl: "no-cache",
+			Metadata:     map[string]string{"source": "conformance"},
+		})
+		if err != nil {
+			t.Fatalf("Upload failed: %v", err)
+		}
+		sum := md5.Sum(data)
+		want := gcs.ObjectAttrs{
+			Name:         "reports/2024/q1",
+			Size:         int64(len(data)),
+			ContentType:  "text/csv",
+			CacheControl: "no-cache",
+			CRC32C:       crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)),
+			MD5:          sum[:],
+			Metadata:     map[string]string{"source": "conformance"},
+		}
+		checkBlobAttrs(t, "Upload", attrs, want)
+		if attrs.Generation == 0 {
+			t.Error("expected Upload to return a generation")
+		}
+
+		stat, err := store.Stat(ctx, "reports/2024/q1")
+		if err != nil {
+			t.Fatalf("Stat failed: %v", err)
+		}
+		checkBlobAttrs(t, "Stat", stat, want)
+		if stat.Generation != attrs.Generation {
+			t.Errorf("expected Stat to return generation %d, got %d", attrs.Generation, stat.Generation)
+		}
+
+		if got := mustDownload(t, store, "reports/2024/q1"); got != string(data) {
+			t.Errorf("expected downloaded data %q, got %q", data, got)
+		}
+	})
+
+	t.Run("EmptyAndBinaryObjects", func(t *testing.T) {
+		ctx, store := ctxFor(t), newStore(t)
+		binary := []byte{0, 1, 2, 0xff, '\n', 0}
+		for name, data := range map[string][]byte{"empty": {}, "binary": binary} {
+			attrs, err := store.Upload(ctx, name, bytes.NewReader(data), gcs.UploadOptions{})
+			if err != nil {
+				t.Fatalf("Upload(%q) failed: %v", name, err)
+			}
+			if attrs.Size != int64(len(data)) {
+				t.Errorf("expected %q to have size %d, got %d", name, len(data), attrs.Size)
+			}
+			if got := mustDownload(t, store, name); got != string(data) {
+				t.Errorf("expected %q to round-trip, got %q", name, got)
+			}
+		}
+	})
+
+	t.Run("Compression", func(t *testing.T) {
+		ctx, store := ctxFor(t), newStore(t)
+		data := strings.Repeat("compressible ", 100)
+		for _, compression := range []gcs.Compression{gcs.Gzip, gcs.Zstd} {
+			name := "compressed-" + compression.String()
+			if _, err := store.Upload(ctx, name, strings.NewReader(data), gcs.UploadOptions{Compression: compression}); err != nil {
+				t.Fatalf("Upload(%q) failed: %v", name, err)
+			}
+			if got := mustDownload(t, store, name); got != data {
+				t.Errorf("expected %q to round-trip, got %q", name, got)
+			}
+		}
+
+		invalid := map[string]gcs.UploadOptions{
+			"compression-and-encoding": {Compression: gcs.Gzip, ContentEncoding: "gzip"},
+			"unknown-compression":      {Compression: gcs.Compression(99)},
+		}
+		for name, opts := range invalid {
+			if _, err := store.Upload(ctx, name, strings.NewReader(data), opts); err == nil {
+				t.Errorf("expected Upload(%q) to reject %+v", name, opts)
+			}
+			if _, err := store.Stat(ctx, name); !errors.Is(err, gcs.ErrNotFound) {
+				t.Errorf("expected no object %q after a rejected upload, got %v", name, err)
+			}
+		}
+	})
+
+	t.Run("ContentTypeDetection", func(t *testing.T) {
+		ctx, store := ctxFor(t), newStore(t)
+		tests := []struct{ object, data, want string }{
+			{"config.json", "{}", "application/json"},
+			{"page", "<!DOCTYPE html><html></html>", "text/html; charset=utf-8"},
+			{"blob", "\x00\x01\x02", "application/octet-stream"},
+		}
+		for _, tc := range tests {
+			attrs, err := store.Upload(ctx, tc.object, strings.NewReader(tc.data), gcs.UploadOptions{})
+			if err != nil {
+				t.Fatalf("Upload(%q) failed: %v", tc.object, err)
+			}
+			if attrs.ContentType != tc.want {
+				t.Errorf("expected content type %q for %q, got %q", tc.want, tc.object, attrs.ContentType)
+			}
+			if got := mustDownload(t, store, tc.object); got != tc.data {
+				t.Errorf("expected detection not to consume data of %q, got %q", tc.object, got)
+			}
+		}
+	})
+
+	t.Run("Overwrite", func(t *testing.T) {
+		ctx, store := ctxFor(t), newStore(t)
+		first := mustUpload(t, store, "doc", "version one")
+		second := mustUpload(t, store, "doc", "v2")
+		if first.Generation == second.Generation {
+			t.Errorf("expected a new generation on overwrite, got %d twice", first.Generation)
+		}
+		if got := mustDownload(t, store, "doc"); got != "v2" {
+			t.Errorf("expected overwritten data %q, got %q", "v2", got)
+		}
+		if attrs, err := store.Stat(ctx, "doc"); err != nil || attrs.Size != 2 || attrs.Generation != second.Generation {
+			t.Errorf("expected Stat to describe the new generation, got %+v, %v", attrs, err)
+		}
+	})
+
+	t.Run("RangeReads", func(t *testing.T) {
+		ctx, store := ctxFor(t), newStore(t)
+		mustUpload(t, store, "digits", "0123456789")
+		tests := []struct {
+			offset, length int64
+			want           string
+		}{
+			{0, -1, "0123456789"},
+			{2, 3, "234"},
+			{7, -1, "789"},
+			{8, 100, "89"},
+			{-4, -1, "6789"},
+			{-100, -1, "0123456789"},
+		}
+		for _, tc := range tests {
+			r, err := store.NewRangeReader(ctx, "digits", tc.offset, tc.length)
+			if err != nil {
+				t.Errorf("NewRangeReader(%d, %d) failed: %v", tc.offset, tc.length, err)
+				continue
+			}
+			got, err := io.ReadAll(r)
+			r.Close()
+			if err != nil || string(got) != tc.want {
+				t.Errorf("NewRangeReader(%d, %d): expected %q, got %q, %v", tc.offset, tc.length, tc.want, got, err)
+			}
+		}
+		if r, err := store.NewRangeReader(ctx, "digits", 10, -1); err == nil {
+			r.Close()
+			t.Error("expected NewRangeReader to fail for an offset at the end of the object")
+		}
+	})
+
+	t.Run("ExpectedChecksums", func(t *testing.T) {
+		ctx, store := ctxFor(t), newStore(t)
+		data := []byte("checked")
+		crc := crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli))
+		sum := md5.Sum(data)
+		if _, err := store.Upload(ctx, "checked", bytes.NewReader(data), gcs.UploadOptions{CRC32C: &crc, MD5: sum[:]}); err != nil {
+			t.Fatalf("expected matching checksums to succeed, got %v", err)
+		}
+
+		wrong := crc + 1
+		_, err := store.Upload(ctx, "bad-crc", bytes.NewReader(data), gcs.UploadOptions{CRC32C: &wrong})
+		if !errors.Is(err, gcs.ErrChecksumMismatch) {
+			t.Errorf("expected ErrChecksumMismatch for a wrong CRC32C, got %v", err)
+		}
+		_, err = store.Upload(ctx, "bad-md5", bytes.NewReader(data), gcs.UploadOptions{MD5: make([]byte, md5.Size)})
+		if !errors.Is(err, gcs.ErrChecksumMismatch) {
+			t.Errorf("expected ErrChecksumMismatch for a wrong MD5, got %v", err)
+		}
+		for _, name := range []string{"bad-crc", "bad-md5"} {
+			if _, err := store.Stat(ctx, name); !errors.Is(err, gcs.ErrNotFound) {
+				t.Errorf("expected no object %q after a checksum mismatch, got %v", name, err)
+			}
+		}
+	})
+
+	t.Run("Conditions", func(t *testing.T) {
+		ctx, store := ctxFor(t), newStore(t)
+		create := gcs.UploadOptions{Conditions: gcs.Conditions{DoesNotExist: true}}
+		first, err := store.Upload(ctx, "once", strings.NewReader("v1"), create)
+		if err != nil {
+			t.Fatalf("expected DoesNotExist upload to create the object, got %v", err)
+		}
+		if _, err := store.Upload(ctx, "once", strings.NewReader("v2"), create); !errors.Is(err, gcs.ErrPreconditionFailed) {
+			t.Errorf("expected ErrPreconditionFailed for an existing object, got %v", err)
+		}
+		stale := gcs.UploadOptions{Conditions: gcs.Conditions{GenerationMatch: first.Generation + 1}}
+		if _, err := store.Upload(ctx, "once", strings.NewReader("v2"), stale); !errors.Is(err, gcs.ErrPreconditionFailed) {
+			t.Errorf("expected ErrPreconditionFailed for a stale generation, got %v", err)
+		}
+		if got := mustDownload(t, store, "once"); got != "v1" {
+			t.Errorf("expected failed conditions to keep %q, got %q", "v1", got)
+		}
+
+		current := gcs.UploadOptions{Conditions: gcs.Conditions{GenerationMatch: first.Generation}}
+		second, err := store.Upload(ctx, "once", strings.NewReader("v2"), current)
+		if err != nil {
+			t.Fatalf("expected upload with the current generation to succeed, got %v", err)
+		}
+
+		if err := store.Delete(ctx, "once", gcs.Conditions{GenerationMatch: first.Generation}); !errors.Is(err, gcs.ErrPreconditionFailed) {
+			t.Errorf("expected Delete with a stale generation to fail, got %v", err)
+		}
+		if err := store.Delete(ctx, "once", gcs.Conditions{GenerationMatch: second.Generation}); err != nil {
+			t.Errorf("expected Delete with the current generation to succeed, got %v", err)
+		}
+	})
+
+	t.Run("Listing", func(t *testing.T) {
+		ctx, store := ctxFor(t), newStore(t)
+		for _, name := range []string{"a-c", "a/b", "a/d/e", "b", "logs/1", "logs/2", "logs/3"} {
+			mustUpload(t, store, name, "data of "+name)
+		}
+		tests := []struct {
+			name string
+			opts gcs.ListOptions
+			want []string
+		}{
+			{"All ordered by name", gcs.ListOptions{}, []string{"a-c", "a/b", "a/d/e", "b", "logs/1", "logs/2", "logs/3"}},
+			{"Prefix", gcs.ListOptions{Prefix: "a/"}, []string{"a/b", "a/d/e"}},
+			{"Delimiter", gcs.ListOptions{Delimiter: "/"}, []string{"a-c", "b", "a/", "logs/"}},
+			{"Prefix and delimiter", gcs.ListOptions{Prefix: "a/", Delimiter: "/"}, []string{"a/b", "a/d/"}},
+			{"Offsets", gcs.ListOptions{StartOffset: "logs/2", EndOffset: "logs/3"}, []string{"logs/2"}},
+			{"No matches", gcs.ListOptions{Prefix: "missing/"}, nil},
+		}
+		for _, tc := range tests {
+			got, err := listBlobNames(store, tc.opts)
+			if err != nil {
+				t.Errorf("%s: List failed: %v", tc.name, err)
+				continue
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+			}
+		}
+
+		for attrs, err := range store.List(ctx, gcs.ListOptions{Prefix: "logs/"}) {
+			if err != nil {
+				t.Fatalf("List failed: %v", err)
+			}
+			if attrs.Size != int64(len("data of "+attrs.Name)) || attrs.Generation == 0 {
+				t.Errorf("expected listed attributes for %q, got %+v", attrs.Name, attrs)
+			}
+			break // stopping early must not panic or block
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		ctx, store := ctxFor(t), newStore(t)
+		mustUpload(t, store, "dir/keep", "keep")
+		mustUpload(t, store, "dir/sub/remove", "remove")
+		if err := store.Delete(ctx, "dir/sub/remove", gcs.Conditions{}); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		if _, err := store.Stat(ctx, "dir/sub/remove"); !errors.Is(err, gcs.ErrNotFound) {
+			t.Errorf("expected deleted object to be gone, got %v", err)
+		}
+		if got, err := listBlobNames(store, gcs.ListOptions{}); err != nil || fmt.Sprint(got) != "[dir/keep]" {
+			t.Errorf("expected only dir/keep to remain, got %v, %v", got, err)
+		}
+	})
+
+	t.Run("ConcurrentUse", func(t *testing.T) {
+		ctx, store := ctxFor(t), newStore(t)
+		const n = 20
+		var wg sync.WaitGroup
+		errs := make(chan error, 2*n)
+		for i := range n {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				name := fmt.Sprintf("concurrent/%02d", i)
+				if _, err := store.Upload(ctx, name, strings.NewReader(name), gcs.UploadOptions{}); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := store.Stat(ctx, name); err != nil {
+					errs <- err
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Errorf("concurrent operation failed: %v", err)
+		}
+		if got, err := listBlobNames(store, gcs.ListOptions{Prefix: "concurrent/"}); err != nil || len(got) != n {
+			t.Errorf("expected %d objects, got %d, %v", n, len(got), err)
+		}
+	})
+}
+
+// checkBlobAttrs compares the attributes a conformance test controls.
+func checkBlobAttrs(t *testing.T, op string, got *gcs.ObjectAttrs, want gcs.ObjectAttrs) {
+	t.Helper()
+	if got.Name != want.Name || got.Size != want.Size || got.ContentType != want.ContentType ||
+		got.CacheControl != want.CacheControl || got.CRC32C != want.CRC32C || !bytes.Equal(got.MD5, want.MD5) ||
+		fmt.Sprint(got.Metadata) != fmt.Sprint(want.Metadata) {
+		t.Errorf("%s: expected attributes %+v, got %+v", op, want, *got)
+	}
+}
+
+func mustUpload(t *testing.T, store gcs.BlobStore, object, data string) *gcs.ObjectAttrs {
+	t.Helper()
+	attrs, err := store.Upload(ctxFor(t), object, strings.NewReader(data), gcs.UploadOptions{})
+	if err != nil {
+		t.Fatalf("Upload(%q) failed: %v", object, err)
+	}
+	return attrs
+}
+
+func mustDownload(t *testing.T, store gcs.BlobStore, object string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := store.Download(ctxFor(t), object, &buf); err != nil {
+		t.Fatalf("Download(%q) failed: %v", object, err)
+	}
+	return buf.String()
+}
+
+// listBlobNames returns the names, or prefixes, of the listed objects.
+func listBlobNames(store gcs.BlobStore, opts gcs.ListOptions) ([]string, error) {
+	var names []string
+	for attrs, err := range store.List(context.Background(), opts) {
+		if err != nil {
+			return names, err
+		}
+		if attrs.Prefix != "" {
+			names = append(names, attrs.Prefix)
+		} else {
+			names = append(names, attrs.Name)
+		}
+	}
+	return names, nil
+}
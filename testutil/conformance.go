@@ -0,0 +1,421 @@
+package testutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/duizendstra/dui-go/firestore"
+)
+
+// KVFactory returns a new, empty KV for a single conformance test. It should register
+// any cleanup, such as closing the KV, with t.Cleanup.
+type KVFactory func(t *testing.T) firestore.KV
+
+// RunKVConformance runs the shared KV test suite against the implementations returned
+// by newKV, verifying the semantics documented on firestore.KV: missing keys read as
+// empty strings without error, writes overwrite, empty values are stored keys, unicode
+// and large keys round-trip, listing is ordered by key, conditional writes detect
+// concurrent changes, concurrent use is safe, and operations fail after Close. Each
+// subtest gets its own KV from newKV.
+//
+// Keys used by the suite avoid "/", which Firestore does not allow in document IDs.
+// Implementations are expected to accept keys up to 1000 bytes and values up to
+// 512 KiB.
+//
+// The suite works with any firestore.KV or store.KV implementation, including
+// FirestoreKV against the emulator (see NewEmulatorKV), MockFirestoreKV,
+// store.FirestoreStore and the store package's MemoryStore and file store, which run
+// it without an emulator.
+func RunKVConformance(t *testing.T, newKV KVFactory) {
+	t.Helper()
+
+	t.Run("MissingKeys", func(t *testing.T) {
+		ctx, kv := ctxFor(t), newKV(t)
+		if val, err := kv.Get(ctx, "missing"); err != nil || val != "" {
+			t.Errorf("expected empty value and no error for a missing key, got %q, %v", val, err)
+		}
+		if val, found, err := kv.Lookup(ctx, "missing"); err != nil || found || val != "" {
+			t.Errorf("expected Lookup to report a missing key, got %q, %v, %v", val, found, err)
+		}
+		if _, err := firestore.GetExisting(ctx, kv, "missing"); !errors.Is(err, firestore.ErrNotFound) {
+			t.Errorf("expected GetExisting to return ErrNotFound, got %v", err)
+		}
+		if ok, err := kv.Exists(ctx, "missing"); err != nil || ok {
+			t.Errorf("expected missing key not to exist, got %v, %v", ok, err)
+		}
+		if got, err := kv.GetMulti(ctx, []string{"missing", "also-missing"}); err != nil || len(got) != 0 {
+			t.Errorf("expected an empty map for missing keys, got %v, %v", got, err)
+		}
+		if val, version, err := kv.GetVersion(ctx, "missing"); err != nil || val != "" || version != firestore.NoVersion {
+			t.Errorf("expected empty value and NoVersion, got %q, %d, %v", val, version, err)
+		}
+		if err := kv.Delete(ctx, "missing"); err != nil {
+			t.Errorf("expected deleting a missing key to succeed, got %v", err)
+		}
+		if page, err := kv.List(ctx, firestore.ListOptions{}); err != nil || len(page.Keys) != 0 || page.NextPageToken != "" {
+			t.Errorf("expected an empty page, got %+v, %v", page, err)
+		}
+		var seen string
+		err := kv.Update(ctx, "counter", func(old string) (string, error) {
+			seen = old
+			return "1", nil
+		})
+		if err != nil || seen != "" {
+			t.Errorf("expected Update to see an empty value for a missing key, got %q, %v", seen, err)
+		}
+	})
+
+	t.Run("SetGet", func(t *testing.T) {
+		ctx, kv := ctxFor(t), newKV(t)
+		mustSet(t, kv, "key", "value")
+		if val := mustGet(t, kv, "key"); val != "value" {
+			t.Errorf("expected 'value', got %q", val)
+		}
+		if ok, err := kv.Exists(ctx, "key"); err != nil || !ok {
+			t.Errorf("expected key to exist, got %v, %v", ok, err)
+		}
+	})
+
+	t.Run("Overwrite", func(t *testing.T) {
+		ctx, kv := ctxFor(t), newKV(t)
+		mustSet(t, kv, "key", "first")
+		_, before, err := kv.GetVersion(ctx, "key")
+		if err != nil {
+			t.Fatalf("GetVersion failed: %v", err)
+		}
+		mustSet(t, kv, "key", "second")
+		if val := mustGet(t, kv, "key"); val != "second" {
+			t.Errorf("expected 'second', got %q", val)
+		}
+		if _, after, err := kv.GetVersion(ctx, "key"); err != nil || after == before {
+			t.Errorf("expected the version to change on overwrite, got %d and %d, %v", before, after, err)
+		}
+
+		if err := kv.SetMulti(ctx, map[string]string{"key": "third"}); err != nil {
+			t.Fatalf("SetMulti failed: %v", err)
+		}
+		if val := mustGet(t, kv, "key"); val != "third" {
+			t.Errorf("expected SetMulti to overwrite, got %q", val)
+		}
+	})
+
+	t.Run("EmptyValue", func(t *testing.T) {
+		ctx, kv := ctxFor(t), newKV(t)
+		mustSet(t, kv, "empty", "")
+		if val := mustGet(t, kv, "empty"); val != "" {
+			t.Errorf("expected an empty value, got %q", val)
+		}
+		// An empty value is still a stored key, unlike a missing one.
+		if val, found, err := kv.Lookup(ctx, "empty"); err != nil || !found || val != "" {
+			t.Errorf("expected Lookup to find the empty value, got %q, %v, %v", val, found, err)
+		}
+		if _, err := firestore.GetExisting(ctx, kv, "empty"); err != nil {
+			t.Errorf("expected GetExisting to return the empty value, got %v", err)
+		}
+		if ok, err := kv.Exists(ctx, "empty"); err != nil || !ok {
+			t.Errorf("expected a key with an empty value to exist, got %v, %v", ok, err)
+		}
+		if got, err := kv.GetMulti(ctx, []string{"empty"}); err != nil || len(got) != 1 {
+			t.Errorf("expected GetMulti to include the empty value, got %v, %v", got, err)
+		}
+		if page, err := kv.List(ctx, firestore.ListOptions{}); err != nil || !slices.Equal(page.Keys, []string{"empty"}) {
+			t.Errorf("expected the key to be listed, got %+v, %v", page, err)
+		}
+	})
+
+	t.Run("UnicodeKeysAndValues", func(t *testing.T) {
+		ctx, kv := ctxFor(t), newKV(t)
+		values := map[string]string{
+			"ключ":          "значение",
+			"日本語のキー":        "値",
+			"emoji-🔑":       "🔒✨",
+			"spaces in key": "tabs\tand\nnewlines",
+			"mixed-ÄÖÜ-ß-ñ": "naïve café",
+		}
+		for key, value := range values {
+			mustSet(t, kv, key, value)
+		}
+		for key, value := range values {
+			if got := mustGet(t, kv, key); got != value {
+				t.Errorf("key %q: expected %q, got %q", key, value, got)
+			}
+		}
+
+		var listed []string
+		for key, err := range kv.Scan(ctx, firestore.ListOptions{}) {
+			if err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+			listed = append(listed, key)
+		}
+		if len(listed) != len(values) {
+			t.Errorf("expected %d keys, got %v", len(values), listed)
+		}
+	})
+
+	t.Run("LargeKeysAndValues", func(t *testing.T) {
+		ctx, kv := ctxFor(t), newKV(t)
+		// Firestore limits document IDs to 1500 bytes and documents to 1 MiB.
+		key := strings.Repeat("k", 1000)
+		value := strings.Repeat("0123456789abcdef", 32*1024)
+		mustSet(t, kv, key, value)
+		if got := mustGet(t, kv, key); got != value {
+			t.Errorf("expected a %d byte value, got %d bytes", len(value), len(got))
+		}
+		if got, err := kv.GetMulti(ctx, []string{key}); err != nil || got[key] != value {
+			t.Errorf("expected GetMulti to return the large value, got %d bytes, %v", len(got[key]), err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		ctx, kv := ctxFor(t), newKV(t)
+		mustSet(t, kv, "key", "value")
+		if err := kv.Delete(ctx, "key"); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		if _, found, err := kv.Lookup(ctx, "key"); err != nil || found {
+			t.Errorf("expected Lookup not to find the deleted key, got %v, %v", found, err)
+		}
+		if val := mustGet(t, kv, "key"); val != "" {
+			t.Errorf("expected deleted key to read as empty, got %q", val)
+		}
+		if ok, err := kv.Exists(ctx, "key"); err != nil || ok {
+			t.Errorf("expected deleted key not to exist, got %v, %v", ok, err)
+		}
+		if err := kv.Delete(ctx, "key"); err != nil {
+			t.Errorf("expected deleting a missing key to succeed, got %v", err)
+		}
+	})
+
+	t.Run("Multi", func(t *testing.T) {
+		ctx, kv := ctxFor(t), newKV(t)
+		if err := kv.SetMulti(ctx, map[string]string{"a": "1", "b": "2"}); err != nil {
+			t.Fatalf("SetMulti failed: %v", err)
+		}
+		got, err := kv.GetMulti(ctx, []string{"a", "b", "missing"})
+		if err != nil {
+			t.Fatalf("GetMulti failed: %v", err)
+		}
+		if len(got) != 2 || got["a"] != "1" || got["b"] != "2" {
+			t.Errorf("expected map[a:1 b:2], got %v", got)
+		}
+	})
+
+	t.Run("ListAndScan", func(t *testing.T) {
+		ctx, kv := ctxFor(t), newKV(t)
+		if err := kv.SetMulti(ctx, map[string]string{"p-c": "3", "p-a": "1", "p-b": "2", "q": "4"}); err != nil {
+			t.Fatalf("SetMulti failed: %v", err)
+		}
+
+		page, err := kv.List(ctx, firestore.ListOptions{Prefix: "p-", PageSize: 2})
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		if !slices.Equal(page.Keys, []string{"p-a", "p-b"}) || page.NextPageToken == "" {
+			t.Fatalf("unexpected first page: %+v", page)
+		}
+		page, err = kv.List(ctx, firestore.ListOptions{Prefix: "p-", PageSize: 2, PageToken: page.NextPageToken})
+		if err != nil {
+			t.Fatalf("List of second page failed: %v", err)
+		}
+		if !slices.Equal(page.Keys, []string{"p-c"}) || page.NextPageToken != "" {
+			t.Errorf("unexpected second page: %+v", page)
+		}
+
+		var keys []string
+		for key, err := range kv.Scan(ctx, firestore.ListOptions{}) {
+			if err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+			keys = append(keys, key)
+		}
+		if !slices.Equal(keys, []string{"p-a", "p-b", "p-c", "q"}) {
+			t.Errorf("unexpected scan result: %v", keys)
+		}
+	})
+
+	t.Run("ConditionalWrites", func(t *testing.T) {
+		ctx, kv := ctxFor(t), newKV(t)
+		if err := kv.SetIfVersion(ctx, "key", "v1", firestore.NoVersion); err != nil {
+			t.Fatalf("SetIfVersion on a new key failed: %v", err)
+		}
+		if err := kv.SetIfVersion(ctx, "key", "v2", firestore.NoVersion); !errors.Is(err, firestore.ErrPreconditionFailed) {
+			t.Errorf("expected ErrPreconditionFailed for an existing key, got %v", err)
+		}
+
+		val, version, err := kv.GetVersion(ctx, "key")
+		if err != nil || val != "v1" || version == firestore.NoVersion {
+			t.Fatalf("unexpected GetVersion result: %q, %d, %v", val, version, err)
+		}
+		if err := kv.SetIfVersion(ctx, "key", "v2", version); err != nil {
+			t.Fatalf("SetIfVersion with the current version failed: %v", err)
+		}
+		if err := kv.SetIfVersion(ctx, "key", "v3", version); !errors.Is(err, firestore.ErrPreconditionFailed) {
+			t.Errorf("expected ErrPreconditionFailed for a stale version, got %v", err)
+		}
+
+		if ok, err := kv.CompareAndSwap(ctx, "key", "stale", "v3"); err != nil || ok {
+			t.Errorf("expected CompareAndSwap with a stale value to fail, got %v, %v", ok, err)
+		}
+		if ok, err := kv.CompareAndSwap(ctx, "key", "v2", "v3"); err != nil || !ok {
+			t.Errorf("expected CompareAndSwap to succeed, got %v, %v", ok, err)
+		}
+
+		if err := kv.Update(ctx, "key", func(old string) (string, error) { return old + "!", nil }); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		if val := mustGet(t, kv, "key"); val != "v3!" {
+			t.Errorf("expected 'v3!', got %q", val)
+		}
+	})
+
+	t.Run("SetWithTTL", func(t *testing.T) {
+		ctx, kv := ctxFor(t), newKV(t)
+		if err := kv.SetWithTTL(ctx, "key", "value", time.Hour); err != nil {
+			t.Fatalf("SetWithTTL failed: %v", err)
+		}
+		if val := mustGet(t, kv, "key"); val != "value" {
+			t.Errorf("expected 'value' before expiry, got %q", val)
+		}
+		if err := kv.SetWithTTL(ctx, "key", "value", 0); err == nil {
+			t.Error("expected an error for a non-positive TTL")
+		}
+	})
+
+	t.Run("ConcurrentAccess", func(t *testing.T) {
+		ctx, kv := ctxFor(t), newKV(t)
+		const writers, keysPerWriter = 8, 5
+
+		var wg sync.WaitGroup
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < keysPerWriter; i++ {
+					key := fmt.Sprintf("w%d-k%d", w, i)
+					if err := kv.Set(ctx, key, key); err != nil {
+						t.Errorf("Set(%q) failed: %v", key, err)
+						return
+					}
+					if _, err := kv.Get(ctx, key); err != nil {
+						t.Errorf("Get(%q) failed: %v", key, err)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		for w := 0; w < writers; w++ {
+			for i := 0; i < keysPerWriter; i++ {
+				key := fmt.Sprintf("w%d-k%d", w, i)
+				if got := mustGet(t, kv, key); got != key {
+					t.Errorf("expected %q, got %q", key, got)
+				}
+			}
+		}
+
+		// Concurrent increments either commit or fail with ErrConflict; none may be lost.
+		var committed atomic.Int64
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := kv.Update(ctx, "counter", func(old string) (string, error) {
+					n, _ := strconv.Atoi(old)
+					return strconv.Itoa(n + 1), nil
+				})
+				switch {
+				case err == nil:
+					committed.Add(1)
+				case !errors.Is(err, firestore.ErrConflict):
+					t.Errorf("Update failed: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if committed.Load() == 0 {
+			t.Fatal("expected at least one concurrent Update to commit")
+		}
+		if got, want := mustGet(t, kv, "counter"), strconv.FormatInt(committed.Load(), 10); got != want {
+			t.Errorf("expected counter %s after %s committed updates, got %s", want, want, got)
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		ctx, kv := ctxFor(t), newKV(t)
+		mustSet(t, kv, "key", "value")
+		if err := kv.Close(); err != nil {
+			t.Fatalf("expected Close to succeed, got %v", err)
+		}
+		if val, err := kv.Get(ctx, "key"); err == nil {
+			t.Errorf("expected Get to fail after Close, got %q", val)
+		}
+		if err := kv.Set(ctx, "key", "other"); err == nil {
+			t.Error("expected Set to fail after Close")
+		}
+		if err := kv.Update(ctx, "key", func(old string) (string, error) { return old, nil }); err == nil {
+			t.Error("expected Update to fail after Close")
+		}
+		// Closing again, as the factory's cleanup may, must not panic.
+		_ = kv.Close()
+	})
+
+	t.Run("Watch", func(t *testing.T) {
+		ctx, kv := ctxFor(t), newKV(t)
+		mustSet(t, kv, "key", "before")
+		events, err := kv.Watch(ctx, "key")
+		if err != nil {
+			t.Fatalf("Watch failed: %v", err)
+		}
+		mustSet(t, kv, "key", "value")
+		for {
+			select {
+			case ev := <-events:
+				if ev.Err != nil || ev.Type != firestore.EventSet {
+					continue
+				}
+				if want := ev.Value == "before"; ev.Initial != want {
+					t.Errorf("expected Initial %v for the event with value %q", want, ev.Value)
+				}
+				if ev.Value == "value" {
+					return
+				}
+			case <-ctx.Done():
+				t.Fatal("timed out waiting for the set event")
+			}
+		}
+	})
+}
+
+// ctxFor returns a context that is cancelled when the test ends or after a timeout
+// generous enough for emulator round trips.
+func ctxFor(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func mustSet(t *testing.T, kv firestore.KV, key, value string) {
+	t.Helper()
+	if err := kv.Set(ctxFor(t), key, value); err != nil {
+		t.Fatalf("Set(%q) failed: %v", key, err)
+	}
+}
+
+func mustGet(t *testing.T, kv firestore.KV, key string) string {
+	t.Helper()
+	val, err := kv.Get(ctxFor(t), key)
+	if err != nil {
+		t.Fatalf("Get(%q) failed: %v", key, err)
+	}
+	return val
+}
@@ -0,0 +1,13 @@
+package testutil
+
+import (
+	"testing"
+
+	"github.com/duizendstra/dui-go/firestore"
+)
+
+func TestMockFirestoreKVConformance(t *testing.T) {
+	RunKVConformance(t, func(t *testing.T) firestore.KV {
+		return NewMockFirestoreKV()
+	})
+}
@@ -1,8 +1,23 @@
 // Package testutil provides testing utilities, including mock implementations
-// of various interfaces (e.g., cache.Cache, firestore.KV) used by other packages.
+// of various interfaces (e.g., cache.Cache, firestore.KV, gcs.BlobStore) used by other packages.
 //
 // These mocks allow developers to test code that depends on these interfaces
 // without requiring real services or complex setups. Keep this package focused
 // on test-related functionality, ensuring production code remains free of
 // testing scaffolding.
+//
+// RunKVConformance is a shared test suite for firestore.KV and store.KV
+// implementations. NewEmulatorKV returns a FirestoreKV backed by the Firestore
+// emulator, started through the gcloud CLI if FIRESTORE_EMULATOR_HOST is not set, so
+// the suite can run against the real implementation:
+//
+//	func TestConformance(t *testing.T) {
+//		testutil.RunKVConformance(t, func(t *testing.T) firestore.KV {
+//			return testutil.NewEmulatorKV(t)
+//		})
+//	}
+//
+// MockBlobStore implements gcs.BlobStore on top of gcs.MemoryBlobStore, recording
+// calls and failing methods on demand via SetError. RunBlobStoreConformance is the
+// matching shared suite for gcs.BlobStore implementations.
 package testutil
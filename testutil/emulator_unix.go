@@ -0,0 +1,21 @@
+//go:build !windows
+
+package testutil
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// configureEmulatorProcess starts the emulator in its own process group, because
+// gcloud runs the actual emulator as a child process.
+func configureEmulatorProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// stopEmulatorProcess terminates gcloud together with the emulator it started.
+func stopEmulatorProcess(cmd *exec.Cmd) {
+	if cmd.Process != nil {
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package testutil
+
+import "os/exec"
+
+// configureEmulatorProcess is a no-op on Windows.
+func configureEmulatorProcess(cmd *exec.Cmd) {}
+
+// stopEmulatorProcess kills gcloud. On Windows the emulator child process may have to
+// be stopped separately.
+func stopEmulatorProcess(cmd *exec.Cmd) {
+	if cmd.Process != nil {
+		_ = cmd.Process.Kill()
+	}
+}
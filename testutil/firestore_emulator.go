@@ -0,0 +1,110 @@
+package testutil
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/duizendstra/dui-go/firestore"
+)
+
+// emulatorStartTimeout bounds how long FirestoreEmulator waits for a started emulator
+// to accept connections.
+const emulatorStartTimeout = 60 * time.Second
+
+// FirestoreEmulator makes sure a Firestore emulator is available for the test and
+// returns its address. If FIRESTORE_EMULATOR_HOST is set, that emulator is used.
+// Otherwise, if the gcloud CLI is installed, an emulator is started on a free port,
+// FIRESTORE_EMULATOR_HOST is set for the duration of the test and the emulator is
+// stopped when the test ends. The test is skipped if no emulator is available or
+// when running with -short.
+//
+// Because it may set an environment variable, FirestoreEmulator cannot be used in
+// parallel tests unless FIRESTORE_EMULATOR_HOST is already set.
+func FirestoreEmulator(t testing.TB) string {
+	t.Helper()
+	if addr := os.Getenv(firestore.EmulatorHostEnv); addr != "" {
+		return addr
+	}
+	if testing.Short() {
+		t.Skip("skipping Firestore emulator test in short mode")
+	}
+	gcloud, err := exec.LookPath("gcloud")
+	if err != nil {
+		t.Skipf("skipping: %s is not set and gcloud is not installed", firestore.EmulatorHostEnv)
+	}
+
+	addr, err := freeLocalAddr()
+	if err != nil {
+		t.Fatalf("failed to find a free port for the Firestore emulator: %v", err)
+	}
+
+	cmd := exec.Command(gcloud, "emulators", "firestore", "start", "--host-port="+addr, "--quiet")
+	configureEmulatorProcess(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start the Firestore emulator: %v", err)
+	}
+	t.Cleanup(func() {
+		stopEmulatorProcess(cmd)
+		_ = cmd.Wait()
+	})
+
+	if err := waitForListener(addr, emulatorStartTimeout); err != nil {
+		t.Fatalf("Firestore emulator did not start: %v", err)
+	}
+	t.Setenv(firestore.EmulatorHostEnv, addr)
+	return addr
+}
+
+// NewEmulatorKV returns a FirestoreKV connected to the Firestore emulator (see
+// FirestoreEmulator) that uses a fresh, uniquely named collection, so tests do not see
+// each other's data. The options are passed to firestore.NewKV. The KV is closed when
+// the test ends.
+func NewEmulatorKV(t testing.TB, opts ...firestore.Option) *firestore.FirestoreKV {
+	t.Helper()
+	FirestoreEmulator(t)
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		t.Fatalf("failed to generate collection name: %v", err)
+	}
+	collection := "test-" + hex.EncodeToString(suffix)
+
+	kv, err := firestore.NewKV(context.Background(), "", collection, opts...)
+	if err != nil {
+		t.Fatalf("failed to create FirestoreKV for the emulator: %v", err)
+	}
+	t.Cleanup(func() { _ = kv.Close() })
+	return kv
+}
+
+// freeLocalAddr returns a loopback address with a port that is currently unused.
+func freeLocalAddr() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	return l.Addr().String(), nil
+}
+
+// waitForListener polls addr until it accepts TCP connections or timeout elapses.
+func waitForListener(addr string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			return conn.Close()
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s not reachable after %s: %w", addr, timeout, err)
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
@@ -0,0 +1,121 @@
+package testutil
+
+import (
+	"context"
+	"io"
+	"iter"
+	"sync"
+
+	"github.com/duizendstra/dui-go/gcs"
+)
+
+// Compile-time check that MockBlobStore implements gcs.BlobStore
+var _ gcs.BlobStore = (*MockBlobStore)(nil)
+
+// BlobUploadCall records a call to MockBlobStore.Upload.
+type BlobUploadCall struct {
+	Object  string
+	Options gcs.UploadOptions
+}
+
+// MockBlobStore is a mock implementation of the gcs.BlobStore interface, designed
+// for testing code that stores blobs. It keeps objects in a gcs.MemoryBlobStore, so
+// uploads, reads, listings and conditions behave like they do on GCS, and it records
+// the calls to its methods.
+//
+// This mock never fails by default; use SetError to make a method fail, for example
+// to test how callers handle an unavailable bucket.
+//
+// It is safe to call these methods concurrently, but reading the recorded calls
+// while concurrent operations are ongoing is not recommended.
+type MockBlobStore struct {
+	mu     sync.Mutex
+	store  *gcs.MemoryBlobStore
+	errors map[string]error
+
+	UploadCalls         []BlobUploadCall
+	DownloadCalls       []string
+	NewRangeReaderCalls []string
+	ListCalls           []gcs.ListOptions
+	DeleteCalls         []string
+	StatCalls           []string
+}
+
+// NewMockBlobStore returns a new, empty MockBlobStore.
+func NewMockBlobStore() *MockBlobStore {
+	return &MockBlobStore{
+		store:  gcs.NewMemoryBlobStore(),
+		errors: make(map[string]error),
+	}
+}
+
+// SetError makes every later call to the named method, such as "Upload" or "List",
+// return err; a nil err makes the method succeed again. Failing calls are still
+// recorded but do not change the stored objects.
+func (m *MockBlobStore) SetError(method string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil {
+		delete(m.errors, method)
+		return
+	}
+	m.errors[method] = err
+}
+
+// Upload records the call and stores the object.
+func (m *MockBlobStore) Upload(ctx context.Context, object string, r io.Reader, opts gcs.UploadOptions) (*gcs.ObjectAttrs, error) {
+	if err := m.record("Upload", func() { m.UploadCalls = append(m.UploadCalls, BlobUploadCall{object, opts}) }); err != nil {
+		return nil, err
+	}
+	return m.store.Upload(ctx, object, r, opts)
+}
+
+// Download records the call and writes the content of the object to w.
+func (m *MockBlobStore) Download(ctx context.Context, object string, w io.Writer) error {
+	if err := m.record("Download", func() { m.DownloadCalls = append(m.DownloadCalls, object) }); err != nil {
+		return err
+	}
+	return m.store.Download(ctx, object, w)
+}
+
+// NewRangeReader records the call and opens a range of the object.
+func (m *MockBlobStore) NewRangeReader(ctx context.Context, object string, offset, length int64) (io.ReadCloser, error) {
+	if err := m.record("NewRangeReader", func() { m.NewRangeReaderCalls = append(m.NewRangeReaderCalls, object) }); err != nil {
+		return nil, err
+	}
+	return m.store.NewRangeReader(ctx, object, offset, length)
+}
+
+// List records the call and iterates over the matching objects.
+func (m *MockBlobStore) List(ctx context.Context, opts gcs.ListOptions) iter.Seq2[gcs.ObjectAttrs, error] {
+	if err := m.record("List", func() { m.ListCalls = append(m.ListCalls, opts) }); err != nil {
+		return func(yield func(gcs.ObjectAttrs, error) bool) {
+			yield(gcs.ObjectAttrs{}, err)
+		}
+	}
+	return m.store.List(ctx, opts)
+}
+
+// Delete records the call and deletes the object.
+func (m *MockBlobStore) Delete(ctx context.Context, object string, conds gcs.Conditions) error {
+	if err := m.record("Delete", func() { m.DeleteCalls = append(m.DeleteCalls, object) }); err != nil {
+		return err
+	}
+	return m.store.Delete(ctx, object, conds)
+}
+
+// Stat records the call and returns the attributes of the object.
+func (m *MockBlobStore) Stat(ctx context.Context, object string) (*gcs.ObjectAttrs, error) {
+	if err := m.record("Stat", func() { m.StatCalls = append(m.StatCalls, object) }); err != nil {
+		return nil, err
+	}
+	return m.store.Stat(ctx, object)
+}
+
+// record appends a call under the lock and returns the error set for the method.
+func (m *MockBlobStore) record(method string, appendCall func()) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	appendCall()
+	return m.errors[method]
+}
@@ -0,0 +1,64 @@
+package testutil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/duizendstra/dui-go/gcs"
+)
+
+func TestMockBlobStoreConformance(t *testing.T) {
+	RunBlobStoreConformance(t, func(t *testing.T) gcs.BlobStore {
+		return NewMockBlobStore()
+	})
+}
+
+func TestMockBlobStore(t *testing.T) {
+	ctx := context.Background()
+	m := NewMockBlobStore()
+
+	opts := gcs.UploadOptions{ContentType: "text/plain"}
+	if _, err := m.Upload(ctx, "greeting", strings.NewReader("hello"), opts); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := m.Download(ctx, "greeting", &buf); err != nil || buf.String() != "hello" {
+		t.Errorf("expected 'hello', got %q, %v", buf.String(), err)
+	}
+	for range m.List(ctx, gcs.ListOptions{Prefix: "greet"}) {
+	}
+
+	if len(m.UploadCalls) != 1 || m.UploadCalls[0].Object != "greeting" || m.UploadCalls[0].Options.ContentType != "text/plain" {
+		t.Errorf("expected one recorded upload of 'greeting', got %+v", m.UploadCalls)
+	}
+	if len(m.DownloadCalls) != 1 || m.DownloadCalls[0] != "greeting" {
+		t.Errorf("expected one recorded download, got %v", m.DownloadCalls)
+	}
+	if len(m.ListCalls) != 1 || m.ListCalls[0].Prefix != "greet" {
+		t.Errorf("expected one recorded listing, got %+v", m.ListCalls)
+	}
+
+	unavailable := errors.New("bucket unavailable")
+	m.SetError("Upload", unavailable)
+	m.SetError("List", unavailable)
+	if _, err := m.Upload(ctx, "greeting", strings.NewReader("bye"), gcs.UploadOptions{}); !errors.Is(err, unavailable) {
+		t.Errorf("expected injected error, got %v", err)
+	}
+	for _, err := range m.List(ctx, gcs.ListOptions{}) {
+		if !errors.Is(err, unavailable) {
+			t.Errorf("expected injected List error, got %v", err)
+		}
+	}
+	if len(m.UploadCalls) != 2 {
+		t.Errorf("expected failing calls to be recorded, got %d uploads", len(m.UploadCalls))
+	}
+
+	m.SetError("Upload", nil)
+	buf.Reset()
+	if err := m.Download(ctx, "greeting", &buf); err != nil || buf.String() != "hello" {
+		t.Errorf("expected the failed upload to leave 'hello', got %q, %v", buf.String(), err)
+	}
+}
@@ -6,8 +6,11 @@ import (
 	"github.com/duizendstra/dui-go/cache"
 )
 
-// Compile-time check that MockCache implements cache.Cache
-var _ cache.Cache = (*MockCache)(nil)
+// Compile-time check that MockCache implements cache.Cache and cache.Deleter
+var (
+	_ cache.Cache   = (*MockCache)(nil)
+	_ cache.Deleter = (*MockCache)(nil)
+)
 
 // MockCache is a mock implementation of the cache.Cache interface, designed
 // for testing. It records calls to its methods, storing keys and values in an
@@ -24,6 +27,7 @@ type MockCache struct {
 		Value interface{}
 	}
 	SetAllCalls []map[string]interface{}
+	DeleteCalls [][]string
 	FlushCalls  int
 }
 
@@ -76,6 +80,16 @@ func (m *MockCache) GetAll() map[string]interface{} {
 	return copyMap
 }
 
+// Delete records the call and removes the entries for the given keys.
+func (m *MockCache) Delete(keys ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.DeleteCalls = append(m.DeleteCalls, keys)
+	for _, key := range keys {
+		delete(m.data, key)
+	}
+}
+
 // Flush records the call and removes all entries from the cache.
 func (m *MockCache) Flush() {
 	m.mu.Lock()
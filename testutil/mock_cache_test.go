@@ -19,6 +19,14 @@ func TestMockCache(t *testing.T) {
 		t.Errorf("expected 3 items, got %d", len(all))
 	}
 
+	mc.Delete("a")
+	if _, ok := mc.Get("a"); ok {
+		t.Error("expected no value for 'a' after Delete")
+	}
+	if len(mc.DeleteCalls) != 1 {
+		t.Errorf("expected 1 Delete call, got %d", len(mc.DeleteCalls))
+	}
+
 	mc.Flush()
 	all = mc.GetAll()
 	if len(all) != 0 {
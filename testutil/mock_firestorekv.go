@@ -2,42 +2,395 @@ package testutil
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/duizendstra/dui-go/firestore"
 )
 
+// Compile-time check that MockFirestoreKV implements firestore.KV
+var _ firestore.KV = (*MockFirestoreKV)(nil)
+
+// ErrMockClosed is returned by operations on a MockFirestoreKV after Close.
+var ErrMockClosed = errors.New("mock KV is closed")
+
 // MockFirestoreKV is an in-memory mock that simulates the behavior of a FirestoreKV.
 // It stores keys and values in a map and returns empty strings for missing keys,
 // just like a FirestoreKV would if a document doesn't exist.
 //
-// This mock never simulates errors by default, but you can add logic to do so if needed.
+// Every write assigns the key a new version, so the conditional operations
+// (SetIfVersion, CompareAndSwap, Update) behave like their Firestore counterparts.
+// This mock never simulates errors by default; use SimulateConflicts to make
+// conditional writes fail as if another instance had modified the key.
+//
+// Keys written with SetWithTTL expire according to the mock's clock, which defaults to
+// time.Now and can be replaced with SetClock to test expiry without sleeping.
+//
+// After Close, every operation fails with ErrMockClosed, as a closed FirestoreKV
+// fails its calls.
+//
+// Watch and WatchPrefix deliver an event for every write and delete made through the
+// mock, so consumers of change streams can be tested offline. Events are queued per
+// watcher, so writers never block on slow consumers.
 type MockFirestoreKV struct {
-	mu   sync.Mutex
-	data map[string]string
+	mu        sync.Mutex
+	data      map[string]string
+	versions  map[string]firestore.Version
+	expiry    map[string]time.Time
+	lastVer   firestore.Version
+	conflicts int
+	now       func() time.Time
+	watchers  map[*firestore.EventQueue]func(key string) bool
+	closed    bool
 }
 
 // NewMockFirestoreKV creates a new MockFirestoreKV instance with an empty in-memory map.
 func NewMockFirestoreKV() *MockFirestoreKV {
-	return &MockFirestoreKV{data: make(map[string]string)}
+	return &MockFirestoreKV{
+		data:     make(map[string]string),
+		versions: make(map[string]firestore.Version),
+		expiry:   make(map[string]time.Time),
+		now:      time.Now,
+		watchers: make(map[*firestore.EventQueue]func(key string) bool),
+	}
+}
+
+// SetClock replaces the clock used to decide whether keys written with SetWithTTL
+// have expired.
+func (m *MockFirestoreKV) SetClock(now func() time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = now
+}
+
+// SimulateConflicts makes the next n conditional writes fail as if a concurrent
+// writer had changed the key first. SetIfVersion then returns an error wrapping
+// firestore.ErrPreconditionFailed, and Update and CompareAndSwap retry, failing with
+// firestore.ErrConflict once firestore.MaxUpdateAttempts attempts have conflicted.
+func (m *MockFirestoreKV) SimulateConflicts(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.conflicts = n
 }
 
 // Get retrieves the value associated with the given key.
-// If the key does not exist, returns an empty string and no error.
+// If the key does not exist or has expired, returns an empty string and no error.
 func (m *MockFirestoreKV) Get(ctx context.Context, key string) (string, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	val := m.data[key]
+	if m.closed {
+		return "", ErrMockClosed
+	}
+	val, _ := m.lookup(key)
 	return val, nil
 }
 
-// Set stores the given value under the specified key.
+// Lookup retrieves the value associated with the given key and reports whether the key
+// exists and has not expired.
+func (m *MockFirestoreKV) Lookup(ctx context.Context, key string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return "", false, ErrMockClosed
+	}
+	val, ok := m.lookup(key)
+	return val, ok, nil
+}
+
+// Set stores the given value under the specified key, removing any expiry.
 func (m *MockFirestoreKV) Set(ctx context.Context, key, value string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.data[key] = value
+	if m.closed {
+		return ErrMockClosed
+	}
+	m.put(key, value)
+	return nil
+}
+
+// Expiry returns the time a key written with SetWithTTL expires, or the zero time if
+// the key has no expiry, does not exist or has expired.
+func (m *MockFirestoreKV) Expiry(ctx context.Context, key string) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return time.Time{}, ErrMockClosed
+	}
+	if _, ok := m.lookup(key); !ok {
+		return time.Time{}, nil
+	}
+	return m.expiry[key], nil
+}
+
+// Delete removes the given key. Deleting a missing key is not an error.
+func (m *MockFirestoreKV) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrMockClosed
+	}
+	if _, ok := m.lookup(key); ok {
+		m.notify(firestore.Event{Type: firestore.EventDelete, Key: key})
+	}
+	delete(m.data, key)
+	delete(m.versions, key)
+	delete(m.expiry, key)
+	return nil
+}
+
+// Exists reports whether the given key is present and has not expired.
+func (m *MockFirestoreKV) Exists(ctx context.Context, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return false, ErrMockClosed
+	}
+	_, ok := m.lookup(key)
+	return ok, nil
+}
+
+// GetMulti retrieves the values for the given keys. Missing keys are omitted from
+// the returned map.
+func (m *MockFirestoreKV) GetMulti(ctx context.Context, keys []string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrMockClosed
+	}
+	result := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if val, ok := m.lookup(key); ok {
+			result[key] = val
+		}
+	}
+	return result, nil
+}
+
+// SetMulti stores all given key-value pairs.
+func (m *MockFirestoreKV) SetMulti(ctx context.Context, values map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrMockClosed
+	}
+	for key, val := range values {
+		m.put(key, val)
+	}
+	return nil
+}
+
+// List returns one page of keys in ascending order, using the same page token format
+// as firestore.FirestoreKV.
+func (m *MockFirestoreKV) List(ctx context.Context, opts firestore.ListOptions) (firestore.ListPage, error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return firestore.ListPage{}, ErrMockClosed
+	}
+	keys := make([]string, 0, len(m.data))
+	for key := range m.data {
+		if _, ok := m.lookup(key); ok {
+			keys = append(keys, key)
+		}
+	}
+	m.mu.Unlock()
+	return firestore.PaginateKeys(keys, opts)
+}
+
+// Scan iterates over all keys matching the options in ascending order.
+func (m *MockFirestoreKV) Scan(ctx context.Context, opts firestore.ListOptions) iter.Seq2[string, error] {
+	return firestore.ScanPages(ctx, m.List, opts)
+}
+
+// GetVersion retrieves the value and version of the given key. A missing key has an
+// empty value and firestore.NoVersion, as does an expired key.
+func (m *MockFirestoreKV) GetVersion(ctx context.Context, key string) (string, firestore.Version, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return "", firestore.NoVersion, ErrMockClosed
+	}
+	val, version := m.current(key)
+	return val, version, nil
+}
+
+// SetIfVersion stores the value only if the key is still at the given version.
+func (m *MockFirestoreKV) SetIfVersion(ctx context.Context, key, value string, version firestore.Version) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrMockClosed
+	}
+	if _, current := m.current(key); m.takeConflict() || current != version {
+		return fmt.Errorf("mock conditional set (key=%s, version=%d): %w", key, version, firestore.ErrPreconditionFailed)
+	}
+	m.put(key, value)
+	return nil
+}
+
+// CompareAndSwap sets the key to newValue only if its current value equals old.
+func (m *MockFirestoreKV) CompareAndSwap(ctx context.Context, key, old, newValue string) (bool, error) {
+	return firestore.CompareAndSwapWith(ctx, m.Update, key, old, newValue)
+}
+
+// Update replaces the value with the result of fn. Like a Firestore transaction, it
+// retries when the key changed between reading and writing, up to
+// firestore.MaxUpdateAttempts times.
+func (m *MockFirestoreKV) Update(ctx context.Context, key string, fn firestore.UpdateFunc) error {
+	for attempt := 0; attempt < firestore.MaxUpdateAttempts; attempt++ {
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			return ErrMockClosed
+		}
+		old, version := m.current(key)
+		m.mu.Unlock()
+
+		value, err := fn(old)
+		if err != nil {
+			return err
+		}
+
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			return ErrMockClosed
+		}
+		if _, current := m.current(key); !m.takeConflict() && current == version {
+			m.put(key, value)
+			m.mu.Unlock()
+			return nil
+		}
+		m.mu.Unlock()
+	}
+	return fmt.Errorf("mock update (key=%s): %w", key, firestore.ErrConflict)
+}
+
+// SetWithTTL stores the value under the given key. The key expires once the mock's
+// clock reaches the current time plus ttl.
+func (m *MockFirestoreKV) SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("ttl must be positive (key=%s, ttl=%s)", key, ttl)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrMockClosed
+	}
+	m.put(key, value)
+	m.expiry[key] = m.now().Add(ttl)
 	return nil
 }
 
-// Close is a no-op for MockFirestoreKV, present only to match the FirestoreKV interface.
+// Watch delivers an event for every change to the key until ctx is done, then closes
+// the channel. If the key exists, its current value is delivered first.
+func (m *MockFirestoreKV) Watch(ctx context.Context, key string) (<-chan firestore.Event, error) {
+	if key == "" {
+		return nil, fmt.Errorf("watch key cannot be empty")
+	}
+	return m.watch(ctx, func(k string) bool { return k == key })
+}
+
+// WatchPrefix delivers an event for every change to keys starting with prefix until
+// ctx is done. The current values of matching keys are delivered first, in key order.
+func (m *MockFirestoreKV) WatchPrefix(ctx context.Context, prefix string) (<-chan firestore.Event, error) {
+	return m.watch(ctx, func(k string) bool { return strings.HasPrefix(k, prefix) })
+}
+
+// Close ends all watches and makes further operations fail with ErrMockClosed.
+// Closing an already closed mock is not an error.
 func (m *MockFirestoreKV) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	for q := range m.watchers {
+		q.Stop()
+	}
 	return nil
 }
+
+// put stores the value, assigns it a new version and removes any expiry. The caller
+// must hold m.mu.
+func (m *MockFirestoreKV) put(key, value string) {
+	m.lastVer++
+	m.data[key] = value
+	m.versions[key] = m.lastVer
+	delete(m.expiry, key)
+	m.notify(firestore.Event{Type: firestore.EventSet, Key: key, Value: value, Version: m.lastVer})
+}
+
+// lookup returns the value of a key that exists and has not expired. The caller must
+// hold m.mu.
+func (m *MockFirestoreKV) lookup(key string) (string, bool) {
+	if expireAt, ok := m.expiry[key]; ok && !m.now().Before(expireAt) {
+		return "", false
+	}
+	val, ok := m.data[key]
+	return val, ok
+}
+
+// current returns the value and version of a key, treating expired keys as missing.
+// The caller must hold m.mu.
+func (m *MockFirestoreKV) current(key string) (string, firestore.Version) {
+	val, ok := m.lookup(key)
+	if !ok {
+		return "", firestore.NoVersion
+	}
+	return val, m.versions[key]
+}
+
+// takeConflict consumes one simulated conflict, if any. The caller must hold m.mu.
+func (m *MockFirestoreKV) takeConflict() bool {
+	if m.conflicts > 0 {
+		m.conflicts--
+		return true
+	}
+	return false
+}
+
+// watch registers a watcher for the keys accepted by match, queues the current state
+// of those keys and starts delivering events.
+func (m *MockFirestoreKV) watch(ctx context.Context, match func(key string) bool) (<-chan firestore.Event, error) {
+	q := firestore.NewEventQueue()
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, ErrMockClosed
+	}
+	keys := make([]string, 0)
+	for key := range m.data {
+		if _, ok := m.lookup(key); ok && match(key) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		q.Push(firestore.Event{Type: firestore.EventSet, Key: key, Value: m.data[key], Version: m.versions[key], Initial: true})
+	}
+	m.watchers[q] = match
+	m.mu.Unlock()
+
+	go func() {
+		q.Run(ctx)
+		m.mu.Lock()
+		delete(m.watchers, q)
+		m.mu.Unlock()
+	}()
+	return q.Events(), nil
+}
+
+// notify queues the event for all watchers interested in its key. The caller must
+// hold m.mu.
+func (m *MockFirestoreKV) notify(ev firestore.Event) {
+	for q, match := range m.watchers {
+		if match(ev.Key) {
+			q.Push(ev)
+		}
+	}
+}
@@ -2,7 +2,11 @@ package testutil
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
+
+	"github.com/duizendstra/dui-go/firestore"
 )
 
 func TestMockFirestoreKV(t *testing.T) {
@@ -29,3 +33,298 @@ func TestMockFirestoreKV(t *testing.T) {
 		t.Errorf("expected empty for nonExistent, got %q", val)
 	}
 }
+
+func TestMockFirestoreKV_DeleteAndExists(t *testing.T) {
+	mkv := NewMockFirestoreKV()
+	ctx := context.Background()
+
+	if err := mkv.Set(ctx, "k", "v"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	exists, err := mkv.Exists(ctx, "k")
+	if err != nil || !exists {
+		t.Fatalf("expected k to exist, got exists=%v err=%v", exists, err)
+	}
+
+	if err := mkv.Delete(ctx, "k"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	exists, err = mkv.Exists(ctx, "k")
+	if err != nil || exists {
+		t.Fatalf("expected k to be deleted, got exists=%v err=%v", exists, err)
+	}
+
+	if err := mkv.Delete(ctx, "never-set"); err != nil {
+		t.Errorf("Delete of missing key should not fail, got %v", err)
+	}
+}
+
+func TestMockFirestoreKV_Multi(t *testing.T) {
+	mkv := NewMockFirestoreKV()
+	ctx := context.Background()
+
+	if err := mkv.SetMulti(ctx, map[string]string{"a": "1", "b": "2", "empty": ""}); err != nil {
+		t.Fatalf("SetMulti failed: %v", err)
+	}
+
+	got, err := mkv.GetMulti(ctx, []string{"a", "b", "empty", "missing"})
+	if err != nil {
+		t.Fatalf("GetMulti failed: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected 3 entries, got %d: %v", len(got), got)
+	}
+	if got["a"] != "1" || got["b"] != "2" {
+		t.Errorf("unexpected values: %v", got)
+	}
+	if val, ok := got["empty"]; !ok || val != "" {
+		t.Errorf("expected empty value to be present, got %q (present %v)", val, ok)
+	}
+	if _, ok := got["missing"]; ok {
+		t.Error("expected missing key to be omitted")
+	}
+}
+
+func TestMockFirestoreKV_ListAndScan(t *testing.T) {
+	mkv := NewMockFirestoreKV()
+	ctx := context.Background()
+
+	if err := mkv.SetMulti(ctx, map[string]string{"job:2": "b", "job:1": "a", "job:3": "c", "other": "x"}); err != nil {
+		t.Fatalf("SetMulti failed: %v", err)
+	}
+
+	page, err := mkv.List(ctx, firestore.ListOptions{Prefix: "job:", PageSize: 2})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(page.Keys) != 2 || page.Keys[0] != "job:1" || page.Keys[1] != "job:2" {
+		t.Errorf("unexpected first page: %v", page.Keys)
+	}
+	if page.NextPageToken == "" {
+		t.Fatal("expected a next page token")
+	}
+
+	page, err = mkv.List(ctx, firestore.ListOptions{Prefix: "job:", PageSize: 2, PageToken: page.NextPageToken})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(page.Keys) != 1 || page.Keys[0] != "job:3" || page.NextPageToken != "" {
+		t.Errorf("unexpected second page: %+v", page)
+	}
+
+	var scanned []string
+	for key, err := range mkv.Scan(ctx, firestore.ListOptions{PageSize: 1}) {
+		if err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		scanned = append(scanned, key)
+	}
+	if len(scanned) != 4 || scanned[3] != "other" {
+		t.Errorf("unexpected scan result: %v", scanned)
+	}
+}
+
+func TestMockFirestoreKV_Conditional(t *testing.T) {
+	mkv := NewMockFirestoreKV()
+	ctx := context.Background()
+
+	t.Run("SetIfVersion with NoVersion creates a missing key once", func(t *testing.T) {
+		if err := mkv.SetIfVersion(ctx, "k", "v1", firestore.NoVersion); err != nil {
+			t.Fatalf("SetIfVersion failed: %v", err)
+		}
+		err := mkv.SetIfVersion(ctx, "k", "v2", firestore.NoVersion)
+		if !errors.Is(err, firestore.ErrPreconditionFailed) {
+			t.Fatalf("expected ErrPreconditionFailed, got %v", err)
+		}
+	})
+
+	t.Run("SetIfVersion rejects a stale version", func(t *testing.T) {
+		_, version, err := mkv.GetVersion(ctx, "k")
+		if err != nil {
+			t.Fatalf("GetVersion failed: %v", err)
+		}
+		if err := mkv.Set(ctx, "k", "changed"); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+		if err := mkv.SetIfVersion(ctx, "k", "stale", version); !errors.Is(err, firestore.ErrPreconditionFailed) {
+			t.Fatalf("expected ErrPreconditionFailed, got %v", err)
+		}
+
+		value, current, err := mkv.GetVersion(ctx, "k")
+		if err != nil {
+			t.Fatalf("GetVersion failed: %v", err)
+		}
+		if err := mkv.SetIfVersion(ctx, "k", "fresh", current); err != nil {
+			t.Fatalf("SetIfVersion with current version failed: %v (value %q)", err, value)
+		}
+	})
+
+	t.Run("CompareAndSwap only swaps on a match", func(t *testing.T) {
+		swapped, err := mkv.CompareAndSwap(ctx, "k", "wrong", "x")
+		if err != nil || swapped {
+			t.Fatalf("expected no swap, got swapped=%v err=%v", swapped, err)
+		}
+		swapped, err = mkv.CompareAndSwap(ctx, "k", "fresh", "x")
+		if err != nil || !swapped {
+			t.Fatalf("expected swap, got swapped=%v err=%v", swapped, err)
+		}
+	})
+
+	t.Run("Update retries simulated conflicts", func(t *testing.T) {
+		calls := 0
+		mkv.SimulateConflicts(2)
+		err := mkv.Update(ctx, "counter", func(old string) (string, error) {
+			calls++
+			return old + "+", nil
+		})
+		if err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		if calls != 3 {
+			t.Errorf("expected 3 attempts, got %d", calls)
+		}
+		if val, _ := mkv.Get(ctx, "counter"); val != "+" {
+			t.Errorf("expected '+', got %q", val)
+		}
+	})
+
+	t.Run("Update gives up with ErrConflict", func(t *testing.T) {
+		mkv.SimulateConflicts(firestore.MaxUpdateAttempts)
+		err := mkv.Update(ctx, "counter", func(old string) (string, error) { return "never", nil })
+		if !errors.Is(err, firestore.ErrConflict) {
+			t.Fatalf("expected ErrConflict, got %v", err)
+		}
+	})
+
+	t.Run("Update returns the error of fn", func(t *testing.T) {
+		fnErr := errors.New("invalid")
+		err := mkv.Update(ctx, "counter", func(old string) (string, error) { return "", fnErr })
+		if !errors.Is(err, fnErr) {
+			t.Fatalf("expected fn error, got %v", err)
+		}
+	})
+}
+
+func TestMockFirestoreKV_TTL(t *testing.T) {
+	mkv := NewMockFirestoreKV()
+	ctx := context.Background()
+
+	now := time.Unix(10000, 0)
+	mkv.SetClock(func() time.Time { return now })
+
+	if err := mkv.SetWithTTL(ctx, "lock", "owner-1", time.Minute); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	if err := mkv.SetWithTTL(ctx, "bad", "v", 0); err == nil {
+		t.Error("expected an error for a non-positive ttl")
+	}
+
+	if val, _ := mkv.Get(ctx, "lock"); val != "owner-1" {
+		t.Errorf("expected 'owner-1' before expiry, got %q", val)
+	}
+
+	now = now.Add(time.Minute)
+
+	if val, _ := mkv.Get(ctx, "lock"); val != "" {
+		t.Errorf("expected expired key to read as empty, got %q", val)
+	}
+	if exists, _ := mkv.Exists(ctx, "lock"); exists {
+		t.Error("expected expired key not to exist")
+	}
+	if _, found, _ := mkv.Lookup(ctx, "lock"); found {
+		t.Error("expected Lookup not to find the expired key")
+	}
+	if _, version, _ := mkv.GetVersion(ctx, "lock"); version != firestore.NoVersion {
+		t.Errorf("expected NoVersion for expired key, got %d", version)
+	}
+	if page, _ := mkv.List(ctx, firestore.ListOptions{}); len(page.Keys) != 0 {
+		t.Errorf("expected expired key not to be listed, got %v", page.Keys)
+	}
+
+	// An expired key can be claimed again with a NoVersion precondition.
+	if err := mkv.SetIfVersion(ctx, "lock", "owner-2", firestore.NoVersion); err != nil {
+		t.Fatalf("SetIfVersion on expired key failed: %v", err)
+	}
+	now = now.Add(time.Hour)
+	if val, _ := mkv.Get(ctx, "lock"); val != "owner-2" {
+		t.Errorf("expected plain write to remove the expiry, got %q", val)
+	}
+}
+
+// nextEvent reads one event from the channel or fails the test after a timeout.
+func nextEvent(t *testing.T, events <-chan firestore.Event) firestore.Event {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("event channel closed unexpectedly")
+		}
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return firestore.Event{}
+}
+
+func TestMockFirestoreKV_Watch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mkv := NewMockFirestoreKV()
+	_ = mkv.Set(ctx, "config", "v1")
+
+	events, err := mkv.Watch(ctx, "config")
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	if ev := nextEvent(t, events); ev.Type != firestore.EventSet || ev.Value != "v1" {
+		t.Errorf("expected initial set of v1, got %+v", ev)
+	}
+
+	_ = mkv.Set(ctx, "other", "ignored")
+	_ = mkv.Set(ctx, "config", "v2")
+	_ = mkv.Update(ctx, "config", func(old string) (string, error) { return old + "+", nil })
+	_ = mkv.Delete(ctx, "config")
+	_ = mkv.Delete(ctx, "config")
+
+	if ev := nextEvent(t, events); ev.Type != firestore.EventSet || ev.Value != "v2" || ev.Version == firestore.NoVersion {
+		t.Errorf("expected set of v2 with a version, got %+v", ev)
+	}
+	if ev := nextEvent(t, events); ev.Value != "v2+" {
+		t.Errorf("expected set of v2+, got %+v", ev)
+	}
+	if ev := nextEvent(t, events); ev.Type != firestore.EventDelete || ev.Key != "config" {
+		t.Errorf("expected delete of config, got %+v", ev)
+	}
+
+	if _, err := mkv.Watch(ctx, ""); err == nil {
+		t.Error("expected an error for an empty key")
+	}
+
+	cancel()
+	for ev := range events {
+		t.Errorf("expected no further events, got %+v", ev)
+	}
+}
+
+func TestMockFirestoreKV_WatchPrefix(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mkv := NewMockFirestoreKV()
+	_ = mkv.SetMulti(ctx, map[string]string{"app/b": "2", "app/a": "1", "other": "x"})
+
+	events, err := mkv.WatchPrefix(ctx, "app/")
+	if err != nil {
+		t.Fatalf("WatchPrefix failed: %v", err)
+	}
+	for _, key := range []string{"app/a", "app/b"} {
+		if ev := nextEvent(t, events); ev.Key != key {
+			t.Errorf("expected initial event for %s, got %+v", key, ev)
+		}
+	}
+
+	_ = mkv.Set(ctx, "other", "y")
+	_ = mkv.SetWithTTL(ctx, "app/c", "3", time.Minute)
+	if ev := nextEvent(t, events); ev.Key != "app/c" || ev.Value != "3" {
+		t.Errorf("expected set of app/c, got %+v", ev)
+	}
+}